@@ -0,0 +1,82 @@
+// cache.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/BadarSaghir/go_img_collage/pkg/collage"
+)
+
+// runCache implements `collage cache stats|prune|clear`, which inspects and
+// bounds the tile cache (-cache-dir) and the download cache (-download-cache).
+func runCache(args []string) {
+	fs := flag.NewFlagSet("cache", flag.ExitOnError)
+	var dirs stringList
+	fs.Var(&dirs, "cache-dir", "Tile cache directory; may be repeated")
+	fs.Var(&dirs, "download-cache", "Download cache directory; may be repeated")
+	maxSize := fs.String("max-size", "", "For prune: the size each cache is reduced to, removing the oldest entries first, e.g. 5GB")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s cache stats|prune|clear -cache-dir DIR [-download-cache DIR] [flags]\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+
+	var action string
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if len(dirs) == 0 || (action != "stats" && action != "prune" && action != "clear") {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var limit int64
+	switch {
+	case action == "prune" && *maxSize == "":
+		log.Fatalf("Error: prune needs -max-size")
+	case action == "prune":
+		var err error
+		if limit, err = collage.ParseByteSize(*maxSize); err != nil {
+			log.Fatalf("Error: -max-size: %v", err)
+		}
+	}
+
+	for _, dir := range dirs {
+		if action == "stats" {
+			n, bytes, oldest, err := collage.CacheStats(dir)
+			if err != nil {
+				log.Fatalf("Error: %v", err)
+			}
+			fmt.Printf("%s: %d entries, %s", dir, n, formatBytes(bytes))
+			if n > 0 {
+				fmt.Printf(", oldest written %v ago", time.Since(oldest).Round(time.Minute))
+			}
+			fmt.Println()
+			continue
+		}
+		removed, freed, err := collage.PruneCache(dir, limit) // clear prunes to 0
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("%s: removed %d entries, freed %s\n", dir, removed, formatBytes(freed))
+	}
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 GB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,97 @@
+// config.go
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// loadConfig reads a config file of flag values, in YAML (.yaml, .yml), TOML
+// (.toml) or JSON (.json) depending on its extension. Keys are flag names,
+// with - and _ interchangeable; repeatable flags such as input_dir take a list.
+func loadConfig(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	values := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &values)
+	case ".toml":
+		err = toml.Unmarshal(data, &values)
+	case ".json":
+		err = json.Unmarshal(data, &values)
+	default:
+		return nil, fmt.Errorf("unsupported config file %s: use .yaml, .toml or .json", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// applyConfig sets every flag named in the config file at path that was not
+// given on the command line, so command-line flags override the file.
+func applyConfig(path string) error {
+	values, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	given := givenFlags()
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // report errors in a stable order
+	for _, key := range keys {
+		f := lookupFlag(key)
+		if f == nil || f.Name == "config" {
+			return fmt.Errorf("%s: unknown option %q", path, key)
+		}
+		if given[f.Name] {
+			continue
+		}
+		items, ok := values[key].([]any)
+		if !ok {
+			items = []any{values[key]}
+		}
+		for _, item := range items {
+			switch item.(type) {
+			case map[string]any, []any, nil:
+				return fmt.Errorf("%s: option %q needs a value or a list of values", path, key)
+			}
+			if err := flag.Set(f.Name, fmt.Sprint(item)); err != nil { // recorded for givenFlags
+				return fmt.Errorf("%s: invalid value %v for %q: %v", path, item, key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// givenFlags returns the names of the flags set on the command line or by the config file.
+func givenFlags() map[string]bool {
+	given := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { given[f.Name] = true })
+	return given
+}
+
+// lookupFlag finds the flag called name, trying - for _ and _ for - since the
+// flags use both.
+func lookupFlag(name string) *flag.Flag {
+	for _, n := range []string{name, strings.ReplaceAll(name, "_", "-"), strings.ReplaceAll(name, "-", "_")} {
+		if f := flag.Lookup(n); f != nil {
+			return f
+		}
+	}
+	return nil
+}
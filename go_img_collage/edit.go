@@ -0,0 +1,217 @@
+// edit.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BadarSaghir/go_img_collage/pkg/collage"
+)
+
+// project records the options and the ordered image plan of a collage run, so
+// small layout corrections can be made later without rescanning the input tree.
+type project struct {
+	Dir        string   `json:"dir"`         // working directory of the run, which relative paths are relative to
+	OutputFile string   `json:"output_file"` // collage written by the run
+	Args       []string `json:"args"`        // flags of the run (see projectArgs)
+	Images     []string `json:"images"`      // the images drawn, in cell order, as given (URLs and archive entries rather than their downloads)
+}
+
+// unprojectedFlags are the flags a project does not record: those finding,
+// filtering, ordering and sampling the images, whose outcome is recorded in
+// its image list instead, the output file and those that keep the command
+// running or save the project.
+var unprojectedFlags = map[string]bool{
+	"input_dir": true, "file-list": true, "include": true, "exclude": true,
+	"since": true, "after": true, "before": true, "since-by": true,
+	"skip-blurry": true, "skip-uniform": true, "min-width": true, "min-height": true, "min-bytes": true,
+	"sort": true, "reverse": true, "shuffle": true, "max-images": true, "max-per-folder": true, "sample": true,
+	"output_file": true, "watch": true, "watch-delay": true, "serve": true, "project": true, "config": true,
+}
+
+// projectArgs returns the flags of this run to record in a project, given on
+// the command line or read from -config, with one argument per value of
+// repeated flags.
+func projectArgs() []string {
+	var args []string
+	flag.Visit(func(f *flag.Flag) {
+		if unprojectedFlags[f.Name] {
+			return
+		}
+		if list, ok := f.Value.(*stringList); ok {
+			for _, v := range *list {
+				args = append(args, "-"+f.Name+"="+v)
+			}
+			return
+		}
+		args = append(args, "-"+f.Name+"="+f.Value.String())
+	})
+	return args
+}
+
+// loadProject reads a project file written by saveProject.
+func loadProject(path string) (*project, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p project
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse project file %s: %v", path, err)
+	}
+	return &p, nil
+}
+
+// saveProject writes the project as indented JSON to path.
+func saveProject(path string, p *project) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeated flag.
+type stringList []string
+
+func (s *stringList) String() string { return strings.Join(*s, ",") }
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// swapCells exchanges the images at the two 0-based cell indices given as "a,b".
+func swapCells(images []string, spec string) error {
+	parts := strings.Split(spec, ",")
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid swap %q: expected two cell indices like 12,37", spec)
+	}
+	a, errA := strconv.Atoi(strings.TrimSpace(parts[0]))
+	b, errB := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if errA != nil || errB != nil {
+		return fmt.Errorf("invalid swap %q: cell indices must be integers", spec)
+	}
+	if a < 0 || a >= len(images) || b < 0 || b >= len(images) {
+		return fmt.Errorf("invalid swap %q: cells must be between 0 and %d", spec, len(images)-1)
+	}
+	images[a], images[b] = images[b], images[a]
+	return nil
+}
+
+// excludeImage removes path from images, returning an error if it is not part
+// of the plan. Relative images are relative to the project directory dir; a
+// relative path may be given as in the project or relative to the current
+// directory. URLs must match exactly.
+func excludeImage(images []string, dir, path string) ([]string, error) {
+	targets := []string{path}
+	if !collage.IsURL(path) {
+		targets = []string{resolvePath(dir, path)}
+		if abs, err := filepath.Abs(path); err == nil {
+			targets = append(targets, abs)
+		}
+	}
+	for i, img := range images {
+		if !collage.IsURL(img) {
+			img = resolvePath(dir, img)
+		}
+		if slices.Contains(targets, img) {
+			return append(images[:i], images[i+1:]...), nil
+		}
+	}
+	return images, fmt.Errorf("image %s is not part of the project", path)
+}
+
+// resolvePath returns path made absolute against dir unless it already is.
+func resolvePath(dir, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(dir, path)
+}
+
+// runEdit implements `collage edit project.collage [--swap a,b] [--exclude path]`.
+// Swaps are applied first (their indices refer to the current layout), then exclusions,
+// after which the project is saved and the collage re-rendered from the edited plan
+// by running the command again with the recorded flags, in the recorded directory.
+func runEdit(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("edit", flag.ExitOnError)
+	var swaps, excludes stringList
+	fs.Var(&swaps, "swap", "Swap two cells given as 'a,b' (0-based cell indices); may be repeated")
+	fs.Var(&excludes, "exclude", "Remove an image from the collage, given as in the project, by URL or by its path from here; may be repeated")
+	outputFile := fs.String("output_file", "", "Write the re-rendered collage here instead of the project's output file")
+	noRender := fs.Bool("no-render", false, "Only update the project file, do not re-render the collage")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s edit project.collage [flags]\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+
+	// Allow the project path before the flags, as in `collage edit p.collage --swap 1,2`.
+	var projectPath string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		projectPath, args = args[0], args[1:]
+	}
+	fs.Parse(args)
+	if projectPath == "" && fs.NArg() > 0 {
+		projectPath = fs.Arg(0)
+	}
+	if projectPath == "" {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	p, err := loadProject(projectPath)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	for _, spec := range swaps {
+		if err := swapCells(p.Images, spec); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	for _, path := range excludes {
+		if p.Images, err = excludeImage(p.Images, p.Dir, path); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+	if *outputFile != "" {
+		if p.OutputFile, err = filepath.Abs(*outputFile); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+	}
+
+	if err := saveProject(projectPath, p); err != nil {
+		log.Fatalf("Error saving project: %v", err)
+	}
+	fmt.Printf("Project saved to '%s' (%d images)\n", projectPath, len(p.Images))
+
+	if *noRender {
+		return
+	}
+	list, err := os.CreateTemp("", "collage-edit-*.txt")
+	if err != nil {
+		log.Fatalf("Error: failed to write the image list: %v", err)
+	}
+	defer os.Remove(list.Name())
+	_, err = fmt.Fprintln(list, strings.Join(p.Images, "\n"))
+	if cerr := list.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		log.Fatalf("Error: failed to write the image list: %v", err)
+	}
+	b := &builder{ctx: ctx, dir: p.Dir, args: append(p.Args, "-file-list="+list.Name(), "-output_file="+p.OutputFile)}
+	if status := b.build(); status != 0 {
+		os.Remove(list.Name())
+		os.Exit(status)
+	}
+}
@@ -0,0 +1,109 @@
+// edit_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestProjectRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trip.collage")
+	want := &project{
+		Dir:        "/photos",
+		OutputFile: "/photos/collage.jpg",
+		Args:       []string{"-cell_size=200", "-caption=filename"},
+		Images:     []string{"2024/a.jpg", "https://cdn.test/b.jpg", "export.zip/Trip/c.png"},
+	}
+	if err := saveProject(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadProject(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("loadProject() = %+v, want %+v", got, want)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadProject(path); err == nil {
+		t.Error("loadProject() of a damaged file succeeded, want an error")
+	}
+	if _, err := loadProject(filepath.Join(t.TempDir(), "missing.collage")); err == nil {
+		t.Error("loadProject() of a missing file succeeded, want an error")
+	}
+}
+
+func TestSwapCells(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []string
+		wantErr bool
+	}{
+		{"0,2", []string{"c", "b", "a"}, false},
+		{" 1 , 1 ", []string{"a", "b", "c"}, false},
+		{"0", nil, true},
+		{"0,x", nil, true},
+		{"0,3", nil, true},
+		{"-1,0", nil, true},
+	}
+	for _, tt := range tests {
+		images := []string{"a", "b", "c"}
+		err := swapCells(images, tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("swapCells(%q) error = %v, want error %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if err == nil && !slices.Equal(images, tt.want) {
+			t.Errorf("swapCells(%q) = %v, want %v", tt.spec, images, tt.want)
+		}
+	}
+}
+
+func TestExcludeImage(t *testing.T) {
+	dir := t.TempDir()
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromCwd, err := filepath.Rel(cwd, filepath.Join(dir, "2024", "b.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	images := []string{"2024/a.jpg", "2024/b.jpg", "/elsewhere/c.jpg", "https://cdn.test/d.jpg"}
+	tests := []struct {
+		name, path string
+		want       []string // nil if path is not in the project
+	}{
+		{"as in the project", "2024/a.jpg", []string{"2024/b.jpg", "/elsewhere/c.jpg", "https://cdn.test/d.jpg"}},
+		{"uncleaned", "./2024//a.jpg", []string{"2024/b.jpg", "/elsewhere/c.jpg", "https://cdn.test/d.jpg"}},
+		{"absolute", filepath.Join(dir, "2024", "b.jpg"), []string{"2024/a.jpg", "/elsewhere/c.jpg", "https://cdn.test/d.jpg"}},
+		{"relative to the current directory", fromCwd, []string{"2024/a.jpg", "/elsewhere/c.jpg", "https://cdn.test/d.jpg"}},
+		{"absolute outside the project directory", "/elsewhere/c.jpg", []string{"2024/a.jpg", "2024/b.jpg", "https://cdn.test/d.jpg"}},
+		{"URL", "https://cdn.test/d.jpg", []string{"2024/a.jpg", "2024/b.jpg", "/elsewhere/c.jpg"}},
+		{"URL cleaned as a path", "https:/cdn.test/d.jpg", nil},
+		{"not in the project", "2024/e.jpg", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := excludeImage(slices.Clone(images), dir, tt.path)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("excludeImage(%q) = %v, want an error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("excludeImage(%q) error = %v", tt.path, err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("excludeImage(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,10 +2,19 @@ module github.com/BadarSaghir/go_img_collage
 
 go 1.23.6
 
-require github.com/edsrzf/mmap-go v1.2.0
+require (
+	github.com/chai2010/webp v1.1.1
+	github.com/davidbyttow/govips/v2 v2.16.0
+	github.com/edsrzf/mmap-go v1.2.0
+	github.com/fsnotify/fsnotify v1.10.1
+	golang.org/x/image v0.24.0
+)
 
 require (
-	github.com/chai2010/webp v1.1.1 // indirect
-	golang.org/x/image v0.24.0 // indirect
-	golang.org/x/sys v0.0.0-20211216021012-1d35b9e2eb4e // indirect
+	github.com/BurntSushi/toml v1.6.0
+	github.com/go-text/typesetting v0.3.4
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0
+	golang.org/x/text v0.22.0
+	gopkg.in/yaml.v3 v3.0.1
 )
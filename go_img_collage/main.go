@@ -2,243 +2,762 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"image"
-	"image/color"
-	"image/draw"
-	"image/jpeg"
-	_ "image/png" // in case you add png support later
 	"log"
-	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
-	"github.com/chai2010/webp"
-	mmap "github.com/edsrzf/mmap-go"
-	xdraw "golang.org/x/image/draw"
+	"github.com/BadarSaghir/go_img_collage/pkg/collage"
 )
 
-// loadImage opens the image file at path and decodes it.
-// It supports .webp and .jpg (case‑insensitive).
-func loadImage(path string) (image.Image, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+// Exit statuses besides 0 (success) and 1 (any other error), so scripts can
+// tell how a run ended.
+const (
+	exitUnchanged   = 3 // -state-file shows the inputs have not changed since the last run, so nothing was rendered
+	exitNoImages    = 4 // no images were found, or none were left after filtering
+	exitImageErrors = 5 // images could not be read, downloaded or decoded; without -strict the collage was written without them
+	exitEncode      = 6 // the output could not be encoded or written
+)
+
+// errUsage is returned by parseFlags when the required flags are missing.
+var errUsage = errors.New("missing required flags")
+
+// exitCode ends a run with its exit status, without a message of its own: the
+// status of -watch or -serve, or one the run has already explained.
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(c))
+}
+
+func main() {
+	ctx := handleSignals()
+
+	// Dispatch subcommands before parsing the collage flags.
+	if len(os.Args) > 1 && os.Args[1] == "edit" {
+		runEdit(ctx, os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "cache" {
+		runCache(os.Args[2:])
+		return
+	}
+	// `prewarm` takes the collage flags, so it caches exactly the tiles the
+	// same command without it would draw.
+	prewarm := len(os.Args) > 1 && os.Args[1] == "prewarm"
+	if prewarm {
+		os.Args = append(os.Args[:1], os.Args[2:]...)
 	}
-	defer f.Close()
 
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".webp":
-		// Use the webp package to decode.
-		return webp.Decode(f)
-	case ".jpg", ".jpeg":
-		return jpeg.Decode(f)
-	default:
-		return nil, fmt.Errorf("unsupported file extension: %s", ext)
+	cfg, err := parseFlags(ctx, prewarm)
+	if err == nil {
+		err = run(ctx, cfg)
+	}
+	var code exitCode
+	switch {
+	case err == nil:
+		return
+	case errors.Is(err, errUsage):
+		flag.Usage()
+	case !errors.As(err, &code):
+		log.Printf("Error: %v", err)
 	}
+	os.Exit(exitStatus(err))
 }
 
-// getSortedImagePaths returns a slice of image file paths gathered from the sorted subfolders of rootDir.
-// It also returns a slice of subfolder paths (in sorted order) for later per‑folder counting.
-func getSortedImagePaths(rootDir string) ([]string, []string, error) {
-	entries, err := os.ReadDir(rootDir)
-	if err != nil {
-		return nil, nil, err
-	}
+// config is the parsed command line: the collage options and the flags that
+// decide what to do with them.
+type config struct {
+	opts    collage.Options
+	prewarm bool // only fill the tile cache
+	start   time.Time
+
+	video, subtitles string
+	frames           int
+	fileList         string
+	perFolder        bool
+	prefetch         int
+
+	watch      bool
+	serve      string
+	watchDelay time.Duration
+
+	ocr     bool
+	ocrLang string
 
-	var subfolders []string
-	for _, e := range entries {
-		if e.IsDir() {
-			subfolders = append(subfolders, filepath.Join(rootDir, e.Name()))
+	skipReport   string
+	openResult   bool
+	openWith     string
+	setWallpaper bool
+	notify       bool
+	projectFile  string
+}
+
+// parseFlags parses the command line, and the -config file it names, into a
+// config. It returns errUsage if required flags are missing.
+func parseFlags(ctx context.Context, prewarm bool) (*config, error) {
+	cfg := &config{opts: collage.DefaultOptions(), prewarm: prewarm}
+	opts := &cfg.opts
+	opts.Context = ctx
+	opts.Log = log.New(os.Stdout, "", 0)
+	var inputDirs stringList
+	flag.Var(&inputDirs, "input_dir", "Path to the root directory containing subfolders with images, or a bucket such as s3://bucket/prefix or gs://bucket/prefix; may be repeated to merge several roots, including identical photos once")
+	flag.StringVar(&cfg.video, "video", "", "Make a contact sheet of this video instead of scanning -input_dir: -frames frames at even intervals, extracted with ffmpeg and captioned with their time unless -caption says otherwise")
+	flag.StringVar(&cfg.subtitles, "subtitles", "", "SubRip (.srt) subtitles of the -video: each time caption is followed by the line spoken at or nearest to its frame")
+	flag.IntVar(&cfg.frames, "frames", collage.DefaultFrames, "Number of frames of a -video contact sheet")
+	flag.BoolVar(&cfg.watch, "watch", false, "Keep running and rebuild the collage whenever images are added, removed or changed under the input directories (with -cache-dir only the changed images are redone)")
+	flag.StringVar(&cfg.serve, "serve", "", "Serve the collage on this address (e.g. :8080) to a browser page that reloads it after every build, with /preview?width=N for a small JPEG and POST /rebuild to build it again; add -watch to rebuild on changes")
+	flag.DurationVar(&cfg.watchDelay, "watch-delay", 2*time.Second, "With -watch, wait until the input directories have been quiet this long before rebuilding")
+	flag.StringVar(&cfg.fileList, "file-list", "", "Collage exactly the images listed in this file, one path per line in cell order, instead of scanning -input_dir; - reads standard input (e.g. find ... | collage -file-list -)")
+	flag.IntVar(&opts.MaxDownloads, "max-downloads", opts.MaxDownloads, "Downloads from http(s) URLs of -file-list and from s3:// or gs:// buckets run at once, bucket listings included")
+	flag.IntVar(&opts.MaxDownloads, "max-concurrent-downloads", opts.MaxDownloads, "Same as -max-downloads")
+	maxBandwidth := flag.String("max-bandwidth", "", "Limit all downloads together to this many bytes per second, e.g. 2M (default unlimited)")
+	flag.DurationVar(&opts.DownloadTimeout, "download-timeout", opts.DownloadTimeout, "Give up on a download request after this long (0 disables); transient failures are retried")
+	flag.StringVar(&opts.DownloadCache, "download-cache", "", "Keep downloads in this directory and only fetch them again when they change on the server")
+	downloadCacheSize := flag.String("download-cache-size", "", "Evict the least recently used downloads beyond this size, e.g. 5G (default unlimited)")
+	flag.StringVar(&opts.OutputPath, "output_file", "", "Output collage file; the format follows the extension: .webp (lossless), .png, .jpg, .avif (needs libavif's avifenc), or CMYK .tif/.pdf")
+	flag.StringVar(&opts.ManifestPath, "manifest", "", "Also write a JSON manifest of every image's cell index, pixel rectangle (x, y, w, h) and source path, e.g. collage.json for a clickable web viewer")
+	flag.StringVar(&opts.OccupancyPath, "occupancy", "", "Also write which grid cells hold an image, a title or nothing: a PNG with one pixel per cell, or JSON for a .json name")
+	flag.StringVar(&opts.HTMLPath, "html", "", "Also write an HTML page (e.g. collage.html) whose image map links every cell to its original file, with alt text from EXIF descriptions, captions or file names")
+	flag.StringVar(&opts.SiteDir, "site", "", "Instead of a single collage, write a static gallery site to this directory: an index collage, a page per folder and a page per image")
+	flag.StringVar(&opts.SiteTemplates, "site-templates", "", "Directory of index.html, folder.html and/or image.html Go templates replacing the -site defaults")
+	htmlThumbs := flag.String("html-thumbs", "", "Show lazily loaded thumbnails of these sizes in pixels (e.g. 160,320,640, picked by screen density with srcset) in the -html page's image list, so sheets of thousands of images stay usable")
+	flag.BoolVar(&opts.HTMLDark, "html-dark", false, "Give the -html page a dark stylesheet used when the reader's system prefers dark mode")
+	flag.StringVar(&opts.LinkTemplate, "link-template", "", "Link cells of the -html page to this URL instead of the file, with {path}, {name} and {index} replaced, e.g. https://photos.example.com/{name}")
+	flag.BoolVar(&opts.WebPLossless, "webp_lossless", opts.WebPLossless, "Encode .webp output losslessly; use -webp_lossless=false with -quality for much smaller files")
+	flag.IntVar(&opts.Quality, "quality", opts.Quality, "Quality (1-100) of lossy WebP, JPEG and AVIF output")
+	targetFileSize := flag.String("target-filesize", "", "Lower the quality of .jpg, .webp (made lossy) or .avif output until the file fits this size, e.g. 25MB; -quality is the highest tried")
+	cellSize := flag.String("cell_size", fmt.Sprint(opts.CellSize), "Size of each cell in pixels, or in mm, cm, in or pt at -dpi (e.g. 2cm)")
+	flag.StringVar(cellSize, "cell-size", *cellSize, "Same as -cell_size")
+	width := flag.String("width", "", "Collage width in pixels, or in mm, cm, in or pt at -dpi (e.g. 24in); sets the cell size to fit -cols, gutters and margins")
+	flag.IntVar(&opts.Cols, "cols", 0, "Number of grid columns (default: nearly square grid)")
+	flag.IntVar(&opts.Rows, "rows", 0, "Number of grid rows (default: as many as the images need)")
+	gutter := flag.String("gutter", "0", "Space between neighbouring cells in pixels, or in mm, cm, in or pt at -dpi")
+	margin := flag.String("margin", "0", "Space around the grid in pixels, or in mm, cm, in or pt at -dpi")
+	flag.StringVar(&opts.Background, "background", opts.Background, "Background colour: transparent or a CSS colour (name, #rgb, #rrggbbaa, rgb(r g b / a))")
+	flag.Float64Var(&opts.JitterRotation, "jitter-rotation", 0, "Tilt each image by a random angle of up to this many degrees (e.g. 3) for a hand-placed look")
+	inset := flag.String("inset", "0", "Shrink each image this far inside its cell on every side, so images never touch, in pixels or in mm, cm, in or pt at -dpi")
+	insetJitter := flag.String("inset-jitter", "0", "Add a random extra inset of up to this much per cell, in pixels or in mm, cm, in or pt at -dpi")
+	flag.Int64Var(&opts.Seed, "seed", opts.Seed, "Seed for the random jitter and -shuffle; the same seed gives the same collage")
+	flag.StringVar(&opts.ExactGrid, "exact-grid", "", "Require the images left after filtering to fill a grid of RxC rows by columns exactly (e.g. 3x3 product sheets), failing otherwise")
+	flag.StringVar(&opts.Layout, "layout", opts.Layout, "Cell arrangement: grid (square cells), buckets (landscape, square and portrait images in stacked grids of matching cells, avoiding letterboxing) sections (each folder on new rows below a banner with its name) justified (rows of a common height keeping each image's aspect ratio, like Flickr) or treemap (tile areas proportional to -weight)")
+	flag.StringVar(&opts.Weight, "weight", opts.Weight, "Tile weight of -layout treemap: size (file size) or resolution (pixel count)")
+	flag.StringVar(&opts.WeightsFile, "weights", "", "File of \"weight path\" lines (path or file name) giving the -layout treemap weights explicitly")
+	flag.StringVar(&opts.Spans, "spans", "", "Give images blocks of several cells: aspect (landscape 2x1, portrait 1x2) or resolution (2x2 for images of at least twice the median pixel count)")
+	flag.StringVar(&opts.Pack, "pack", opts.Pack, "Placement of -spans blocks: order (image order, first free spot) or largest (largest blocks first, small ones backfill the holes)")
+	flag.IntVar(&opts.PackEffort, "pack-effort", opts.PackEffort, "Grid widths tried when packing -spans blocks, keeping the one with the fewest empty cells; higher is tighter but slower")
+	flag.StringVar(&opts.Sort, "sort", opts.Sort, "Image order: name (folder by folder), brightness (brightest first, day to night), temperature (coolest to warmest light), color (a rainbow by dominant hue, then greys light to dark), exif-date (by capture time across all folders, else file time), mtime (oldest file first), size (smallest file first) or round-robin (one image of each folder in turn, so every album shows near the top)")
+	flag.BoolVar(&opts.Reverse, "reverse", false, "Reverse the -sort order")
+	var compare stringList
+	flag.Var(&compare, "compare", "Instead of the collage, write a sheet previewing the images under this layout configuration, a comma-separated list of settings such as layout=justified,gutter=4mm (layout, fit, sort, spans, pack, weight, cols, rows, cell-size, gutter, margin, inset, exact-grid, jitter-rotation, seed, shuffle, background), beside the others given; repeat for each configuration")
+	flag.IntVar(&opts.PerPage, "per-page", 0, "Split the images into collages of at most this many, written as name_p1.ext, name_p2.ext, ... in order (e.g. carousel slides)")
+	flag.IntVar(&opts.Carousel, "carousel", 0, "Render one panorama this many slides wide, written to the output, and cut it into square slides name_s1.ext, name_s2.ext, ... whose pictures continue across the cuts, for a swipeable multi-image post")
+	flag.IntVar(&opts.SlideSize, "slide-size", collage.DefaultSlideSize, "Side in pixels of a -carousel slide")
+	flag.IntVar(&opts.Variants, "variants", 0, "Render this many variations (shuffled, with the jitter of successive seeds) as name_v1.ext, name_v2.ext, ..., decoding each image once, to pick the nicest")
+	flag.BoolVar(&opts.Shuffle, "shuffle", false, "Arrange the images in a random order that -seed makes reproducible (e.g. -seed $(date +%j) for a new wallpaper each day)")
+	flag.StringVar(&opts.Fit, "fit", opts.Fit, "How images fill their cells: contain (letterbox), cover (centre-crop to fill) or stretch")
+	flag.StringVar(&opts.Backend, "backend", opts.Backend, "Image backend: go (built in) or vips (libvips decodes and scales JPEG and WebP much faster in less memory; needs a binary built with -tags vips)")
+	flag.StringVar(&opts.Filter, "filter", opts.Filter, "Resampling filter: auto (box for over 4x downscales, else catmullrom), nearest, bilinear, catmullrom or box (area average)")
+	flag.StringVar(&opts.TilePrint, "tile-print", "", "Split the collage into AxB overlapping printable pages with crop marks (e.g. 3x2)")
+	flag.StringVar(&opts.PageSize, "page-size", opts.PageSize, "Page size for -tile-print: a3, a4, a5, letter, legal, tabloid or WxH in mm")
+	flag.IntVar(&opts.DPI, "dpi", opts.DPI, "Print resolution in dots per inch")
+	flag.Float64Var(&opts.TileOverlap, "tile-overlap", opts.TileOverlap, "Overlap between neighbouring printed pages in mm")
+	flag.Float64Var(&opts.Bleed, "bleed", 0, "Extend the background this many mm beyond the trim edge for print")
+	flag.BoolVar(&opts.CropMarks, "crop-marks", false, "Draw crop and registration marks around the trim area for print")
+	flag.StringVar(&opts.ICCProfile, "icc-profile", "", "CMYK output ICC profile to separate .tif/.pdf output with (embedded in it)")
+	flag.StringVar(&opts.ProofPath, "proof", "", "Write a soft-proof preview PNG simulating the print condition of -icc-profile, else -proof-condition")
+	flag.StringVar(&opts.ProofCondition, "proof-condition", opts.ProofCondition, "Printer profile simulated by -proof without -icc-profile: coated, uncoated or newsprint")
+	flag.IntVar(&opts.ProofWidth, "proof-width", opts.ProofWidth, "Maximum width of the soft-proof preview in pixels")
+	flag.BoolVar(&opts.GamutWarning, "gamut-warning", opts.GamutWarning, "Highlight out-of-gamut areas in the soft-proof")
+	flag.Float64Var(&opts.GamutThreshold, "gamut-threshold", opts.GamutThreshold, "Chroma loss (CIELAB units) above which a proof pixel is flagged out of gamut")
+	flag.StringVar(&opts.MattePath, "matte", "", "Also write the alpha channel of the output as a grayscale PNG matte (black = uncovered), for compositing colour (e.g. a .jpg output) and matte separately; works with -stream")
+	flag.StringVar(&opts.MatteArea, "matte-area", opts.MatteArea, "Area of the -matte: canvas (the whole output, bleed included) or trim (the collage inside the bleed)")
+	flag.StringVar(&opts.CoverageReport, "coverage-report", "", "Write a JSON report of the transparent regions left uncovered")
+	flag.IntVar(&opts.EncodeWorkers, "encode-workers", opts.EncodeWorkers, "Parallel workers for striped encoders (CMYK TIFF)")
+	flag.BoolVar(&opts.Streaming, "stream", false, "Render one row of cells at a time and stream it to a .png or CMYK .tif encoder, so memory use is one row instead of the whole canvas")
+	flag.BoolVar(&opts.Update, "update", false, "Redraw only the cells whose images changed or were added since the last -update run, using the cell manifest kept beside the output")
+	flag.BoolVar(&opts.SkipSpaceCheck, "skip-space-check", false, "Do not check for free temp and output disk space before rendering")
+	flag.StringVar(&opts.CacheDir, "cache-dir", "", "Cache resized tiles here, keyed by path, mtime, size and cell size, so re-runs only process new or changed images")
+	flag.IntVar(&opts.Retry.Attempts, "retries", opts.Retry.Attempts, "Retry transient read errors (network filesystems) this many times before skipping an image")
+	flag.DurationVar(&opts.Retry.Backoff, "retry-backoff", opts.Retry.Backoff, "Delay before the first retry, doubled for each further retry")
+	flag.DurationVar(&opts.ImageTimeout, "image-timeout", opts.ImageTimeout, "Skip an image whose decode and resize takes longer than this (0 disables)")
+	flag.BoolVar(&opts.ScoreBorders, "score-borders", false, "Frame each cell green, yellow or red by a quick sharpness and exposure score, as a culling aid")
+	var include, exclude stringList
+	flag.Var(&include, "include", "Only collage files matching this glob (matched against the file name, or the path below -input_dir if it has a /) or \"re:<regexp>\"; may be repeated")
+	flag.Var(&exclude, "exclude", "Leave out files matching this glob or \"re:<regexp>\", e.g. \"*_thumb*\"; may be repeated and wins over -include")
+	since := flag.String("since", "", "Only include images newer than a duration (7d, 2w, 36h) or date (2024-06-01), e.g. for weekly \"what's new\" collages")
+	after := flag.String("after", "", "Only include images dated on or after this date (e.g. 2024-01-01) or duration ago; same as -since")
+	before := flag.String("before", "", "Only include images dated before this date (e.g. 2025-01-01) or duration ago, e.g. with -after for \"2024 in review\" collages")
+	flag.StringVar(&opts.SinceBy, "since-by", opts.SinceBy, "Image date compared by -since, -after and -before: mtime (file modification time) or exif (capture time, else mtime)")
+	flag.Float64Var(&opts.SkipBlurry, "skip-blurry", 0, "Drop out-of-focus images whose Laplacian variance is below this threshold (e.g. 100); 0 disables")
+	flag.IntVar(&opts.MaxImages, "max-images", 0, "Keep at most this many images, chosen by -sample, to summarise a huge archive; 0 keeps all")
+	flag.IntVar(&opts.MaxPerFolder, "max-per-folder", 0, "Keep at most this many images of each folder, chosen by -sample; 0 keeps all")
+	flag.StringVar(&opts.Sample, "sample", opts.Sample, "Images kept by -max-images and -max-per-folder: first, last, evenly (spread over the -sort order) or random (reproducible with -seed)")
+	flag.IntVar(&opts.MinWidth, "min-width", 0, "Drop images narrower than this many pixels, such as thumbnails; 0 disables")
+	flag.IntVar(&opts.MinHeight, "min-height", 0, "Drop images lower than this many pixels; 0 disables")
+	minBytes := flag.String("min-bytes", "", "Drop image files smaller than this (e.g. 20K), such as stubs left by failed copies")
+	flag.Float64Var(&opts.SkipUniform, "skip-uniform", 0, "Drop almost single-colour images (pocket shots, black frames) where at least this fraction of pixels share one colour (e.g. 0.97); 0 disables")
+	flag.IntVar(&opts.Frame, "frame", 0, "Frame (0-based) to draw from animated GIF and WebP images; past the last frame gives the last")
+	flag.BoolVar(&opts.NoEXIFRotate, "no-exif-rotate", false, "Do not turn photos upright according to their EXIF orientation")
+	flag.IntVar(&opts.MaxErrorsShown, "max-errors-shown", opts.MaxErrorsShown, "Log at most this many per-image errors individually; all are summarised at the end")
+	var reserve, titleCells stringList
+	flag.Var(&reserve, "reserve", "Keep a WxH block of cells empty, e.g. 2x2:center or 1x1:r0c3 (center, top, bottom, left, right, top-left, ..., rNcM); may be repeated")
+	flag.Var(&titleCells, "title-cell", "Render a text block in a reserved WxH block of cells, e.g. \"Summer 2024:2x2:center\"; may be repeated")
+	flag.StringVar(&opts.Font, "font", "", "TrueType/OpenType font (.ttf, .otf, .ttc) for all text; missing characters fall back to installed CJK, emoji and symbol fonts")
+	flag.Float64Var(&opts.FontSize, "font-size", 0, "Text size in pixels (0 sizes each text feature automatically)")
+	flag.StringVar(&opts.Caption, "caption", "", "Caption each image with its filename, index (the cell index used by `edit --swap`), time (of a -video frame) or text (read by -ocr)")
+	flag.BoolVar(&cfg.ocr, "ocr", false, "Read the text in the images with tesseract, if installed, for -caption text and a search box on the -html page (e.g. for folders of screenshots)")
+	flag.StringVar(&cfg.ocrLang, "ocr-lang", collage.DefaultOCRLanguage, "Tesseract language(s) of -ocr, e.g. eng+deu")
+	flag.StringVar(&opts.CaptionStyle, "caption-style", opts.CaptionStyle, "Keep captions legible over busy images: box (semi-transparent band), outline or plain")
+	flag.StringVar(&opts.CaptionColor, "caption-color", opts.CaptionColor, "Caption text colour: auto (black or white, whichever contrasts more with the image) or a CSS colour (name, #rgb, #rrggbbaa, rgb(r g b / a))")
+	flag.StringVar(&opts.StateFile, "state-file", "", fmt.Sprintf("Remember the input files and settings of the last run here; if nothing changed, exit with status %d without output (for scheduled jobs)", exitUnchanged))
+	flag.BoolVar(&opts.Quiet, "quiet", false, "Do not show rendering progress (processed images, percent, ETA) for scripting")
+	badges := flag.String("badges", "", "Comma-separated metadata badges to draw on each image: camera (EXIF model), video (motion photo), raw (RAW file beside it), flash (flash fired)")
+	flag.StringVar(&opts.Target, "target", "", "Build a photo mosaic: arrange the images on a -cols wide grid (default 40) so their average colours reproduce this image")
+	flag.IntVar(&opts.MosaicRepeats, "mosaic-repeats", 0, "With -target, use each image at most this many times (0: unlimited)")
+	flag.BoolVar(&opts.Hierarchical, "hierarchical", false, "Build a collage per subfolder and compose those, captioned with the folder names, into an overview of the whole tree")
+	flag.BoolVar(&cfg.perFolder, "per-folder", false, "Write one collage per subfolder under -output_dir instead of one combined collage")
+	flag.StringVar(&opts.OutputDir, "output_dir", "", "Output root for -per-folder; the input tree is mirrored there and unchanged folders are skipped")
+	flag.StringVar(&opts.Format, "format", opts.Format, "Output format of -per-folder collages: webp, png, jpg or avif")
+	flag.IntVar(&opts.ScanWorkers, "scan-workers", opts.ScanWorkers, "Folders read at once while scanning; raise for large trees on network storage")
+	flag.IntVar(&opts.Jobs, "jobs", 0, "Folder collages -per-folder builds in parallel (0: one per CPU)")
+	flag.BoolVar(&opts.Recursive, "recursive", false, "With -per-folder, make a collage for every folder at every level of the tree")
+	flag.IntVar(&cfg.prefetch, "prefetch", 256, "Decode and resize up to this many images in the background while the tree is still being scanned (0 disables)")
+	flag.BoolVar(&opts.Strict, "strict", false, fmt.Sprintf("Stop at the first image that cannot be read, downloaded or decoded instead of leaving it out; either way such failures exit with status %d (no images: %d, output not written: %d)", exitImageErrors, exitNoImages, exitEncode))
+	flag.StringVar(&cfg.skipReport, "skip-report", "", "Write a JSON list of every file left out of the collage and why (e.g. skipped.json)")
+	flag.BoolVar(&cfg.openResult, "open", false, "Show the result in the system's default viewer when done")
+	wallpaper := flag.String("wallpaper", "", "Make a wallpaper of this screen size, WxH in pixels (e.g. 2560x1440) or 720p, 1080p, 1440p, 4k, 5k, 8k, uwqhd: the layout is stretched to fill it with -fit cover cells inside a -margin clear of menu bars and taskbars")
+	social := flag.String("social", "", "Export for social media: square (1080x1080, 9 images per slide), portrait (1080x1350, 12 per slide) or story (1080x1920, 15 per slide), as cover-fitted JPEG pages at quality 90 unless -fit, -per-page or -quality say otherwise")
+	flag.BoolVar(&cfg.setWallpaper, "set-wallpaper", false, "Set the finished collage as the desktop wallpaper (macOS, Windows, GNOME or feh)")
+	flag.BoolVar(&cfg.notify, "notify-desktop", false, "Show a desktop notification with the duration and failed image count when the collage is done or fails")
+	flag.StringVar(&cfg.openWith, "open-with", "", "Show the result with this command instead (e.g. \"eog\" or \"gimp {}\"; {} is the file, else it is appended); implies -open")
+	flag.StringVar(&cfg.projectFile, "project", "", "Save the image plan to this project file for later `edit` runs (e.g. project.collage)")
+	configFile := flag.String("config", "", "Read options from this YAML, TOML or JSON file (e.g. collage.yaml) keyed by flag name, with lists for repeated flags; command-line flags override it")
+	flag.Parse()
+	cfg.start = time.Now()
+
+	if *configFile != "" {
+		if err := applyConfig(*configFile); err != nil {
+			return nil, err
 		}
 	}
-	sort.Strings(subfolders)
 
-	var imagePaths []string
-	for _, folder := range subfolders {
-		files, err := os.ReadDir(folder)
+	if len(inputDirs) > 0 {
+		opts.InputDir, opts.InputDirs = inputDirs[0], inputDirs[1:]
+	}
+	if (opts.InputDir == "" && cfg.fileList == "" && cfg.video == "") || (opts.OutputPath == "" && !cfg.perFolder && !cfg.prewarm && opts.SiteDir == "") || (cfg.perFolder && opts.OutputDir == "") {
+		return nil, errUsage
+	}
+	var err error
+	if opts.Reserved, err = parseReservations(reserve); err != nil {
+		return nil, err
+	}
+	if opts.TitleCells, err = parseTitleCells(titleCells); err != nil {
+		return nil, err
+	}
+	// Convert the lengths to pixels now -dpi is known.
+	for _, l := range []struct {
+		name string
+		spec *string
+		dst  *int
+	}{
+		{"cell_size", cellSize, &opts.CellSize},
+		{"gutter", gutter, &opts.Gutter},
+		{"margin", margin, &opts.Margin},
+		{"inset", inset, &opts.Inset},
+		{"inset-jitter", insetJitter, &opts.InsetJitter},
+	} {
+		if *l.dst, err = collage.ParseLength(*l.spec, opts.DPI); err != nil {
+			return nil, fmt.Errorf("-%s: %v", l.name, err)
+		}
+	}
+	if *width != "" {
+		w, err := collage.ParseLength(*width, opts.DPI)
+		if err != nil {
+			return nil, fmt.Errorf("-width: %v", err)
+		}
+		if opts.Cols <= 0 {
+			return nil, fmt.Errorf("-width needs -cols to divide the width into cells")
+		}
+		if opts.CellSize = (w - 2*opts.Margin - (opts.Cols-1)*opts.Gutter) / opts.Cols; opts.CellSize <= 0 {
+			return nil, fmt.Errorf("-width %s leaves no room for %d columns", *width, opts.Cols)
+		}
+	}
+	// A wallpaper fills the screen with cover-fitted cells, clear of menu bars
+	// and taskbars, unless -fit or -margin say otherwise.
+	if *wallpaper != "" {
+		size, err := collage.ParseSize(*wallpaper)
 		if err != nil {
-			log.Printf("Warning: could not read folder %s: %v", folder, err)
+			return nil, fmt.Errorf("-wallpaper: %v", err)
+		}
+		opts.Size = *wallpaper
+		given := givenFlags()
+		if !given["fit"] {
+			opts.Fit = collage.FitCover
+		}
+		if !given["margin"] {
+			opts.Margin = collage.SafeMargin(size)
+		}
+	}
+	if *social != "" {
+		preset, ok := socialPresets[strings.ToLower(*social)]
+		if !ok {
+			return nil, fmt.Errorf("-social: unknown preset %q: use square, portrait or story", *social)
+		}
+		if *wallpaper != "" {
+			return nil, fmt.Errorf("-social and -wallpaper both set the output size; give one")
+		}
+		opts.Size = preset.size
+		given := givenFlags()
+		if !given["fit"] {
+			opts.Fit = collage.FitCover
+		}
+		if !given["per-page"] {
+			opts.PerPage = preset.perPage
+		}
+		if !given["quality"] {
+			opts.Quality = preset.quality
+		}
+		if ext := strings.ToLower(filepath.Ext(opts.OutputPath)); ext != ".jpg" && ext != ".jpeg" {
+			log.Printf("Warning: -social: platforms may reject %s uploads; write a .jpg", ext)
+		}
+	}
+	if opts.Carousel > 0 && opts.Size != "" {
+		return nil, fmt.Errorf("-carousel sets the output size itself; drop -wallpaper or -social")
+	}
+	opts.Badges = splitList(*badges)
+	opts.Include, opts.Exclude = include, exclude
+	opts.Compare = compare
+	for _, item := range splitList(*htmlThumbs) {
+		size, err := strconv.Atoi(item)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("-html-thumbs: invalid size %q: use pixel sizes like 160,320", item)
+		}
+		opts.HTMLThumbs = append(opts.HTMLThumbs, size)
+	}
+	for _, b := range []struct {
+		name, spec string
+		dst        *int64
+	}{
+		{"max-bandwidth", *maxBandwidth, &opts.MaxBandwidth},
+		{"target-filesize", *targetFileSize, &opts.TargetFileSize},
+		{"min-bytes", *minBytes, &opts.MinBytes},
+		{"download-cache-size", *downloadCacheSize, &opts.DownloadCacheSize},
+	} {
+		if b.spec == "" {
 			continue
 		}
-
-		var imgsInFolder []string
-		for _, file := range files {
-			if file.IsDir() {
-				continue
-			}
-			lowName := strings.ToLower(file.Name())
-			if strings.HasSuffix(lowName, ".webp") ||
-				strings.HasSuffix(lowName, ".jpg") ||
-				strings.HasSuffix(lowName, ".jpeg") {
-				imgsInFolder = append(imgsInFolder, filepath.Join(folder, file.Name()))
-			}
+		if *b.dst, err = collage.ParseByteSize(b.spec); err != nil {
+			return nil, fmt.Errorf("-%s: %v", b.name, err)
 		}
-		sort.Strings(imgsInFolder)
-		imagePaths = append(imagePaths, imgsInFolder...)
 	}
-	return imagePaths, subfolders, nil
+	if *since != "" && *after != "" {
+		return nil, fmt.Errorf("-since and -after both set the earliest date; give one")
+	}
+	for _, d := range []struct {
+		name, spec string
+		dst        *time.Time
+	}{
+		{"since", *since, &opts.Since},
+		{"after", *after, &opts.Since},
+		{"before", *before, &opts.Before},
+	} {
+		if d.spec == "" {
+			continue
+		}
+		if *d.dst, err = collage.ParseSince(d.spec, time.Now()); err != nil {
+			return nil, fmt.Errorf("-%s: %v", d.name, err)
+		}
+	}
+
+	// Reject flags that do not go together.
+	switch {
+	case cfg.subtitles != "" && cfg.video == "":
+		return nil, fmt.Errorf("-subtitles captions the frames of a -video; give one")
+	case cfg.video != "" && cfg.fileList != "":
+		return nil, fmt.Errorf("-video and -file-list both give the images; give one")
+	case cfg.projectFile != "" && (cfg.video != "" || cfg.perFolder || opts.SiteDir != "" || opts.Variants > 1 || len(opts.Compare) > 0 || opts.Target != ""):
+		return nil, fmt.Errorf("-project records the images of one collage for `edit`; drop -video, -per-folder, -site, -variants, -compare and -target")
+	case cfg.watch && (cfg.prewarm || cfg.video != "" || cfg.fileList != ""):
+		return nil, fmt.Errorf("-watch watches -input_dir; drop prewarm, -video and -file-list")
+	case cfg.serve != "" && !cfg.watch && (cfg.prewarm || cfg.perFolder || opts.SiteDir != ""):
+		return nil, fmt.Errorf("-serve shows a single collage; drop prewarm, -per-folder and -site")
+	case cfg.perFolder && cfg.video != "":
+		return nil, fmt.Errorf("-video makes one contact sheet; drop -per-folder")
+	case cfg.perFolder && cfg.prewarm:
+		return nil, fmt.Errorf("prewarm makes the tiles of one collage; drop -per-folder")
+	}
+	return cfg, nil
 }
 
-// createCollage creates the collage image given the list of image paths, cell size, and writes the result to outputPath.
-// This version uses a disk‑backed memory map to hold the collage buffer.
-func createCollage(imagePaths []string, cellSize int, outputPath string) error {
-	totalImages := len(imagePaths)
-	if totalImages == 0 {
-		return fmt.Errorf("no images found")
+// run makes what cfg asks for. It returns an exitCode error for a run that
+// ends with a status besides 0 or 1 without a message of its own.
+func run(ctx context.Context, cfg *config) error {
+	opts := cfg.opts
+
+	// showResult opens the finished output if asked to.
+	showResult := func(path string) {
+		if !cfg.openResult && cfg.openWith == "" {
+			return
+		}
+		if err := openFile(path, cfg.openWith); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+
+	// notifyResult reports on the desktop that making path finished or failed
+	// with err, if asked to.
+	notifyResult := func(path string, err error) {
+		if !cfg.notify {
+			return
+		}
+		took := time.Since(cfg.start).Round(100 * time.Millisecond)
+		title, message := "Collage done", fmt.Sprintf("%s written in %v", filepath.Base(path), took)
+		if err != nil {
+			title, message = "Collage failed", fmt.Sprintf("%v (after %v)", err, took)
+		}
+		if n := opts.Skipped.Failures(); n > 0 {
+			message += fmt.Sprintf("; images that failed: %d", n)
+		}
+		if err := notifyDesktop(title, message); err != nil {
+			log.Printf("Warning: %v", err)
+		}
 	}
 
-	// Calculate grid dimensions (nearly square).
-	ncols := int(math.Ceil(math.Sqrt(float64(totalImages))))
-	nrows := int(math.Ceil(float64(totalImages) / float64(ncols)))
-	collageWidth := ncols * cellSize
-	collageHeight := nrows * cellSize
-	bufferSize := collageWidth * collageHeight * 4 // 4 bytes per pixel (RGBA)
+	// fail ends a run that could not make path with err.
+	fail := func(path string, err error) error {
+		printSkipSummary(opts.Skipped)
+		notifyResult(path, err)
+		return err
+	}
 
-	// Create a temporary file to back our collage buffer.
-	tmpFile, err := os.CreateTemp("", "collage-*.tmp")
-	if err != nil {
-		return fmt.Errorf("failed to create temp file: %v", err)
+	// succeed ends a run that made path: it summarises the files left out and,
+	// if some of them failed, ends with exitImageErrors so scripts can tell a
+	// collage with missing images from a complete one.
+	succeed := func(path string) error {
+		notifyResult(path, nil)
+		printSkipSummary(opts.Skipped)
+		if opts.Skipped.Failures() > 0 {
+			return exitCode(exitImageErrors)
+		}
+		return nil
 	}
-	// Ensure the file is removed after we're done.
-	defer os.Remove(tmpFile.Name())
 
-	// Set the file size.
-	if err := tmpFile.Truncate(int64(bufferSize)); err != nil {
-		return fmt.Errorf("failed to truncate temp file: %v", err)
+	// Rebuild on every change of the inputs, or serve the collage to a
+	// browser and rebuild it when asked to, instead of building it once.
+	if cfg.watch {
+		b := newBuilder(ctx, "watch", "serve")
+		roots := append([]string{opts.InputDir}, opts.InputDirs...)
+		watchFunc := func() int { return watchInputs(ctx, b, roots, cfg.watchDelay, outputFilter(opts)) }
+		if cfg.serve == "" {
+			return exitCode(watchFunc())
+		}
+		return exitCode(serveCollage(ctx, cfg.serve, firstOutput(opts), b, watchFunc))
+	}
+	if cfg.serve != "" {
+		return exitCode(serveCollage(ctx, cfg.serve, firstOutput(opts), newBuilder(ctx, "serve"), nil))
 	}
 
-	// Memory-map the temporary file (read-write).
-	mapped, err := mmap.Map(tmpFile, mmap.RDWR, 0)
-	if err != nil {
-		return fmt.Errorf("failed to memory-map file: %v", err)
+	// Record the files left out for the summary, -skip-report and exit status.
+	opts.Skipped = &collage.SkipLog{}
+	defer writeSkipReport(opts.Skipped, cfg.skipReport)
+
+	// Write a collage per folder instead of a combined one.
+	if cfg.perFolder {
+		if info, err := os.Stat(opts.InputDir); len(opts.InputDirs) > 0 || cfg.fileList != "" || err != nil || !info.IsDir() {
+			return fmt.Errorf("-per-folder mirrors a single local -input_dir")
+		}
+		if err := collage.CreatePerFolder(opts); err != nil {
+			return fail(opts.OutputDir, err)
+		}
+		showResult(opts.OutputDir)
+		return succeed(opts.OutputDir)
 	}
-	// Ensure the mapping is unmapped later.
-	defer mapped.Unmap()
 
-	// Create an RGBA image that uses the memory-mapped slice as its pixel buffer.
-	collage := &image.RGBA{
-		Pix:    mapped,
-		Stride: collageWidth * 4,
-		Rect:   image.Rect(0, 0, collageWidth, collageHeight),
+	// Start loading images as soon as the scan finds them (prewarm has its own
+	// workers, variants share their tiles through the tile cache instead and
+	// comparisons draw smaller tiles).
+	if !cfg.prewarm && opts.Variants <= 1 && len(opts.Compare) == 0 {
+		opts.Prefetch = collage.NewPrefetcher(opts, cfg.prefetch)
+		defer opts.Prefetch.Close()
 	}
 
-	// Fill the collage background with transparent white (R, G, B = 255, Alpha = 0).
-	draw.Draw(collage, collage.Rect, &image.Uniform{color.RGBA{255, 255, 255, 0}}, image.Point{}, draw.Src)
+	// Get sorted image paths, with photos found under several roots once, or
+	// take them as listed.
+	var imagePaths, subfolders []string
+	var err error
+	if cfg.video != "" {
+		var cleanupFrames func()
+		if imagePaths, opts.FrameTimes, cleanupFrames, err = collage.VideoFrames(cfg.video, cfg.frames, opts); err != nil {
+			return err
+		}
+		defer cleanupFrames()
+		if !givenFlags()["caption"] {
+			opts.Caption = collage.CaptionTime
+		}
+		if cfg.subtitles != "" {
+			if opts.Subtitles, err = collage.ReadSubtitles(cfg.subtitles); err != nil {
+				return err
+			}
+		}
+		subfolders = collage.ImageFolders(imagePaths)
+	} else if cfg.fileList != "" {
+		if imagePaths, err = collage.ReadImageList(cfg.fileList, opts.Skipped); err != nil {
+			return err
+		}
+		subfolders = collage.ImageFolders(imagePaths)
+	} else {
+		if len(opts.InputDirs) > 0 {
+			opts.Duplicates = map[string][]string{}
+		}
+		if imagePaths, subfolders, err = collage.Scan(opts); err != nil {
+			return err
+		}
+		opts.Since, opts.Before = time.Time{}, time.Time{} // the scan already left out images by date
+	}
 
-	// Process each image.
-	for idx, imgPath := range imagePaths {
-		img, err := loadImage(imgPath)
+	// Leave the collage alone if nothing changed since the last run, before
+	// fetching anything. Remote and archived images are only known by their
+	// content, so with those the check waits until they are fetched.
+	unchanged := func(images []string) bool {
+		o := opts
+		o.Images = images
+		same, err := collage.Unchanged(o)
 		if err != nil {
-			log.Printf("Error processing '%s': %v", imgPath, err)
-			continue
+			log.Printf("Warning: could not check state file: %v", err)
 		}
+		return same
+	}
+	fetched := slices.ContainsFunc(imagePaths, collage.NeedsFetch)
+	if !cfg.prewarm && !fetched && unchanged(imagePaths) {
+		return exitCode(exitUnchanged)
+	}
 
-		// Convert to RGBA if needed.
-		bounds := img.Bounds()
-		origW, origH := bounds.Dx(), bounds.Dy()
+	// Fetch the images given as URLs, listed from buckets or inside archives.
+	listed := imagePaths
+	var cleanupFetched func()
+	if imagePaths, opts.Sources, cleanupFetched, err = collage.FetchImages(imagePaths, opts); err != nil {
+		return err
+	}
+	defer cleanupFetched()
+	opts.Prefetch.Add(imagePaths)
+	opts.Images = imagePaths
+	if !cfg.prewarm && fetched && unchanged(imagePaths) {
+		return exitCode(exitUnchanged)
+	}
 
-		// Determine scale factor (so that the longer side equals cellSize).
-		scaleFactor := float64(cellSize) / float64(max(origW, origH))
-		newW := int(float64(origW) * scaleFactor)
-		newH := int(float64(origH) * scaleFactor)
+	// Only fill the tile cache for a later run.
+	if cfg.prewarm {
+		return collage.Prewarm(opts)
+	}
 
-		// Create a new RGBA image for the resized image.
-		resized := image.NewRGBA(image.Rect(0, 0, newW, newH))
-		// Use high-quality scaling.
-		xdraw.CatmullRom.Scale(resized, resized.Rect, img, bounds, xdraw.Over, nil)
+	// Count images per subfolder from the scan, without reading the folders again.
+	counts := map[string]int{}
+	for _, path := range listed {
+		counts[collage.ImageFolder(path)]++
+	}
+	dups := 0
+	for _, others := range opts.Duplicates {
+		for _, path := range others {
+			counts[filepath.Dir(path)]++
+			dups++
+		}
+	}
+	totalCount := 0
+	fmt.Println("Image counts per folder:")
+	for _, folder := range subfolders {
+		totalCount += counts[folder]
+		fmt.Printf("  %s: %d images\n", folder, counts[folder])
+	}
+	fmt.Printf("\nTotal images found: %d\n", totalCount)
+	if dups > 0 {
+		fmt.Printf("Duplicates across input roots included once: %d\n", dups)
+	}
 
-		// Compute cell position.
-		row := idx / ncols
-		col := idx % ncols
-		cellX := col * cellSize
-		cellY := row * cellSize
-		// Center the resized image in the cell.
-		offsetX := cellX + (cellSize-newW)/2
-		offsetY := cellY + (cellSize-newH)/2
+	if totalCount == 0 {
+		printSkipSummary(opts.Skipped)
+		exts := collage.ImageExtensions()
+		log.Printf("No %s or %s images found in the provided folders.", strings.Join(exts[:len(exts)-1], ", "), exts[len(exts)-1])
+		return exitCode(exitNoImages)
+	}
+	if n := opts.Skipped.Failures(); n > 0 && opts.Strict {
+		printSkipSummary(opts.Skipped)
+		log.Printf("Error: -strict: %d files or folders could not be read or downloaded", n)
+		return exitCode(exitImageErrors)
+	}
 
-		// Paste the resized image onto the collage.
-		destRect := image.Rect(offsetX, offsetY, offsetX+newW, offsetY+newH)
-		draw.Draw(collage, destRect, resized, image.Point{}, draw.Over)
+	// Read the text in the images for captions and the -html search.
+	if cfg.ocr {
+		if opts.Texts, err = collage.ReadText(imagePaths, cfg.ocrLang, opts); err != nil {
+			return err
+		}
 	}
 
-	// Ensure any changes to the memory map are flushed.
-	if err := mapped.Flush(); err != nil {
-		return fmt.Errorf("failed to flush memory map: %v", err)
+	// Build the static site instead of a single collage.
+	if opts.SiteDir != "" {
+		if err := collage.CreateSite(opts); err != nil {
+			return fail(opts.SiteDir, fmt.Errorf("failed to create site: %w", err))
+		}
+		showResult(filepath.Join(opts.SiteDir, "index.html"))
+		return succeed(opts.SiteDir)
 	}
 
-	// Save the final collage as a WebP image.
-	outFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %v", err)
+	// Create the collage, noting the images drawn for the project.
+	var drawn []string
+	if cfg.projectFile != "" {
+		opts.Drawn = &drawn
+	}
+	if err := collage.Create(opts); err != nil {
+		return fail(opts.OutputPath, fmt.Errorf("failed to create collage: %w", err))
+	}
+	result := firstOutput(opts)
+	if cfg.setWallpaper {
+		if err := setDesktopWallpaper(result); err != nil {
+			log.Printf("Warning: %v", err)
+		} else {
+			fmt.Println("Desktop wallpaper set")
+		}
 	}
-	defer outFile.Close()
+	showResult(result)
 
-	// Use lossless encoding.
-	options := &webp.Options{Lossless: true}
-	if err := webp.Encode(outFile, collage, options); err != nil {
-		return fmt.Errorf("failed to encode WebP: %v", err)
+	// Save the plan so the layout can be corrected with `collage edit`.
+	if cfg.projectFile != "" {
+		p := &project{OutputFile: opts.OutputPath, Args: projectArgs()}
+		if p.Dir, err = os.Getwd(); err != nil {
+			return fmt.Errorf("failed to save project: %v", err)
+		}
+		for _, path := range drawn {
+			p.Images = append(p.Images, opts.Source(path))
+		}
+		if err := saveProject(cfg.projectFile, p); err != nil {
+			return fmt.Errorf("failed to save project: %v", err)
+		}
+		fmt.Printf("Project saved to '%s'\n", cfg.projectFile)
 	}
-	fmt.Printf("Collage saved to '%s'\n", outputPath)
-	return nil
+	return succeed(opts.OutputPath)
 }
 
-func max(a, b int) int {
-	if a > b {
-		return a
+// exitStatus returns the exit status of a run that failed with err.
+func exitStatus(err error) int {
+	var sig interrupted
+	var code exitCode
+	switch {
+	case errors.As(err, &code):
+		return int(code)
+	case errors.As(err, &sig):
+		return sig.status()
+	case errors.Is(err, collage.ErrNoImages):
+		return exitNoImages
+	case errors.Is(err, collage.ErrImageFailed):
+		return exitImageErrors
+	case errors.Is(err, collage.ErrEncode):
+		return exitEncode
 	}
-	return b
+	return 1
 }
 
-func main() {
-	// Parse command-line arguments.
-	inputDir := flag.String("input_dir", "", "Path to the root directory containing subfolders with images")
-	outputFile := flag.String("output_file", "", "Output collage file (e.g. collage.webp)")
-	cellSize := flag.Int("cell_size", 200, "Size in pixels for each cell (default: 200)")
-	flag.Parse()
-
-	if *inputDir == "" || *outputFile == "" {
-		flag.Usage()
-		os.Exit(1)
+// firstOutput returns the collage written to opts.OutputPath or, when several
+// are written beside it, the first of them.
+func firstOutput(opts collage.Options) string {
+	switch {
+	case len(opts.Compare) > 0 || opts.Carousel > 0:
+	case opts.Variants > 1:
+		return collage.VariantPath(opts.OutputPath, 1)
+	case opts.PerPage > 0:
+		return collage.PagePath(opts.OutputPath, 1)
 	}
+	return opts.OutputPath
+}
 
-	// Get sorted image paths.
-	imagePaths, subfolders, err := getSortedImagePaths(*inputDir)
-	if err != nil {
-		log.Fatalf("Error: %v\n", err)
+// socialPresets are the -social exports: the output size of a slide, the
+// images per slide and the JPEG quality, high enough to survive the platform's
+// own recompression.
+var socialPresets = map[string]struct {
+	size             string
+	perPage, quality int
+}{
+	"square":   {"1080x1080", 9, 90},
+	"portrait": {"1080x1350", 12, 90},
+	"story":    {"1080x1920", 15, 90},
+}
+
+// parseReservations parses the -reserve specs.
+func parseReservations(specs []string) ([]collage.Reservation, error) {
+	var reserved []collage.Reservation
+	for _, spec := range specs {
+		r, err := collage.ParseReservation(spec)
+		if err != nil {
+			return nil, err
+		}
+		reserved = append(reserved, r)
 	}
+	return reserved, nil
+}
 
-	// Count images per subfolder.
-	totalCount := 0
-	fmt.Println("Image counts per folder:")
-	for _, folder := range subfolders {
-		files, err := os.ReadDir(folder)
+// parseTitleCells parses the -title-cell specs.
+func parseTitleCells(specs []string) ([]collage.TitleCell, error) {
+	var cells []collage.TitleCell
+	for _, spec := range specs {
+		t, err := collage.ParseTitleCell(spec)
 		if err != nil {
-			log.Printf("Warning: could not read folder %s: %v", folder, err)
-			continue
+			return nil, err
 		}
-		count := 0
-		for _, file := range files {
-			lowName := strings.ToLower(file.Name())
-			if !file.IsDir() && (strings.HasSuffix(lowName, ".webp") || strings.HasSuffix(lowName, ".jpg") || strings.HasSuffix(lowName, ".jpeg")) {
-				count++
-			}
+		cells = append(cells, t)
+	}
+	return cells, nil
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
 		}
-		totalCount += count
-		fmt.Printf("  %s: %d images\n", folder, count)
 	}
-	fmt.Printf("\nTotal images found: %d\n", totalCount)
+	return items
+}
 
-	if totalCount == 0 {
-		log.Fatalf("No .webp or .jpg images found in the provided folders.")
+// printSkipSummary reports how many files were left out of the collage, and why.
+func printSkipSummary(skipped *collage.SkipLog) {
+	counts := skipped.ByReason()
+	reasons := make([]string, 0, len(counts))
+	total := 0
+	for reason, n := range counts {
+		reasons = append(reasons, reason)
+		total += n
+	}
+	if total == 0 {
+		return
 	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if counts[reasons[i]] != counts[reasons[j]] {
+			return counts[reasons[i]] > counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	for i, reason := range reasons {
+		reasons[i] = fmt.Sprintf("%d %s", counts[reason], reason)
+	}
+	fmt.Printf("Skipped %d files: %s\n", total, strings.Join(reasons, ", "))
+}
 
-	// Create the collage.
-	if err := createCollage(imagePaths, *cellSize, *outputFile); err != nil {
-		log.Fatalf("Error creating collage: %v", err)
+// writeSkipReport saves the files left out of the collage to path, if a report was requested.
+func writeSkipReport(skipped *collage.SkipLog, path string) {
+	if skipped == nil || path == "" {
+		return
+	}
+	if err := skipped.WriteJSON(path); err != nil {
+		log.Printf("Warning: could not write skip report: %v", err)
+		return
 	}
+	fmt.Printf("Skip report saved to '%s' (%d files)\n", path, len(skipped.Entries()))
 }
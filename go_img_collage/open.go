@@ -0,0 +1,46 @@
+// open.go
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// openFile shows path in the viewer given by command or, if command is empty,
+// in the default application of the operating system. In command, {} stands
+// for the path; without it the path is appended. The viewer is started in the
+// background and not waited for.
+func openFile(path, command string) error {
+	var args []string
+	if command != "" {
+		args = strings.Fields(command)
+		found := false
+		for i, a := range args {
+			if strings.Contains(a, "{}") {
+				args[i], found = strings.ReplaceAll(a, "{}", path), true
+			}
+		}
+		if !found {
+			args = append(args, path)
+		}
+	} else {
+		switch runtime.GOOS {
+		case "darwin":
+			args = []string{"open", path}
+		case "windows":
+			args = []string{"rundll32", "url.dll,FileProtocolHandler", path}
+		default:
+			args = []string{"xdg-open", path}
+		}
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("empty viewer command")
+	}
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open %s with %s: %v", path, args[0], err)
+	}
+	return cmd.Process.Release()
+}
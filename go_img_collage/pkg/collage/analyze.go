@@ -0,0 +1,214 @@
+// analyze.go
+package collage
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// analysisSize is the longest side, in pixels, of the copy of an image that is
+// analysed, so scores do not depend on the original resolution.
+const analysisSize = 256
+
+// uniformTolerance is how far, per 0-255 channel, a pixel may differ from an
+// image's median colour and still count towards its Uniformity.
+const uniformTolerance = 24
+
+// imageStats are quick quality measures of an image.
+type imageStats struct {
+	Sharpness  float64 // variance of the Laplacian of the luminance (0-255 scale); low means blurry
+	Brightness float64 // mean luminance, 0 (black) to 1 (white)
+	Clipped    float64 // fraction of pixels crushed to black or blown out to white
+	Uniformity float64 // fraction of pixels close to the median colour; near 1 for single-colour frames
+	Warmth     float64 // mean red minus blue, -1 (cool, blue) to 1 (warm, orange): a colour temperature proxy
+	Hue        float64 // dominant hue in degrees, 0 (red) through 120 (green) and 240 (blue) to 360
+	Chroma     float64 // mean chroma, 0 (grey) to 1 (fully saturated); the Hue is meaningless near 0
+}
+
+// hueBins is the number of bins of the hue histogram the dominant hue is found in.
+const hueBins = 36
+
+// analyzeImage computes the statistics of img from a copy scaled to analysisSize.
+func analyzeImage(img image.Image) imageStats {
+	b := img.Bounds()
+	scale := min(1, float64(analysisSize)/float64(max(b.Dx(), b.Dy())))
+	w, h := max(1, int(float64(b.Dx())*scale)), max(1, int(float64(b.Dy())*scale))
+	small := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.ApproxBiLinear.Scale(small, small.Rect, img, b, draw.Src, nil)
+	gray := image.NewGray(small.Rect)
+	draw.Draw(gray, gray.Rect, small, image.Point{}, draw.Src)
+
+	var st imageStats
+	st.Uniformity = uniformity(small)
+	for i := 0; i < len(small.Pix); i += 4 {
+		st.Warmth += float64(small.Pix[i]) - float64(small.Pix[i+2])
+	}
+	st.Warmth /= float64(len(small.Pix)/4) * 255
+	st.Hue, st.Chroma = dominantHue(small)
+	var clipped int
+	for _, v := range gray.Pix {
+		st.Brightness += float64(v)
+		if v <= 5 || v >= 250 {
+			clipped++
+		}
+	}
+	n := float64(len(gray.Pix))
+	st.Brightness /= n * 255
+	st.Clipped = float64(clipped) / n
+
+	// 4-neighbour Laplacian over the interior pixels.
+	var sum, sumSq, count float64
+	for y := 1; y < h-1; y++ {
+		for x := 1; x < w-1; x++ {
+			c := gray.Pix[y*gray.Stride+x]
+			lap := float64(gray.Pix[(y-1)*gray.Stride+x]) + float64(gray.Pix[(y+1)*gray.Stride+x]) +
+				float64(gray.Pix[y*gray.Stride+x-1]) + float64(gray.Pix[y*gray.Stride+x+1]) - 4*float64(c)
+			sum += lap
+			sumSq += lap * lap
+			count++
+		}
+	}
+	if count > 0 {
+		mean := sum / count
+		st.Sharpness = sumSq/count - mean*mean
+	}
+	return st
+}
+
+// dominantHue returns the hue (in degrees) most of the colour of img has, by a
+// chroma-weighted histogram refined to the weighted mean hue of its fullest
+// bin and the bins either side, and the mean chroma of img.
+func dominantHue(img *image.RGBA) (hue, chroma float64) {
+	var hist [hueBins]float64
+	var sin, cos [hueBins]float64
+	for i := 0; i < len(img.Pix); i += 4 {
+		r, g, b := float64(img.Pix[i])/255, float64(img.Pix[i+1])/255, float64(img.Pix[i+2])/255
+		hi, lo := math.Max(r, math.Max(g, b)), math.Min(r, math.Min(g, b))
+		c := hi - lo
+		chroma += c
+		if c == 0 {
+			continue
+		}
+		var h float64
+		switch hi {
+		case r:
+			h = math.Mod((g-b)/c+6, 6)
+		case g:
+			h = (b-r)/c + 2
+		default:
+			h = (r-g)/c + 4
+		}
+		h *= 60
+		bin := min(int(h/360*hueBins), hueBins-1)
+		hist[bin] += c
+		sin[bin] += c * math.Sin(h*math.Pi/180)
+		cos[bin] += c * math.Cos(h*math.Pi/180)
+	}
+	chroma /= float64(len(img.Pix) / 4)
+
+	best := 0
+	for i := range hist {
+		if hist[i] > hist[best] {
+			best = i
+		}
+	}
+	var y, x float64
+	for d := -1; d <= 1; d++ {
+		bin := (best + d + hueBins) % hueBins
+		y, x = y+sin[bin], x+cos[bin]
+	}
+	if x == 0 && y == 0 {
+		return 0, chroma
+	}
+	return math.Mod(math.Atan2(y, x)*180/math.Pi+360, 360), chroma
+}
+
+// uniformity returns the fraction of pixels of img within uniformTolerance of
+// its per-channel median colour.
+func uniformity(img *image.RGBA) float64 {
+	// Step 1: Find the median of each channel from its histogram.
+	var hist [3][256]int
+	for i := 0; i < len(img.Pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			hist[c][img.Pix[i+c]]++
+		}
+	}
+	n := len(img.Pix) / 4
+	var median [3]int
+	for c := range hist {
+		for count := 0; count <= n/2; median[c]++ {
+			count += hist[c][median[c]]
+		}
+		median[c]--
+	}
+
+	// Step 2: Count the pixels close to the median in every channel.
+	matched := 0
+	for i := 0; i < len(img.Pix); i += 4 {
+		near := true
+		for c := 0; c < 3 && near; c++ {
+			d := int(img.Pix[i+c]) - median[c]
+			near = d <= uniformTolerance && d >= -uniformTolerance
+		}
+		if near {
+			matched++
+		}
+	}
+	return float64(matched) / float64(n)
+}
+
+// Quality grades shown by score borders.
+const (
+	gradeGood = iota
+	gradeFair
+	gradePoor
+)
+
+// Sharpness and exposure limits for the quality grades.
+const (
+	sharpnessFair = 150 // Laplacian variance below which an image is soft
+	sharpnessPoor = 50  // ... and below which it is blurry
+)
+
+// grade rates the image as good, fair or poor by the worse of its sharpness and exposure.
+func (st imageStats) grade() int {
+	g := gradeGood
+	switch {
+	case st.Sharpness < sharpnessPoor:
+		g = gradePoor
+	case st.Sharpness < sharpnessFair:
+		g = gradeFair
+	}
+	switch {
+	case st.Brightness < 0.15 || st.Brightness > 0.85 || st.Clipped > 0.25:
+		g = gradePoor
+	case st.Brightness < 0.25 || st.Brightness > 0.75 || st.Clipped > 0.1:
+		g = max(g, gradeFair)
+	}
+	return g
+}
+
+// gradeColors are the border colours of the grades: green, yellow and red.
+var gradeColors = []color.RGBA{
+	gradeGood: {46, 204, 64, 255},
+	gradeFair: {255, 220, 0, 255},
+	gradePoor: {255, 65, 54, 255},
+}
+
+// drawScoreBorder frames cell on dst in the colour of the image's grade.
+func drawScoreBorder(dst draw.Image, cell image.Rectangle, st imageStats) {
+	t := max(2, min(cell.Dx(), cell.Dy())/40)
+	c := &image.Uniform{gradeColors[st.grade()]}
+	for _, r := range []image.Rectangle{
+		image.Rect(cell.Min.X, cell.Min.Y, cell.Max.X, cell.Min.Y+t),
+		image.Rect(cell.Min.X, cell.Max.Y-t, cell.Max.X, cell.Max.Y),
+		image.Rect(cell.Min.X, cell.Min.Y, cell.Min.X+t, cell.Max.Y),
+		image.Rect(cell.Max.X-t, cell.Min.Y, cell.Max.X, cell.Max.Y),
+	} {
+		draw.Draw(dst, r.Intersect(cell), c, image.Point{}, draw.Src)
+	}
+}
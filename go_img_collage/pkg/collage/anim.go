@@ -0,0 +1,170 @@
+// anim.go
+package collage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+
+	"github.com/chai2010/webp"
+)
+
+// decodeGIF decodes frame (0-based) of a GIF, composited over the frames before
+// it as a viewer shows it. Indices past the last frame give the last frame.
+func decodeGIF(data []byte, frame int) (image.Image, error) {
+	g, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(g.Image) == 0 {
+		return nil, fmt.Errorf("GIF has no frames")
+	}
+	frame = max(0, min(frame, len(g.Image)-1))
+	canvas := image.NewRGBA(image.Rect(0, 0, g.Config.Width, g.Config.Height))
+	if canvas.Rect.Empty() {
+		canvas = image.NewRGBA(g.Image[0].Bounds())
+	}
+	var previous *image.RGBA
+	for i := 0; i <= frame; i++ {
+		disposal := byte(0)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(canvas.Rect)
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, g.Image[i].Bounds(), g.Image[i], g.Image[i].Bounds().Min, draw.Over)
+		if i == frame {
+			break
+		}
+		// Undo the frame as its disposal method asks before drawing the next.
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, g.Image[i].Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(canvas.Pix, previous.Pix)
+		}
+	}
+	return canvas, nil
+}
+
+// WebP extended-format (VP8X) flags.
+const (
+	webpFlagAnimation = 0x02
+	webpFlagAlpha     = 0x10
+)
+
+// webpChunk is one RIFF chunk of a WebP file.
+type webpChunk struct {
+	id   string
+	data []byte
+}
+
+// webpChunks splits the RIFF payload of a WebP file, or of an ANMF frame, into chunks.
+func webpChunks(data []byte) []webpChunk {
+	var chunks []webpChunk
+	for i := 0; i+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n < 0 || i+8+n > len(data) {
+			break
+		}
+		chunks = append(chunks, webpChunk{string(data[i : i+4]), data[i+8 : i+8+n]})
+		i += 8 + n + n%2
+	}
+	return chunks
+}
+
+// isAnimatedWebP reports whether the WebP file has the animation flag set.
+func isAnimatedWebP(data []byte) bool {
+	if len(data) < 12 {
+		return false
+	}
+	chunks := webpChunks(data[12:])
+	return len(chunks) > 0 && chunks[0].id == "VP8X" && len(chunks[0].data) > 0 && chunks[0].data[0]&webpFlagAnimation != 0
+}
+
+// uint24 reads a 24-bit little-endian integer.
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// decodeAnimatedWebP decodes frame (0-based) of an animated WebP, composited
+// over the frames before it. Indices past the last frame give the last frame.
+func decodeAnimatedWebP(data []byte, frame int) (image.Image, error) {
+	chunks := webpChunks(data[12:])
+	if len(chunks[0].data) < 10 {
+		return nil, fmt.Errorf("invalid VP8X chunk")
+	}
+	canvas := image.NewRGBA(image.Rect(0, 0, uint24(chunks[0].data[4:])+1, uint24(chunks[0].data[7:])+1))
+
+	var frames [][]byte
+	for _, c := range chunks {
+		if c.id == "ANMF" && len(c.data) >= 16 {
+			frames = append(frames, c.data)
+		}
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("animated WebP has no frames")
+	}
+	frame = max(0, min(frame, len(frames)-1))
+	for i := 0; i <= frame; i++ {
+		f := frames[i]
+		x, y := 2*uint24(f[0:]), 2*uint24(f[3:])
+		img, err := decodeWebPFrame(f[16:], uint24(f[6:])+1, uint24(f[9:])+1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode frame %d: %v", i, err)
+		}
+		r := img.Bounds().Sub(img.Bounds().Min).Add(image.Pt(x, y))
+		op := draw.Over
+		if f[15]&0x02 != 0 { // do not blend
+			op = draw.Src
+		}
+		draw.Draw(canvas, r, img, img.Bounds().Min, op)
+		if i < frame && f[15]&0x01 != 0 { // dispose to background
+			draw.Draw(canvas, r, image.Transparent, image.Point{}, draw.Src)
+		}
+	}
+	return canvas, nil
+}
+
+// decodeWebPFrame decodes the image chunks of an ANMF frame of w by h pixels by
+// wrapping them in a still WebP file.
+func decodeWebPFrame(data []byte, w, h int) (image.Image, error) {
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	writeChunk := func(id string, payload []byte) {
+		body.WriteString(id)
+		binary.Write(&body, binary.LittleEndian, uint32(len(payload)))
+		body.Write(payload)
+		if len(payload)%2 != 0 {
+			body.WriteByte(0)
+		}
+	}
+	chunks := webpChunks(data)
+	for _, c := range chunks {
+		if c.id == "ALPH" {
+			// Lossy frames with alpha need the extended format.
+			vp8x := make([]byte, 10)
+			vp8x[0] = webpFlagAlpha
+			vp8x[4], vp8x[5], vp8x[6] = byte(w-1), byte((w-1)>>8), byte((w-1)>>16)
+			vp8x[7], vp8x[8], vp8x[9] = byte(h-1), byte((h-1)>>8), byte((h-1)>>16)
+			writeChunk("VP8X", vp8x)
+			break
+		}
+	}
+	for _, c := range chunks {
+		if c.id == "ALPH" || c.id == "VP8 " || c.id == "VP8L" {
+			writeChunk(c.id, c.data)
+		}
+	}
+
+	var file bytes.Buffer
+	file.WriteString("RIFF")
+	binary.Write(&file, binary.LittleEndian, uint32(body.Len()))
+	file.Write(body.Bytes())
+	return webp.Decode(&file)
+}
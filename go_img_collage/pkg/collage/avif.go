@@ -0,0 +1,110 @@
+// avif.go
+package collage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+)
+
+// AVIF is decoded and encoded with the avifdec and avifenc tools of libavif,
+// which must be on PATH; there is no pure Go AV1 codec to build in.
+const (
+	avifDecoder = "avifdec"
+	avifEncoder = "avifenc"
+)
+
+// avifSpeed trades encoding time for size (0 slowest and smallest, 10 fastest).
+const avifSpeed = 6
+
+// avifTool returns the path of a libavif command-line tool.
+func avifTool(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("AVIF support needs %s from libavif on PATH: %v", name, err)
+	}
+	return path, nil
+}
+
+// decodeAVIF decodes the contents of an AVIF file by converting it to PNG with
+// avifdec, which is killed if ctx is cancelled.
+func decodeAVIF(ctx context.Context, data []byte) (image.Image, error) {
+	tool, err := avifTool(avifDecoder)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "collage-avif-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	in, out := filepath.Join(dir, "in.avif"), filepath.Join(dir, "out.png")
+	if err := os.WriteFile(in, data, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to write temp file: %v", err)
+	}
+	if msg, err := exec.CommandContext(ctx, tool, "--depth", "8", in, out).CombinedOutput(); err != nil {
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		return nil, fmt.Errorf("%s failed: %v: %s", avifDecoder, err, bytes.TrimSpace(msg))
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return png.Decode(f)
+}
+
+// encodeAVIF writes img as AVIF at opts.Quality by passing it to avifenc as PNG.
+// AVIF keeps the alpha channel.
+func encodeAVIF(w io.Writer, img *image.RGBA, opts Options) error {
+	tool, err := avifTool(avifEncoder)
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "collage-avif-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Step 1: Hand the canvas to avifenc as a fast PNG.
+	in, out := filepath.Join(dir, "in.png"), filepath.Join(dir, "out.avif")
+	f, err := os.Create(in)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	enc := png.Encoder{CompressionLevel: png.NoCompression}
+	err = enc.Encode(f, img)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write temp file: %v", err)
+	}
+
+	// Step 2: Encode and copy the result to w.
+	args := []string{"-q", strconv.Itoa(opts.Quality), "--speed", strconv.Itoa(avifSpeed), "--jobs", strconv.Itoa(max(1, opts.EncodeWorkers)), in, out}
+	if msg, err := exec.CommandContext(opts.context(), tool, args...).CombinedOutput(); err != nil {
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s failed: %v: %s", avifEncoder, err, bytes.TrimSpace(msg))
+	}
+	result, err := os.Open(out)
+	if err != nil {
+		return err
+	}
+	defer result.Close()
+	_, err = io.Copy(w, result)
+	return err
+}
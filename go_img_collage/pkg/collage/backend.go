@@ -0,0 +1,42 @@
+// backend.go
+package collage
+
+import (
+	"fmt"
+	"image"
+)
+
+// Image backends (Options.Backend) that decode and scale the source images.
+const (
+	BackendGo   = "go"   // the pure Go decoders and golang.org/x/image/draw
+	BackendVips = "vips" // libvips, in binaries built with -tags vips (see vips.go)
+)
+
+// vipsResize decodes a JPEG or WebP file and scales it into a cell of cellW by
+// cellH pixels as opts.Fit says, turned upright by its EXIF orientation. It is
+// set by vips.go in binaries built with libvips and nil otherwise.
+var vipsResize func(data []byte, cellW, cellH int, opts Options) (*image.RGBA, error)
+
+// checkBackend returns an error for an unknown backend or one this binary was built without.
+func checkBackend(backend string) error {
+	switch backend {
+	case "", BackendGo:
+		return nil
+	case BackendVips:
+		if vipsResize == nil {
+			return fmt.Errorf("this binary was built without libvips: rebuild with -tags vips to use -backend vips")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown backend %q: use go or vips", backend)
+}
+
+// useVips reports whether the image data is decoded with libvips: the vips
+// backend handles still JPEG and WebP files, the formats it is much faster
+// for, and leaves GIF, AVIF, animated WebP and unrotated images to Go.
+func useVips(data []byte, opts Options) bool {
+	if opts.Backend != BackendVips || vipsResize == nil || opts.NoEXIFRotate {
+		return false
+	}
+	return jpegInput.magic(data) || (webpInput.magic(data) && !isAnimatedWebP(data))
+}
@@ -0,0 +1,200 @@
+// badge.go
+package collage
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"os"
+	"strings"
+
+	"golang.org/x/image/vector"
+)
+
+// Badge types (Options.Badges) drawn in the top-left corner of each image.
+const (
+	BadgeCamera = "camera" // camera icon with the EXIF camera model
+	BadgeVideo  = "video"  // play icon for motion photos: a Live Photo video beside the file or an embedded motion photo
+	BadgeRaw    = "raw"    // "RAW" when a RAW file with the same name sits beside the image
+	BadgeFlash  = "flash"  // lightning icon when EXIF records that the flash fired
+)
+
+// Additional EXIF tags read for badges.
+const (
+	tagMake  = 0x010F
+	tagModel = 0x0110
+	tagFlash = 0x9209
+)
+
+// Extensions of the companion files that earn the raw and video badges.
+var (
+	rawExtensions   = []string{".dng", ".cr2", ".cr3", ".nef", ".arw", ".raf", ".orf", ".rw2", ".pef", ".srw"}
+	videoExtensions = []string{".mov", ".mp4"}
+)
+
+// motionPhotoMarkers are the XMP properties of phones that embed a short video in the JPEG.
+var motionPhotoMarkers = [][]byte{[]byte(`MotionPhoto="1"`), []byte(`MicroVideo="1"`)}
+
+// checkBadges returns an error for an unknown badge type.
+func checkBadges(badges []string) error {
+	for _, b := range badges {
+		switch b {
+		case BadgeCamera, BadgeVideo, BadgeRaw, BadgeFlash:
+		default:
+			return fmt.Errorf("unknown badge %q: use camera, video, raw or flash", b)
+		}
+	}
+	return nil
+}
+
+// badge is one badge to draw: an icon, a label, or both.
+type badge struct {
+	icon  string // BadgeCamera, BadgeVideo or BadgeFlash; empty for none
+	label string
+}
+
+// imageBadges returns the badges of the requested types that apply to the image
+// at path, in the order requested.
+func imageBadges(path string, info *imageInfo, types []string) []badge {
+	var badges []badge
+	for _, t := range types {
+		switch t {
+		case BadgeCamera:
+			model := info.exif.str(tagModel)
+			if model == "" {
+				model = info.exif.str(tagMake)
+			}
+			if model != "" {
+				badges = append(badges, badge{icon: BadgeCamera, label: model})
+			}
+		case BadgeVideo:
+			if info.motion || hasCompanion(path, videoExtensions) {
+				badges = append(badges, badge{icon: BadgeVideo})
+			}
+		case BadgeRaw:
+			if hasCompanion(path, rawExtensions) {
+				badges = append(badges, badge{label: "RAW"})
+			}
+		case BadgeFlash:
+			if flash, ok := info.exif.uint(tagFlash); ok && flash&1 != 0 {
+				badges = append(badges, badge{icon: BadgeFlash})
+			}
+		}
+	}
+	return badges
+}
+
+// isMotionPhoto reports whether the image file contents declare an embedded video.
+// The XMP packet sits near the start of the file, so only its head is searched.
+func isMotionPhoto(data []byte) bool {
+	head := data[:min(len(data), 256<<10)]
+	for _, m := range motionPhotoMarkers {
+		if bytes.Contains(head, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCompanion reports whether a file with the same name as path and one of
+// the extensions, in lower or upper case, exists beside it.
+func hasCompanion(path string, exts []string) bool {
+	base := trimImageExt(path)
+	for _, ext := range exts {
+		for _, e := range []string{ext, strings.ToUpper(ext)} {
+			if _, err := os.Stat(base + e); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// drawBadges draws badges in a row from the top-left corner of the image pasted
+// at rect on dst, dropping those that do not fit the image width.
+func drawBadges(dst *image.RGBA, rect image.Rectangle, badges []badge, fonts *fontSet) {
+	h := max(10, min(rect.Dx(), rect.Dy())/10)
+	gap := max(2, h/5)
+	x, y := rect.Min.X+gap, rect.Min.Y+gap
+	fg := &image.Uniform{captionWhite}
+	for _, b := range badges {
+		// Step 1: Measure the icon and label.
+		w := 0
+		if b.icon != "" {
+			w += h
+		}
+		var mask *image.Alpha
+		if b.label != "" {
+			lines := shapeText(b.label, fonts).wrap(math.MaxInt32)
+			lw, lh := linesSize(lines)
+			if lw == 0 || lh == 0 {
+				continue
+			}
+			scale := 0.6 * float64(h) / float64(lh)
+			mask = textMask(image.Pt(int(math.Ceil(float64(lw)*scale))+h/2, h), lines, scale)
+			w += mask.Rect.Dx()
+		}
+
+		// Step 2: Draw the box and its contents if it fits.
+		box := image.Rect(x, y, x+w, y+h)
+		if box.Max.X > rect.Max.X-gap || box.Max.Y > rect.Max.Y {
+			return
+		}
+		draw.Draw(dst, box, &image.Uniform{captionBoxColor}, image.Point{}, draw.Over)
+		if b.icon != "" {
+			icon := iconMask(b.icon, h)
+			draw.DrawMask(dst, image.Rect(x, y, x+h, y+h), fg, image.Point{}, icon, image.Point{}, draw.Over)
+		}
+		if mask != nil {
+			draw.DrawMask(dst, image.Rect(box.Max.X-mask.Rect.Dx(), y, box.Max.X, y+h), fg, image.Point{}, mask, image.Point{}, draw.Over)
+		}
+		x = box.Max.X + gap
+	}
+}
+
+// iconMask draws the icon of a badge type into a size by size alpha mask.
+// Shapes are given in fractions of the size.
+func iconMask(icon string, size int) *image.Alpha {
+	s := float32(size)
+	z := vector.NewRasterizer(size, size)
+	polygon := func(pts ...float32) {
+		z.MoveTo(pts[0]*s, pts[1]*s)
+		for i := 2; i < len(pts); i += 2 {
+			z.LineTo(pts[i]*s, pts[i+1]*s)
+		}
+		z.ClosePath()
+	}
+	// circle winds clockwise, or anticlockwise to cut a hole in a clockwise shape.
+	circle := func(cx, cy, r float32, clockwise bool) {
+		const steps = 24
+		for i := 0; i <= steps; i++ {
+			a := 2 * math.Pi * float64(i) / steps
+			if !clockwise {
+				a = -a
+			}
+			x, y := (cx+r*float32(math.Cos(a)))*s, (cy+r*float32(math.Sin(a)))*s
+			if i == 0 {
+				z.MoveTo(x, y)
+			} else {
+				z.LineTo(x, y)
+			}
+		}
+		z.ClosePath()
+	}
+
+	switch icon {
+	case BadgeCamera:
+		polygon(0.12, 0.32, 0.34, 0.32, 0.4, 0.22, 0.6, 0.22, 0.66, 0.32, 0.88, 0.32, 0.88, 0.8, 0.12, 0.8)
+		circle(0.5, 0.56, 0.17, false)
+		circle(0.5, 0.56, 0.09, true)
+	case BadgeVideo:
+		polygon(0.32, 0.2, 0.8, 0.5, 0.32, 0.8)
+	case BadgeFlash:
+		polygon(0.58, 0.1, 0.7, 0.1, 0.56, 0.42, 0.76, 0.42, 0.4, 0.92, 0.48, 0.55, 0.26, 0.55)
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, size, size))
+	z.Draw(mask, mask.Rect, image.Opaque, image.Point{})
+	return mask
+}
@@ -0,0 +1,330 @@
+// bucket.go
+package collage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// bucketSource lists the objects of a cloud storage bucket below a prefix
+// like a folder tree: the first path element below the prefix is the album.
+type bucketSource struct {
+	root   string                                // the input root as given, e.g. s3://bucket/photos
+	prefix string                                // object key prefix, ending in / unless empty
+	list   func(prefix string) ([]string, error) // returns the keys below prefix
+	url    func(key string) (string, error)      // returns the download URL of an object
+	opts   Options
+}
+
+func (s *bucketSource) List() ([]string, []string, error) {
+	keys, err := s.list(s.prefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list %s: %v", s.root, err)
+	}
+	filter, err := newPathFilter(s.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Step 1: Group the images by album, as the local scan does.
+	byAlbum := map[string][]string{}
+	for _, key := range keys {
+		rel := strings.TrimPrefix(key, s.prefix)
+		album, name, ok := strings.Cut(rel, "/")
+		switch {
+		case rel == "" || strings.HasSuffix(rel, "/") || strings.Contains(name, "/"):
+			continue // folder markers and deeper levels, which the local scan does not read either
+		case !ok:
+			s.opts.Skipped.Add(s.root+"/"+rel, SkipOutsideAlbum, "")
+		case path.Ext(name) != "" && !IsImageFile(name):
+			// Objects without an extension are kept and sniffed when downloaded.
+			s.opts.Skipped.Add(s.root+"/"+rel, SkipUnsupported, path.Ext(name))
+		default:
+			if ok, why := filter.allows("", rel); !ok {
+				s.opts.Skipped.Add(s.root+"/"+rel, SkipExcluded, why)
+				continue
+			}
+			byAlbum[album] = append(byAlbum[album], key)
+		}
+	}
+	albums := make([]string, 0, len(byAlbum))
+	for album := range byAlbum {
+		albums = append(albums, album)
+	}
+	sort.Strings(albums)
+
+	// Step 2: Turn the keys into download URLs in album order.
+	var images, folders []string
+	for _, album := range albums {
+		sort.Strings(byAlbum[album])
+		for _, key := range byAlbum[album] {
+			u, err := s.url(key)
+			if err != nil {
+				return nil, nil, err
+			}
+			images = append(images, u)
+		}
+		if len(byAlbum[album]) > 0 {
+			folders = append(folders, ImageFolder(images[len(images)-1]))
+		}
+	}
+	return images, folders, nil
+}
+
+// splitBucketRoot splits scheme://bucket/prefix into the bucket and the key
+// prefix, which ends in / unless empty.
+func splitBucketRoot(root string) (bucket, prefix string, err error) {
+	_, rest, _ := strings.Cut(root, "://")
+	bucket, prefix, _ = strings.Cut(strings.TrimSuffix(rest, "/"), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf("invalid input %s: no bucket name", root)
+	}
+	if prefix != "" {
+		prefix += "/"
+	}
+	return bucket, prefix, nil
+}
+
+// newS3Source opens s3://bucket/prefix. Credentials come from
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN (public
+// buckets need none), the region from AWS_REGION (default us-east-1), and
+// AWS_ENDPOINT_URL selects an S3-compatible service such as MinIO.
+func newS3Source(root string, opts Options) (ImageSource, error) {
+	bucket, prefix, err := splitBucketRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	c := s3Client{
+		region: os.Getenv("AWS_REGION"),
+		key:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		token:  os.Getenv("AWS_SESSION_TOKEN"),
+		d:      opts.downloader(),
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if endpoint := os.Getenv("AWS_ENDPOINT_URL"); endpoint != "" {
+		c.base = strings.TrimSuffix(endpoint, "/") + "/" + bucket // path-style
+	} else {
+		c.base = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, c.region)
+	}
+	return &bucketSource{root: root, prefix: prefix, list: c.list, url: c.objectURL, opts: opts}, nil
+}
+
+// s3Client talks to one S3 bucket, signing requests with AWS Signature
+// Version 4 when it has credentials.
+type s3Client struct {
+	base                       string // bucket URL
+	region, key, secret, token string
+	d                          *Downloader // fetches the listings within the download limits
+}
+
+// list returns the keys below prefix with ListObjectsV2.
+func (c s3Client) list(prefix string) ([]string, error) {
+	var keys []string
+	next := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if next != "" {
+			q.Set("continuation-token", next)
+		}
+		body, err := c.d.get(c.base+"/?"+q.Encode(), func(r *http.Request) { c.sign(r, time.Now()) })
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+		if err := xml.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("unexpected listing: %v", err)
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, obj.Key)
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return keys, nil
+		}
+		next = page.NextContinuationToken
+	}
+}
+
+// objectURL returns the URL of an object, presigned for an hour if the
+// client has credentials.
+func (c s3Client) objectURL(key string) (string, error) {
+	u, err := url.Parse(c.base + "/" + uriEncode(key, false))
+	if err != nil {
+		return "", err
+	}
+	if c.key == "" {
+		return u.String(), nil
+	}
+	now := time.Now().UTC()
+	q := url.Values{
+		"X-Amz-Algorithm":     {"AWS4-HMAC-SHA256"},
+		"X-Amz-Credential":    {c.key + "/" + c.scope(now)},
+		"X-Amz-Date":          {now.Format("20060102T150405Z")},
+		"X-Amz-Expires":       {"3600"},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	if c.token != "" {
+		q.Set("X-Amz-Security-Token", c.token)
+	}
+	u.RawQuery = canonicalQuery(q)
+	sig := c.signature(now, "GET", u, "host:"+u.Host+"\n", "host", "UNSIGNED-PAYLOAD")
+	u.RawQuery += "&X-Amz-Signature=" + sig
+	return u.String(), nil
+}
+
+// sign adds the Authorization header to r; without credentials it does nothing.
+func (c s3Client) sign(r *http.Request, now time.Time) {
+	if c.key == "" {
+		return
+	}
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	headers := "host:" + r.URL.Host + "\nx-amz-content-sha256:UNSIGNED-PAYLOAD\nx-amz-date:" + amzDate + "\n"
+	signed := "host;x-amz-content-sha256;x-amz-date"
+	if c.token != "" {
+		r.Header.Set("X-Amz-Security-Token", c.token)
+		headers += "x-amz-security-token:" + c.token + "\n"
+		signed += ";x-amz-security-token"
+	}
+	r.URL.RawQuery = canonicalQuery(r.URL.Query())
+	sig := c.signature(now, r.Method, r.URL, headers, signed, "UNSIGNED-PAYLOAD")
+	r.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		c.key, c.scope(now), signed, sig))
+}
+
+// scope returns the credential scope of a request made at now.
+func (c s3Client) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + c.region + "/s3/aws4_request"
+}
+
+// signature computes the Signature Version 4 of a request from its canonical
+// parts; u.RawQuery must already be canonical.
+func (c s3Client) signature(now time.Time, method string, u *url.URL, headers, signed, payload string) string {
+	canonical := strings.Join([]string{method, uriEncode(u.Path, false), u.RawQuery, headers, signed, payload}, "\n")
+	sum := sha256.Sum256([]byte(canonical))
+	toSign := "AWS4-HMAC-SHA256\n" + now.Format("20060102T150405Z") + "\n" + c.scope(now) + "\n" + hex.EncodeToString(sum[:])
+	key := []byte("AWS4" + c.secret)
+	for _, part := range []string{now.Format("20060102"), c.region, "s3", "aws4_request", toSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	return hex.EncodeToString(key)
+}
+
+// canonicalQuery encodes q sorted by key as Signature Version 4 requires.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vals := append([]string(nil), q[k]...)
+		sort.Strings(vals)
+		for _, v := range vals {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters and, unless
+// encodeSlash is set, slashes.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case 'A' <= ch && ch <= 'Z', 'a' <= ch && ch <= 'z', '0' <= ch && ch <= '9',
+			ch == '-', ch == '_', ch == '.', ch == '~', ch == '/' && !encodeSlash:
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "%%%02X", ch)
+		}
+	}
+	return b.String()
+}
+
+// newGCSSource opens gs://bucket/prefix through the Cloud Storage JSON API.
+// Private buckets need an OAuth token in GOOGLE_OAUTH_ACCESS_TOKEN (e.g. from
+// `gcloud auth print-access-token`); STORAGE_EMULATOR_HOST selects an emulator.
+func newGCSSource(root string, opts Options) (ImageSource, error) {
+	bucket, prefix, err := splitBucketRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	base := "https://storage.googleapis.com"
+	if host := os.Getenv("STORAGE_EMULATOR_HOST"); host != "" {
+		base = strings.TrimSuffix(host, "/")
+		if !strings.Contains(base, "://") {
+			base = "http://" + base
+		}
+	}
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	sign := func(r *http.Request) {
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+	d := opts.downloader()
+	list := func(prefix string) ([]string, error) {
+		var keys []string
+		next := ""
+		for {
+			q := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+			if next != "" {
+				q.Set("pageToken", next)
+			}
+			body, err := d.get(base+"/storage/v1/b/"+url.PathEscape(bucket)+"/o?"+q.Encode(), sign)
+			if err != nil {
+				return nil, err
+			}
+			var page struct {
+				Items []struct {
+					Name string `json:"name"`
+				} `json:"items"`
+				NextPageToken string `json:"nextPageToken"`
+			}
+			if err := json.Unmarshal(body, &page); err != nil {
+				return nil, fmt.Errorf("unexpected listing: %v", err)
+			}
+			for _, obj := range page.Items {
+				keys = append(keys, obj.Name)
+			}
+			if page.NextPageToken == "" {
+				return keys, nil
+			}
+			next = page.NextPageToken
+		}
+	}
+	objectURL := func(key string) (string, error) {
+		return base + "/storage/v1/b/" + url.PathEscape(bucket) + "/o/" + url.PathEscape(key) + "?alt=media", nil
+	}
+	if u, err := url.Parse(base); err == nil && token != "" {
+		authorizeHost(u.Host, sign)
+	}
+	return &bucketSource{root: root, prefix: prefix, list: list, url: objectURL, opts: opts}, nil
+}
@@ -0,0 +1,51 @@
+// bucket_test.go
+package collage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestBucketList(t *testing.T) {
+	keys := []string{
+		"photos/trip/a.jpg",
+		"photos/trip/IMG_0001", // no extension: sniffed when downloaded
+		"photos/trip/notes.txt",
+		"photos/trip/",
+		"photos/trip/raw/b.jpg",
+		"photos/loose.jpg",
+		"photos/home/c.png",
+	}
+	opts := DefaultOptions()
+	opts.Skipped = &SkipLog{}
+	s := &bucketSource{
+		root:   "gs://album/photos",
+		prefix: "photos/",
+		list:   func(string) ([]string, error) { return keys, nil },
+		url:    func(key string) (string, error) { return "https://cdn.test/" + key, nil },
+		opts:   opts,
+	}
+	images, folders, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantImages := []string{
+		"https://cdn.test/photos/home/c.png",
+		"https://cdn.test/photos/trip/IMG_0001",
+		"https://cdn.test/photos/trip/a.jpg",
+	}
+	if !slices.Equal(images, wantImages) {
+		t.Errorf("images = %v, want %v", images, wantImages)
+	}
+	wantFolders := []string{"https://cdn.test/photos/home", "https://cdn.test/photos/trip"}
+	if !slices.Equal(folders, wantFolders) {
+		t.Errorf("folders = %v, want %v", folders, wantFolders)
+	}
+	wantSkips := []Skip{
+		{Path: "gs://album/photos/trip/notes.txt", Reason: SkipUnsupported, Detail: ".txt"},
+		{Path: "gs://album/photos/loose.jpg", Reason: SkipOutsideAlbum},
+	}
+	if got := opts.Skipped.Entries(); !slices.Equal(got, wantSkips) {
+		t.Errorf("skipped = %v, want %v", got, wantSkips)
+	}
+}
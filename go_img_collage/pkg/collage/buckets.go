@@ -0,0 +1,110 @@
+// buckets.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"math"
+)
+
+// Layout modes (Options.Layout).
+const (
+	LayoutGrid      = "grid"      // square cells on one grid, optionally with -spans blocks and reserved cells
+	LayoutBuckets   = "buckets"   // landscape, square and portrait images in separate grids of matching cells, stacked
+	LayoutSections  = "sections"  // each folder on new rows of the grid below a banner with its name
+	LayoutJustified = "justified" // rows of a common height filling the width, keeping every image's aspect ratio
+	LayoutTreemap   = "treemap"   // rectangles with areas proportional to the images' weights (Options.Weight)
+)
+
+// bucketAspect is the width to height ratio (or its inverse) from which an
+// image counts as landscape (or portrait) in LayoutBuckets.
+const bucketAspect = 1.2
+
+// bucketCellAspect is the aspect ratio of the landscape and (inverted) portrait
+// cells in LayoutBuckets; their short side is the cell size.
+const bucketCellAspect = 1.5
+
+// checkLayout returns an error for an unknown layout mode or options it cannot honour.
+func checkLayout(opts Options) error {
+	switch opts.Layout {
+	case "", LayoutGrid:
+		return nil
+	case LayoutBuckets, LayoutSections, LayoutJustified, LayoutTreemap:
+		if len(opts.Reserved) > 0 || len(opts.TitleCells) > 0 || opts.Spans != SpanNone || opts.ExactGrid != "" {
+			return fmt.Errorf("reserved cells, title cells, -spans and -exact-grid need the grid layout")
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown layout %q: use grid, buckets, sections, justified or treemap", opts.Layout)
+}
+
+// bucketLayout groups the images into landscape, square and portrait buckets
+// and lays each out, in image order, as a grid of cells of matching aspect,
+// stacked top to bottom and centred. The grids are about as wide as a nearly
+// square grid of all the images, or opts.Cols square cells.
+func bucketLayout(paths []string, opts Options) Layout {
+	cell := opts.CellSize
+	long := int(math.Round(float64(cell) * bucketCellAspect))
+	buckets := []struct {
+		size    image.Point
+		members []int
+	}{{size: image.Pt(long, cell)}, {size: image.Pt(cell, cell)}, {size: image.Pt(cell, long)}}
+	for i, s := range imageSizes(paths, opts) {
+		switch {
+		case s.X > 0 && s.Y > 0 && float64(s.X) >= bucketAspect*float64(s.Y):
+			buckets[0].members = append(buckets[0].members, i)
+		case s.X > 0 && s.Y > 0 && float64(s.Y) >= bucketAspect*float64(s.X):
+			buckets[2].members = append(buckets[2].members, i)
+		default:
+			buckets[1].members = append(buckets[1].members, i)
+		}
+	}
+
+	cols := opts.Cols
+	if cols <= 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(len(paths)))))
+	}
+	width := cols*(cell+opts.Gutter) - opts.Gutter
+
+	// Step 1: Lay out each bucket as a grid of its own cells from the top-left corner.
+	type section struct {
+		cells []image.Rectangle
+		size  image.Point
+	}
+	var sections []section
+	maxW := 0
+	for _, b := range buckets {
+		if len(b.members) == 0 {
+			continue
+		}
+		ncols := min(len(b.members), max(1, (width+opts.Gutter)/(b.size.X+opts.Gutter)))
+		nrows := (len(b.members) + ncols - 1) / ncols
+		s := section{size: image.Pt(ncols*(b.size.X+opts.Gutter)-opts.Gutter, nrows*(b.size.Y+opts.Gutter)-opts.Gutter)}
+		for k := range b.members {
+			x, y := k%ncols*(b.size.X+opts.Gutter), k/ncols*(b.size.Y+opts.Gutter)
+			s.cells = append(s.cells, image.Rect(x, y, x+b.size.X, y+b.size.Y))
+		}
+		sections = append(sections, s)
+		maxW = max(maxW, s.size.X)
+	}
+
+	// Step 2: Stack the sections, centred, and hand each image its cell.
+	layout := Layout{Cells: make([]image.Rectangle, len(paths))}
+	y := opts.Margin
+	k := 0
+	for _, b := range buckets {
+		if len(b.members) == 0 {
+			continue
+		}
+		s := sections[k]
+		k++
+		origin := image.Pt(opts.Margin+(maxW-s.size.X)/2, y)
+		for j, i := range b.members {
+			layout.Cells[i] = s.cells[j].Add(origin)
+		}
+		y += s.size.Y + opts.Gutter
+	}
+	layout.Width = maxW + 2*opts.Margin
+	layout.Height = y - opts.Gutter + opts.Margin
+	return layout
+}
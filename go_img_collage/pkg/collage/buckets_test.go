@@ -0,0 +1,27 @@
+// buckets_test.go
+package collage
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestBucketLayout(t *testing.T) {
+	opts := DefaultOptions()
+	opts.CellSize, opts.Cols = 100, 2
+	paths := writeTestImages(t, image.Pt(200, 100), image.Pt(100, 100), image.Pt(100, 200), image.Pt(300, 100))
+	l := bucketLayout(paths, opts)
+	want := []image.Rectangle{
+		image.Rect(0, 0, 150, 100),    // landscape bucket, one 150x100 cell a row
+		image.Rect(25, 200, 125, 300), // square bucket, centred
+		image.Rect(25, 300, 125, 450), // portrait bucket
+		image.Rect(0, 100, 150, 200),
+	}
+	if l.Width != 150 || l.Height != 450 {
+		t.Errorf("bucketLayout() is %dx%d, want 150x450", l.Width, l.Height)
+	}
+	if !reflect.DeepEqual(l.Cells, want) {
+		t.Errorf("bucketLayout() cells = %v, want %v", l.Cells, want)
+	}
+}
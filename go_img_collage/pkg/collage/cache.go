@@ -0,0 +1,119 @@
+// cache.go
+package collage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+)
+
+// tileMeta is stored beside each cached tile: what loadResized learned about
+// the source image besides its pixels.
+type tileMeta struct {
+	EXIF     []byte     `json:"exif,omitempty"` // EXIF TIFF structure of the source
+	Motion   bool       `json:"motion,omitempty"`
+	Analyzed int        `json:"analyzed,omitempty"` // statsVersion of Stats; 0 if not analysed
+	Stats    imageStats `json:"stats"`
+}
+
+// statsVersion is bumped when imageStats gains measures, so cached tiles
+// analysed before then are analysed again.
+const statsVersion = 2
+
+// tileKey returns the cache key of the tile of the image at path for a cell of
+// cellW by cellH: a hash of the path, its modification time and size, the cell
+// size and the options that change the tile. It returns "" if path cannot be read.
+func tileKey(path string, cellW, cellH int, opts Options) string {
+	info, err := os.Stat(path)
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%d\n%dx%d\n%s\n%d\n%t\n%s\n%s\n", abs, info.ModTime().UnixNano(), info.Size(), cellW, cellH, opts.Fit, opts.Frame, opts.NoEXIFRotate, opts.Filter, opts.Backend)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// tilePath returns the path of a cached tile file; tiles are spread over 256
+// subdirectories by the first byte of their key.
+func tilePath(dir, key, ext string) string {
+	return filepath.Join(dir, key[:2], key+ext)
+}
+
+// loadTile returns the cached tile for key and fills info from its metadata.
+// It misses if the tile is absent or damaged, or info needs statistics the
+// cache does not hold.
+func loadTile(dir, key string, info *imageInfo) (*image.RGBA, bool) {
+	data, err := os.ReadFile(tilePath(dir, key, ".json"))
+	if err != nil {
+		return nil, false
+	}
+	var meta tileMeta
+	if json.Unmarshal(data, &meta) != nil || (info != nil && info.analyze && meta.Analyzed != statsVersion) {
+		return nil, false
+	}
+	f, err := os.Open(tilePath(dir, key, ".png"))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	img, err := png.Decode(f)
+	if err != nil {
+		return nil, false
+	}
+	tile, ok := img.(*image.RGBA)
+	if !ok {
+		tile = image.NewRGBA(img.Bounds())
+		draw.Draw(tile, tile.Rect, img, img.Bounds().Min, draw.Src)
+	}
+	if info != nil {
+		info.exif = parseTIFF(meta.EXIF)
+		info.motion = meta.Motion
+		if info.analyze {
+			info.stats = meta.Stats
+		}
+	}
+	return tile, true
+}
+
+// storeTile saves a tile and its metadata under key. Files are written to a
+// temporary name and renamed, so concurrent runs never see partial tiles.
+// Failures only cost the next run a cache miss, so they are not reported.
+func storeTile(dir, key string, tile *image.RGBA, meta tileMeta) {
+	if os.MkdirAll(filepath.Dir(tilePath(dir, key, "")), 0o755) != nil {
+		return
+	}
+	write := func(ext string, encode func(f *os.File) error) bool {
+		f, err := os.CreateTemp(filepath.Dir(tilePath(dir, key, "")), "tile-*.tmp")
+		if err != nil {
+			return false
+		}
+		err = encode(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			err = os.Rename(f.Name(), tilePath(dir, key, ext))
+		}
+		if err != nil {
+			os.Remove(f.Name())
+			return false
+		}
+		return true
+	}
+	// The tile goes first: a metadata file marks a complete entry.
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if !write(".png", func(f *os.File) error { return enc.Encode(f, tile) }) {
+		return
+	}
+	write(".json", func(f *os.File) error { return json.NewEncoder(f).Encode(meta) })
+}
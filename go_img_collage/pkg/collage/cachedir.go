@@ -0,0 +1,110 @@
+// cachedir.go
+package collage
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cacheEntry is one cached item, such as a tile (.png and .json) or a download
+// (.data and .json): the files in a cache directory sharing a key.
+type cacheEntry struct {
+	files []string
+	size  int64
+	used  time.Time // latest modification time of its files
+}
+
+// isCacheKey reports whether name is a cache key: 64 hex digits.
+func isCacheKey(name string) bool {
+	_, err := hex.DecodeString(name)
+	return len(name) == 64 && err == nil
+}
+
+// cacheEntries lists the entries of the tile or download cache in dir, oldest
+// first. Files that do not look like cache entries are left out, so a cache
+// pointed at the wrong directory is never emptied.
+func cacheEntries(dir string) ([]*cacheEntry, error) {
+	subdirs, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byKey := map[string]*cacheEntry{}
+	for _, sub := range subdirs {
+		if !sub.IsDir() || len(sub.Name()) != 2 {
+			continue
+		}
+		files, err := os.ReadDir(filepath.Join(dir, sub.Name()))
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			key, _, _ := strings.Cut(f.Name(), ".")
+			info, err := f.Info()
+			if err != nil || f.IsDir() || !isCacheKey(key) {
+				continue
+			}
+			e := byKey[key]
+			if e == nil {
+				e = &cacheEntry{}
+				byKey[key] = e
+			}
+			e.files = append(e.files, filepath.Join(dir, sub.Name(), f.Name()))
+			e.size += info.Size()
+			if info.ModTime().After(e.used) {
+				e.used = info.ModTime()
+			}
+		}
+	}
+	entries := make([]*cacheEntry, 0, len(byKey))
+	for _, e := range byKey {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].used.Before(entries[j].used) })
+	return entries, nil
+}
+
+// CacheStats returns the number of entries in the tile or download cache in
+// dir, their total size in bytes and the age of the oldest.
+func CacheStats(dir string) (entries int, bytes int64, oldest time.Time, err error) {
+	list, err := cacheEntries(dir)
+	if err != nil {
+		return 0, 0, time.Time{}, err
+	}
+	for _, e := range list {
+		bytes += e.size
+	}
+	if len(list) > 0 {
+		oldest = list[0].used
+	}
+	return len(list), bytes, oldest, nil
+}
+
+// PruneCache removes the least recently written entries of the tile or
+// download cache in dir until it holds at most maxBytes, and returns how many
+// entries and bytes it removed. maxBytes 0 empties the cache.
+func PruneCache(dir string, maxBytes int64) (removed int, freed int64, err error) {
+	list, err := cacheEntries(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var total int64
+	for _, e := range list {
+		total += e.size
+	}
+	for _, e := range list {
+		if total <= maxBytes {
+			break
+		}
+		for _, f := range e.files {
+			os.Remove(f)
+		}
+		total -= e.size
+		freed += e.size
+		removed++
+	}
+	return removed, freed, nil
+}
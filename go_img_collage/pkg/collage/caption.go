@@ -0,0 +1,208 @@
+// caption.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"path/filepath"
+)
+
+// Caption contents (Options.Caption).
+const (
+	CaptionFilename = "filename" // the file name without its extension
+	CaptionIndex    = "index"    // the 0-based cell index, as used by `collage edit --swap`
+	CaptionTime     = "time"     // the time in the video of a frame (see VideoFrames) and its subtitle (see Options.Subtitles), else the file name
+	CaptionText     = "text"     // the start of the text read from the image (see Options.Texts), else the file name
+)
+
+// Caption styles (Options.CaptionStyle) that keep captions legible over busy images.
+const (
+	CaptionPlain   = "plain"   // text only
+	CaptionOutline = "outline" // text with a dark outline
+	CaptionBox     = "box"     // text on a semi-transparent band along the bottom of the image
+)
+
+// Caption text colours (Options.CaptionColor); any other CSS colour (see
+// parseColor) is also accepted.
+const (
+	CaptionAuto  = "auto" // black or white, whichever contrasts more with the image under the text
+	CaptionWhite = "white"
+	CaptionBlack = "black"
+)
+
+// Caption colours; the box is 60% black (premultiplied).
+var (
+	captionWhite    = color.RGBA{255, 255, 255, 255}
+	captionBlack    = color.RGBA{0, 0, 0, 255}
+	captionBoxColor = color.RGBA{0, 0, 0, 153}
+)
+
+// checkCaption returns an error for an unknown caption mode or style.
+func checkCaption(opts Options) error {
+	switch opts.Caption {
+	case "", CaptionFilename, CaptionIndex, CaptionTime, CaptionText:
+	default:
+		return fmt.Errorf("unknown caption %q: use filename, index, time or text", opts.Caption)
+	}
+	switch opts.CaptionStyle {
+	case CaptionPlain, CaptionOutline, CaptionBox:
+	default:
+		return fmt.Errorf("unknown caption style %q: use plain, outline or box", opts.CaptionStyle)
+	}
+	if opts.CaptionColor != CaptionAuto {
+		if _, err := parseColor(opts.CaptionColor); err != nil {
+			return fmt.Errorf("unknown caption color %q: use auto or a CSS colour", opts.CaptionColor)
+		}
+	}
+	return nil
+}
+
+// captionText returns the caption for the image at path in cell idx: for
+// CaptionTime, the time of a video frame (see Options.FrameTimes) followed by
+// the subtitle nearest to it, if any, and for CaptionText the start of the
+// text read from it.
+func captionText(mode, path string, idx int, opts Options) string {
+	switch mode {
+	case CaptionIndex:
+		return fmt.Sprint(idx)
+	case CaptionTime:
+		if at, ok := opts.FrameTimes[path]; ok {
+			if sub := nearestSubtitle(opts.Subtitles, at); sub != "" {
+				return formatTimestamp(at) + "  " + sub
+			}
+			return formatTimestamp(at)
+		}
+	case CaptionText:
+		if text, ok := opts.Texts[path]; ok {
+			return snippet(text)
+		}
+	}
+	return trimImageExt(filepath.Base(path))
+}
+
+// drawCaption draws text along the bottom of the image pasted at rect on dst,
+// in opts.CaptionStyle. The text is opts.FontSize pixels high, or a twelfth of
+// the image's larger side if that is 0, and shrunk if needed to fit the image width.
+func drawCaption(dst *image.RGBA, rect image.Rectangle, text string, fonts *fontSet, opts Options) {
+	size := opts.FontSize
+	if size <= 0 {
+		size = math.Max(8, float64(max(rect.Dx(), rect.Dy()))/12)
+	}
+	pad := math.Max(1, math.Round(size*0.3))
+
+	// Subtitles are sentences: wrap them at the image width rather than
+	// shrinking them to fit on one line.
+	width := math.MaxInt32
+	if len(opts.Subtitles) > 0 {
+		width = int((float64(rect.Dx()) - 2*pad) * measureSize / size)
+	}
+	lines := shapeText(text, fonts).wrap(width)
+	w, h := linesSize(lines)
+	if w == 0 || h == 0 {
+		return
+	}
+	scale := size / measureSize
+	if avail := float64(rect.Dx()) - 2*pad; float64(w)*scale > avail {
+		scale = math.Max(avail, 1) / float64(w)
+	}
+
+	band := image.Rect(rect.Min.X, rect.Max.Y-int(math.Ceil(float64(h)*scale+2*pad)), rect.Max.X, rect.Max.Y).Intersect(rect)
+	mask := textMask(band.Size(), lines, scale)
+
+	// Pick the text colour; the outline and box take black or white,
+	// whichever contrasts more with it.
+	var fg color.Color = captionWhite
+	darkText := false
+	switch {
+	case opts.CaptionColor != CaptionAuto:
+		c, _ := parseColor(opts.CaptionColor) // checked by checkCaption
+		fg, darkText = c, isDark(c)
+	case opts.CaptionStyle != CaptionBox && prefersBlackText(dst, band, mask):
+		fg, darkText = captionBlack, true
+	}
+	outline := captionBlack
+	if darkText {
+		outline = captionWhite
+	}
+
+	switch opts.CaptionStyle {
+	case CaptionBox:
+		box := captionBoxColor
+		if darkText {
+			box = color.RGBA{153, 153, 153, 153} // 60% white
+		}
+		draw.Draw(dst, band, &image.Uniform{box}, image.Point{}, draw.Over)
+	case CaptionOutline:
+		halo := dilate(mask, max(1, int(size/12)))
+		draw.DrawMask(dst, band, &image.Uniform{outline}, image.Point{}, halo, image.Point{}, draw.Over)
+	}
+	draw.DrawMask(dst, band, &image.Uniform{fg}, image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// prefersBlackText samples the pixels of dst under the text mask drawn at r and
+// reports whether black text contrasts more with them than white, using the
+// WCAG contrast ratio of their mean relative luminance.
+func prefersBlackText(dst *image.RGBA, r image.Rectangle, mask *image.Alpha) bool {
+	var sum, weight float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			a := float64(mask.AlphaAt(x-r.Min.X, y-r.Min.Y).A)
+			if a == 0 {
+				continue
+			}
+			i := dst.PixOffset(x, y)
+			// The canvas colour channels already hold the image over white.
+			p := dst.Pix[i : i+3 : i+3]
+			lum := 0.2126*srgbToLinear(float64(p[0])/255) + 0.7152*srgbToLinear(float64(p[1])/255) + 0.0722*srgbToLinear(float64(p[2])/255)
+			sum += lum * a
+			weight += a
+		}
+	}
+	if weight == 0 {
+		return false
+	}
+	lum := sum / weight
+	// Contrast against black is (L+0.05)/0.05, against white 1.05/(L+0.05).
+	return (lum+0.05)/0.05 > 1.05/(lum+0.05)
+}
+
+// dilate grows the opaque areas of mask by radius pixels in every direction.
+func dilate(mask *image.Alpha, radius int) *image.Alpha {
+	b := mask.Rect
+	tmp := image.NewAlpha(b)
+	out := image.NewAlpha(b)
+	// Separable maximum filter: rows, then columns.
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var m uint8
+			for dx := -radius; dx <= radius; dx++ {
+				if xx := x + dx; xx >= b.Min.X && xx < b.Max.X {
+					m = maxUint8(m, mask.AlphaAt(xx, y).A)
+				}
+			}
+			tmp.SetAlpha(x, y, color.Alpha{m})
+		}
+	}
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			var m uint8
+			for dy := -radius; dy <= radius; dy++ {
+				if yy := y + dy; yy >= b.Min.Y && yy < b.Max.Y {
+					m = maxUint8(m, tmp.AlphaAt(x, yy).A)
+				}
+			}
+			out.SetAlpha(x, y, color.Alpha{m})
+		}
+	}
+	return out
+}
+
+func maxUint8(a, b uint8) uint8 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,70 @@
+// carousel.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// DefaultSlideSize is the side in pixels of a carousel slide when
+// Options.SlideSize is not set, the square post size of most platforms.
+const DefaultSlideSize = 1080
+
+// SlicePath returns the path of slide i (1-based) of the output at path:
+// collage.jpg becomes collage_s1.jpg, collage_s2.jpg, ...
+func SlicePath(path string, i int) string {
+	return numberedPath(path, "s", i)
+}
+
+// createCarousel renders the images as one panorama opts.Carousel slides wide
+// and cuts it into that many square slides for a swipeable multi-image post.
+// The panorama is written to opts.OutputPath and slide i beside it as
+// SlicePath(opts.OutputPath, i). Cells run across the cuts, so a picture
+// leaving one slide continues on the next.
+func createCarousel(opts Options) error {
+	if opts.Hierarchical || opts.Target != "" || opts.Update || opts.PerPage > 0 || opts.Size != "" {
+		return fmt.Errorf("carousels cannot be combined with hierarchical, mosaic, updated, paged or sized collages")
+	}
+	if opts.Bleed > 0 || opts.CropMarks {
+		return fmt.Errorf("carousels cannot have bleed or crop marks")
+	}
+	if opts.ManifestPath != "" || opts.HTMLPath != "" || opts.OccupancyPath != "" || opts.MattePath != "" {
+		return fmt.Errorf("carousels cannot write manifests, image maps, occupancy masks or mattes")
+	}
+	if err := checkOutput(opts); err != nil {
+		return err
+	}
+	side := opts.SlideSize
+	if side == 0 {
+		side = DefaultSlideSize
+	}
+	if side < 0 {
+		return fmt.Errorf("invalid slide size %d", side)
+	}
+
+	// Step 1: Render the panorama at the size of the slides side by side.
+	sub := opts
+	sub.Carousel, sub.StateFile = 0, ""
+	sub.Size = fmt.Sprintf("%dx%d", opts.Carousel*side, side)
+	panorama, err := build(sub)
+	if err != nil {
+		return err
+	}
+	if err := writeOutput(panorama, sub); err != nil {
+		return fmt.Errorf("%w: %w", ErrEncode, err)
+	}
+
+	// Step 2: Cut it into the slides.
+	for i := 1; i <= opts.Carousel; i++ {
+		slide := sub
+		slide.OutputPath = SlicePath(opts.OutputPath, i)
+		img := image.NewRGBA(image.Rect(0, 0, side, side))
+		draw.Draw(img, img.Rect, panorama, image.Pt((i-1)*side, 0), draw.Src)
+		if err := writeOutput(img, slide); err != nil {
+			return fmt.Errorf("%w: slide %d: %w", ErrEncode, i, err)
+		}
+	}
+	opts.logger().Printf("Wrote %d slides of %dx%d beside %s\n", opts.Carousel, side, side, opts.OutputPath)
+	return nil
+}
@@ -0,0 +1,38 @@
+// cleanup.go
+package collage
+
+import "sync"
+
+var (
+	cleanupMu    sync.Mutex
+	cleanupFuncs = map[int]func(){}
+	cleanupNext  int
+)
+
+// onInterrupt registers f to run if the process is interrupted and returns a
+// function that unregisters it once the resource is safely released.
+func onInterrupt(f func()) (unregister func()) {
+	cleanupMu.Lock()
+	defer cleanupMu.Unlock()
+	id := cleanupNext
+	cleanupNext++
+	cleanupFuncs[id] = f
+	return func() {
+		cleanupMu.Lock()
+		defer cleanupMu.Unlock()
+		delete(cleanupFuncs, id)
+	}
+}
+
+// Cleanup removes the temp canvas and partial outputs of renders still in
+// progress, newest first. It is meant to be called from a SIGINT/SIGTERM
+// handler right before the process exits, and leaves the registry locked so
+// no render can release (or reuse) those resources concurrently.
+func Cleanup() {
+	cleanupMu.Lock()
+	for id := cleanupNext - 1; id >= 0; id-- {
+		if f, ok := cleanupFuncs[id]; ok {
+			f()
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// cmyk.go
+package collage
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isCMYKOutput reports whether path names a print format written as CMYK.
+func isCMYKOutput(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".tif", ".tiff", ".pdf":
+		return true
+	}
+	return false
+}
+
+// writeCMYK converts img to CMYK and writes it as a TIFF or PDF depending on the
+// extension of path. Transparent areas are composited over white paper first.
+//
+// When iccPath is set, the colours are separated through that CMYK output
+// profile, which is embedded in the output (TIFF InterColorProfile tag, PDF
+// ICCBased colour space and output intent) so the RIP knows the press condition
+// they were made for. Without one, the simple device formula from image/color
+// is used and the output is untagged DeviceCMYK.
+//
+// The profile is opts.ICCProfile and the resolution opts.DPI; writing stops
+// once opts.Context is cancelled.
+func writeCMYK(path string, img image.Image, opts Options) error {
+	var icc *iccProfile
+	if opts.ICCProfile != "" {
+		var err error
+		if icc, err = loadICCProfile(opts.ICCProfile); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer f.Close()
+
+	if strings.ToLower(filepath.Ext(path)) == ".pdf" {
+		err = writeCMYKPDF(f, img, icc, opts)
+	} else {
+		err = writeCMYKTIFF(f, img, icc, opts)
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// cmykRow converts row y of img to interleaved 8-bit CMYK samples in buf,
+// through icc if not nil.
+func cmykRow(img image.Image, y int, buf []byte, icc *iccProfile) {
+	b := img.Bounds()
+	rgba, isRGBA := img.(*image.RGBA)
+	for x := b.Min.X; x < b.Max.X; x++ {
+		var r, g, bl, a uint8
+		if isRGBA {
+			i := rgba.PixOffset(x, y)
+			r, g, bl, a = rgba.Pix[i], rgba.Pix[i+1], rgba.Pix[i+2], rgba.Pix[i+3]
+		} else {
+			c := color.RGBAModel.Convert(img.At(x, y)).(color.RGBA)
+			r, g, bl, a = c.R, c.G, c.B, c.A
+		}
+		// Premultiplied colour over white paper.
+		paper := 255 - a
+		var c, m, yy, k uint8
+		if icc != nil {
+			c, m, yy, k = icc.separate(r+paper, g+paper, bl+paper)
+		} else {
+			c, m, yy, k = color.RGBToCMYK(r+paper, g+paper, bl+paper)
+		}
+		o := (x - b.Min.X) * 4
+		buf[o], buf[o+1], buf[o+2], buf[o+3] = c, m, yy, k
+	}
+}
+
+// tiffRowsPerStrip is the number of rows compressed together in each TIFF strip.
+const tiffRowsPerStrip = 64
+
+// tiffEntry is a single IFD entry; values longer than four bytes are stored out of line.
+type tiffEntry struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+// writeCMYKTIFF writes img as a Deflate-compressed, 8-bit separated (CMYK) TIFF.
+// Strips are written first and the IFD last, so the image is streamed row by row.
+// Strips are independent, so up to opts.EncodeWorkers of them are converted and
+// compressed in parallel while finished ones are written out in order.
+func writeCMYKTIFF(f *os.File, img image.Image, icc *iccProfile, opts Options) error {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	out := cancelWriter{f, opts}
+
+	// Header; the IFD offset at byte 4 is patched once the strips are written.
+	if _, err := out.Write([]byte{'I', 'I', 42, 0, 0, 0, 0, 0}); err != nil {
+		return err
+	}
+	offset := int64(8)
+
+	// Compress strips concurrently; the semaphore bounds the strips held in memory.
+	nStrips := (h + tiffRowsPerStrip - 1) / tiffRowsPerStrip
+	results := make([]chan []byte, nStrips)
+	for i := range results {
+		results[i] = make(chan []byte, 1)
+	}
+	sem := make(chan struct{}, max(1, opts.EncodeWorkers))
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := 0; i < nStrips; i++ {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int) {
+				results[i] <- compressCMYKStrip(img, b.Min.Y+i*tiffRowsPerStrip, min(tiffRowsPerStrip, h-i*tiffRowsPerStrip), icc)
+			}(i)
+		}
+	}()
+
+	var stripOffsets, stripCounts []uint32
+	for i := 0; i < nStrips; i++ {
+		strip := <-results[i]
+		<-sem
+		if offset+int64(len(strip)) > 1<<32-1 {
+			return fmt.Errorf("CMYK TIFF exceeds the 4 GiB classic TIFF limit")
+		}
+		if _, err := out.Write(strip); err != nil {
+			return err
+		}
+		stripOffsets = append(stripOffsets, uint32(offset))
+		stripCounts = append(stripCounts, uint32(len(strip)))
+		offset += int64(len(strip))
+	}
+
+	var profile []byte
+	if icc != nil {
+		profile = icc.data
+	}
+	return writeTIFFIFD(f, offset, w, h, stripOffsets, stripCounts, profile, opts.DPI)
+}
+
+// writeTIFFIFD finishes a CMYK TIFF whose strips end at offset: it writes the
+// IFD describing them and patches the IFD offset in the header.
+func writeTIFFIFD(f *os.File, offset int64, w, h int, stripOffsets, stripCounts []uint32, icc []byte, dpi int) error {
+	le := binary.LittleEndian
+	short := func(vs ...uint16) []byte {
+		out := make([]byte, 2*len(vs))
+		for i, v := range vs {
+			le.PutUint16(out[2*i:], v)
+		}
+		return out
+	}
+	long := func(vs ...uint32) []byte {
+		out := make([]byte, 4*len(vs))
+		for i, v := range vs {
+			le.PutUint32(out[4*i:], v)
+		}
+		return out
+	}
+	const tShort, tLong, tRational, tUndefined = 3, 4, 5, 7
+	entries := []tiffEntry{
+		{256, tLong, 1, long(uint32(w))},
+		{257, tLong, 1, long(uint32(h))},
+		{258, tShort, 4, short(8, 8, 8, 8)},
+		{259, tShort, 1, short(8)}, // Adobe Deflate
+		{262, tShort, 1, short(5)}, // Separated
+		{273, tLong, uint32(len(stripOffsets)), long(stripOffsets...)},
+		{277, tShort, 1, short(4)},
+		{278, tLong, 1, long(tiffRowsPerStrip)},
+		{279, tLong, uint32(len(stripCounts)), long(stripCounts...)},
+		{282, tRational, 1, long(uint32(dpi), 1)},
+		{283, tRational, 1, long(uint32(dpi), 1)},
+		{284, tShort, 1, short(1)}, // Chunky
+		{296, tShort, 1, short(2)}, // Inch
+		{332, tShort, 1, short(1)}, // InkSet CMYK
+	}
+	if len(icc) > 0 {
+		entries = append(entries, tiffEntry{34675, tUndefined, uint32(len(icc)), icc})
+	}
+
+	// Lay out the IFD followed by the out-of-line values.
+	if offset%2 == 1 {
+		if _, err := f.Write([]byte{0}); err != nil {
+			return err
+		}
+		offset++
+	}
+	ifdOffset := offset
+	dataOffset := ifdOffset + 2 + int64(len(entries))*12 + 4
+	var ifd, data []byte
+	ifd = le.AppendUint16(ifd, uint16(len(entries)))
+	for _, e := range entries {
+		ifd = le.AppendUint16(ifd, e.tag)
+		ifd = le.AppendUint16(ifd, e.typ)
+		ifd = le.AppendUint32(ifd, e.count)
+		if len(e.value) <= 4 {
+			ifd = append(ifd, e.value...)
+			ifd = append(ifd, make([]byte, 4-len(e.value))...)
+			continue
+		}
+		ifd = le.AppendUint32(ifd, uint32(dataOffset+int64(len(data))))
+		data = append(data, e.value...)
+		if len(data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	ifd = le.AppendUint32(ifd, 0) // no further IFDs
+	if _, err := f.Write(append(ifd, data...)); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(4, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(f, le, uint32(ifdOffset))
+}
+
+// compressCMYKStrip converts rows [y, y+rows) of img to CMYK through icc and
+// returns them zlib-compressed.
+func compressCMYKStrip(img image.Image, y, rows int, icc *iccProfile) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	row := make([]byte, img.Bounds().Dx()*4)
+	for yy := y; yy < y+rows; yy++ {
+		cmykRow(img, yy, row, icc)
+		zw.Write(row) // writes to a bytes.Buffer cannot fail
+	}
+	zw.Close()
+	return buf.Bytes()
+}
+
+// writeCMYKPDF writes img as a single-page PDF whose page size matches the image at opts.DPI.
+// The image is a Flate-compressed DeviceCMYK (or ICCBased) XObject streamed row by row.
+func writeCMYKPDF(f *os.File, img image.Image, icc *iccProfile, opts Options) error {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	pageW := float64(w) / float64(opts.DPI) * 72
+	pageH := float64(h) / float64(opts.DPI) * 72
+
+	bw := bufio.NewWriter(cancelWriter{f, opts})
+	out := &countingWriter{w: bw}
+	var xref []int64
+	beginObj := func() int {
+		xref = append(xref, out.n)
+		fmt.Fprintf(out, "%d 0 obj\n", len(xref))
+		return len(xref)
+	}
+
+	fmt.Fprintf(out, "%%PDF-1.6\n%%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-4 are fixed so the catalog can reference them up front.
+	colorSpace := "/DeviceCMYK"
+	intents := ""
+	if icc != nil {
+		colorSpace = "[/ICCBased 6 0 R]"
+		intents = fmt.Sprintf(" /OutputIntents [<< /Type /OutputIntent /S /GTS_PDFX /OutputConditionIdentifier %s /DestOutputProfile 6 0 R >>]", pdfString(icc.name))
+	}
+	beginObj()
+	fmt.Fprintf(out, "<< /Type /Catalog /Pages 2 0 R%s >>\nendobj\n", intents)
+	beginObj()
+	fmt.Fprintf(out, "<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n")
+	beginObj()
+	fmt.Fprintf(out, "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /XObject << /Im0 4 0 R >> >> /Contents 5 0 R >>\nendobj\n", pageW, pageH)
+
+	// Image XObject; its compressed length is written as object 7 afterwards.
+	beginObj()
+	fmt.Fprintf(out, "<< /Type /XObject /Subtype /Image /Width %d /Height %d /ColorSpace %s /BitsPerComponent 8 /Filter /FlateDecode /Length 7 0 R >>\nstream\n", w, h, colorSpace)
+	start := out.n
+	zw := zlib.NewWriter(out)
+	row := make([]byte, w*4)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		cmykRow(img, y, row, icc)
+		if _, err := zw.Write(row); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	imageLen := out.n - start
+	fmt.Fprintf(out, "\nendstream\nendobj\n")
+
+	content := fmt.Sprintf("q %.2f 0 0 %.2f 0 0 cm /Im0 Do Q", pageW, pageH)
+	beginObj()
+	fmt.Fprintf(out, "<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content)
+
+	beginObj()
+	if icc != nil {
+		fmt.Fprintf(out, "<< /N 4 /Alternate /DeviceCMYK /Length %d >>\nstream\n", len(icc.data))
+		out.Write(icc.data)
+		fmt.Fprintf(out, "\nendstream\nendobj\n")
+	} else {
+		fmt.Fprintf(out, "null\nendobj\n")
+	}
+
+	beginObj()
+	fmt.Fprintf(out, "%d\nendobj\n", imageLen)
+
+	xrefOffset := out.n
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(xref)+1)
+	for _, off := range xref {
+		fmt.Fprintf(out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(xref)+1, xrefOffset)
+	if out.err != nil {
+		return out.err
+	}
+	return bw.Flush()
+}
+
+// pdfString returns s as a PDF literal string.
+func pdfString(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`, "\n", `\n`)
+	return "(" + r.Replace(s) + ")"
+}
+
+// countingWriter counts the bytes written through it and remembers the first error.
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	if err != nil && c.err == nil {
+		c.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,452 @@
+// collage.go
+
+// Package collage builds image collages: it gathers images from sorted
+// subfolders, lays them out in a grid of cells, renders them onto a canvas and
+// writes the result together with optional print and report outputs.
+//
+// The collage command is a thin wrapper around this package; other programs can
+// call Build to get the collage as an image, or Create to render and write it
+// exactly as the command does.
+package collage
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"runtime"
+	"time"
+)
+
+// Options controls how a collage is laid out, rendered and written.
+type Options struct {
+	InputDir    string   // root directory whose subfolders are scanned when Images is empty
+	InputDirs   []string // further roots scanned after InputDir; identical images are included once
+	Images      []string // image paths in cell order; overrides InputDir
+	CellSize    int      // size in pixels of each square cell
+	Fit         string   // how images fill their cells: FitContain, FitCover or FitStretch
+	Filter      string   // resampling filter: FilterAuto, FilterNearest, FilterBilinear, FilterCatmullRom or FilterBox
+	Backend     string   // image decoding and scaling backend: BackendGo or BackendVips
+	Cols, Rows  int      // grid dimensions in cells; 0 chooses a nearly square grid
+	Sort        string   // image order: SortName, SortBrightness, SortTemperature, SortColor, SortEXIFDate, SortMTime, SortSize or SortRoundRobin
+	Reverse     bool     // reverse the Sort order
+	Shuffle     bool     // random order by Seed instead of Sort
+	Variants    int      // render this many variations with successive seeds (see createVariants); 0 or 1 renders one
+	PerPage     int      // split the images into collages of at most this many (see createPages); 0 renders one
+	Carousel    int      // cut a panorama of the images into this many square slides (see createCarousel); 0 renders one
+	SlideSize   int      // side in pixels of a carousel slide; 0 uses DefaultSlideSize
+	Compare     []string // layout configurations ("layout=justified,gutter=4") previewed side by side instead of the collage
+	Gutter      int      // space in pixels between neighbouring cells
+	Margin      int      // space in pixels around the grid
+	Size        string   // output size "WxH" in pixels or a screen name (see ParseSize) the layout is stretched to fill; empty keeps its own size
+	Layout      string   // cell arrangement: LayoutGrid, LayoutBuckets, LayoutSections, LayoutJustified or LayoutTreemap
+	Weight      string   // treemap tile weight: WeightSize or WeightResolution
+	WeightsFile string   // file of "weight path" lines giving the treemap weights; overrides Weight
+	ExactGrid   string   // "RxC" grid of R rows by C columns the images must fill exactly; empty disables
+	Spans       string   // images taking blocks of several cells: SpanNone, SpanAspect or SpanResolution
+	Pack        string   // placement of the cell blocks: PackOrder or PackLargest
+	PackEffort  int      // column counts tried when packing, keeping the grid with the fewest holes; more is slower
+	Background  string   // canvas colour: "transparent" or any CSS colour (see parseColor)
+	OutputPath  string   // collage output file (used by Create)
+
+	ManifestPath  string // JSON file listing the cell index, pixel rectangle and source path of every image; empty disables
+	HTMLPath      string // HTML page showing the collage with each cell linked to its image; empty disables
+	LinkTemplate  string // link of each cell in HTMLPath, with {path}, {name} and {index} replaced; empty links the file
+	HTMLDark      bool   // give HTMLPath a dark stylesheet used when the reader prefers dark mode
+	SiteDir       string // directory CreateSite writes a static gallery site to
+	SiteTemplates string // directory of page templates replacing those of CreateSite; empty uses the defaults
+	HTMLThumbs    []int  // thumbnail sizes in pixels shown, lazily loaded with srcset, in the image list of HTMLPath; empty disables
+	OccupancyPath string // PNG (one pixel per grid cell) or .json mask of which grid cells hold images; empty disables
+
+	JitterRotation float64 // tilt each image by a random angle of up to this many degrees; 0 disables
+	Inset          int     // shrink each image this many pixels inside its cell on every side
+	InsetJitter    int     // add a random extra inset of up to this many pixels per cell
+	Seed           int64   // seed of the random jitter and Shuffle order, so runs are reproducible
+
+	WebPLossless   bool  // encode .webp output losslessly; otherwise lossy at Quality
+	Quality        int   // 1-100 quality of lossy WebP, JPEG and AVIF output
+	TargetFileSize int64 // largest lossy output file in bytes, reached by lowering the quality below Quality; 0 disables
+
+	Reserved   []Reservation // blocks of cells kept free of images
+	TitleCells []TitleCell   // text blocks rendered in their own reserved cells
+
+	// Text.
+	Font     string  // TrueType/OpenType font (.ttf, .otf, .ttc) for all text; empty uses the built-in Go font
+	FontSize float64 // text size in pixels; 0 sizes each text feature automatically
+
+	Caption      string     // caption drawn on each image: CaptionFilename, CaptionIndex, CaptionTime, CaptionText or empty for none
+	CaptionStyle string     // CaptionPlain, CaptionOutline or CaptionBox
+	CaptionColor string     // CaptionAuto or a CSS colour, e.g. CaptionWhite
+	Subtitles    []Subtitle // subtitle cues added to CaptionTime captions (see ReadSubtitles)
+
+	Badges []string // metadata badges drawn on each image: BadgeCamera, BadgeVideo, BadgeRaw, BadgeFlash
+
+	Hierarchical bool // build a collage per folder and lay those out, captioned by folder name, as the collage
+
+	Target        string // image reproduced as a photo mosaic of the images; empty disables
+	MosaicRepeats int    // times each image may appear in the mosaic; 0 is unlimited
+
+	// Per-folder output (CreatePerFolder).
+	OutputDir   string // root the input tree is mirrored under, one collage per folder
+	Format      string // output format extension of the per-folder collages, e.g. "webp"
+	Recursive   bool   // a collage for every folder of the tree, not only the subfolders of InputDir
+	ScanWorkers int    // folders read at once while scanning; 0 or 1 reads one at a time
+	Jobs        int    // folder collages built at once; 0 uses one per CPU
+
+	// Print output.
+	TilePrint   string  // "AxB" splits the collage into A columns by B rows of pages; empty disables
+	PageSize    string  // page size name (a4, letter, ...) or WxH in millimetres
+	DPI         int     // print resolution used to convert millimetres to pixels
+	TileOverlap float64 // overlap between neighbouring pages in millimetres
+	Bleed       float64 // background extended beyond the trim edge, in millimetres
+	CropMarks   bool    // draw crop and registration marks outside the bleed
+	ICCProfile  string  // CMYK output profile to separate TIFF/PDF output with; embedded in it
+
+	// Soft-proofing.
+	ProofPath      string  // soft-proof preview PNG; empty disables
+	ProofCondition string  // printer profile simulated by the proof without an ICCProfile (see printConditions)
+	ProofWidth     int     // maximum width of the proof in pixels
+	GamutWarning   bool    // highlight out-of-gamut pixels in the proof
+	GamutThreshold float64 // chroma loss (CIELAB units) above which a pixel is out of gamut
+
+	// Transparency coverage.
+	MattePath      string // grayscale PNG of the alpha channel (black = uncovered), for compositing; empty disables
+	MatteArea      string // area of the matte: MatteCanvas or MatteTrim
+	CoverageReport string // JSON report of uncovered regions; empty disables
+
+	EncodeWorkers  int  // parallel workers for formats encoded in independent strips
+	SkipSpaceCheck bool // do not verify free disk space before rendering
+	Streaming      bool // render one row of cells at a time straight into a .png or .tif encoder
+	Update         bool // redraw only the changed cells of the existing output, tracked in a manifest beside it
+
+	CacheDir     string        // directory of resized tiles reused while their source file is unchanged; empty disables
+	Retry        RetryPolicy   // retrying of transient source read and download errors
+	ImageTimeout time.Duration // maximum decode and resize time per image; 0 disables
+
+	// Downloads of http(s) images listed in Images (see FetchImages) and of
+	// bucket listings.
+	MaxDownloads      int           // downloads run at once
+	MaxBandwidth      int64         // bytes per second over all downloads; 0 is unlimited
+	DownloadTimeout   time.Duration // maximum time per download request; 0 disables
+	DownloadCache     string        // directory keeping downloads between runs; empty disables
+	DownloadCacheSize int64         // bytes the download cache may hold; 0 is unlimited
+
+	NoEXIFRotate bool // draw photos as stored, ignoring their EXIF orientation
+	Frame        int  // frame (0-based) drawn from animated GIF and WebP files
+	ScoreBorders bool // frame each cell green, yellow or red by the image's sharpness and exposure
+
+	Include []string  // scan only files matching one of these patterns (see pathPattern); empty includes all
+	Exclude []string  // leave out files matching any of these patterns
+	Since   time.Time // leave out images dated before this; zero includes all
+	Before  time.Time // leave out images dated at or after this; zero includes all
+	SinceBy string    // image date compared with Since and Before: DateModified or DateTaken
+
+	// Quality filters applied before layout; rejected images are recorded in Skipped.
+	SkipBlurry  float64 // drop images whose Laplacian variance (see imageStats) is below this; 0 disables
+	SkipUniform float64 // drop images whose Uniformity (see imageStats) is at least this fraction; 0 disables
+	MinWidth    int     // drop images narrower than this many pixels as drawn; 0 disables
+	MinHeight   int     // drop images lower than this many pixels as drawn; 0 disables
+	MinBytes    int64   // drop image files smaller than this many bytes; 0 disables
+
+	// Sampling applied after sorting, to bound the collage of a large archive.
+	MaxImages    int    // keep at most this many images; 0 keeps all
+	MaxPerFolder int    // keep at most this many images of each folder; 0 keeps all
+	Sample       string // which images are kept: SampleFirst, SampleLast, SampleEvenly or SampleRandom
+
+	StateFile      string      // records the inputs of the last successful Create, for Unchanged; empty disables
+	Prefetch       *Prefetcher // if set, loads images in the background as Scan finds them
+	Quiet          bool        // do not show rendering progress on stderr
+	MaxErrorsShown int         // per-image errors logged individually before only the summary is shown
+	Strict         bool        // stop at the first image that cannot be read or decoded with ErrImageFailed, instead of leaving its cell empty
+	Skipped        *SkipLog    // if set, receives every source file left out of the collage
+	// Context, if set, cancels scanning, analysis, rendering and encoding,
+	// which then remove their partial outputs and return its cause.
+	Context context.Context
+	// Duplicates, if non-nil, receives from Scan the other locations of each
+	// included image found under several input roots, keyed by the included
+	// path; they are listed in the cell manifest.
+	Duplicates map[string][]string
+	// FrameTimes gives the time in their video of images that are frames of
+	// one (see VideoFrames), keyed by path, for CaptionTime.
+	FrameTimes map[string]time.Duration
+	// Texts gives the text read from images (see ReadText), keyed by path,
+	// for CaptionText and the search of the image map page.
+	Texts map[string]string
+	// Sources gives the original URL or archive entry of each image that
+	// FetchImages made a local file, keyed by that file (see Source).
+	Sources map[string]string
+	// Drawn, if set, receives the images chosen for the collage, after
+	// filtering, sorting and sampling, in cell order.
+	Drawn *[]string
+	// Log receives progress messages, warnings and per-image errors; nil
+	// discards them. DefaultOptions sets a logger writing to io.Discard.
+	Log *log.Logger
+}
+
+// DefaultOptions returns the defaults used by the collage command.
+func DefaultOptions() Options {
+	return Options{
+		CellSize:        200,
+		Fit:             FitContain,
+		Filter:          FilterAuto,
+		Backend:         BackendGo,
+		Sort:            SortName,
+		Layout:          LayoutGrid,
+		Weight:          WeightSize,
+		Pack:            PackOrder,
+		PackEffort:      1,
+		SinceBy:         DateModified,
+		Sample:          SampleFirst,
+		Background:      "transparent",
+		Format:          "webp",
+		ScanWorkers:     16,
+		Seed:            1,
+		WebPLossless:    true,
+		CaptionStyle:    CaptionBox,
+		CaptionColor:    CaptionAuto,
+		Quality:         90,
+		PageSize:        "a4",
+		DPI:             300,
+		TileOverlap:     10,
+		ProofCondition:  "coated",
+		ProofWidth:      2000,
+		GamutWarning:    true,
+		GamutThreshold:  10,
+		MatteArea:       MatteCanvas,
+		EncodeWorkers:   runtime.NumCPU(),
+		Retry:           RetryPolicy{Attempts: 3, Backoff: 500 * time.Millisecond},
+		ImageTimeout:    time.Minute,
+		MaxDownloads:    4,
+		DownloadTimeout: time.Minute,
+		MaxErrorsShown:  10,
+		Log:             log.New(io.Discard, "", 0),
+	}
+}
+
+// imagePaths returns opts.Images, or scans opts.InputDir when none are given,
+// without the images rejected by the quality filters, in opts.Sort order and
+// sampled down to opts.MaxPerFolder and opts.MaxImages.
+func (opts Options) imagePaths() ([]string, error) {
+	if err := checkSort(opts.Sort); err != nil {
+		return nil, err
+	}
+	if opts.Shuffle && opts.Sort != SortName {
+		return nil, fmt.Errorf("shuffling replaces the %s sort order; drop one of them", opts.Sort)
+	}
+	if err := checkSinceBy(opts.SinceBy); err != nil {
+		return nil, err
+	}
+	if err := checkSample(opts.Sample); err != nil {
+		return nil, err
+	}
+	paths := opts.Images
+	if len(paths) == 0 {
+		if opts.InputDir == "" {
+			return nil, fmt.Errorf("no images or input directory given")
+		}
+		var err error
+		if paths, _, err = Scan(opts); err != nil { // dates folder images as it reads them
+			return nil, err
+		}
+	} else {
+		paths = filterSince(paths, opts)
+	}
+	paths = filterSmall(paths, opts)
+	switch opts.Sort {
+	case SortEXIFDate:
+		paths = sortByDate(paths, opts)
+	case SortMTime, SortSize:
+		paths = sortByFileInfo(paths, opts.Sort)
+	case SortRoundRobin:
+		paths = interleaveFolders(paths)
+	}
+	if opts.hasFilters() || sortsByStats(opts.Sort) {
+		stats := analyzeImages(paths, opts)
+		if err := opts.canceled(); err != nil {
+			return nil, err
+		}
+		paths, stats = filterImages(paths, stats, opts)
+		paths = sortImages(paths, stats, opts.Sort)
+	}
+	if opts.Shuffle {
+		paths = shuffled(paths, opts.Seed)
+	} else if opts.Reverse {
+		paths = reversed(paths)
+	}
+	paths = sample(paths, opts)
+	if opts.Drawn != nil {
+		*opts.Drawn = paths
+	}
+	return paths, nil
+}
+
+// Source returns where the image at path came from: its URL or archive entry
+// if FetchImages fetched it, else path itself.
+func (opts Options) Source(path string) string {
+	if src, ok := opts.Sources[path]; ok {
+		return src
+	}
+	return path
+}
+
+// discardLog is the logger of options without one.
+var discardLog = log.New(io.Discard, "", 0)
+
+// logger returns opts.Log, or discardLog if it is nil.
+func (opts Options) logger() *log.Logger {
+	if opts.Log == nil {
+		return discardLog
+	}
+	return opts.Log
+}
+
+// selected returns opts for rendering paths, already found, filtered, sorted
+// and sampled by imagePaths, as they are: the options that choose and order
+// the images are cleared so they do not apply a second time, and the choice
+// is not recorded in Drawn again.
+func (opts Options) selected(paths []string) Options {
+	opts.Images, opts.Drawn = paths, nil
+	opts.Include, opts.Exclude = nil, nil
+	opts.Sort, opts.Reverse, opts.Shuffle = SortName, false, false
+	opts.Since, opts.Before = time.Time{}, time.Time{}
+	opts.SkipBlurry, opts.SkipUniform = 0, 0
+	opts.MinBytes, opts.MinWidth, opts.MinHeight = 0, 0, 0
+	opts.MaxImages, opts.MaxPerFolder = 0, 0
+	return opts
+}
+
+// gridSpec returns the grid the collage is laid out on.
+func (opts Options) gridSpec() GridSpec {
+	return GridSpec{
+		CellSize:   opts.CellSize,
+		Cols:       opts.Cols,
+		Rows:       opts.Rows,
+		Gutter:     opts.Gutter,
+		Margin:     opts.Margin,
+		Reserved:   opts.reservations(),
+		Pack:       opts.Pack,
+		PackEffort: opts.PackEffort,
+	}
+}
+
+// reservations returns the blocks kept free of images: opts.Reserved followed by
+// the blocks of the title cells, in the order of Layout.Reserved.
+func (opts Options) reservations() []Reservation {
+	reserved := append([]Reservation(nil), opts.Reserved...)
+	for _, t := range opts.TitleCells {
+		reserved = append(reserved, t.Reservation)
+	}
+	return reserved
+}
+
+// checkText validates the caption and badge settings and, if the collage draws
+// any text, loads the font.
+func checkText(opts Options) error {
+	if err := checkCaption(opts); err != nil {
+		return err
+	}
+	if err := checkBadges(opts.Badges); err != nil {
+		return err
+	}
+	if len(opts.TitleCells) > 0 || opts.Caption != "" || len(opts.Badges) > 0 || opts.Layout == LayoutSections {
+		if _, err := loadFonts(opts.Font); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// drawTitleCells renders the title cells into their reserved blocks and the
+// section banners of the layout, offset by origin.
+func drawTitleCells(dst *image.RGBA, origin image.Point, layout Layout, opts Options) error {
+	if len(opts.TitleCells) == 0 && len(layout.Headers) == 0 {
+		return nil
+	}
+	fonts, err := loadFonts(opts.Font)
+	if err != nil {
+		return err
+	}
+	for i, t := range opts.TitleCells {
+		drawTitleCell(dst, layout.Reserved[len(opts.Reserved)+i].Add(origin), t.Text, fonts, opts.FontSize)
+	}
+	for _, h := range layout.Headers {
+		if r := h.Rect.Add(origin); r.Overlaps(dst.Rect) {
+			drawTitleCell(dst, r, h.Text, fonts, opts.FontSize)
+		}
+	}
+	return nil
+}
+
+// Build lays out and renders the collage described by opts into an in-memory
+// image and returns it. Print marks and bleed are included when requested;
+// no files are written.
+func Build(opts Options) (image.Image, error) {
+	if opts.Hierarchical {
+		master, cleanup, err := opts.overview()
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		opts = master
+	}
+	if opts.Target != "" {
+		mosaic, cleanup, err := opts.mosaic()
+		if err != nil {
+			return nil, err
+		}
+		defer cleanup()
+		opts = mosaic
+	}
+	return build(opts)
+}
+
+// build implements Build for a flat collage.
+func build(opts Options) (*image.RGBA, error) {
+	paths, err := opts.imagePaths()
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, ErrNoImages
+	}
+	if err := checkFit(opts.Fit); err != nil {
+		return nil, err
+	}
+	if err := checkFilter(opts.Filter); err != nil {
+		return nil, err
+	}
+	if err := checkBackend(opts.Backend); err != nil {
+		return nil, err
+	}
+	if err := checkText(opts); err != nil {
+		return nil, err
+	}
+
+	layout, err := opts.planLayout(paths)
+	if err != nil {
+		return nil, err
+	}
+	trim, bounds := canvasBounds(layout, opts)
+	bg, err := parseColor(opts.Background)
+	if err != nil {
+		return nil, err
+	}
+	img := image.NewRGBA(bounds)
+	fillBackground(img, bg)
+
+	errs := newErrorLog(opts.MaxErrorsShown, opts.logger())
+	prog := newProgress(len(paths), opts)
+	err = renderImages(img, trim.Min, layout, paths, opts, errs, prog)
+	prog.finish()
+	if err != nil {
+		return nil, err
+	}
+	if err := drawTitleCells(img, trim.Min, layout, opts); err != nil {
+		return nil, err
+	}
+	if opts.CropMarks {
+		drawPrintMarks(img, trim, mmToPixels(opts.Bleed, opts.DPI), opts.DPI)
+	}
+	return img, nil
+}
@@ -0,0 +1,59 @@
+// colors_test.go
+package collage
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    color.NRGBA
+		wantErr bool
+	}{
+		{"", color.NRGBA{255, 255, 255, 0}, false},
+		{" Transparent ", color.NRGBA{255, 255, 255, 0}, false},
+		{"navy", color.NRGBA{0, 0, 128, 255}, false},
+		{"RebeccaPurple", color.NRGBA{0x66, 0x33, 0x99, 255}, false},
+		{"#f80", color.NRGBA{0xff, 0x88, 0x00, 255}, false},
+		{"#f808", color.NRGBA{0xff, 0x88, 0x00, 0x88}, false},
+		{"#1A2b3C", color.NRGBA{0x1a, 0x2b, 0x3c, 255}, false},
+		{"#1a2b3c80", color.NRGBA{0x1a, 0x2b, 0x3c, 0x80}, false},
+		{"rgb(10, 20, 30)", color.NRGBA{10, 20, 30, 255}, false},
+		{"rgba(10,20,30,0.5)", color.NRGBA{10, 20, 30, 128}, false},
+		{"rgb(10 20 30 / 50%)", color.NRGBA{10, 20, 30, 128}, false},
+		{"rgb(100%, 50%, 0%)", color.NRGBA{255, 128, 0, 255}, false},
+		{"rgb(300, -5, 30)", color.NRGBA{255, 0, 30, 255}, false}, // clamped
+		{"#12345", color.NRGBA{}, true},
+		{"#ggg", color.NRGBA{}, true},
+		{"rgb(1, 2)", color.NRGBA{}, true},
+		{"rgb(1, 2, 3", color.NRGBA{}, true},
+		{"rgb(a, b, c)", color.NRGBA{}, true},
+		{"notacolour", color.NRGBA{}, true},
+	}
+	for _, tt := range tests {
+		got, err := parseColor(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseColor(%q) = %v, %v, want %v, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestIsDark(t *testing.T) {
+	tests := []struct {
+		c    color.NRGBA
+		want bool
+	}{
+		{color.NRGBA{0, 0, 0, 255}, true},
+		{color.NRGBA{255, 255, 255, 255}, false},
+		{color.NRGBA{0, 0, 128, 255}, true},
+		{color.NRGBA{255, 255, 0, 255}, false},
+		{color.NRGBA{255, 0, 0, 255}, false}, // black text contrasts more with pure red
+	}
+	for _, tt := range tests {
+		if got := isDark(tt.c); got != tt.want {
+			t.Errorf("isDark(%v) = %v, want %v", tt.c, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+// compare.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Comparison sheet geometry, in pixels.
+const (
+	compareCellSize    = 64  // largest cell size the configurations are previewed at
+	comparePanelHeight = 600 // height every preview is scaled to
+	compareLabelHeight = 48  // band above each preview naming its configuration
+	compareGap         = 24  // space between and around the previews
+)
+
+// compareKeys lists the settings a comparison configuration may override.
+const compareKeys = "layout, fit, sort, spans, pack, weight, cols, rows, cell-size, gutter, margin, inset, exact-grid, jitter-rotation, seed, shuffle or background"
+
+// withSettings returns opts with the settings of spec, a comma-separated list
+// of key=value pairs such as "layout=justified,gutter=4mm", applied.
+func (opts Options) withSettings(spec string) (Options, error) {
+	for _, pair := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok {
+			return opts, fmt.Errorf("invalid setting %q in %q: expected key=value", pair, spec)
+		}
+		key, value = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-"), strings.TrimSpace(value)
+		var err error
+		switch key {
+		case "layout":
+			opts.Layout = value
+		case "fit":
+			opts.Fit = value
+		case "sort":
+			opts.Sort = value
+		case "spans":
+			opts.Spans = value
+		case "pack":
+			opts.Pack = value
+		case "weight":
+			opts.Weight = value
+		case "exact-grid":
+			opts.ExactGrid = value
+		case "background":
+			opts.Background = value
+		case "cols":
+			opts.Cols, err = strconv.Atoi(value)
+		case "rows":
+			opts.Rows, err = strconv.Atoi(value)
+		case "cell-size":
+			opts.CellSize, err = ParseLength(value, opts.DPI)
+		case "gutter":
+			opts.Gutter, err = ParseLength(value, opts.DPI)
+		case "margin":
+			opts.Margin, err = ParseLength(value, opts.DPI)
+		case "inset":
+			opts.Inset, err = ParseLength(value, opts.DPI)
+		case "jitter-rotation":
+			opts.JitterRotation, err = strconv.ParseFloat(value, 64)
+		case "seed":
+			opts.Seed, err = strconv.ParseInt(value, 10, 64)
+		case "shuffle":
+			opts.Shuffle, err = strconv.ParseBool(value)
+		default:
+			return opts, fmt.Errorf("unknown setting %q in %q: use %s", key, spec, compareKeys)
+		}
+		if err != nil {
+			return opts, fmt.Errorf("invalid %s %q in %q: %v", key, value, spec, err)
+		}
+	}
+	return opts, nil
+}
+
+// createComparison renders the images under each configuration of opts.Compare
+// (see withSettings) and writes the previews side by side, each labelled with
+// its configuration, to opts.OutputPath. The previews use cells of at most
+// compareCellSize pixels, with the gutters, margins and insets scaled to
+// match, so a layout can be chosen before the full-size render.
+func createComparison(opts Options) error {
+	if err := checkOutput(opts); err != nil {
+		return err
+	}
+	if len(opts.Compare) < 2 {
+		return fmt.Errorf("a comparison needs at least two configurations")
+	}
+	fonts, err := loadFonts(opts.Font)
+	if err != nil {
+		return err
+	}
+	bg, err := parseColor(opts.Background)
+	if err != nil {
+		return err
+	}
+
+	// Step 1: Find and filter the images once; each configuration sorts them itself.
+	base := opts
+	base.Sort, base.Reverse, base.Shuffle = SortName, false, false
+	paths, err := base.imagePaths()
+	if err != nil {
+		return err
+	}
+
+	// Step 2: Render a preview of each configuration.
+	previews := make([]image.Image, len(opts.Compare))
+	for i, spec := range opts.Compare {
+		sub, err := opts.withSettings(spec)
+		if err != nil {
+			return err
+		}
+		sub.Compare, sub.Images = nil, paths
+		sub.SkipBlurry, sub.SkipUniform = 0, 0
+		sub.Hierarchical, sub.Target, sub.Size = false, "", ""
+		if sub.CellSize > compareCellSize {
+			scale := float64(compareCellSize) / float64(sub.CellSize)
+			sub.CellSize = compareCellSize
+			sub.Gutter = int(math.Round(float64(sub.Gutter) * scale))
+			sub.Margin = int(math.Round(float64(sub.Margin) * scale))
+			sub.Inset = int(math.Round(float64(sub.Inset) * scale))
+			sub.InsetJitter = int(math.Round(float64(sub.InsetJitter) * scale))
+			sub.FontSize *= scale
+		}
+		opts.logger().Printf("Rendering configuration %d of %d: %s\n", i+1, len(opts.Compare), spec)
+		if previews[i], err = build(sub); err != nil {
+			return fmt.Errorf("configuration %q: %v", spec, err)
+		}
+	}
+
+	// Step 3: Scale the previews to a common height and lay them out in a row.
+	widths := make([]int, len(previews))
+	sheetW := compareGap
+	for i, p := range previews {
+		b := p.Bounds()
+		widths[i] = max(1, int(math.Round(float64(b.Dx())*comparePanelHeight/float64(b.Dy()))))
+		sheetW += widths[i] + compareGap
+	}
+	sheet := image.NewRGBA(image.Rect(0, 0, sheetW, compareLabelHeight+comparePanelHeight+2*compareGap))
+	fillBackground(sheet, bg)
+	x := compareGap
+	for i, p := range previews {
+		label := image.Rect(x, compareGap, x+widths[i], compareGap+compareLabelHeight)
+		drawTitleCell(sheet, label, opts.Compare[i], fonts, 0)
+		panel := image.Rect(x, label.Max.Y, x+widths[i], label.Max.Y+comparePanelHeight)
+		scaler(opts.Filter, panel, p.Bounds()).Scale(sheet, panel, p, p.Bounds(), draw.Over, nil)
+		x += widths[i] + compareGap
+	}
+
+	if err := writeOutput(sheet, opts); err != nil {
+		return fmt.Errorf("%w: %w", ErrEncode, err)
+	}
+	opts.logger().Printf("Comparison sheet saved to '%s'\n", opts.OutputPath)
+	return nil
+}
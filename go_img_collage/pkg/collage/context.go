@@ -0,0 +1,38 @@
+// context.go
+package collage
+
+import (
+	"context"
+	"io"
+)
+
+// canceled returns why opts.Context was cancelled, its cause if one was given
+// (such as the signal that interrupted the run), or nil while the run may go on.
+func (opts Options) canceled() error {
+	if opts.Context == nil || opts.Context.Err() == nil {
+		return nil
+	}
+	return context.Cause(opts.Context)
+}
+
+// context returns opts.Context, or a context that is never cancelled if it is nil.
+func (opts Options) context() context.Context {
+	if opts.Context == nil {
+		return context.Background()
+	}
+	return opts.Context
+}
+
+// cancelWriter fails every write once opts.Context is cancelled, so an encoder
+// writing through it stops at its next write.
+type cancelWriter struct {
+	w    io.Writer
+	opts Options
+}
+
+func (w cancelWriter) Write(p []byte) (int, error) {
+	if err := w.opts.canceled(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
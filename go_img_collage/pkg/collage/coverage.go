@@ -0,0 +1,155 @@
+// coverage.go
+package collage
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"log"
+	"os"
+	"sort"
+)
+
+// uncoveredRegion is a connected area of fully transparent pixels.
+type uncoveredRegion struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	Pixels int `json:"pixels"`
+}
+
+// coverageReport summarises which parts of a transparent collage remain uncovered.
+type coverageReport struct {
+	Width            int               `json:"width"`
+	Height           int               `json:"height"`
+	UncoveredPixels  int               `json:"uncovered_pixels"`
+	UncoveredPercent float64           `json:"uncovered_percent"`
+	Regions          []uncoveredRegion `json:"regions"`
+}
+
+// Areas of the output exported as a matte (Options.MatteArea).
+const (
+	MatteCanvas = "canvas" // the whole output, bleed included
+	MatteTrim   = "trim"   // the collage inside the bleed
+)
+
+// checkMatteArea returns an error for an unknown matte area.
+func checkMatteArea(area string) error {
+	switch area {
+	case MatteCanvas, MatteTrim:
+		return nil
+	}
+	return fmt.Errorf("unknown matte area %q: use canvas or trim", area)
+}
+
+// writeCoverageMask saves the alpha channel of img as a grayscale PNG, where
+// black marks uncovered (transparent) areas and white fully covered ones.
+func writeCoverageMask(path string, img *image.RGBA) error {
+	b := img.Bounds()
+	mask := image.NewGray(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		src := img.Pix[img.PixOffset(b.Min.X, y):]
+		dst := mask.Pix[(y-b.Min.Y)*mask.Stride:]
+		for x := 0; x < b.Dx(); x++ {
+			dst[x] = src[4*x+3]
+		}
+	}
+	return writePNG(path, mask)
+}
+
+// writeCoverageReport finds the connected transparent regions of img and writes
+// their bounding boxes, largest first, as JSON to path, logging a summary to log.
+func writeCoverageReport(path string, img *image.RGBA, log *log.Logger) error {
+	report := findUncovered(img)
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	log.Printf("Coverage report saved to '%s' (%.2f%% uncovered in %d regions)\n",
+		path, report.UncoveredPercent, len(report.Regions))
+	return nil
+}
+
+// run is a horizontal span [x0, x1) of transparent pixels on one row.
+type run struct {
+	y, x0, x1 int
+	label     int
+}
+
+// findUncovered labels transparent pixels by connecting horizontal runs that
+// overlap runs on the previous row, merging labels with a union-find.
+func findUncovered(img *image.RGBA) coverageReport {
+	b := img.Bounds()
+	var parent []int
+	find := func(i int) int {
+		for parent[i] != i {
+			parent[i] = parent[parent[i]]
+			i = parent[i]
+		}
+		return i
+	}
+
+	var runs, prev []run
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		var cur []run
+		row := img.Pix[img.PixOffset(b.Min.X, y):]
+		for x := 0; x < b.Dx(); {
+			if row[4*x+3] != 0 {
+				x++
+				continue
+			}
+			start := x
+			for x < b.Dx() && row[4*x+3] == 0 {
+				x++
+			}
+			r := run{y: y, x0: start, x1: x, label: -1}
+			for _, p := range prev {
+				if p.x0 < r.x1 && r.x0 < p.x1 {
+					if r.label < 0 {
+						r.label = find(p.label)
+					} else if a, c := find(r.label), find(p.label); a != c {
+						parent[c] = a
+					}
+				}
+			}
+			if r.label < 0 {
+				r.label = len(parent)
+				parent = append(parent, r.label)
+			}
+			cur = append(cur, r)
+		}
+		runs = append(runs, cur...)
+		prev = cur
+	}
+
+	report := coverageReport{Width: b.Dx(), Height: b.Dy(), Regions: []uncoveredRegion{}}
+	regions := map[int]*uncoveredRegion{}
+	for _, r := range runs {
+		root := find(r.label)
+		reg, ok := regions[root]
+		if !ok {
+			reg = &uncoveredRegion{X: r.x0, Y: r.y - b.Min.Y}
+			regions[root] = reg
+		}
+		x0, y0 := min(reg.X, r.x0), min(reg.Y, r.y-b.Min.Y)
+		x1 := max(reg.X+reg.Width, r.x1)
+		y1 := max(reg.Y+reg.Height, r.y-b.Min.Y+1)
+		reg.X, reg.Y, reg.Width, reg.Height = x0, y0, x1-x0, y1-y0
+		reg.Pixels += r.x1 - r.x0
+		report.UncoveredPixels += r.x1 - r.x0
+	}
+	for _, reg := range regions {
+		report.Regions = append(report.Regions, *reg)
+	}
+	sort.Slice(report.Regions, func(i, j int) bool {
+		return report.Regions[i].Pixels > report.Regions[j].Pixels
+	})
+	if total := b.Dx() * b.Dy(); total > 0 {
+		report.UncoveredPercent = 100 * float64(report.UncoveredPixels) / float64(total)
+	}
+	return report
+}
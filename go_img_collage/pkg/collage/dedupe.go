@@ -0,0 +1,67 @@
+// dedupe.go
+package collage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// dedupeImages drops the images whose content is identical to an earlier one,
+// as when the same photo was copied into several input roots. Each dropped
+// path is recorded in opts.Skipped and in opts.Duplicates under the path kept.
+// Only files of equal size are hashed; unreadable files are kept.
+func dedupeImages(paths []string, opts Options) []string {
+	// Step 1: Group the files by size; a file of unique size has no duplicate.
+	sizes := make(map[int64]int, len(paths))
+	size := make([]int64, len(paths))
+	for i, path := range paths {
+		size[i] = -1
+		if info, err := os.Stat(path); err == nil {
+			size[i] = info.Size()
+			sizes[size[i]]++
+		}
+	}
+
+	// Step 2: Hash the files sharing a size and keep the first of each hash.
+	first := map[string]string{}
+	var kept []string
+	for i, path := range paths {
+		if size[i] < 0 || sizes[size[i]] < 2 {
+			kept = append(kept, path)
+			continue
+		}
+		sum, err := fileHash(path)
+		if err != nil {
+			opts.logger().Printf("Warning: could not hash %s: %v", path, err)
+			kept = append(kept, path)
+			continue
+		}
+		if orig, ok := first[sum]; ok {
+			opts.Skipped.Add(path, SkipDuplicate, fmt.Sprintf("same as %s", orig))
+			if opts.Duplicates != nil {
+				opts.Duplicates[orig] = append(opts.Duplicates[orig], path)
+			}
+			continue
+		}
+		first[sum] = path
+		kept = append(kept, path)
+	}
+	return kept
+}
+
+// fileHash returns the hex SHA-256 of the file's content.
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,56 @@
+// dims.go
+package collage
+
+import (
+	"bytes"
+	"image"
+	"runtime"
+	"sync"
+)
+
+// imageSize returns the dimensions of the image at path as drawn, i.e. turned
+// upright by its EXIF orientation unless opts.NoEXIFRotate is set. Only the
+// header is decoded where the format allows.
+func imageSize(path string, opts Options) (image.Point, error) {
+	data, err := opts.Retry.readFile(path, opts.logger())
+	if err != nil {
+		return image.Point{}, err
+	}
+	var size image.Point
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		size = image.Pt(cfg.Width, cfg.Height)
+	} else {
+		img, err := decodeImage(opts.context(), path, data, opts.Frame)
+		if err != nil {
+			return image.Point{}, err
+		}
+		size = img.Bounds().Size()
+	}
+	if !opts.NoEXIFRotate && parseEXIF(data).orientation() >= 5 {
+		size.X, size.Y = size.Y, size.X
+	}
+	return size, nil
+}
+
+// imageSizes returns the drawn dimensions of every image, read in parallel.
+// Images whose size cannot be read get the zero size.
+func imageSizes(paths []string, opts Options) []image.Point {
+	sizes := make([]image.Point, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				sizes[i], _ = imageSize(paths[i], opts)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return sizes
+}
@@ -0,0 +1,45 @@
+// dims_test.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeTestImages writes a blank PNG of each size into a temp directory and
+// returns their paths in order.
+func writeTestImages(t *testing.T, sizes ...image.Point) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for i, s := range sizes {
+		path := filepath.Join(dir, fmt.Sprintf("%02d.png", i))
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = png.Encode(f, image.NewGray(image.Rect(0, 0, s.X, s.Y)))
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestImageSizes(t *testing.T) {
+	paths := writeTestImages(t, image.Pt(30, 20), image.Pt(5, 8))
+	paths = append(paths, filepath.Join(t.TempDir(), "missing.png"))
+	want := []image.Point{{30, 20}, {5, 8}, {}}
+	got := imageSizes(paths, DefaultOptions())
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("imageSizes()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
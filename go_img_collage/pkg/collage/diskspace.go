@@ -0,0 +1,83 @@
+// diskspace.go
+package collage
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// spaceNeed is the space required on the filesystem holding dir.
+type spaceNeed struct {
+	dir   string
+	what  string
+	bytes uint64
+}
+
+// checkDiskSpace verifies before any work starts that the filesystems holding the
+// temp directory and the output file have room for the memory-mapped canvas and
+// the encoded collage, so a long run does not die halfway through with ENOSPC.
+// Needs on the same filesystem are added together. Filesystems whose free space
+// cannot be determined are not checked.
+func checkDiskSpace(needs ...spaceNeed) error {
+	type fsTotal struct {
+		free  uint64
+		need  uint64
+		parts []string
+		dir   string
+	}
+	totals := map[uint64]*fsTotal{}
+	var order []uint64
+	for _, n := range needs {
+		free, dev, err := diskFree(n.dir)
+		if err != nil {
+			continue
+		}
+		t, ok := totals[dev]
+		if !ok {
+			t = &fsTotal{free: free, dir: n.dir}
+			totals[dev] = t
+			order = append(order, dev)
+		}
+		t.need += n.bytes
+		t.parts = append(t.parts, fmt.Sprintf("%s %s", n.what, formatBytes(n.bytes)))
+	}
+	for _, dev := range order {
+		t := totals[dev]
+		if t.need > t.free {
+			return fmt.Errorf("not enough disk space in %s: need about %s (%s) but only %s is free; "+
+				"free up space, point TMPDIR or -output_file elsewhere, or pass -skip-space-check",
+				t.dir, formatBytes(t.need), strings.Join(t.parts, ", "), formatBytes(t.free))
+		}
+	}
+	return nil
+}
+
+// estimateOutputSize is a conservative estimate of the encoded size of a collage
+// of the given dimensions; lossless encoders rarely beat 2:1 on photographs.
+func estimateOutputSize(width, height int) uint64 {
+	return uint64(width) * uint64(height) * 4 / 2
+}
+
+// outputDir returns the directory that will hold path.
+func outputDir(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Dir(path)
+	}
+	return filepath.Dir(abs)
+}
+
+// formatBytes renders n using binary units (KiB, MiB, ...).
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,11 @@
+//go:build !unix && !windows
+
+// diskspace_other.go
+package collage
+
+import "errors"
+
+// diskFree is not supported on this platform, so the preflight check is skipped.
+func diskFree(dir string) (uint64, uint64, error) {
+	return 0, 0, errors.New("free disk space is not available on this platform")
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+// diskspace_unix.go
+package collage
+
+import "syscall"
+
+// diskFree returns the bytes available to unprivileged users on the filesystem
+// holding dir, and an identifier of that filesystem.
+func diskFree(dir string) (uint64, uint64, error) {
+	var st syscall.Stat_t
+	if err := syscall.Stat(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return 0, 0, err
+	}
+	return uint64(fs.Bavail) * uint64(fs.Bsize), uint64(st.Dev), nil
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+// diskspace_windows.go
+package collage
+
+import (
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/windows"
+)
+
+// diskFree returns the bytes available to the caller on the volume holding dir,
+// and an identifier of that volume.
+func diskFree(dir string) (uint64, uint64, error) {
+	p, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var free, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(p, &free, &total, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	// Identify the volume by its drive letter or UNC share.
+	var id uint64
+	for _, c := range strings.ToUpper(filepath.VolumeName(dir)) {
+		id = id*31 + uint64(c)
+	}
+	return free, id, nil
+}
@@ -0,0 +1,131 @@
+// dlcache.go
+package collage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// downloadMeta is stored beside each cached download: the response validators
+// used to revalidate it and the hash its data is checked against.
+type downloadMeta struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"`
+	Size         int64  `json:"size"`
+	SHA256       string `json:"sha256"`
+}
+
+// downloadCache keeps downloaded files in dir, keyed by URL, up to maxBytes
+// in total; the least recently used are evicted beyond that.
+type downloadCache struct {
+	dir      string
+	maxBytes int64      // 0 is unlimited
+	mu       sync.Mutex // serializes eviction
+}
+
+// downloadPath returns the path of the cached download of url with the given
+// extension (".data" or ".json").
+func (c *downloadCache) downloadPath(url, ext string) string {
+	h := sha256.Sum256([]byte(stableURL(url)))
+	key := hex.EncodeToString(h[:])
+	return filepath.Join(c.dir, key[:2], key+ext)
+}
+
+// load returns the cached download of url if its data matches its recorded
+// size and hash. A damaged entry is removed, with a warning to log.
+func (c *downloadCache) load(url string, log *log.Logger) ([]byte, *downloadMeta, bool) {
+	raw, err := os.ReadFile(c.downloadPath(url, ".json"))
+	if err != nil {
+		return nil, nil, false
+	}
+	var meta downloadMeta
+	if json.Unmarshal(raw, &meta) != nil || meta.URL != stableURL(url) {
+		return nil, nil, false
+	}
+	data, err := os.ReadFile(c.downloadPath(url, ".data"))
+	if err == nil && int64(len(data)) == meta.Size && sha256Hex(data) == meta.SHA256 {
+		return data, &meta, true
+	}
+	log.Printf("Warning: discarding damaged cached download of %s", url)
+	os.Remove(c.downloadPath(url, ".data"))
+	os.Remove(c.downloadPath(url, ".json"))
+	return nil, nil, false
+}
+
+// touch marks the cached download of url as just used.
+func (c *downloadCache) touch(url string) {
+	now := time.Now()
+	os.Chtimes(c.downloadPath(url, ".data"), now, now)
+}
+
+// store caches data as the download of url described by meta, then evicts
+// old entries beyond the size limit.
+func (c *downloadCache) store(data []byte, meta downloadMeta) error {
+	meta.URL, meta.Size, meta.SHA256 = stableURL(meta.URL), int64(len(data)), sha256Hex(data)
+	raw, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	dataPath := c.downloadPath(meta.URL, ".data")
+	if err := os.MkdirAll(filepath.Dir(dataPath), 0o755); err != nil {
+		return err
+	}
+	// Write the data under a temporary name first so readers never see half a file.
+	tmp := dataPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dataPath); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.WriteFile(c.downloadPath(meta.URL, ".json"), raw, 0o644); err != nil {
+		return err
+	}
+	c.evict()
+	return nil
+}
+
+// evict removes the least recently used downloads until the cache holds at
+// most maxBytes.
+func (c *downloadCache) evict() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	PruneCache(c.dir, c.maxBytes)
+}
+
+// stableURL returns url without the query parameters of S3 presigning, which
+// change on every run, so presigned downloads are cached by their object.
+func stableURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || !strings.Contains(u.RawQuery, "X-Amz-") {
+		return rawURL
+	}
+	q := u.Query()
+	for k := range q {
+		if strings.HasPrefix(k, "X-Amz-") {
+			q.Del(k)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// sha256Hex returns the hex SHA-256 of data.
+func sha256Hex(data []byte) string {
+	h := sha256.Sum256(data)
+	return hex.EncodeToString(h[:])
+}
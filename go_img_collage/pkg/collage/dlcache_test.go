@@ -0,0 +1,116 @@
+// dlcache_test.go
+package collage
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestStableURL(t *testing.T) {
+	tests := []struct {
+		url, want string
+	}{
+		{"https://cdn.test/a.jpg", "https://cdn.test/a.jpg"},
+		{"https://cdn.test/a.jpg?w=200", "https://cdn.test/a.jpg?w=200"},
+		{
+			"https://b.s3.us-east-1.amazonaws.com/a.jpg?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Date=20240601T000000Z&X-Amz-Signature=abc",
+			"https://b.s3.us-east-1.amazonaws.com/a.jpg",
+		},
+		{"https://b.test/a.jpg?versionId=3&X-Amz-Expires=3600", "https://b.test/a.jpg?versionId=3"},
+	}
+	for _, tt := range tests {
+		if got := stableURL(tt.url); got != tt.want {
+			t.Errorf("stableURL(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadCacheLoad(t *testing.T) {
+	const url = "https://cdn.test/a.jpg"
+	data := []byte("image data")
+	tests := []struct {
+		name   string
+		damage func(c *downloadCache)
+		url    string
+		hit    bool
+	}{
+		{"stored", func(*downloadCache) {}, url, true},
+		{"presigned again", func(*downloadCache) {}, url + "?X-Amz-Signature=other", true},
+		{"other URL", func(*downloadCache) {}, "https://cdn.test/b.jpg", false},
+		{"truncated", func(c *downloadCache) {
+			os.WriteFile(c.downloadPath(url, ".data"), data[:4], 0o644)
+		}, url, false},
+		{"corrupted", func(c *downloadCache) {
+			os.WriteFile(c.downloadPath(url, ".data"), bytes.ToUpper(data), 0o644)
+		}, url, false},
+		{"data missing", func(c *downloadCache) { os.Remove(c.downloadPath(url, ".data")) }, url, false},
+		{"metadata unreadable", func(c *downloadCache) {
+			os.WriteFile(c.downloadPath(url, ".json"), []byte("{"), 0o644)
+		}, url, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &downloadCache{dir: t.TempDir()}
+			if err := c.store(data, downloadMeta{URL: url, ETag: `"v1"`, ContentType: "image/jpeg"}); err != nil {
+				t.Fatal(err)
+			}
+			tt.damage(c)
+			got, meta, ok := c.load(tt.url, discardLog)
+			if ok != tt.hit {
+				t.Fatalf("load() hit = %v, want %v", ok, tt.hit)
+			}
+			if !ok {
+				return
+			}
+			if !bytes.Equal(got, data) || meta.ETag != `"v1"` || meta.ContentType != "image/jpeg" {
+				t.Errorf("load() = %q, %+v, want the stored download", got, meta)
+			}
+		})
+	}
+}
+
+func TestDownloadCacheEvict(t *testing.T) {
+	dir := t.TempDir()
+	c := &downloadCache{dir: dir}
+	urls := []string{"https://cdn.test/a.jpg", "https://cdn.test/b.jpg", "https://cdn.test/c.jpg"}
+	data := bytes.Repeat([]byte("x"), 100)
+	for i, url := range urls[:2] {
+		if err := c.store(data, downloadMeta{URL: url}); err != nil {
+			t.Fatal(err)
+		}
+		old := time.Now().Add(-time.Duration(2-i) * time.Hour) // a.jpg is the oldest
+		os.Chtimes(c.downloadPath(url, ".data"), old, old)
+		os.Chtimes(c.downloadPath(url, ".json"), old, old)
+	}
+	_, size, _, err := CacheStats(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Using a.jpg makes b.jpg the least recently used, which c.jpg replaces.
+	c.touch(urls[0])
+	c.maxBytes = size + 10
+	if err := c.store(data, downloadMeta{URL: urls[2]}); err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []bool{true, false, true} {
+		if _, _, ok := c.load(urls[i], discardLog); ok != want {
+			t.Errorf("%s cached = %v, want %v", urls[i], ok, want)
+		}
+	}
+
+	raw, err := os.ReadFile(c.downloadPath(urls[2], ".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta downloadMeta
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Size != int64(len(data)) || meta.SHA256 != sha256Hex(data) {
+		t.Errorf("stored metadata = %+v, want the size and hash of the data", meta)
+	}
+}
@@ -0,0 +1,152 @@
+// download.go
+package collage
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// IsURL reports whether an image list entry is an http(s) URL to download.
+func IsURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
+
+// NeedsFetch reports whether path is a URL or an archive entry, which
+// FetchImages makes a local file.
+func NeedsFetch(path string) bool {
+	_, _, ok := splitArchivePath(path)
+	return IsURL(path) || ok
+}
+
+// FetchImages makes the remote and archived entries of paths local files and
+// returns paths with each replaced by its file, in a temp directory removed by
+// cleanup. URLs are downloaded opts.MaxDownloads at a time, retrying transient
+// failures by opts.Retry; with opts.DownloadCache, unchanged files are reused.
+// ZIP archive entries (see zipSource) are extracted. A file keeps the name of
+// its URL or entry, with the extension of its sniffed or declared type.
+// Entries that fail or are not images are left out and recorded in opts.Skipped.
+// sources maps each file made back to its entry in paths, for Options.Sources.
+func FetchImages(paths []string, opts Options) (local []string, sources map[string]string, cleanup func(), err error) {
+	cleanup = func() {}
+	var urls, entries []int
+	for i, p := range paths {
+		if IsURL(p) {
+			urls = append(urls, i)
+		} else if _, _, ok := splitArchivePath(p); ok {
+			entries = append(entries, i)
+		}
+	}
+	if len(urls) == 0 && len(entries) == 0 {
+		return paths, nil, cleanup, nil
+	}
+	dir, err := os.MkdirTemp("", "collage-downloads-*")
+	if err != nil {
+		return nil, nil, cleanup, fmt.Errorf("failed to create download directory: %v", err)
+	}
+	unregister := onInterrupt(func() { os.RemoveAll(dir) })
+	cleanup = func() {
+		os.RemoveAll(dir)
+		unregister()
+	}
+
+	local = append([]string(nil), paths...)
+	failed := make([]bool, len(paths))
+	if len(entries) > 0 {
+		if err := extractEntries(paths, entries, dir, local, failed, opts); err != nil {
+			cleanup()
+			return nil, nil, func() {}, err
+		}
+	}
+
+	d := opts.downloader()
+	if len(urls) > 0 {
+		opts.logger().Printf("Downloading %d images...\n", len(urls))
+	}
+	var wg sync.WaitGroup
+	for _, i := range urls {
+		wg.Add(1)
+		go func() { // the Downloader bounds how many run at once
+			defer wg.Done()
+			file, err := download(d, paths[i], filepath.Join(dir, fmt.Sprint(i)), opts)
+			if err != nil {
+				opts.logger().Printf("Warning: %v", err)
+				failed[i] = true
+				return
+			}
+			local[i] = file
+		}()
+	}
+	wg.Wait()
+
+	kept := local[:0]
+	sources = map[string]string{}
+	for i, p := range local {
+		if failed[i] {
+			continue
+		}
+		kept = append(kept, p)
+		if p != paths[i] {
+			sources[p] = paths[i]
+		}
+	}
+	return kept, sources, cleanup, nil
+}
+
+// downloader returns a Downloader with the limits and cache of opts.
+func (opts Options) downloader() *Downloader {
+	d := NewDownloader(opts.MaxDownloads, opts.MaxBandwidth, opts.DownloadTimeout)
+	if opts.DownloadCache != "" {
+		d.UseCache(opts.DownloadCache, opts.DownloadCacheSize)
+	}
+	d.Log = opts.Log
+	return d
+}
+
+// download fetches the image at rawURL into dir, recording why in
+// opts.Skipped if it cannot, and returns the file's path.
+func download(d *Downloader, rawURL, dir string, opts Options) (string, error) {
+	var data []byte
+	var contentType string
+	err := opts.Retry.do(opts.logger(), rawURL, func() error {
+		var err error
+		data, contentType, err = d.Fetch(rawURL)
+		return err
+	})
+	if err != nil {
+		opts.Skipped.Add(rawURL, SkipDownload, err.Error())
+		return "", err
+	}
+	ext, mediaType, ok := ImageExt(contentType, data)
+	if !ok {
+		opts.Skipped.Add(rawURL, SkipNotImage, mediaType)
+		return "", fmt.Errorf("%s is not a supported image (%s)", rawURL, mediaType)
+	}
+	name := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		name = path.Base(u.Path)
+	}
+	file, err := saveFetched(dir, name, ext, data)
+	if err != nil {
+		return "", fmt.Errorf("failed to save download of %s: %v", rawURL, err)
+	}
+	return file, nil
+}
+
+// saveFetched writes data to dir as name, with its image extensions replaced
+// by ext, and returns the file's path.
+func saveFetched(dir, name, ext string, data []byte) (string, error) {
+	name = trimImageExt(name)
+	if name == "" || name == "/" || name == "." {
+		name = "image"
+	}
+	file := filepath.Join(dir, name+ext)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	return file, os.WriteFile(file, data, 0o644)
+}
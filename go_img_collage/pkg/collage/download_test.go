@@ -0,0 +1,83 @@
+// download_test.go
+package collage
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestFetchImagesCache(t *testing.T) {
+	var mu sync.Mutex
+	etag, sent, notModified := `"v1"`, 0, 0
+	body := func(w int) []byte {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, 1))); err != nil {
+			t.Fatal(err)
+		}
+		return buf.Bytes()
+	}
+	data := body(1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		sent++
+		w.Header().Set("ETag", etag)
+		w.Write(data) // no Content-Type: the image is sniffed
+	}))
+	defer srv.Close()
+
+	opts := DefaultOptions()
+	opts.DownloadCache = t.TempDir()
+	fetch := func() []byte {
+		t.Helper()
+		local, _, cleanup, err := FetchImages([]string{srv.URL + "/photos/IMG_0001"}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cleanup()
+		if len(local) != 1 {
+			t.Fatalf("FetchImages() = %v, want one file", local)
+		}
+		got, err := os.ReadFile(local[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	tests := []struct {
+		name              string
+		change            func()
+		sent, notModified int
+	}{
+		{"first run downloads", func() {}, 1, 0},
+		{"unchanged file is revalidated", func() {}, 1, 1},
+		{"changed file is downloaded again", func() { etag, data = `"v2"`, body(2) }, 2, 1},
+		{"damaged cache entry is replaced", func() {
+			os.WriteFile((&downloadCache{dir: opts.DownloadCache}).downloadPath(srv.URL+"/photos/IMG_0001", ".data"), []byte("x"), 0o644)
+		}, 3, 1},
+	}
+	for _, tt := range tests {
+		mu.Lock()
+		tt.change()
+		want := data
+		mu.Unlock()
+		if got := fetch(); !bytes.Equal(got, want) {
+			t.Errorf("%s: fetched %d bytes, want the %d served", tt.name, len(got), len(want))
+		}
+		if sent != tt.sent || notModified != tt.notModified {
+			t.Errorf("%s: server sent %d files and %d Not Modified, want %d and %d", tt.name, sent, notModified, tt.sent, tt.notModified)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+// errlog.go
+package collage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"sort"
+	"sync"
+	"text/tabwriter"
+)
+
+// Errors the entry points wrap so callers, such as the command's exit status,
+// can tell the kinds of failure apart with errors.Is.
+var (
+	// ErrNoImages is returned when no images are left to draw.
+	ErrNoImages = errors.New("no images found")
+	// ErrImageFailed is returned with Options.Strict for the first image that cannot be used.
+	ErrImageFailed = errors.New("failed to process image")
+	// ErrEncode is returned when the output cannot be encoded or written.
+	ErrEncode = errors.New("failed to write output")
+)
+
+var (
+	// errUnsupportedFormat is returned for files no decoder is registered for.
+	errUnsupportedFormat = errors.New("unsupported file extension")
+	// errTimedOut is returned when processing an image exceeds -image-timeout.
+	errTimedOut = errors.New("timed out")
+)
+
+// imageError is a failure to process a single source image.
+type imageError struct {
+	Path string
+	Kind string
+	Err  error
+}
+
+// errorLog collects per-image errors. Only the first limit of them are logged as
+// they happen; the rest are counted and reported by summary, grouped by kind.
+type errorLog struct {
+	mu      sync.Mutex
+	log     *log.Logger
+	limit   int
+	entries []imageError
+}
+
+func newErrorLog(limit int, log *log.Logger) *errorLog {
+	return &errorLog{log: log, limit: limit}
+}
+
+// imageFailure is the error a strict run stops with when the image at path fails with err.
+func imageFailure(path string, err error) error {
+	return fmt.Errorf("%w '%s': %v", ErrImageFailed, path, err)
+}
+
+// errorKind classifies err into a coarse category for the summary table.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, errTimedOut):
+		return "timeout"
+	case errors.Is(err, errUnsupportedFormat):
+		return "unsupported format"
+	case errors.Is(err, fs.ErrNotExist):
+		return "missing file"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied"
+	case isTransient(err):
+		return "read error (transient)"
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return "read error"
+	}
+	return "decode error"
+}
+
+// add records that path failed with err.
+func (l *errorLog) add(path string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, imageError{Path: path, Kind: errorKind(err), Err: err})
+	switch n := len(l.entries); {
+	case n <= l.limit:
+		l.log.Printf("Error processing '%s': %v", path, err)
+	case n == l.limit+1:
+		l.log.Printf("Further errors are not shown individually; see the summary at the end")
+	}
+}
+
+// failed returns the set of paths that failed.
+func (l *errorLog) failed() map[string]bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	failed := make(map[string]bool, len(l.entries))
+	for _, e := range l.entries {
+		failed[e.Path] = true
+	}
+	return failed
+}
+
+// count returns the number of recorded errors.
+func (l *errorLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.entries)
+}
+
+// summary writes a table of errors grouped by kind, most frequent first, with
+// the number of distinct messages and one example of each kind.
+func (l *errorLog) summary(w io.Writer) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) == 0 {
+		return
+	}
+
+	type group struct {
+		kind     string
+		count    int
+		messages map[string]bool
+		example  imageError
+	}
+	groups := map[string]*group{}
+	for _, e := range l.entries {
+		g, ok := groups[e.Kind]
+		if !ok {
+			g = &group{kind: e.Kind, messages: map[string]bool{}, example: e}
+			groups[e.Kind] = g
+		}
+		g.count++
+		g.messages[e.Err.Error()] = true
+	}
+	var sorted []*group
+	for _, g := range groups {
+		sorted = append(sorted, g)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].kind < sorted[j].kind
+	})
+
+	fmt.Fprintf(w, "\n%d images could not be processed:\n", len(l.entries))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "  KIND\tCOUNT\tDISTINCT\tEXAMPLE")
+	for _, g := range sorted {
+		fmt.Fprintf(tw, "  %s\t%d\t%d\t%s: %v\n", g.kind, g.count, len(g.messages), g.example.Path, g.example.Err)
+	}
+	tw.Flush()
+}
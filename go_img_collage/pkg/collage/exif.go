@@ -0,0 +1,298 @@
+// exif.go
+package collage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF tags read by the collage.
+const (
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagDateTimeOriginal = 0x9003
+)
+
+// exifEntry is the raw value of one EXIF tag.
+type exifEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// exifData holds the tags of the main (IFD0) and Exif sub-IFD of an image.
+type exifData struct {
+	order binary.ByteOrder
+	tags  map[uint16]exifEntry
+}
+
+// exifTypeSizes gives the size in bytes of one value of each TIFF field type.
+var exifTypeSizes = map[uint16]uint32{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// parseEXIF returns the EXIF data embedded in a JPEG (APP1 segment) or WebP
+// (EXIF chunk) file, or nil if there is none or it cannot be parsed.
+func parseEXIF(data []byte) *exifData {
+	return parseTIFF(exifTIFF(data))
+}
+
+// exifTIFF returns the TIFF structure holding the EXIF data of a JPEG or WebP
+// file, or nil if there is none.
+func exifTIFF(data []byte) []byte {
+	switch {
+	case len(data) > 4 && data[0] == 0xFF && data[1] == 0xD8:
+		return jpegEXIF(data)
+	case len(data) > 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return webpEXIF(data)
+	}
+	return nil
+}
+
+// exifHeader reads the part of the JPEG or WebP file at path that parseEXIF
+// needs, without the image data: the segments before the scan of a JPEG, or
+// the RIFF header and EXIF chunk of a WebP. Other files give nil.
+func exifHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return nil, truncated(err)
+	}
+	switch {
+	case head[0] == 0xFF && head[1] == 0xD8:
+		return jpegHeader(io.MultiReader(bytes.NewReader(head), f))
+	case string(head[:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return webpHeader(head, f)
+	}
+	return nil, nil
+}
+
+// jpegHeader copies the JPEG segments from r up to the start of the image
+// data, which is where jpegEXIF stops looking.
+func jpegHeader(r io.Reader) ([]byte, error) {
+	data := make([]byte, 2, 64<<10)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, truncated(err)
+	}
+	for {
+		marker := make([]byte, 4)
+		if _, err := io.ReadFull(r, marker[:2]); err != nil {
+			return data, truncated(err)
+		}
+		data = append(data, marker[:2]...)
+		switch m := marker[1]; {
+		case marker[0] != 0xFF, m == 0xDA, m == 0xD9:
+			return data, nil
+		case m == 0xD8, m == 0x01, m >= 0xD0 && m <= 0xD7:
+			continue
+		}
+		if _, err := io.ReadFull(r, marker[2:]); err != nil {
+			return data, truncated(err)
+		}
+		data = append(data, marker[2:]...)
+		n := int(binary.BigEndian.Uint16(marker[2:]))
+		if n < 2 {
+			return data, nil
+		}
+		seg := make([]byte, n-2)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return data, truncated(err)
+		}
+		data = append(data, seg...)
+	}
+}
+
+// webpHeader returns the RIFF header head of a WebP file followed by its EXIF
+// chunk, seeking past the chunks before it.
+func webpHeader(head []byte, f io.ReadSeeker) ([]byte, error) {
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(f, chunk); err != nil {
+			return nil, truncated(err)
+		}
+		n := int64(binary.LittleEndian.Uint32(chunk[4:]))
+		if string(chunk[:4]) != "EXIF" {
+			if _, err := f.Seek(n+n%2, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		body := make([]byte, n)
+		if _, err := io.ReadFull(f, body); err != nil {
+			return nil, truncated(err)
+		}
+		return append(append(head, chunk...), body...), nil
+	}
+}
+
+// truncated returns nil for the error of a read that ran past the end of the
+// file, which only means the metadata looked for is missing.
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+	return err
+}
+
+// parseTIFF parses the IFD0 and Exif sub-IFD of an EXIF TIFF structure, or
+// returns nil if it is missing or invalid.
+func parseTIFF(tiff []byte) *exifData {
+	if len(tiff) < 8 {
+		return nil
+	}
+
+	e := &exifData{tags: map[uint16]exifEntry{}}
+	switch string(tiff[:2]) {
+	case "II":
+		e.order = binary.LittleEndian
+	case "MM":
+		e.order = binary.BigEndian
+	default:
+		return nil
+	}
+	if !e.readIFD(tiff, e.order.Uint32(tiff[4:])) {
+		return nil
+	}
+	if sub, ok := e.tags[tagExifIFD]; ok && len(sub.value) == 4 {
+		e.readIFD(tiff, e.order.Uint32(sub.value))
+	}
+	return e
+}
+
+// jpegEXIF returns the TIFF structure of the Exif APP1 segment of a JPEG file.
+func jpegEXIF(data []byte) []byte {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xD8 || marker == 0x01 || (marker >= 0xD0 && marker <= 0xD7) {
+			i += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // image data follows; no more metadata
+			return nil
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return nil
+		}
+		seg := data[i+4 : i+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return seg[6:]
+		}
+		i += 2 + n
+	}
+	return nil
+}
+
+// webpEXIF returns the contents of the EXIF chunk of a WebP file.
+func webpEXIF(data []byte) []byte {
+	for i := 12; i+8 <= len(data); {
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n < 0 || i+8+n > len(data) {
+			return nil
+		}
+		if string(data[i:i+4]) == "EXIF" {
+			// Some writers keep the JPEG "Exif\0\0" prefix.
+			return bytes.TrimPrefix(data[i+8:i+8+n], []byte("Exif\x00\x00"))
+		}
+		i += 8 + n + n%2
+	}
+	return nil
+}
+
+// readIFD adds the entries of the IFD at offset in tiff to e.tags, without
+// overwriting tags already read. It reports whether the IFD was valid.
+func (e *exifData) readIFD(tiff []byte, offset uint32) bool {
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return false
+	}
+	count := int(e.order.Uint16(tiff[offset:]))
+	pos := int(offset) + 2
+	if pos+count*12 > len(tiff) {
+		return false
+	}
+	for i := 0; i < count; i++ {
+		entry := tiff[pos+i*12 : pos+i*12+12]
+		tag, typ, n := e.order.Uint16(entry), e.order.Uint16(entry[2:]), e.order.Uint32(entry[4:])
+		size, ok := exifTypeSizes[typ]
+		if !ok || n > uint32(len(tiff)) {
+			continue
+		}
+		value := entry[8:12]
+		if total := size * n; total > 4 {
+			off := e.order.Uint32(entry[8:])
+			if uint64(off)+uint64(total) > uint64(len(tiff)) {
+				continue
+			}
+			value = tiff[off : off+total]
+		} else {
+			value = value[:total]
+		}
+		if _, seen := e.tags[tag]; !seen {
+			e.tags[tag] = exifEntry{typ: typ, count: n, value: value}
+		}
+	}
+	return true
+}
+
+// uint returns the first value of an integer tag.
+func (e *exifData) uint(tag uint16) (uint32, bool) {
+	if e == nil {
+		return 0, false
+	}
+	entry, ok := e.tags[tag]
+	if !ok || entry.count == 0 {
+		return 0, false
+	}
+	switch entry.typ {
+	case 1, 7:
+		return uint32(entry.value[0]), true
+	case 3:
+		return uint32(e.order.Uint16(entry.value)), true
+	case 4:
+		return e.order.Uint32(entry.value), true
+	}
+	return 0, false
+}
+
+// str returns the value of an ASCII tag without its terminating NULs and surrounding spaces.
+func (e *exifData) str(tag uint16) string {
+	if e == nil {
+		return ""
+	}
+	entry, ok := e.tags[tag]
+	if !ok || entry.typ != 2 {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimRight(string(entry.value), "\x00"))
+}
+
+// dateTaken returns the capture time (DateTimeOriginal, else DateTime) in local time.
+func (e *exifData) dateTaken() (time.Time, bool) {
+	for _, tag := range []uint16{tagDateTimeOriginal, tagDateTime} {
+		if t, err := time.ParseInLocation("2006:01:02 15:04:05", e.str(tag), time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// orientation returns the EXIF orientation (1-8), or 1 if the image has none.
+func (e *exifData) orientation() int {
+	o, ok := e.uint(tagOrientation)
+	if !ok || o < 1 || o > 8 {
+		return 1
+	}
+	return int(o)
+}
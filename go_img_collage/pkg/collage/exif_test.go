@@ -0,0 +1,187 @@
+// exif_test.go
+package collage
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testTag is an IFD entry for buildTIFF; value is stored out of line if it
+// is longer than four bytes.
+type testTag struct {
+	tag, typ uint16
+	count    uint32
+	value    []byte
+}
+
+// byteOrder is binary.LittleEndian or binary.BigEndian.
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// buildTIFF returns an EXIF TIFF structure with the entries of ifd0 and, if
+// not nil, an Exif sub-IFD with those of sub.
+func buildTIFF(order byteOrder, ifd0, sub []testTag) []byte {
+	if sub != nil {
+		ifd0 = append(ifd0, testTag{tagExifIFD, 4, 1, nil}) // offset filled in below
+	}
+	ifdSize := func(n int) uint32 { return uint32(2 + 12*n + 4) }
+	subOffset := 8 + ifdSize(len(ifd0))
+	dataOffset := subOffset
+	if sub != nil {
+		dataOffset += ifdSize(len(sub))
+	}
+	var data []byte
+	ifd := func(tags []testTag) []byte {
+		out := order.AppendUint16(nil, uint16(len(tags)))
+		for _, t := range tags {
+			value := t.value
+			if t.tag == tagExifIFD {
+				value = order.AppendUint32(nil, subOffset)
+			}
+			out = order.AppendUint16(out, t.tag)
+			out = order.AppendUint16(out, t.typ)
+			out = order.AppendUint32(out, t.count)
+			if len(value) > 4 {
+				out = order.AppendUint32(out, dataOffset+uint32(len(data)))
+				data = append(data, value...)
+				continue
+			}
+			out = append(out, value...)
+			out = append(out, make([]byte, 4-len(value))...)
+		}
+		return order.AppendUint32(out, 0)
+	}
+	tiff := []byte("II*\x00")
+	if order.String() == binary.BigEndian.String() {
+		tiff = []byte("MM\x00*")
+	}
+	tiff = order.AppendUint32(tiff, 8)
+	tiff = append(tiff, ifd(ifd0)...)
+	if sub != nil {
+		tiff = append(tiff, ifd(sub)...)
+	}
+	return append(tiff, data...)
+}
+
+// shortTag and asciiTag return IFD entries of a SHORT and an ASCII value.
+func shortTag(order byteOrder, tag, v uint16) testTag {
+	return testTag{tag, 3, 1, order.AppendUint16(nil, v)}
+}
+
+func asciiTag(tag uint16, s string) testTag {
+	return testTag{tag, 2, uint32(len(s) + 1), append([]byte(s), 0)}
+}
+
+func TestParseTIFF(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	date := func(s string) time.Time {
+		d, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	truncated := buildTIFF(le, []testTag{shortTag(le, tagOrientation, 6)}, nil)
+	truncated = truncated[:12]
+	badOffset := buildTIFF(le, []testTag{{tagDateTime, 2, 20, nil}}, nil)
+	le.PutUint32(badOffset[8+2+8:], 1000) // value of DateTime past the end
+
+	tests := []struct {
+		name        string
+		tiff        []byte
+		valid       bool
+		orientation int
+		taken       time.Time // zero if none
+	}{
+		{"little-endian orientation", buildTIFF(le, []testTag{shortTag(le, tagOrientation, 6)}, nil), true, 6, time.Time{}},
+		{"big-endian orientation", buildTIFF(be, []testTag{shortTag(be, tagOrientation, 8)}, nil), true, 8, time.Time{}},
+		{"long orientation", buildTIFF(le, []testTag{{tagOrientation, 4, 1, le.AppendUint32(nil, 3)}}, nil), true, 3, time.Time{}},
+		{"orientation out of range", buildTIFF(le, []testTag{shortTag(le, tagOrientation, 9)}, nil), true, 1, time.Time{}},
+		{"no tags", buildTIFF(le, nil, nil), true, 1, time.Time{}},
+		{"original date in the Exif IFD", buildTIFF(be,
+			[]testTag{asciiTag(tagDateTime, "2024:05:02 10:00:00")},
+			[]testTag{asciiTag(tagDateTimeOriginal, "2024:05:01 09:30:00")}), true, 1, date("2024-05-01 09:30:00")},
+		{"modification date only", buildTIFF(le, []testTag{asciiTag(tagDateTime, "2023:12:31 23:59:59")}, nil), true, 1, date("2023-12-31 23:59:59")},
+		{"unparsable date", buildTIFF(le, []testTag{asciiTag(tagDateTime, "yesterday")}, nil), true, 1, time.Time{}},
+		{"value out of bounds", badOffset, true, 1, time.Time{}},
+		{"truncated IFD", truncated, false, 1, time.Time{}},
+		{"unknown byte order", append([]byte("XX"), buildTIFF(le, nil, nil)[2:]...), false, 1, time.Time{}},
+		{"too short", []byte("II*\x00"), false, 1, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := parseTIFF(tt.tiff)
+			if (e != nil) != tt.valid {
+				t.Fatalf("parseTIFF() = %v, want valid %v", e, tt.valid)
+			}
+			if e == nil {
+				return
+			}
+			if got := e.orientation(); got != tt.orientation {
+				t.Errorf("orientation() = %d, want %d", got, tt.orientation)
+			}
+			taken, ok := e.dateTaken()
+			if ok != !tt.taken.IsZero() || !taken.Equal(tt.taken) {
+				t.Errorf("dateTaken() = %v, %v, want %v", taken, ok, tt.taken)
+			}
+		})
+	}
+}
+
+func TestParseEXIF(t *testing.T) {
+	le := binary.LittleEndian
+	tiff := buildTIFF(le, []testTag{shortTag(le, tagOrientation, 6)}, nil)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	jpeg := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0, 4, 0, 0} // SOI and a short APP0
+	jpeg = append(jpeg, 0xFF, 0xE1)
+	jpeg = binary.BigEndian.AppendUint16(jpeg, uint16(len(app1)+2))
+	jpeg = append(jpeg, app1...)
+	jpeg = append(jpeg, 0xFF, 0xDA, 0, 2)
+
+	webp := func(chunk []byte) []byte {
+		out := []byte("RIFF\x00\x00\x00\x00WEBPVP8 ")
+		out = le.AppendUint32(out, 1)
+		out = append(out, 0, 0) // one byte of image data and its padding
+		out = append(out, "EXIF"...)
+		out = le.AppendUint32(out, uint32(len(chunk)))
+		return append(out, chunk...)
+	}
+	afterScan := []byte{0xFF, 0xD8, 0xFF, 0xDA, 0, 2, 0xFF, 0xE1}
+
+	tests := []struct {
+		name        string
+		data        []byte
+		orientation int
+	}{
+		{"JPEG APP1", jpeg, 6},
+		{"WebP EXIF chunk", webp(tiff), 6},
+		{"WebP EXIF chunk with JPEG prefix", webp(app1), 6},
+		{"JPEG without EXIF", []byte{0xFF, 0xD8, 0xFF, 0xD9}, 1},
+		{"JPEG with metadata after the scan", afterScan, 1},
+		{"PNG", []byte("\x89PNG\r\n\x1a\n"), 1},
+	}
+	dir := t.TempDir()
+	for _, tt := range tests {
+		if got := parseEXIF(tt.data).orientation(); got != tt.orientation {
+			t.Errorf("%s: orientation = %d, want %d", tt.name, got, tt.orientation)
+		}
+
+		// Reading only the header of the file finds the same tags.
+		path := filepath.Join(dir, "image")
+		if err := os.WriteFile(path, tt.data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		header, err := exifHeader(path)
+		if err != nil {
+			t.Fatalf("%s: exifHeader() error = %v", tt.name, err)
+		}
+		if got := parseEXIF(header).orientation(); got != tt.orientation {
+			t.Errorf("%s: orientation from exifHeader() = %d, want %d", tt.name, got, tt.orientation)
+		}
+	}
+}
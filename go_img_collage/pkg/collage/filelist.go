@@ -0,0 +1,76 @@
+// filelist.go
+package collage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ReadImageList reads the images of a collage, in cell order, from a list of
+// paths one per line, so another tool can pick them instead of a scan. path
+// "-" reads standard input. Blank lines and lines starting with # are
+// ignored; files without a supported extension are recorded in skipped.
+// http(s) URLs are kept for FetchImages, whatever their extension.
+func ReadImageList(path string, skipped *SkipLog) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file list: %v", err)
+		}
+		defer f.Close()
+		r = f
+	}
+	var images []string
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64<<10), 1<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !IsURL(line) && !IsImageFile(line) {
+			skipped.Add(line, SkipUnsupported, filepath.Ext(line))
+			continue
+		}
+		images = append(images, line)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read file list: %v", err)
+	}
+	return images, nil
+}
+
+// ImageFolder returns the folder of an image path or URL.
+func ImageFolder(p string) string {
+	if IsURL(p) {
+		u, err := url.Parse(p)
+		if err != nil {
+			return p
+		}
+		if dir := path.Dir(u.Path); dir != "." && dir != "/" {
+			return u.Scheme + "://" + u.Host + dir
+		}
+		return u.Scheme + "://" + u.Host
+	}
+	return filepath.Dir(p)
+}
+
+// ImageFolders returns the folders of paths in order of first appearance.
+func ImageFolders(paths []string) []string {
+	seen := map[string]bool{}
+	var folders []string
+	for _, path := range paths {
+		if dir := ImageFolder(path); !seen[dir] {
+			seen[dir] = true
+			folders = append(folders, dir)
+		}
+	}
+	return folders
+}
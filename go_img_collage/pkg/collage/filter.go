@@ -0,0 +1,132 @@
+// filter.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// hasFilters reports whether any image quality filter is enabled.
+func (opts Options) hasFilters() bool {
+	return opts.SkipBlurry > 0 || opts.SkipUniform > 0
+}
+
+// rejects returns the reason the image with the given statistics is filtered
+// out and a detail for the skip report, or "" if it is kept.
+func (opts Options) rejects(st imageStats) (reason, detail string) {
+	if opts.SkipBlurry > 0 && st.Sharpness < opts.SkipBlurry {
+		return SkipBlurry, fmt.Sprintf("sharpness %.1f below %.1f", st.Sharpness, opts.SkipBlurry)
+	}
+	if opts.SkipUniform > 0 && st.Uniformity >= opts.SkipUniform {
+		return SkipUniform, fmt.Sprintf("%.1f%% one colour, at least %.1f%%", 100*st.Uniformity, 100*opts.SkipUniform)
+	}
+	return "", ""
+}
+
+// analyzeImages analyses the images in parallel for the quality filters and
+// sort keys. Images that cannot be read get nil statistics.
+func analyzeImages(paths []string, opts Options) []*imageStats {
+	stats := make([]*imageStats, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if opts.canceled() != nil {
+					continue // drain the queue
+				}
+				st, err := withTimeout(opts.ImageTimeout, func() (imageStats, error) {
+					return loadStats(paths[i], opts)
+				})
+				if err == nil {
+					stats[i] = &st
+				}
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return stats
+}
+
+// filterImages drops the images rejected by the quality filters before layout,
+// recording them in opts.Skipped, and returns the kept paths with their
+// statistics. Images that could not be analysed are kept, so rendering
+// reports their error as usual.
+func filterImages(paths []string, stats []*imageStats, opts Options) ([]string, []*imageStats) {
+	if !opts.hasFilters() {
+		return paths, stats
+	}
+	var kept []string
+	var keptStats []*imageStats
+	for i, path := range paths {
+		if stats[i] != nil {
+			if reason, detail := opts.rejects(*stats[i]); reason != "" {
+				opts.Skipped.Add(path, reason, detail)
+				continue
+			}
+		}
+		kept = append(kept, path)
+		keptStats = append(keptStats, stats[i])
+	}
+	if dropped := len(paths) - len(kept); dropped > 0 {
+		opts.logger().Printf("Filtered out %d of %d images\n", dropped, len(paths))
+	}
+	return kept, keptStats
+}
+
+// filterSmall drops the images smaller than opts.MinBytes on disk or
+// opts.MinWidth by opts.MinHeight pixels as drawn, such as thumbnails and stub
+// files, recording them in opts.Skipped. Only the image headers are read;
+// images whose size cannot be read are kept, so rendering reports their error.
+func filterSmall(paths []string, opts Options) []string {
+	if opts.MinBytes <= 0 && opts.MinWidth <= 0 && opts.MinHeight <= 0 {
+		return paths
+	}
+	var sizes []image.Point
+	if opts.MinWidth > 0 || opts.MinHeight > 0 {
+		sizes = imageSizes(paths, opts)
+	}
+	var kept []string
+	for i, path := range paths {
+		if opts.MinBytes > 0 {
+			if info, err := os.Stat(path); err == nil && info.Size() < opts.MinBytes {
+				opts.Skipped.Add(path, SkipTooSmall, fmt.Sprintf("%d bytes, below %d", info.Size(), opts.MinBytes))
+				continue
+			}
+		}
+		if sizes != nil && sizes[i] != (image.Point{}) && (sizes[i].X < opts.MinWidth || sizes[i].Y < opts.MinHeight) {
+			opts.Skipped.Add(path, SkipTooSmall, fmt.Sprintf("%dx%d, below %dx%d", sizes[i].X, sizes[i].Y, opts.MinWidth, opts.MinHeight))
+			continue
+		}
+		kept = append(kept, path)
+	}
+	if dropped := len(paths) - len(kept); dropped > 0 {
+		opts.logger().Printf("Left out %d of %d images as too small\n", dropped, len(paths))
+	}
+	return kept
+}
+
+// loadStats loads the image at path, upright unless opts.NoEXIFRotate is set, and analyses it.
+func loadStats(path string, opts Options) (imageStats, error) {
+	data, err := opts.Retry.readFile(path, opts.logger())
+	if err != nil {
+		return imageStats{}, err
+	}
+	var img image.Image
+	if img, err = decodeImage(opts.context(), path, data, opts.Frame); err != nil {
+		return imageStats{}, err
+	}
+	if !opts.NoEXIFRotate {
+		img = orient(img, parseEXIF(data).orientation())
+	}
+	return analyzeImage(img), nil
+}
@@ -0,0 +1,166 @@
+// fonts.go
+package collage
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/go-text/typesetting/font"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+// fallbackFonts are system fonts tried, in order, for characters missing from
+// the main font: CJK first, then monochrome emoji and symbols, then wide-coverage fonts.
+var fallbackFonts = []string{
+	"NotoSansCJK-Regular.ttc", "NotoSansCJKsc-Regular.otf", "NotoSansCJKjp-Regular.otf",
+	"SourceHanSans-Regular.ttc", "wqy-microhei.ttc", "wqy-zenhei.ttc", "DroidSansFallbackFull.ttf",
+	"PingFang.ttc", "Hiragino Sans GB.ttc", "AppleSDGothicNeo.ttc", "msyh.ttc", "msgothic.ttc", "malgun.ttf",
+	"NotoEmoji-Regular.ttf", "NotoSansSymbols2-Regular.ttf", "Symbola.ttf", "seguiemj.ttf", "seguisym.ttf", "Apple Symbols.ttf",
+	"NotoSans-Regular.ttf", "DejaVuSans.ttf", "Arial Unicode.ttf", "arialuni.ttf", "arial.ttf",
+}
+
+// fontDirs returns the directories searched for fallback fonts.
+func fontDirs() []string {
+	home, _ := os.UserHomeDir()
+	switch runtime.GOOS {
+	case "windows":
+		return []string{filepath.Join(os.Getenv("WINDIR"), "Fonts"), filepath.Join(os.Getenv("LOCALAPPDATA"), "Microsoft", "Windows", "Fonts")}
+	case "darwin":
+		return []string{"/System/Library/Fonts", "/Library/Fonts", filepath.Join(home, "Library", "Fonts")}
+	}
+	return []string{"/usr/share/fonts", "/usr/local/share/fonts", filepath.Join(home, ".fonts"), filepath.Join(home, ".local", "share", "fonts")}
+}
+
+// fontSet is a main font plus the fallbacks used for characters it lacks. It
+// implements shaping.Fontmap, so text is split into runs by the font that draws
+// them. Fallbacks are located and parsed only once a missing character is seen.
+// The faces of a set cache glyph lookups and are not safe for concurrent use,
+// so each render takes its own set from loadFonts; the parsed fonts behind
+// them are shared.
+type fontSet struct {
+	main *font.Face
+
+	mu        sync.Mutex
+	fallbacks []*font.Face // nil until loadFallbacks has run
+	resolved  map[rune]*font.Face
+}
+
+var (
+	fontsMu        sync.Mutex
+	parsedFonts    = map[string]*font.Font{} // main fonts by path; "" is the built-in Go font
+	fallbackParsed []*font.Font              // nil until findFallbacks has run
+)
+
+// loadFonts returns a new font set with the font at path, or the built-in Go
+// font if path is empty, as its main font. Fonts are parsed once per path.
+func loadFonts(path string) (*fontSet, error) {
+	fontsMu.Lock()
+	defer fontsMu.Unlock()
+	f, ok := parsedFonts[path]
+	if !ok {
+		data := goregular.TTF
+		if path != "" {
+			var err error
+			if data, err = os.ReadFile(path); err != nil {
+				return nil, fmt.Errorf("failed to read font: %v", err)
+			}
+		}
+		var err error
+		if f, err = parseFont(data); err != nil {
+			return nil, fmt.Errorf("failed to parse font %s: %v", path, err)
+		}
+		parsedFonts[path] = f
+	}
+	return &fontSet{main: font.NewFace(f), resolved: map[rune]*font.Face{}}, nil
+}
+
+// parseFont parses a TrueType/OpenType font, or the first font of a collection (.ttc).
+func parseFont(data []byte) (*font.Font, error) {
+	faces, err := font.ParseTTC(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return faces[0].Font, nil
+}
+
+// loadFallbacks gives the set its own faces of the installed fallback fonts.
+// Callers hold s.mu.
+func (s *fontSet) loadFallbacks() {
+	if s.fallbacks != nil {
+		return
+	}
+	s.fallbacks = []*font.Face{}
+	for _, f := range findFallbacks() {
+		s.fallbacks = append(s.fallbacks, font.NewFace(f))
+	}
+}
+
+// findFallbacks finds and parses the installed fallback fonts, once. Fonts
+// that fail to parse are ignored.
+func findFallbacks() []*font.Font {
+	fontsMu.Lock()
+	defer fontsMu.Unlock()
+	if fallbackParsed != nil {
+		return fallbackParsed
+	}
+	fallbackParsed = []*font.Font{}
+
+	want := map[string]int{}
+	for i, name := range fallbackFonts {
+		want[strings.ToLower(name)] = i
+	}
+	found := make([]string, len(fallbackFonts))
+	for _, dir := range fontDirs() {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if i, ok := want[strings.ToLower(d.Name())]; ok && found[i] == "" {
+				found[i] = path
+			}
+			return nil
+		})
+	}
+	for _, path := range found {
+		if path == "" {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if f, err := parseFont(data); err == nil {
+			fallbackParsed = append(fallbackParsed, f)
+		}
+	}
+	return fallbackParsed
+}
+
+// ResolveFace returns the first font of the set with a glyph for r, or the main
+// font if none has one.
+func (s *fontSet) ResolveFace(r rune) *font.Face {
+	if _, ok := s.main.NominalGlyph(r); ok || r < ' ' {
+		return s.main
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.resolved[r]; ok {
+		return f
+	}
+	s.loadFallbacks()
+	f := s.main
+	for _, fb := range s.fallbacks {
+		if _, ok := fb.NominalGlyph(r); ok {
+			f = fb
+			break
+		}
+	}
+	s.resolved[r] = f
+	return f
+}
@@ -0,0 +1,94 @@
+// hierarchy.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+)
+
+// overviewQuality is the WebP quality of the per-folder collages that become
+// the cells of a hierarchical collage.
+const overviewQuality = 95
+
+// overview prepares a hierarchical collage: it builds one collage per folder of
+// the images and returns the options for the master collage, whose images are
+// those folder collages captioned with the folder names. cleanup removes the
+// folder collages once the master has been rendered.
+func (opts Options) overview() (master Options, cleanup func(), err error) {
+	paths, err := opts.imagePaths()
+	if err != nil {
+		return Options{}, nil, err
+	}
+
+	// Step 1: Group the images by folder, keeping the folder order.
+	var folders []string
+	groups := map[string][]string{}
+	for _, p := range paths {
+		dir := filepath.Dir(p)
+		if _, ok := groups[dir]; !ok {
+			folders = append(folders, dir)
+		}
+		groups[dir] = append(groups[dir], p)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "collage-overview-*")
+	if err != nil {
+		return Options{}, nil, fmt.Errorf("failed to create temp dir: %v", err)
+	}
+	cleanup = func() { os.RemoveAll(tmpDir) }
+	defer onInterrupt(cleanup)()
+
+	// Step 2: Build each folder collage about one master cell wide. They are
+	// already filtered and sorted, and the layout options of the master apply only to it.
+	sub := opts.selected(nil)
+	sub.Hierarchical = false
+	sub.Cols, sub.Rows, sub.Reserved, sub.TitleCells, sub.Size = 0, 0, nil, nil, ""
+	sub.TilePrint, sub.Bleed, sub.CropMarks = "", 0, false
+	sub.Quiet = true
+	var images []string
+	for i, dir := range folders {
+		opts.logger().Printf("Building folder collage %d of %d: %s\n", i+1, len(folders), dir)
+		sub.Images = groups[dir]
+		sub.CellSize = max(16, opts.CellSize/int(math.Ceil(math.Sqrt(float64(len(sub.Images))))))
+		img, err := build(sub)
+		if err != nil {
+			cleanup()
+			return Options{}, nil, fmt.Errorf("failed to build collage of %s: %v", dir, err)
+		}
+
+		// The file name becomes the caption.
+		out := filepath.Join(tmpDir, fmt.Sprintf("%03d", i), filepath.Base(dir)+".webp")
+		if err := writeOverviewCell(out, img, opts); err != nil {
+			cleanup()
+			return Options{}, nil, err
+		}
+		images = append(images, out)
+	}
+
+	// Step 3: Lay the folder collages out like images, captioned by folder name.
+	master = opts.selected(images)
+	master.Hierarchical = false
+	master.Caption = CaptionFilename
+	master.Badges, master.ScoreBorders, master.Frame = nil, false, 0
+	return master, cleanup, nil
+}
+
+// writeOverviewCell saves a folder collage as lossy WebP at path.
+func writeOverviewCell(path string, img *image.RGBA, opts Options) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create temp dir: %v", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	defer f.Close()
+	opts.WebPLossless, opts.Quality = false, overviewQuality
+	if err := encoders[".webp"].encode(f, img, opts); err != nil {
+		return fmt.Errorf("failed to encode folder collage: %v", err)
+	}
+	return nil
+}
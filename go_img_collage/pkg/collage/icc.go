@@ -0,0 +1,646 @@
+// icc.go
+package collage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"unicode/utf16"
+)
+
+// iccProfile is a CMYK output (printer) profile: the file itself, to embed in
+// the output, the sRGB to CMYK separation built from its BToA0 table and, for
+// soft-proofing, the colours the press prints from its AToB table.
+type iccProfile struct {
+	data []byte
+	name string // profile description, used as the output condition of a PDF
+
+	labPCS   bool        // the profile connection space is CIELAB rather than XYZ
+	toCMYK   iccPipeline // PCS to CMYK (BToA0, perceptual)
+	fromCMYK iccPipeline // CMYK to PCS (AToB1, colorimetric, else AToB0); nil if missing
+
+	// link samples the whole sRGB to CMYK conversion on a linkGrid³ lattice,
+	// interpolated per pixel instead of running the pipeline for each;
+	// proofLink likewise samples sRGB to the sRGB colour printed, made on
+	// the first proof.
+	link      []float32
+	proofOnce sync.Once
+	proofLink []float32
+}
+
+// linkGrid is the number of lattice points per sRGB channel in iccProfile.link.
+const linkGrid = 33
+
+// iccProfiles caches the parsed profiles by path; they are read-only once built.
+var (
+	iccMu       sync.Mutex
+	iccProfiles = map[string]*iccProfile{}
+)
+
+// loadICCProfile reads and checks the CMYK output profile at path.
+func loadICCProfile(path string) (*iccProfile, error) {
+	iccMu.Lock()
+	defer iccMu.Unlock()
+	if p, ok := iccProfiles[path]; ok {
+		return p, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ICC profile: %v", err)
+	}
+	p, err := parseICCProfile(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ICC profile %s: %v", path, err)
+	}
+	iccProfiles[path] = p
+	return p, nil
+}
+
+// parseICCProfile parses an ICC profile and returns an error unless it is a
+// CMYK output profile with a BToA0 table to separate colours with.
+func parseICCProfile(data []byte) (*iccProfile, error) {
+	be := binary.BigEndian
+	if len(data) < 132 || string(data[36:40]) != "acsp" {
+		return nil, fmt.Errorf("not an ICC profile")
+	}
+	if class := string(data[12:16]); class != "prtr" {
+		return nil, fmt.Errorf("%q is not an output (printer) profile", strings.TrimSpace(class))
+	}
+	if space := string(data[16:20]); space != "CMYK" {
+		return nil, fmt.Errorf("profile is for %s, not CMYK", strings.TrimSpace(space))
+	}
+	p := &iccProfile{data: data}
+	switch string(data[20:24]) {
+	case "Lab ":
+		p.labPCS = true
+	case "XYZ ":
+	default:
+		return nil, fmt.Errorf("unknown profile connection space %q", data[20:24])
+	}
+
+	// Step 1: Find the tags.
+	tags := map[string][]byte{}
+	count := int(be.Uint32(data[128:]))
+	if count > (len(data)-132)/12 {
+		return nil, fmt.Errorf("truncated tag table")
+	}
+	for i := 0; i < count; i++ {
+		e := data[132+12*i:]
+		off, size := int(be.Uint32(e[4:])), int(be.Uint32(e[8:]))
+		if off < 0 || size < 8 || off > len(data) || size > len(data)-off {
+			return nil, fmt.Errorf("tag %q lies outside the profile", e[:4])
+		}
+		tags[string(e[:4])] = data[off : off+size]
+	}
+
+	// Step 2: Build the separation from the perceptual BToA table.
+	b2a, ok := tags["B2A0"]
+	if !ok {
+		return nil, fmt.Errorf("profile has no BToA0 table to separate colours with")
+	}
+	var err error
+	if p.toCMYK, err = parseICCTransform(b2a, 3, 4, p.labPCS); err != nil {
+		return nil, fmt.Errorf("BToA0: %v", err)
+	}
+	for _, sig := range []string{"A2B1", "A2B0"} {
+		if a2b, ok := tags[sig]; ok {
+			if p.fromCMYK, err = parseICCTransform(a2b, 4, 3, p.labPCS); err != nil {
+				return nil, fmt.Errorf("%s: %v", sig, err)
+			}
+			break
+		}
+	}
+	p.name = iccDescription(tags["desc"])
+	if p.name == "" {
+		p.name = "Custom"
+	}
+
+	// Step 3: Sample the sRGB to CMYK conversion.
+	p.link = make([]float32, 0, linkGrid*linkGrid*linkGrid*4)
+	for r := 0; r < linkGrid; r++ {
+		for g := 0; g < linkGrid; g++ {
+			for b := 0; b < linkGrid; b++ {
+				rgb := [3]float64{float64(r) / (linkGrid - 1), float64(g) / (linkGrid - 1), float64(b) / (linkGrid - 1)}
+				pcs := p.encodePCS(srgbToXYZ50(rgb))
+				for _, v := range p.toCMYK.apply(pcs[:]) {
+					p.link = append(p.link, float32(v))
+				}
+			}
+		}
+	}
+	return p, nil
+}
+
+// separate converts an sRGB colour to CMYK through the profile.
+func (p *iccProfile) separate(r, g, b uint8) (c, m, y, k uint8) {
+	out := interpolateLink(p.link, [3]float32{float32(r) / 255, float32(g) / 255, float32(b) / 255})
+	q := func(v float32) uint8 { return uint8(math.Min(255, math.Max(0, float64(v)*255+0.5))) }
+	return q(out[0]), q(out[1]), q(out[2]), q(out[3])
+}
+
+// proof returns the sRGB colour (components 0-1) an sRGB colour comes out
+// as when separated with the profile and printed.
+func (p *iccProfile) proof(rgb [3]float64) [3]float64 {
+	p.proofOnce.Do(func() {
+		p.proofLink = make([]float32, 0, linkGrid*linkGrid*linkGrid*4)
+		for r := 0; r < linkGrid; r++ {
+			for g := 0; g < linkGrid; g++ {
+				for b := 0; b < linkGrid; b++ {
+					in := p.encodePCS(srgbToXYZ50([3]float64{float64(r) / (linkGrid - 1), float64(g) / (linkGrid - 1), float64(b) / (linkGrid - 1)}))
+					printed := xyz50ToSRGB(p.decodePCS(p.fromCMYK.apply(p.toCMYK.apply(in[:]))))
+					p.proofLink = append(p.proofLink, float32(printed[0]), float32(printed[1]), float32(printed[2]), 0)
+				}
+			}
+		}
+	})
+	out := interpolateLink(p.proofLink, [3]float32{float32(rgb[0]), float32(rgb[1]), float32(rgb[2])})
+	return [3]float64{float64(out[0]), float64(out[1]), float64(out[2])}
+}
+
+// interpolateLink interpolates trilinearly a linkGrid³ lattice of four
+// channels sampled over sRGB at the colour rgb (components 0-1).
+func interpolateLink(link []float32, rgb [3]float32) [4]float32 {
+	var i0 [3]int
+	var f [3]float32
+	for ch, v := range rgb {
+		pos := float32(unit(float64(v))) * (linkGrid - 1)
+		i0[ch] = min(int(pos), linkGrid-2)
+		f[ch] = pos - float32(i0[ch])
+	}
+	var out [4]float32
+	for corner := 0; corner < 8; corner++ {
+		w, idx := float32(1), 0
+		for ch := 0; ch < 3; ch++ {
+			i := i0[ch]
+			if corner>>(2-ch)&1 == 1 {
+				w *= f[ch]
+				i++
+			} else {
+				w *= 1 - f[ch]
+			}
+			idx = idx*linkGrid + i
+		}
+		if w == 0 {
+			continue
+		}
+		for o := range out {
+			out[o] += w * link[idx*4+o]
+		}
+	}
+	return out
+}
+
+// encodePCS returns a D50 XYZ colour in the normalized encoding the profile's
+// tables take: CIELAB or XYZ, depending on its connection space.
+func (p *iccProfile) encodePCS(xyz [3]float64) [3]float64 {
+	if !p.labPCS {
+		// u1Fixed15: 1.0 is 0x8000 of 0xFFFF.
+		for i := range xyz {
+			xyz[i] = unit(xyz[i] * 0x8000 / 0xFFFF)
+		}
+		return xyz
+	}
+	lab := xyzToLab50(xyz)
+	return [3]float64{
+		unit(lab[0] / 100),
+		unit((lab[1] + 128) / 255),
+		unit((lab[2] + 128) / 255),
+	}
+}
+
+// decodePCS returns the D50 XYZ colour of a colour in the normalized encoding
+// of the profile connection space.
+func (p *iccProfile) decodePCS(v []float64) [3]float64 {
+	if !p.labPCS {
+		return [3]float64{v[0] * 0xFFFF / 0x8000, v[1] * 0xFFFF / 0x8000, v[2] * 0xFFFF / 0x8000}
+	}
+	return lab50ToXYZ([3]float64{v[0] * 100, v[1]*255 - 128, v[2]*255 - 128})
+}
+
+// d50 is the white point of the profile connection space.
+var d50 = [3]float64{0.9642, 1, 0.8249}
+
+// srgbToXYZ50 converts an sRGB colour (components 0-1) to XYZ, adapted to D50
+// with the Bradford transform as ICC profiles expect.
+func srgbToXYZ50(rgb [3]float64) [3]float64 {
+	r, g, b := srgbToLinear(rgb[0]), srgbToLinear(rgb[1]), srgbToLinear(rgb[2])
+	return [3]float64{
+		0.4360747*r + 0.3850649*g + 0.1430804*b,
+		0.2225045*r + 0.7168786*g + 0.0606169*b,
+		0.0139322*r + 0.0971045*g + 0.7141733*b,
+	}
+}
+
+// xyzToLab50 converts a D50 XYZ colour to CIELAB.
+func xyzToLab50(xyz [3]float64) [3]float64 {
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(xyz[0]/d50[0]), f(xyz[1]/d50[1]), f(xyz[2]/d50[2])
+	return [3]float64{116*fy - 16, 500 * (fx - fy), 200 * (fy - fz)}
+}
+
+// lab50ToXYZ converts a CIELAB colour to D50 XYZ.
+func lab50ToXYZ(lab [3]float64) [3]float64 {
+	finv := func(t float64) float64 {
+		if t > 6.0/29 {
+			return t * t * t
+		}
+		return (116*t - 16) * 27 / 24389
+	}
+	fy := (lab[0] + 16) / 116
+	return [3]float64{d50[0] * finv(fy+lab[1]/500), d50[1] * finv(fy), d50[2] * finv(fy-lab[2]/200)}
+}
+
+// xyz50ToSRGB converts a D50 XYZ colour to sRGB (components 0-1), clipping
+// what sRGB cannot show.
+func xyz50ToSRGB(xyz [3]float64) [3]float64 {
+	x, y, z := xyz[0], xyz[1], xyz[2]
+	return [3]float64{
+		linearToSRGB(3.1338561*x - 1.6168667*y - 0.4906146*z),
+		linearToSRGB(-0.9787684*x + 1.9161415*y + 0.0334540*z),
+		linearToSRGB(0.0719453*x - 0.2289914*y + 1.4052427*z),
+	}
+}
+
+// iccDescription returns the text of a profileDescriptionTag, in either the
+// version 2 (desc) or version 4 (mluc) form.
+func iccDescription(tag []byte) string {
+	be := binary.BigEndian
+	switch {
+	case len(tag) >= 12 && string(tag[:4]) == "desc":
+		n := int(be.Uint32(tag[8:]))
+		if n > len(tag)-12 {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+	case len(tag) >= 28 && string(tag[:4]) == "mluc":
+		n, off := int(be.Uint32(tag[20:])), int(be.Uint32(tag[24:]))
+		if off < 0 || n < 0 || off > len(tag) || n > len(tag)-off {
+			return ""
+		}
+		units := make([]uint16, n/2)
+		for i := range units {
+			units[i] = be.Uint16(tag[off+2*i:])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	return ""
+}
+
+// iccPipeline is a colour transform as a sequence of stages, each taking and
+// returning channel values normalized to 0-1.
+type iccPipeline []func(in []float64) []float64
+
+// apply runs in through the pipeline.
+func (p iccPipeline) apply(in []float64) []float64 {
+	v := in
+	for _, stage := range p {
+		v = stage(v)
+	}
+	return v
+}
+
+// parseICCTransform parses a lut8, lut16, lutAToB or lutBToA tag with nIn input
+// and nOut output channels into a pipeline. labPCS selects the legacy CIELAB
+// encoding of 16-bit luts.
+func parseICCTransform(tag []byte, nIn, nOut int, labPCS bool) (iccPipeline, error) {
+	if len(tag) < 32 {
+		return nil, fmt.Errorf("truncated table")
+	}
+	if int(tag[8]) != nIn || int(tag[9]) != nOut {
+		return nil, fmt.Errorf("table maps %d to %d channels, want %d to %d", tag[8], tag[9], nIn, nOut)
+	}
+	switch typ := string(tag[:4]); typ {
+	case "mft1", "mft2":
+		return parseLut(tag, nIn, nOut, typ == "mft2", labPCS)
+	case "mAB ", "mBA ":
+		return parseLutAB(tag, nIn, nOut, typ == "mAB ")
+	default:
+		return nil, fmt.Errorf("unsupported table type %q", typ)
+	}
+}
+
+// parseLut parses a lut8Type (mft1) or lut16Type (mft2): matrix (for XYZ
+// input), input curves, CLUT and output curves.
+func parseLut(tag []byte, nIn, nOut int, wide, labPCS bool) (iccPipeline, error) {
+	be := binary.BigEndian
+	grid := int(tag[10])
+	inEntries, outEntries, pos, size := 256, 256, 48, 1
+	if wide {
+		if len(tag) < 52 {
+			return nil, fmt.Errorf("truncated table")
+		}
+		inEntries, outEntries, pos, size = int(be.Uint16(tag[48:])), int(be.Uint16(tag[50:])), 52, 2
+	}
+	points := 1
+	for i := 0; i < nIn; i++ {
+		points *= grid
+	}
+	if grid < 2 || inEntries < 2 || outEntries < 2 ||
+		len(tag) < pos+size*(nIn*inEntries+points*nOut+nOut*outEntries) {
+		return nil, fmt.Errorf("truncated table")
+	}
+	read := func(n int) []float64 {
+		vs := make([]float64, n)
+		for i := range vs {
+			if wide {
+				vs[i] = float64(be.Uint16(tag[pos:])) / 0xFFFF
+			} else {
+				vs[i] = float64(tag[pos]) / 0xFF
+			}
+			pos += size
+		}
+		return vs
+	}
+
+	var p iccPipeline
+	if nIn == 3 && !labPCS {
+		var m [12]float64
+		for i := 0; i < 9; i++ {
+			m[i] = s15Fixed16(tag[12+4*i:])
+		}
+		p = append(p, matrixStage(m))
+	}
+	in := make([]iccCurve, nIn)
+	for i := range in {
+		in[i] = sampledCurve(read(inEntries))
+	}
+	grids := make([]int, nIn)
+	for i := range grids {
+		grids[i] = grid
+	}
+	clut := newCLUT(grids, nOut, read(points*nOut))
+	out := make([]iccCurve, nOut)
+	for i := range out {
+		out[i] = sampledCurve(read(outEntries))
+	}
+	// 16-bit luts encode CIELAB with 100 and 127.996 at 0xFF00 rather than 0xFFFF.
+	const legacyLab = float64(0xFF00) / 0xFFFF
+	scale := func(k float64) func([]float64) []float64 {
+		return func(v []float64) []float64 { return []float64{v[0] * k, v[1] * k, v[2] * k} }
+	}
+	if wide && labPCS && nIn == 3 {
+		p = append(p, scale(legacyLab))
+	}
+	p = append(p, curveStage(in), clut.eval, curveStage(out))
+	if wide && labPCS && nOut == 3 {
+		p = append(p, scale(1/legacyLab))
+	}
+	return p, nil
+}
+
+// parseLutAB parses a lutAToBType (mAB) or lutBToAType (mBA); any of their
+// curve sets, matrix and CLUT may be left out.
+func parseLutAB(tag []byte, nIn, nOut int, aToB bool) (iccPipeline, error) {
+	be := binary.BigEndian
+	offB, offMatrix, offM := int(be.Uint32(tag[12:])), int(be.Uint32(tag[16:])), int(be.Uint32(tag[20:]))
+	offCLUT, offA := int(be.Uint32(tag[24:])), int(be.Uint32(tag[28:]))
+	curves := func(off, n int) (func([]float64) []float64, error) {
+		if off == 0 {
+			return nil, nil
+		}
+		cs := make([]iccCurve, n)
+		for i := range cs {
+			c, size, err := parseCurve(tag, off)
+			if err != nil {
+				return nil, err
+			}
+			cs[i] = c
+			off += (size + 3) &^ 3
+		}
+		return curveStage(cs), nil
+	}
+
+	// The A side has the device channels, the B side the connection space.
+	nA, nB := nIn, nOut
+	if !aToB {
+		nA, nB = nOut, nIn
+	}
+	a, err := curves(offA, nA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := curves(offB, nB)
+	if err != nil {
+		return nil, err
+	}
+	m, err := curves(offM, nB)
+	if err != nil {
+		return nil, err
+	}
+	var matrix func([]float64) []float64
+	if offMatrix != 0 {
+		if offMatrix < 0 || offMatrix > len(tag)-48 {
+			return nil, fmt.Errorf("truncated matrix")
+		}
+		var mat [12]float64
+		for i := range mat {
+			mat[i] = s15Fixed16(tag[offMatrix+4*i:])
+		}
+		matrix = matrixStage(mat)
+	}
+	var clut func([]float64) []float64
+	if offCLUT != 0 {
+		if offCLUT < 0 || offCLUT > len(tag)-20 {
+			return nil, fmt.Errorf("truncated CLUT")
+		}
+		grids := make([]int, nIn)
+		points := 1
+		for i := range grids {
+			grids[i] = int(tag[offCLUT+i])
+			if grids[i] < 2 {
+				return nil, fmt.Errorf("CLUT has %d grid points", grids[i])
+			}
+			points *= grids[i]
+		}
+		size := int(tag[offCLUT+16])
+		pos := offCLUT + 20
+		if size != 1 && size != 2 || len(tag) < pos+points*nOut*size {
+			return nil, fmt.Errorf("truncated CLUT")
+		}
+		vs := make([]float64, points*nOut)
+		for i := range vs {
+			if size == 2 {
+				vs[i] = float64(be.Uint16(tag[pos+2*i:])) / 0xFFFF
+			} else {
+				vs[i] = float64(tag[pos+i]) / 0xFF
+			}
+		}
+		clut = newCLUT(grids, nOut, vs).eval
+	}
+
+	stages := []func([]float64) []float64{b, matrix, m, clut, a}
+	if aToB {
+		stages = []func([]float64) []float64{a, clut, m, matrix, b}
+	}
+	var p iccPipeline
+	for _, s := range stages {
+		if s != nil {
+			p = append(p, s)
+		}
+	}
+	return p, nil
+}
+
+// unit clamps v to 0-1.
+func unit(v float64) float64 {
+	return math.Min(1, math.Max(0, v))
+}
+
+// s15Fixed16 decodes a signed 15.16 fixed-point number.
+func s15Fixed16(b []byte) float64 {
+	return float64(int32(binary.BigEndian.Uint32(b))) / 0x10000
+}
+
+// iccCurve maps a channel value (0-1) to another.
+type iccCurve func(float64) float64
+
+// curveStage applies one curve to each channel.
+func curveStage(curves []iccCurve) func([]float64) []float64 {
+	return func(v []float64) []float64 {
+		out := make([]float64, len(v))
+		for i, c := range curves {
+			out[i] = c(v[i])
+		}
+		return out
+	}
+}
+
+// matrixStage multiplies three channels by the 3×3 matrix in m[:9] and adds
+// the offsets in m[9:].
+func matrixStage(m [12]float64) func([]float64) []float64 {
+	return func(v []float64) []float64 {
+		out := make([]float64, 3)
+		for i := range out {
+			out[i] = unit(m[3*i]*v[0] + m[3*i+1]*v[1] + m[3*i+2]*v[2] + m[9+i])
+		}
+		return out
+	}
+}
+
+// sampledCurve interpolates a curve given as evenly spaced samples.
+func sampledCurve(samples []float64) iccCurve {
+	return func(x float64) float64 {
+		pos := unit(x) * float64(len(samples)-1)
+		i := min(int(pos), len(samples)-2)
+		f := pos - float64(i)
+		return samples[i]*(1-f) + samples[i+1]*f
+	}
+}
+
+// parseCurve parses the curveType (curv) or parametricCurveType (para) at off
+// in tag and returns it with its size in bytes.
+func parseCurve(tag []byte, off int) (iccCurve, int, error) {
+	be := binary.BigEndian
+	if off < 0 || off > len(tag)-12 {
+		return nil, 0, fmt.Errorf("truncated curve")
+	}
+	c := tag[off:]
+	switch string(c[:4]) {
+	case "curv":
+		n := int(be.Uint32(c[8:]))
+		if n < 0 || n > (len(c)-12)/2 {
+			return nil, 0, fmt.Errorf("truncated curve")
+		}
+		switch n {
+		case 0:
+			return func(x float64) float64 { return x }, 12, nil
+		case 1:
+			gamma := float64(be.Uint16(c[12:])) / 0x100
+			return func(x float64) float64 { return math.Pow(unit(x), gamma) }, 14, nil
+		}
+		samples := make([]float64, n)
+		for i := range samples {
+			samples[i] = float64(be.Uint16(c[12+2*i:])) / 0xFFFF
+		}
+		return sampledCurve(samples), 12 + 2*n, nil
+	case "para":
+		fn := int(be.Uint16(c[8:]))
+		counts := []int{1, 3, 4, 5, 7}
+		if fn >= len(counts) || len(c) < 12+4*counts[fn] {
+			return nil, 0, fmt.Errorf("unsupported parametric curve")
+		}
+		// Parameters g, a, b, c, d, e, f; the simpler functions use the first few.
+		var v [7]float64
+		for i := 0; i < counts[fn]; i++ {
+			v[i] = s15Fixed16(c[12+4*i:])
+		}
+		g, a, b, cc, d, e, f := v[0], v[1], v[2], v[3], v[4], v[5], v[6]
+		curve := func(x float64) float64 {
+			x = unit(x)
+			switch fn {
+			case 1, 2:
+				if a == 0 || x < -b/a {
+					return cc // zero for function 1
+				}
+				return math.Pow(math.Max(0, a*x+b), g) + cc
+			case 3, 4:
+				if x < d {
+					return cc*x + f // f is zero for function 3
+				}
+				return math.Pow(math.Max(0, a*x+b), g) + e
+			}
+			return math.Pow(x, g)
+		}
+		return curve, 12 + 4*counts[fn], nil
+	}
+	return nil, 0, fmt.Errorf("unsupported curve type %q", c[:4])
+}
+
+// clut is a multidimensional colour lookup table; the first input channel
+// varies slowest.
+type clut struct {
+	grids   []int
+	strides []int
+	nOut    int
+	data    []float64
+}
+
+func newCLUT(grids []int, nOut int, data []float64) *clut {
+	strides := make([]int, len(grids))
+	stride := 1
+	for i := len(grids) - 1; i >= 0; i-- {
+		strides[i] = stride
+		stride *= grids[i]
+	}
+	return &clut{grids: grids, strides: strides, nOut: nOut, data: data}
+}
+
+// eval interpolates the table at in linearly in every dimension.
+func (c *clut) eval(in []float64) []float64 {
+	n := len(c.grids)
+	i0 := make([]int, n)
+	f := make([]float64, n)
+	for d := range c.grids {
+		pos := unit(in[d]) * float64(c.grids[d]-1)
+		i0[d] = min(int(pos), c.grids[d]-2)
+		f[d] = pos - float64(i0[d])
+	}
+	out := make([]float64, c.nOut)
+	for corner := 0; corner < 1<<n; corner++ {
+		w, idx := 1.0, 0
+		for d := 0; d < n; d++ {
+			if corner>>d&1 == 1 {
+				w *= f[d]
+				idx += (i0[d] + 1) * c.strides[d]
+			} else {
+				w *= 1 - f[d]
+				idx += i0[d] * c.strides[d]
+			}
+		}
+		if w == 0 {
+			continue
+		}
+		for o := range out {
+			out[o] += w * c.data[idx*c.nOut+o]
+		}
+	}
+	return out
+}
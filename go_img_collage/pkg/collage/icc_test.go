@@ -0,0 +1,234 @@
+// icc_test.go
+package collage
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// testProfile builds an ICC profile of the given class and colour space with a
+// Lab connection space and the given tags.
+func testProfile(class, space string, tags map[string][]byte) []byte {
+	be := binary.BigEndian
+	header := make([]byte, 128)
+	copy(header[12:], class)
+	copy(header[16:], space)
+	copy(header[20:], "Lab ")
+	copy(header[36:], "acsp")
+	table := be.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	offset := 128 + 4 + 12*len(tags)
+	for _, sig := range []string{"desc", "A2B0", "B2A0"} {
+		tag, ok := tags[sig]
+		if !ok {
+			continue
+		}
+		table = append(table, sig...)
+		table = be.AppendUint32(table, uint32(offset+len(data)))
+		table = be.AppendUint32(table, uint32(len(tag)))
+		data = append(data, tag...)
+		for len(data)%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+	return append(append(header, table...), data...)
+}
+
+// testCLUT returns the samples of a 2×2×2 CLUT mapping Lab to CMYK with
+// C = 1-L, M = a, Y = b and K = 0, which trilinear interpolation reproduces exactly.
+func testCLUT() []uint16 {
+	var vs []uint16
+	for l := 0; l < 2; l++ {
+		for a := 0; a < 2; a++ {
+			for b := 0; b < 2; b++ {
+				vs = append(vs, uint16(0xFFFF*(1-l)), uint16(0xFFFF*a), uint16(0xFFFF*b), 0)
+			}
+		}
+	}
+	return vs
+}
+
+// testLut16 returns a lut16Type (mft2) BToA table with identity curves.
+func testLut16() []byte {
+	be := binary.BigEndian
+	tag := []byte("mft2\x00\x00\x00\x00")
+	tag = append(tag, 3, 4, 2, 0)
+	for i := 0; i < 9; i++ {
+		var v uint32
+		if i%4 == 0 {
+			v = 0x10000
+		}
+		tag = be.AppendUint32(tag, v)
+	}
+	tag = be.AppendUint16(tag, 2)
+	tag = be.AppendUint16(tag, 2)
+	for i := 0; i < 3; i++ {
+		tag = be.AppendUint16(be.AppendUint16(tag, 0), 0xFFFF)
+	}
+	for _, v := range testCLUT() {
+		tag = be.AppendUint16(tag, v)
+	}
+	for i := 0; i < 4; i++ {
+		tag = be.AppendUint16(be.AppendUint16(tag, 0), 0xFFFF)
+	}
+	return tag
+}
+
+// testLutAToB returns a lut16Type (mft2) AToB table undoing testLut16: L = 1-C,
+// a = M and b = Y, whatever K.
+func testLutAToB() []byte {
+	be := binary.BigEndian
+	tag := []byte("mft2\x00\x00\x00\x00")
+	tag = append(tag, 4, 3, 2, 0)
+	tag = append(tag, make([]byte, 36)...)
+	tag = be.AppendUint16(tag, 2)
+	tag = be.AppendUint16(tag, 2)
+	for i := 0; i < 4; i++ {
+		tag = be.AppendUint16(be.AppendUint16(tag, 0), 0xFFFF)
+	}
+	for c := 0; c < 2; c++ {
+		for m := 0; m < 2; m++ {
+			for y := 0; y < 2; y++ {
+				for k := 0; k < 2; k++ {
+					tag = be.AppendUint16(tag, uint16(0xFFFF*(1-c)))
+					tag = be.AppendUint16(tag, uint16(0xFFFF*m))
+					tag = be.AppendUint16(tag, uint16(0xFFFF*y))
+				}
+			}
+		}
+	}
+	for i := 0; i < 3; i++ {
+		tag = be.AppendUint16(be.AppendUint16(tag, 0), 0xFFFF)
+	}
+	return tag
+}
+
+// testLutBToA returns a lutBToAType (mBA) table with identity B curves, a
+// 16-bit CLUT and identity A curves.
+func testLutBToA() []byte {
+	be := binary.BigEndian
+	identity := []byte("curv\x00\x00\x00\x00\x00\x00\x00\x00")
+	tag := []byte("mBA \x00\x00\x00\x00")
+	tag = append(tag, 3, 4, 0, 0)
+	offB := 32
+	offCLUT := offB + 3*len(identity)
+	offA := offCLUT + 20 + 2*len(testCLUT())
+	for _, off := range []int{offB, 0, 0, offCLUT, offA} {
+		tag = be.AppendUint32(tag, uint32(off))
+	}
+	for i := 0; i < 3; i++ {
+		tag = append(tag, identity...)
+	}
+	grid := make([]byte, 20)
+	grid[0], grid[1], grid[2], grid[16] = 2, 2, 2, 2
+	tag = append(tag, grid...)
+	for _, v := range testCLUT() {
+		tag = be.AppendUint16(tag, v)
+	}
+	for i := 0; i < 4; i++ {
+		tag = append(tag, identity...)
+	}
+	return tag
+}
+
+func TestParseICCProfile(t *testing.T) {
+	desc := append([]byte("desc\x00\x00\x00\x00\x00\x00\x00\x05"), "Press\x00"...)
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+		want    string // description of a valid profile
+	}{
+		{"lut16", testProfile("prtr", "CMYK", map[string][]byte{"B2A0": testLut16(), "desc": desc}), "", "Press"},
+		{"lutBToA", testProfile("prtr", "CMYK", map[string][]byte{"B2A0": testLutBToA()}), "", "Custom"},
+		{"not a profile", []byte("GIF89a"), "not an ICC profile", ""},
+		{"display profile", testProfile("mntr", "RGB ", nil), "not an output", ""},
+		{"RGB printer", testProfile("prtr", "RGB ", map[string][]byte{"B2A0": testLut16()}), "not CMYK", ""},
+		{"no separation", testProfile("prtr", "CMYK", map[string][]byte{"desc": desc}), "no BToA0", ""},
+		{"truncated table", testProfile("prtr", "CMYK", map[string][]byte{"B2A0": testLut16()[:60]}), "truncated", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := parseICCProfile(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseICCProfile() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseICCProfile() error = %v", err)
+			}
+			if p.name != tt.want {
+				t.Errorf("name = %q, want %q", p.name, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeparate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rgb     [3]uint8
+		lut16   [4]uint8 // 16-bit luts scale CIELAB by 0xFF00/0xFFFF
+		lutBToA [4]uint8
+	}{
+		{"white", [3]uint8{255, 255, 255}, [4]uint8{1, 128, 128, 0}, [4]uint8{0, 128, 128, 0}},
+		{"black", [3]uint8{0, 0, 0}, [4]uint8{255, 128, 128, 0}, [4]uint8{255, 128, 128, 0}},
+		{"red", [3]uint8{255, 0, 0}, [4]uint8{117, 208, 196, 0}, [4]uint8{116, 209, 197, 0}},
+	}
+	profiles := map[string]*iccProfile{}
+	for name, tag := range map[string][]byte{"lut16": testLut16(), "lutBToA": testLutBToA()} {
+		p, err := parseICCProfile(testProfile("prtr", "CMYK", map[string][]byte{"B2A0": tag}))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		profiles[name] = p
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, want := range map[string][4]uint8{"lut16": tt.lut16, "lutBToA": tt.lutBToA} {
+				c, m, y, k := profiles[name].separate(tt.rgb[0], tt.rgb[1], tt.rgb[2])
+				got := [4]uint8{c, m, y, k}
+				for i := range got {
+					if d := int(got[i]) - int(want[i]); d < -2 || d > 2 {
+						t.Errorf("%s: separate(%v) = %v, want %v", name, tt.rgb, got, want)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProof(t *testing.T) {
+	// The AToB table undoes the BToA one, so the press prints every colour as is.
+	p, err := parseICCProfile(testProfile("prtr", "CMYK", map[string][]byte{"B2A0": testLut16(), "A2B0": testLutAToB()}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.fromCMYK == nil {
+		t.Fatal("AToB0 table not read")
+	}
+	tests := []struct {
+		name string
+		rgb  [3]float64
+	}{
+		{"white", [3]float64{1, 1, 1}},
+		{"black", [3]float64{0, 0, 0}},
+		{"grey", [3]float64{0.5, 0.5, 0.5}},
+		{"orange", [3]float64{0.9, 0.6, 0.2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := p.proof(tt.rgb)
+			for i := range got {
+				if d := got[i] - tt.rgb[i]; d < -0.02 || d > 0.02 {
+					t.Errorf("proof(%v) = %v, want about the same colour", tt.rgb, got)
+					break
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,320 @@
+// imagemap.go
+package collage
+
+import (
+	"fmt"
+	"html/template"
+	"image"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// imageMapTemplate is the HTML page written by writeImageMap: the collage with
+// an image map linking every cell to its source image, and the same links as
+// a list for screen readers and keyboard users, searchable by the text read
+// from the images when there is some.
+var imageMapTemplate = template.Must(template.New("imagemap").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+{{- if .ThumbSize}}
+<style>
+.thumbs { list-style: none; display: flex; flex-wrap: wrap; gap: 8px; padding: 0; }
+.thumbs li { width: {{.ThumbSize}}px; font-size: small; overflow-wrap: anywhere; }
+.thumbs img { display: block; }
+</style>
+{{- end}}
+{{- if .Dark}}
+<meta name="color-scheme" content="light dark">
+<style>
+@media (prefers-color-scheme: dark) {
+  body { background: #121212; color: #e0e0e0; }
+  a { color: #8ab4f8; }
+}
+</style>
+{{- end}}
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<figure>
+<img src="{{.Src}}" width="{{.Width}}" height="{{.Height}}" alt="Collage of {{len .Areas}} images; each links to its original, listed below" usemap="#collage">
+<figcaption>{{.Title}}: {{len .Areas}} images</figcaption>
+</figure>
+<map name="collage">
+{{- range .Areas}}
+<area shape="rect" coords="{{.Coords}}" href="{{.Href}}" alt="{{.Alt}}" title="{{.Alt}}">
+{{- end}}
+</map>
+<nav aria-label="Images in the collage">
+{{- if .Search}}
+<p><input type="search" id="search" placeholder="Search the text in the images" aria-label="Search the text in the images" aria-controls="images"></p>
+{{- end}}
+<ol id="images"{{if .ThumbSize}} class="thumbs"{{end}}>
+{{- range .Areas}}
+<li{{with .Text}} data-text="{{.}}"{{end}}><a href="{{.Href}}">
+{{- with .Thumb}}<img src="{{.Src}}" srcset="{{.Srcset}}" sizes="{{.Width}}px" width="{{.Width}}" height="{{.Height}}" loading="lazy" decoding="async" alt="">{{end -}}
+{{.Alt}}</a></li>
+{{- end}}
+</ol>
+</nav>
+</main>
+{{- if .Search}}
+<script>
+document.getElementById("search").addEventListener("input", e => {
+  const words = e.target.value.toLowerCase().split(/\s+/).filter(w => w);
+  for (const li of document.querySelectorAll("#images li")) {
+    const text = (li.textContent + " " + (li.dataset.text || "")).toLowerCase();
+    li.hidden = !words.every(w => text.includes(w));
+  }
+});
+</script>
+{{- end}}
+</body>
+</html>
+`))
+
+// imageMapArea is one clickable cell of the image map.
+type imageMapArea struct {
+	Coords string
+	Href   template.URL
+	Alt    string
+	Text   string         // the text read from the image (see Options.Texts), if any
+	Thumb  *imageMapThumb // nil without opts.HTMLThumbs or if the image could not be read
+}
+
+// imageMapThumb is the thumbnail of a cell in the list of images: the
+// smallest size, of Width by Height pixels, and every size in Srcset.
+type imageMapThumb struct {
+	Src           template.URL
+	Srcset        template.Srcset
+	Width, Height int
+}
+
+// tagImageDescription is the EXIF tag of the image's title or description.
+const tagImageDescription = 0x010E
+
+// altText describes the image of cell c for the image map: its EXIF
+// description, else its caption (see Options.Caption) or file name, followed
+// by the capture date and camera when EXIF records them.
+func altText(c manifestCell, opts Options) string {
+	var exif *exifData
+	if data, err := opts.Retry.readFile(c.local(), opts.logger()); err == nil {
+		exif = parseEXIF(data)
+	}
+	text := strings.TrimSpace(exif.str(tagImageDescription))
+	if text == "" {
+		mode := opts.Caption
+		if mode == "" {
+			mode = CaptionFilename
+		}
+		text = captionText(mode, c.local(), c.Index, opts)
+	}
+	if t, ok := exif.dateTaken(); ok {
+		text += ", taken " + t.Format("2 January 2006")
+	}
+	if model := strings.TrimSpace(exif.str(tagModel)); model != "" {
+		text += " with " + model
+	}
+	return text
+}
+
+// writeImageMap writes an HTML page to opts.HTMLPath showing the collage with
+// each cell linked to its source image: by default the file itself, relative
+// to the page, or opts.LinkTemplate with {path}, {name} and {index} replaced.
+// Every link carries the image's altText; with opts.Texts the list of images
+// can be searched by the text in them; with opts.HTMLDark the page follows
+// the reader's dark-mode preference. With opts.HTMLThumbs, the list of images
+// shows lazily loaded thumbnails (see writeThumbnails).
+func writeImageMap(m *manifest, opts Options) error {
+	dir := filepath.Dir(opts.HTMLPath)
+	page := struct {
+		Title         string
+		Src           template.URL
+		Width, Height int
+		Dark          bool
+		ThumbSize     int
+		Search        bool
+		Areas         []imageMapArea
+	}{
+		Title:  filepath.Base(opts.OutputPath),
+		Src:    template.URL(fileURL(dir, opts.OutputPath)),
+		Width:  m.Width,
+		Height: m.Height,
+		Dark:   opts.HTMLDark,
+	}
+	thumbs, err := writeThumbnails(m, opts)
+	if err != nil {
+		return err
+	}
+	if len(opts.HTMLThumbs) > 0 {
+		page.ThumbSize = slices.Min(opts.HTMLThumbs)
+	}
+	for _, c := range m.Cells {
+		r := c.rect()
+		href := sourceURL(dir, c.Path)
+		if opts.LinkTemplate != "" {
+			p, name := linkFields(c.Path)
+			href = strings.NewReplacer(
+				"{path}", p,
+				"{name}", name,
+				"{index}", strconv.Itoa(c.Index),
+			).Replace(opts.LinkTemplate)
+		}
+		page.Areas = append(page.Areas, imageMapArea{
+			Coords: fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y),
+			Href:   template.URL(href),
+			Alt:    altText(c, opts),
+			Text:   opts.Texts[c.local()],
+			Thumb:  thumbs[c.Index],
+		})
+	}
+	page.Search = len(opts.Texts) > 0
+
+	f, err := os.Create(opts.HTMLPath)
+	if err != nil {
+		return err
+	}
+	if err := imageMapTemplate.Execute(f, page); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeThumbnails saves thumbnails of every cell's image, fitted into squares
+// of each opts.HTMLThumbs size, as JPEGs in a folder beside opts.HTMLPath
+// (collage.html gets collage_thumbs/), and returns them by cell index for the
+// page's srcset. Images that cannot be read get none.
+func writeThumbnails(m *manifest, opts Options) (map[int]*imageMapThumb, error) {
+	thumbs := map[int]*imageMapThumb{}
+	if len(opts.HTMLThumbs) == 0 {
+		return thumbs, nil
+	}
+	sizes := slices.Clone(opts.HTMLThumbs)
+	slices.Sort(sizes)
+	sizes = slices.Compact(sizes)
+	page := filepath.Dir(opts.HTMLPath)
+	dir := strings.TrimSuffix(opts.HTMLPath, filepath.Ext(opts.HTMLPath)) + "_thumbs"
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create thumbnail folder: %v", err)
+	}
+
+	var mu sync.Mutex // guards thumbs
+	jobs := make(chan manifestCell)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := opts
+			sub.Fit = FitContain
+			for c := range jobs {
+				var t imageMapThumb
+				var srcset []string
+				for i, size := range sizes {
+					img, err := loadResized(c.local(), size, size, sub, nil)
+					if err != nil {
+						opts.logger().Printf("Warning: no thumbnail of %s: %v", c.Path, err)
+						break
+					}
+					file := filepath.Join(dir, fmt.Sprintf("%d_%d.jpg", c.Index, size))
+					if err := writeThumbnail(file, img, opts); err != nil {
+						opts.logger().Printf("Warning: could not save thumbnail %s: %v", file, err)
+						break
+					}
+					src := fileURL(page, file)
+					if i == 0 {
+						t.Src, t.Width, t.Height = template.URL(src), img.Rect.Dx(), img.Rect.Dy()
+					}
+					srcset = append(srcset, fmt.Sprintf("%s %dw", src, img.Rect.Dx()))
+				}
+				if len(srcset) == len(sizes) {
+					t.Srcset = template.Srcset(strings.Join(srcset, ", "))
+					mu.Lock()
+					thumbs[c.Index] = &t
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, c := range m.Cells {
+		jobs <- c
+	}
+	close(jobs)
+	wg.Wait()
+	return thumbs, nil
+}
+
+// writeThumbnail saves img as a JPEG at path.
+func writeThumbnail(path string, img *image.RGBA, opts Options) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	opts.Quality = thumbnailQuality
+	if err := encodeJPEG(f, img, opts); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// thumbnailQuality is the JPEG quality of the HTML page's thumbnails.
+const thumbnailQuality = 80
+
+// fileURL returns a URL for path as seen from a page in dir: relative if
+// possible, otherwise an absolute file: URL.
+func fileURL(dir, path string) string {
+	if rel, err := filepath.Rel(dir, path); err == nil && filepath.IsAbs(dir) == filepath.IsAbs(path) {
+		return escapePath(filepath.ToSlash(rel))
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		abs = path
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(abs)}).String()
+}
+
+// sourceURL returns the link from a page in dir to where an image came from:
+// its URL, the archive holding it or its file.
+func sourceURL(dir, src string) string {
+	if IsURL(src) {
+		return src
+	}
+	if archive, _, ok := splitArchivePath(src); ok {
+		return fileURL(dir, archive)
+	}
+	return fileURL(dir, src)
+}
+
+// linkFields returns the escaped {path} and {name} of the image from src for
+// opts.LinkTemplate: those of its URL path if it was downloaded, else of its
+// file path (inside its archive, for an archive entry).
+func linkFields(src string) (p, name string) {
+	if IsURL(src) {
+		if u, err := url.Parse(src); err == nil {
+			p = u.EscapedPath()
+			return p, path.Base(p)
+		}
+	}
+	return escapePath(filepath.ToSlash(src)), url.PathEscape(filepath.Base(src))
+}
+
+// escapePath escapes each segment of a slash-separated path for use in a URL.
+func escapePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
@@ -0,0 +1,46 @@
+// imagemap_test.go
+package collage
+
+import (
+	"image"
+	"testing"
+)
+
+func TestSourceLinks(t *testing.T) {
+	tests := []struct {
+		src            string
+		href           string
+		wantPath, name string
+	}{
+		{"/site/photos/a b.jpg", "photos/a%20b.jpg", "/site/photos/a%20b.jpg", "a%20b.jpg"},
+		{"/elsewhere/x.jpg", "../elsewhere/x.jpg", "/elsewhere/x.jpg", "x.jpg"},
+		{"https://cdn.test/albums/a%20b.jpg?w=1", "https://cdn.test/albums/a%20b.jpg?w=1", "/albums/a%20b.jpg", "a%20b.jpg"},
+		{"/site/export.zip/Trip/c.jpg", "export.zip", "/site/export.zip/Trip/c.jpg", "c.jpg"},
+	}
+	for _, tt := range tests {
+		if got := sourceURL("/site", tt.src); got != tt.href {
+			t.Errorf("sourceURL(%q) = %q, want %q", tt.src, got, tt.href)
+		}
+		if p, name := linkFields(tt.src); p != tt.wantPath || name != tt.name {
+			t.Errorf("linkFields(%q) = %q, %q, want %q, %q", tt.src, p, name, tt.wantPath, tt.name)
+		}
+	}
+}
+
+func TestNewManifestSources(t *testing.T) {
+	layout := Layout{Cells: []image.Rectangle{image.Rect(0, 0, 10, 10), image.Rect(10, 0, 20, 10)}}
+	opts := DefaultOptions()
+	opts.Sources = map[string]string{"/tmp/dl/1.jpg": "https://cdn.test/1.jpg"}
+	m := newManifest(image.Rect(0, 0, 20, 10), image.Point{}, layout, []string{"/tmp/dl/1.jpg", "/photos/2.jpg"}, opts)
+	tests := []struct {
+		path, local string
+	}{
+		{"https://cdn.test/1.jpg", "/tmp/dl/1.jpg"},
+		{"/photos/2.jpg", "/photos/2.jpg"},
+	}
+	for i, tt := range tests {
+		if c := m.Cells[i]; c.Path != tt.path || c.local() != tt.local {
+			t.Errorf("cell %d: path %q, local %q, want %q, %q", i, c.Path, c.local(), tt.path, tt.local)
+		}
+	}
+}
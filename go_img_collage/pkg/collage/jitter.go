@@ -0,0 +1,70 @@
+// jitter.go
+package collage
+
+import (
+	"image"
+	"math"
+	"math/rand"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/math/f64"
+)
+
+// Random streams of a cell, so each kind of jitter varies independently.
+const (
+	streamRotation = iota
+	streamInset
+)
+
+// cellRand returns the random source for one stream of the cell at idx. It
+// depends only on the seed, the index and the stream, so a collage looks the
+// same on every run.
+func cellRand(seed int64, idx, stream int) *rand.Rand {
+	return rand.New(rand.NewSource((seed*1000003+int64(idx))*8 + int64(stream)))
+}
+
+// insetCell shrinks cell by opts.Inset pixels on every side, plus a random
+// extra of up to opts.InsetJitter pixels, keeping at least one pixel.
+func insetCell(cell image.Rectangle, idx int, opts Options) image.Rectangle {
+	n := opts.Inset
+	if opts.InsetJitter > 0 {
+		n += cellRand(opts.Seed, idx, streamInset).Intn(opts.InsetJitter + 1)
+	}
+	n = min(n, (min(cell.Dx(), cell.Dy())-1)/2)
+	if n <= 0 {
+		return cell
+	}
+	return cell.Inset(n)
+}
+
+// jitterAngle returns the rotation in degrees of the image in cell idx: uniform
+// in ±opts.JitterRotation, or 0 when jitter is off.
+func jitterAngle(idx int, opts Options) float64 {
+	if opts.JitterRotation <= 0 {
+		return 0
+	}
+	return (2*cellRand(opts.Seed, idx, streamRotation).Float64() - 1) * opts.JitterRotation
+}
+
+// pasteRotated draws img rotated by angle degrees about its centre, which is
+// placed at the centre of cell. The image is shrunk as needed so its rotated
+// corners stay inside the cell. It returns the unrotated rectangle the image
+// occupies, for captions and badges.
+func pasteRotated(dst *image.RGBA, cell image.Rectangle, img *image.RGBA, angle float64) image.Rectangle {
+	w, h := float64(img.Rect.Dx()), float64(img.Rect.Dy())
+	sin, cos := math.Sincos(angle * math.Pi / 180)
+	bw := w*math.Abs(cos) + h*math.Abs(sin)
+	bh := w*math.Abs(sin) + h*math.Abs(cos)
+	k := min(1, float64(cell.Dx())/bw, float64(cell.Dy())/bh)
+
+	// Map source pixels to the canvas: scale by k and rotate about the image centre.
+	cx, cy := w/2, h/2
+	dx, dy := float64(cell.Min.X)+float64(cell.Dx())/2, float64(cell.Min.Y)+float64(cell.Dy())/2
+	a, b, d, e := k*cos, -k*sin, k*sin, k*cos
+	s2d := f64.Aff3{a, b, dx - a*cx - b*cy, d, e, dy - d*cx - e*cy}
+	xdraw.BiLinear.Transform(dst, s2d, img, img.Rect, xdraw.Over, nil)
+
+	sw, sh := int(w*k), int(h*k)
+	x0, y0 := int(dx)-sw/2, int(dy)-sh/2
+	return image.Rect(x0, y0, x0+sw, y0+sh)
+}
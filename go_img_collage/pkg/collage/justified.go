@@ -0,0 +1,64 @@
+// justified.go
+package collage
+
+import (
+	"image"
+	"math"
+)
+
+// justifiedLayout packs the images, in order and without cropping, into rows
+// of a common height: images are added to a row at opts.CellSize pixels high
+// until it reaches the target width, then the row is scaled to fill that width
+// exactly. The last row keeps the target height. The width is opts.Cols cells
+// or that of a nearly square grid of the images. Images whose size cannot be
+// read count as square.
+func justifiedLayout(paths []string, opts Options) Layout {
+	cols := opts.Cols
+	if cols <= 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(len(paths)))))
+	}
+	width := cols*(opts.CellSize+opts.Gutter) - opts.Gutter
+
+	aspects := make([]float64, len(paths))
+	for i, s := range imageSizes(paths, opts) {
+		aspects[i] = 1
+		if s.X > 0 && s.Y > 0 {
+			aspects[i] = float64(s.X) / float64(s.Y)
+		}
+	}
+
+	layout := Layout{Width: width + 2*opts.Margin, Cells: make([]image.Rectangle, len(paths))}
+	y := opts.Margin
+	for start := 0; start < len(paths); {
+		// Step 1: Fill a row at the target height until it is wide enough.
+		end, sum := start, 0.0
+		for end < len(paths) {
+			sum += aspects[end]
+			end++
+			if sum*float64(opts.CellSize)+float64((end-start-1)*opts.Gutter) >= float64(width) {
+				break
+			}
+		}
+
+		// Step 2: Scale a full row to the exact width; the last one stays at the target height.
+		avail := float64(width - (end-start-1)*opts.Gutter)
+		height := avail / sum
+		if end == len(paths) && height > float64(opts.CellSize) {
+			height = float64(opts.CellSize)
+		}
+		h := max(1, int(math.Round(height)))
+
+		// Step 3: Place the cells, rounding the running edges so a full row ends flush.
+		x := 0.0
+		for i := start; i < end; i++ {
+			x0 := opts.Margin + int(math.Round(x)) + (i-start)*opts.Gutter
+			x += aspects[i] * height
+			x1 := opts.Margin + int(math.Round(x)) + (i-start)*opts.Gutter
+			layout.Cells[i] = image.Rect(x0, y, max(x0+1, x1), y+h)
+		}
+		y += h + opts.Gutter
+		start = end
+	}
+	layout.Height = y - opts.Gutter + opts.Margin
+	return layout
+}
@@ -0,0 +1,48 @@
+// justified_test.go
+package collage
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestJustifiedLayout(t *testing.T) {
+	wide, square := image.Pt(200, 100), image.Pt(100, 100)
+	tests := []struct {
+		name   string
+		sizes  []image.Point
+		cols   int
+		cells  []image.Rectangle
+		height int
+	}{
+		{
+			name: "full rows", sizes: []image.Point{wide, square, square, wide}, cols: 3,
+			cells:  []image.Rectangle{image.Rect(0, 0, 200, 100), image.Rect(200, 0, 300, 100), image.Rect(0, 100, 100, 200), image.Rect(100, 100, 300, 200)},
+			height: 200,
+		},
+		{
+			name: "scaled row", sizes: []image.Point{wide, wide}, cols: 3,
+			cells:  []image.Rectangle{image.Rect(0, 0, 150, 75), image.Rect(150, 0, 300, 75)},
+			height: 75,
+		},
+		{
+			name: "short last row", sizes: []image.Point{square}, cols: 3,
+			cells:  []image.Rectangle{image.Rect(0, 0, 100, 100)},
+			height: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.CellSize, opts.Cols = 100, tt.cols
+			l := justifiedLayout(writeTestImages(t, tt.sizes...), opts)
+			if l.Width != 300 || l.Height != tt.height {
+				t.Errorf("justifiedLayout() is %dx%d, want 300x%d", l.Width, l.Height, tt.height)
+			}
+			if !reflect.DeepEqual(l.Cells, tt.cells) {
+				t.Errorf("justifiedLayout() cells = %v, want %v", l.Cells, tt.cells)
+			}
+		})
+	}
+}
@@ -0,0 +1,334 @@
+// layout.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+)
+
+// Layout places images on the collage: image i is drawn centred in Cells[i].
+// Rectangles are relative to the top-left corner of the collage (trim) area,
+// which is Width by Height pixels. Reserved holds the blocks kept free of
+// images and Headers the section banners drawn between them.
+type Layout struct {
+	Width, Height int
+	Cells         []image.Rectangle
+	Reserved      []image.Rectangle
+	Headers       []Header
+}
+
+// GridLayout arranges n square cells of cellSize pixels in a nearly square grid,
+// filled row by row.
+func GridLayout(n, cellSize int) Layout {
+	// Calculate grid dimensions (nearly square).
+	ncols := int(math.Ceil(math.Sqrt(float64(n))))
+	nrows := int(math.Ceil(float64(n) / float64(ncols)))
+
+	layout := Layout{Width: ncols * cellSize, Height: nrows * cellSize}
+	for idx := 0; idx < n; idx++ {
+		// Compute cell position.
+		row := idx / ncols
+		col := idx % ncols
+		cellX := col * cellSize
+		cellY := row * cellSize
+		layout.Cells = append(layout.Cells, image.Rect(cellX, cellY, cellX+cellSize, cellY+cellSize))
+	}
+	return layout
+}
+
+// Reservation keeps a Cols by Rows block of grid cells free of images, e.g. for a
+// title or logo added later. Position is center, top, bottom, left, right,
+// top-left, top-right, bottom-left, bottom-right or rNcM for the block's top-left
+// cell at 0-based row N, column M.
+type Reservation struct {
+	Cols, Rows int
+	Position   string
+}
+
+// ParseReservation parses a reservation spec of the form "WxH:position", e.g. "2x2:center".
+func ParseReservation(spec string) (Reservation, error) {
+	size, pos, ok := strings.Cut(spec, ":")
+	if !ok {
+		pos = "center"
+	}
+	cols, rows, err := parseGrid(size)
+	if err != nil {
+		return Reservation{}, err
+	}
+	r := Reservation{Cols: cols, Rows: rows, Position: strings.ToLower(strings.TrimSpace(pos))}
+	if _, _, err := r.cell(cols, rows); err != nil {
+		return Reservation{}, fmt.Errorf("invalid reservation %q: %v", spec, err)
+	}
+	return r, nil
+}
+
+// cell returns the 0-based column and row of the block's top-left cell in a
+// grid of ncols by nrows cells. The result may fall outside the grid.
+func (r Reservation) cell(ncols, nrows int) (col, row int, err error) {
+	switch r.Position {
+	case "center", "centre":
+		return (ncols - r.Cols) / 2, (nrows - r.Rows) / 2, nil
+	case "top":
+		return (ncols - r.Cols) / 2, 0, nil
+	case "bottom":
+		return (ncols - r.Cols) / 2, nrows - r.Rows, nil
+	case "left":
+		return 0, (nrows - r.Rows) / 2, nil
+	case "right":
+		return ncols - r.Cols, (nrows - r.Rows) / 2, nil
+	case "top-left":
+		return 0, 0, nil
+	case "top-right":
+		return ncols - r.Cols, 0, nil
+	case "bottom-left":
+		return 0, nrows - r.Rows, nil
+	case "bottom-right":
+		return ncols - r.Cols, nrows - r.Rows, nil
+	}
+	if _, err := fmt.Sscanf(r.Position, "r%dc%d", &row, &col); err != nil || row < 0 || col < 0 {
+		return 0, 0, fmt.Errorf("unknown position %q", r.Position)
+	}
+	return col, row, nil
+}
+
+// centredX and centredY report whether the block is centred horizontally or vertically.
+func (r Reservation) centredX() bool {
+	return r.Position == "center" || r.Position == "centre" || r.Position == "top" || r.Position == "bottom"
+}
+
+func (r Reservation) centredY() bool {
+	return r.Position == "center" || r.Position == "centre" || r.Position == "left" || r.Position == "right"
+}
+
+// GridSpec describes the grid of square cells a layout is planned on.
+type GridSpec struct {
+	CellSize   int           // size in pixels of each square cell
+	Cols, Rows int           // grid dimensions in cells; 0 chooses them automatically
+	Gutter     int           // space in pixels between neighbouring cells
+	Margin     int           // space in pixels around the grid
+	Reserved   []Reservation // blocks of cells kept free of images
+	Spans      []image.Point // block of cells (columns by rows) of each image; nil gives each one cell
+	Pack       string        // order the image blocks are placed in: PackOrder (or empty) or PackLargest
+	PackEffort int           // automatic column counts tried, keeping the grid with the fewest empty cells; 0 or 1 tries one
+}
+
+// span returns the block of cells image i takes.
+func (g GridSpec) span(i int) image.Point {
+	if g.Spans == nil {
+		return image.Pt(1, 1)
+	}
+	return g.Spans[i]
+}
+
+// packOrder returns the image indices in the order their blocks are placed.
+func (g GridSpec) packOrder(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	if g.Pack == PackLargest && g.Spans != nil {
+		sort.SliceStable(order, func(a, b int) bool {
+			sa, sb := g.Spans[order[a]], g.Spans[order[b]]
+			return sa.X*sa.Y > sb.X*sb.Y
+		})
+	}
+	return order
+}
+
+// rect returns the pixel rectangle of the block of cols by rows cells whose
+// top-left cell is at col, row, including the gutters inside the block.
+func (g GridSpec) rect(col, row, cols, rows int) image.Rectangle {
+	x := g.Margin + col*(g.CellSize+g.Gutter)
+	y := g.Margin + row*(g.CellSize+g.Gutter)
+	return image.Rect(x, y, x+cols*g.CellSize+(cols-1)*g.Gutter, y+rows*g.CellSize+(rows-1)*g.Gutter)
+}
+
+// PlanLayout arranges n images on the grid described by spec, each in its
+// block of spec.Spans cells (one cell by default), filled row by row. Reserved
+// blocks are kept empty and the images flow around them. Positive spec.Cols
+// and spec.Rows fix the grid dimensions; otherwise the grid is nearly square
+// and grown until every image fits. The reserved blocks are returned in
+// Layout.Reserved in the order given.
+func PlanLayout(n int, spec GridSpec) (Layout, error) {
+	cols, rows, reserved := spec.Cols, spec.Rows, spec.Reserved
+
+	// Size the grid for the images plus the reserved cells, wide enough for every block.
+	// Blocks at an explicit rNcM cell also need the grid to reach them.
+	total, ncols, nrows := 0, 0, 0
+	for i := 0; i < n; i++ {
+		span := spec.span(i)
+		total += span.X * span.Y
+		ncols = max(ncols, span.X)
+		nrows = max(nrows, span.Y)
+	}
+	for _, r := range reserved {
+		col, row, err := r.cell(0, 0)
+		if err != nil {
+			return Layout{}, err
+		}
+		total += r.Cols * r.Rows
+		ncols = max(ncols, col+r.Cols)
+		nrows = max(nrows, row+r.Rows)
+	}
+	switch {
+	case cols > 0 && rows > 0:
+		if cols*rows < total {
+			return Layout{}, fmt.Errorf("a grid of %d columns by %d rows has %d cells, too few for %d images and reserved cells", cols, rows, cols*rows, total)
+		}
+		if cols < ncols {
+			return Layout{}, fmt.Errorf("a grid of %d columns is too narrow for blocks of %d columns", cols, ncols)
+		}
+		ncols = cols
+	case cols > 0:
+		if cols < ncols {
+			return Layout{}, fmt.Errorf("a grid of %d columns is too narrow for blocks of %d columns", cols, ncols)
+		}
+		ncols = cols
+	case rows > 0:
+		ncols = max(ncols, int(math.Ceil(float64(total)/float64(rows))))
+	default:
+		ncols = max(ncols, int(math.Ceil(math.Sqrt(float64(total)))))
+		// Prefer a width that lets the first horizontally centred block sit exactly in the middle.
+		for _, r := range reserved {
+			if r.centredX() {
+				if (ncols-r.Cols)%2 != 0 {
+					ncols++
+				}
+				break
+			}
+		}
+
+		// Spend the packing effort on wider grids, keeping the one with the
+		// fewest empty cells (the squarest on a tie).
+		var best Layout
+		var bestErr error
+		bestEmpty := -1
+		for c := ncols; c < ncols+max(1, spec.PackEffort); c++ {
+			layout, err := planRows(n, spec, c, nrows, total, rows)
+			if err != nil {
+				if bestEmpty < 0 {
+					bestErr = err
+				}
+				continue
+			}
+			empty := spec.cells(layout) - total
+			if bestEmpty < 0 || empty < bestEmpty || (empty == bestEmpty && squareness(layout) < squareness(best)) {
+				best, bestEmpty, bestErr = layout, empty, nil
+			}
+		}
+		return best, bestErr
+	}
+	return planRows(n, spec, ncols, nrows, total, rows)
+}
+
+// planRows lays out the images on a grid of ncols columns and the fewest rows
+// (at least nrows, or exactly rows if positive) that hold total cells.
+func planRows(n int, spec GridSpec, ncols, nrows, total, rows int) (Layout, error) {
+	minRows := max(nrows, int(math.Ceil(float64(total)/float64(ncols))))
+	maxRows := minRows + total
+	if rows > 0 {
+		if rows < minRows {
+			return Layout{}, fmt.Errorf("%d rows of %d columns are too few for %d images and reserved cells", rows, ncols, total)
+		}
+		minRows, maxRows = rows, rows
+	}
+
+	// Try the smallest grids first, on the first pass only those that centre the blocks exactly.
+	for _, exact := range []bool{true, false} {
+		for nrows := minRows; nrows <= maxRows; nrows++ {
+			if layout, ok := fitReserved(n, spec, ncols, nrows, exact); ok {
+				return layout, nil
+			}
+		}
+	}
+	if spec.Spans != nil {
+		return Layout{}, fmt.Errorf("reserved cells overlap or images do not fit in a grid of %d columns by %d rows", ncols, maxRows)
+	}
+	return Layout{}, fmt.Errorf("reserved cells overlap or do not fit in a grid of %d columns", ncols)
+}
+
+// cells returns the number of grid cells of a layout planned on g.
+func (g GridSpec) cells(l Layout) int {
+	pitch := g.CellSize + g.Gutter
+	return (l.Width - 2*g.Margin + g.Gutter) / pitch * ((l.Height - 2*g.Margin + g.Gutter) / pitch)
+}
+
+// squareness measures how far a layout is from square: the ratio of its
+// longer to its shorter side.
+func squareness(l Layout) float64 {
+	w, h := float64(l.Width), float64(l.Height)
+	return math.Max(w, h) / math.Max(1, math.Min(w, h))
+}
+
+// fitReserved lays out n images in an ncols by nrows grid around the reserved
+// blocks, placing each image's block in the first free spot in spec.Pack
+// order. It fails if a block falls outside the grid, blocks overlap, the
+// images do not fit, or (with exact) a centred block is off-centre.
+func fitReserved(n int, spec GridSpec, ncols, nrows int, exact bool) (Layout, bool) {
+	taken := make([]bool, ncols*nrows)
+	grid := spec.rect(0, 0, ncols, nrows)
+	layout := Layout{Width: grid.Max.X + spec.Margin, Height: grid.Max.Y + spec.Margin}
+	for _, r := range spec.Reserved {
+		if exact && r.centredY() && (nrows-r.Rows)%2 != 0 {
+			return Layout{}, false
+		}
+		col, row, _ := r.cell(ncols, nrows)
+		if col < 0 || row < 0 || col+r.Cols > ncols || row+r.Rows > nrows {
+			return Layout{}, false
+		}
+		for y := row; y < row+r.Rows; y++ {
+			for x := col; x < col+r.Cols; x++ {
+				if taken[y*ncols+x] {
+					return Layout{}, false
+				}
+				taken[y*ncols+x] = true
+			}
+		}
+		layout.Reserved = append(layout.Reserved, spec.rect(col, row, r.Cols, r.Rows))
+	}
+
+	layout.Cells = make([]image.Rectangle, n)
+	first := 0 // no free cell comes before this one
+	for _, i := range spec.packOrder(n) {
+		for first < len(taken) && taken[first] {
+			first++
+		}
+		span := spec.span(i)
+		idx := first
+		for ; idx < len(taken); idx++ {
+			if blockFree(taken, ncols, nrows, idx%ncols, idx/ncols, span) {
+				break
+			}
+		}
+		if idx == len(taken) {
+			return Layout{}, false
+		}
+		col, row := idx%ncols, idx/ncols
+		for y := row; y < row+span.Y; y++ {
+			for x := col; x < col+span.X; x++ {
+				taken[y*ncols+x] = true
+			}
+		}
+		layout.Cells[i] = spec.rect(col, row, span.X, span.Y)
+	}
+	return layout, true
+}
+
+// blockFree reports whether the block of span cells with its top-left cell at
+// col, row lies inside the grid on cells not taken.
+func blockFree(taken []bool, ncols, nrows, col, row int, span image.Point) bool {
+	if col+span.X > ncols || row+span.Y > nrows {
+		return false
+	}
+	for y := row; y < row+span.Y; y++ {
+		for x := col; x < col+span.X; x++ {
+			if taken[y*ncols+x] {
+				return false
+			}
+		}
+	}
+	return true
+}
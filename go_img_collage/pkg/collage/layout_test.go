@@ -0,0 +1,122 @@
+// layout_test.go
+package collage
+
+import (
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGridLayout(t *testing.T) {
+	tests := []struct {
+		n, cellSize   int
+		width, height int
+		last          image.Rectangle
+	}{
+		{1, 10, 10, 10, image.Rect(0, 0, 10, 10)},
+		{4, 10, 20, 20, image.Rect(10, 10, 20, 20)},
+		{5, 10, 30, 20, image.Rect(10, 10, 20, 20)},
+		{10, 5, 20, 15, image.Rect(5, 10, 10, 15)},
+	}
+	for _, tt := range tests {
+		l := GridLayout(tt.n, tt.cellSize)
+		if l.Width != tt.width || l.Height != tt.height || len(l.Cells) != tt.n {
+			t.Errorf("GridLayout(%d, %d) is %dx%d with %d cells, want %dx%d with %d", tt.n, tt.cellSize, l.Width, l.Height, len(l.Cells), tt.width, tt.height, tt.n)
+			continue
+		}
+		if got := l.Cells[tt.n-1]; got != tt.last {
+			t.Errorf("GridLayout(%d, %d) last cell = %v, want %v", tt.n, tt.cellSize, got, tt.last)
+		}
+	}
+}
+
+func TestParseReservation(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    Reservation
+		wantErr bool
+	}{
+		{"2x2:center", Reservation{Cols: 2, Rows: 2, Position: "center"}, false},
+		{"3x1", Reservation{Cols: 3, Rows: 1, Position: "center"}, false},
+		{"1x2: Top-Left ", Reservation{Cols: 1, Rows: 2, Position: "top-left"}, false},
+		{"1x1:r2c3", Reservation{Cols: 1, Rows: 1, Position: "r2c3"}, false},
+		{"1x1:middle", Reservation{}, true},
+		{"1x1:r-1c0", Reservation{}, true},
+		{"0x2:top", Reservation{}, true},
+		{"2:top", Reservation{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseReservation(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseReservation(%q) = %+v, %v, want %+v, error %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestPlanLayout(t *testing.T) {
+	tests := []struct {
+		name          string
+		n             int
+		spec          GridSpec
+		width, height int
+		cells         map[int]image.Rectangle // expected rectangles of some cells
+		reserved      []image.Rectangle
+		wantErr       string
+	}{
+		{
+			name: "nearly square", n: 5, spec: GridSpec{CellSize: 10},
+			width: 30, height: 20,
+			cells: map[int]image.Rectangle{0: image.Rect(0, 0, 10, 10), 3: image.Rect(0, 10, 10, 20), 4: image.Rect(10, 10, 20, 20)},
+		},
+		{
+			name: "gutter and margin", n: 4, spec: GridSpec{CellSize: 10, Gutter: 2, Margin: 5},
+			width: 32, height: 32,
+			cells: map[int]image.Rectangle{1: image.Rect(17, 5, 27, 15), 3: image.Rect(17, 17, 27, 27)},
+		},
+		{
+			name: "fixed columns", n: 5, spec: GridSpec{CellSize: 10, Cols: 5},
+			width: 50, height: 10,
+			cells: map[int]image.Rectangle{4: image.Rect(40, 0, 50, 10)},
+		},
+		{
+			name: "centred reservation", n: 5, spec: GridSpec{CellSize: 10, Reserved: []Reservation{{Cols: 2, Rows: 2, Position: "center"}}},
+			width: 40, height: 40,
+			cells:    map[int]image.Rectangle{3: image.Rect(30, 0, 40, 10), 4: image.Rect(0, 10, 10, 20)},
+			reserved: []image.Rectangle{image.Rect(10, 10, 30, 30)},
+		},
+		{
+			name: "spans", n: 3, spec: GridSpec{CellSize: 10, Cols: 2, Spans: []image.Point{{2, 1}, {1, 1}, {1, 1}}},
+			width: 20, height: 20,
+			cells: map[int]image.Rectangle{0: image.Rect(0, 0, 20, 10), 1: image.Rect(0, 10, 10, 20), 2: image.Rect(10, 10, 20, 20)},
+		},
+		{name: "too few cells", n: 5, spec: GridSpec{CellSize: 10, Cols: 4, Rows: 1}, wantErr: "too few"},
+		{name: "too narrow", n: 1, spec: GridSpec{CellSize: 10, Cols: 1, Spans: []image.Point{{2, 1}}}, wantErr: "too narrow"},
+		{name: "bad position", n: 1, spec: GridSpec{CellSize: 10, Reserved: []Reservation{{Cols: 1, Rows: 1, Position: "nowhere"}}}, wantErr: "unknown position"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := PlanLayout(tt.n, tt.spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("PlanLayout() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PlanLayout() error = %v", err)
+			}
+			if l.Width != tt.width || l.Height != tt.height || len(l.Cells) != tt.n {
+				t.Fatalf("PlanLayout() is %dx%d with %d cells, want %dx%d with %d", l.Width, l.Height, len(l.Cells), tt.width, tt.height, tt.n)
+			}
+			for i, want := range tt.cells {
+				if l.Cells[i] != want {
+					t.Errorf("cell %d = %v, want %v", i, l.Cells[i], want)
+				}
+			}
+			if !reflect.DeepEqual(l.Reserved, tt.reserved) {
+				t.Errorf("reserved = %v, want %v", l.Reserved, tt.reserved)
+			}
+		})
+	}
+}
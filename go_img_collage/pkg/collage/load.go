@@ -0,0 +1,362 @@
+// load.go
+package collage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chai2010/webp"
+	xdraw "golang.org/x/image/draw"
+)
+
+// LoadImage reads the image file at path, retrying transient read errors, and decodes it.
+// It supports the extensions of decoders, case-insensitively: .webp, .jpg (also
+// .jpeg, .jpe, .jfif), .gif, .png and .avif (AVIF needs libavif's avifdec).
+// The pixels are returned as stored; EXIF orientation is not applied. Animated GIF
+// and WebP files give their first frame.
+func LoadImage(path string, retry RetryPolicy) (image.Image, error) {
+	data, err := retry.readFile(path, discardLog)
+	if err != nil {
+		return nil, err
+	}
+	return decodeImage(context.Background(), path, data, 0)
+}
+
+// decoder reads one input format.
+type decoder struct {
+	name  string
+	mime  string                 // media type, as in an HTTP Content-Type
+	ext   string                 // canonical file extension
+	magic func(data []byte) bool // reports whether data starts like a file of this format
+	// decode decodes frame of data; cancelling ctx stops external decoders.
+	decode func(ctx context.Context, data []byte, frame int) (image.Image, error)
+}
+
+var (
+	webpInput = decoder{"WebP", "image/webp", ".webp", func(data []byte) bool {
+		return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+	}, func(_ context.Context, data []byte, frame int) (image.Image, error) {
+		if isAnimatedWebP(data) {
+			return decodeAnimatedWebP(data, frame)
+		}
+		return webp.Decode(bytes.NewReader(data))
+	}}
+	gifInput = decoder{"GIF", "image/gif", ".gif", func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte("GIF8"))
+	}, func(_ context.Context, data []byte, frame int) (image.Image, error) {
+		return decodeGIF(data, frame)
+	}}
+	jpegInput = decoder{"JPEG", "image/jpeg", ".jpg", func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF})
+	}, func(_ context.Context, data []byte, _ int) (image.Image, error) {
+		return jpeg.Decode(bytes.NewReader(data))
+	}}
+	pngInput = decoder{"PNG", "image/png", ".png", func(data []byte) bool {
+		return bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n"))
+	}, func(_ context.Context, data []byte, _ int) (image.Image, error) {
+		return png.Decode(bytes.NewReader(data))
+	}}
+	avifInput = decoder{"AVIF", "image/avif", ".avif", func(data []byte) bool {
+		return len(data) >= 12 && string(data[4:8]) == "ftyp" && (string(data[8:12]) == "avif" || string(data[8:12]) == "avis")
+	}, func(ctx context.Context, data []byte, _ int) (image.Image, error) {
+		return decodeAVIF(ctx, data)
+	}}
+)
+
+// decoders maps input file extensions (lower case) to their decoders. It is
+// the list of files the collage picks up (see IsImageFile).
+var decoders = map[string]decoder{
+	".webp": webpInput,
+	".gif":  gifInput,
+	".jpg":  jpegInput,
+	".jpeg": jpegInput,
+	".jpe":  jpegInput,
+	".jfif": jpegInput,
+	".png":  pngInput,
+	".avif": avifInput,
+}
+
+// ImageExtensions returns the canonical extensions of the supported image
+// formats, sorted.
+func ImageExtensions() []string {
+	seen := map[string]bool{}
+	var exts []string
+	for _, dec := range decoders {
+		if !seen[dec.ext] {
+			seen[dec.ext] = true
+			exts = append(exts, dec.ext)
+		}
+	}
+	sort.Strings(exts)
+	return exts
+}
+
+// trimImageExt strips the image extensions from the end of name, so both
+// photo.jpg and photo.jpg.webp give photo.
+func trimImageExt(name string) string {
+	for {
+		ext := filepath.Ext(name)
+		if _, ok := decoders[strings.ToLower(ext)]; !ok || ext == name {
+			return name
+		}
+		name = strings.TrimSuffix(name, ext)
+	}
+}
+
+// decodeImage decodes the contents of the image file at path by its extension
+// (the last one, case-insensitively). A file whose contents turn out to be in
+// another supported format, such as a WebP saved as .jpg, is decoded as what
+// it is. frame selects the frame (0-based) of animated GIF and WebP files.
+// Cancelling ctx stops an external decoder such as avifdec.
+func decodeImage(ctx context.Context, path string, data []byte, frame int) (image.Image, error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	dec, ok := decoders[ext]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnsupportedFormat, ext)
+	}
+	if dec.magic(data) {
+		return dec.decode(ctx, data, frame)
+	}
+	if other, ok := sniffDecoder(data); ok {
+		return other.decode(ctx, data, frame)
+	}
+	return dec.decode(ctx, data, frame) // reports why the data is not valid for its extension
+}
+
+// sniffDecoder returns the decoder of the format data starts like.
+func sniffDecoder(data []byte) (decoder, bool) {
+	for _, dec := range []decoder{jpegInput, webpInput, pngInput, gifInput, avifInput} {
+		if dec.magic(data) {
+			return dec, true
+		}
+	}
+	return decoder{}, false
+}
+
+// ImageExt returns the file extension of an image from a source without a
+// trustworthy name, such as a URL or an archive entry, by its contents (the
+// first 512 bytes are enough) or, if those are not recognised, its
+// Content-Type. It reports false, with the media type found, if the source is
+// not a supported image, such as an HTML error page, so it can be skipped
+// before it is stored or decoded.
+func ImageExt(contentType string, head []byte) (ext, mediaType string, ok bool) {
+	if dec, ok := sniffDecoder(head); ok {
+		return dec.ext, dec.mime, true
+	}
+	mediaType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	if mediaType == "application/octet-stream" {
+		if declared, _, err := mime.ParseMediaType(contentType); err == nil {
+			mediaType = declared
+		}
+	}
+	if mediaType == "image/pjpeg" || mediaType == "image/jpg" {
+		mediaType = "image/jpeg"
+	}
+	for _, dec := range []decoder{jpegInput, webpInput, pngInput, gifInput, avifInput} {
+		if mediaType == dec.mime {
+			return dec.ext, mediaType, true
+		}
+	}
+	return "", mediaType, false
+}
+
+// Fit modes (Options.Fit) for scaling an image into its cell.
+const (
+	FitContain = "contain" // largest size that fits, keeping the aspect ratio (letterboxed)
+	FitCover   = "cover"   // fill the cell, keeping the aspect ratio and cropping the centre
+	FitStretch = "stretch" // fill the cell, ignoring the aspect ratio
+)
+
+// checkFit returns an error for an unknown fit mode.
+func checkFit(fit string) error {
+	switch fit {
+	case FitContain, FitCover, FitStretch:
+		return nil
+	}
+	return fmt.Errorf("unknown fit mode %q: use contain, cover or stretch", fit)
+}
+
+// imageInfo receives what loadResized learns about an image besides its pixels.
+type imageInfo struct {
+	analyze bool       // compute stats
+	stats   imageStats // quality statistics, if analyze is set
+	exif    *exifData  // EXIF data; nil if the image has none
+	motion  bool       // the file declares an embedded motion photo video
+}
+
+// loadResized loads the image at path, turns it upright according to its EXIF
+// orientation (unless opts.NoEXIFRotate is set) and scales it into a cell of
+// the given dimensions as opts.Fit says. If info is not nil, it receives the
+// image's metadata and, if info.analyze is set, the quality statistics of the
+// full image. With opts.CacheDir, tiles of unchanged files come from the cache.
+func loadResized(path string, cellW, cellH int, opts Options, info *imageInfo) (*image.RGBA, error) {
+	var key string
+	if opts.CacheDir != "" {
+		if key = tileKey(path, cellW, cellH, opts); key != "" {
+			if tile, ok := loadTile(opts.CacheDir, key, info); ok {
+				return tile, nil
+			}
+		}
+	}
+
+	data, err := opts.Retry.readFile(path, opts.logger())
+	if err != nil {
+		return nil, err
+	}
+	tiff := exifTIFF(data)
+	meta := parseTIFF(tiff)
+	if info == nil {
+		info = &imageInfo{}
+	}
+	info.exif = meta
+	info.motion = isMotionPhoto(data)
+
+	var resized *image.RGBA
+	if useVips(data, opts) {
+		// libvips decodes straight to the cell size, so the statistics come
+		// from the tile rather than the full image.
+		if resized, err = vipsResize(data, cellW, cellH, opts); err != nil {
+			return nil, err
+		}
+		if info.analyze {
+			info.stats = analyzeImage(resized)
+		}
+	} else {
+		img, err := decodeImage(opts.context(), path, data, opts.Frame)
+		if err != nil {
+			return nil, err
+		}
+		if !opts.NoEXIFRotate {
+			img = orient(img, meta.orientation())
+		}
+		if info.analyze {
+			info.stats = analyzeImage(img)
+		}
+		resized = resizeImage(img, cellW, cellH, opts)
+	}
+	if key != "" {
+		meta := tileMeta{EXIF: tiff, Motion: info.motion, Stats: info.stats}
+		if info.analyze {
+			meta.Analyzed = statsVersion
+		}
+		storeTile(opts.CacheDir, key, resized, meta)
+	}
+	return resized, nil
+}
+
+// resizeImage scales img into a cell of cellW by cellH pixels as opts.Fit says.
+func resizeImage(img image.Image, cellW, cellH int, opts Options) *image.RGBA {
+	// Convert to RGBA if needed.
+	bounds := img.Bounds()
+	origW, origH := bounds.Dx(), bounds.Dy()
+
+	newW, newH := cellW, cellH
+	switch opts.Fit {
+	case FitCover:
+		// Crop the source to the cell's aspect ratio around its centre.
+		scaleFactor := math.Max(float64(cellW)/float64(origW), float64(cellH)/float64(origH))
+		cropW := min(origW, int(math.Round(float64(cellW)/scaleFactor)))
+		cropH := min(origH, int(math.Round(float64(cellH)/scaleFactor)))
+		x0 := bounds.Min.X + (origW-cropW)/2
+		y0 := bounds.Min.Y + (origH-cropH)/2
+		bounds = image.Rect(x0, y0, x0+cropW, y0+cropH)
+	case FitStretch:
+	default:
+		// Determine scale factor (so that the image touches the cell on its tighter side).
+		scaleFactor := min(float64(cellW)/float64(origW), float64(cellH)/float64(origH))
+		newW = int(float64(origW) * scaleFactor)
+		newH = int(float64(origH) * scaleFactor)
+	}
+
+	// Create a new RGBA image for the resized image.
+	resized := image.NewRGBA(image.Rect(0, 0, newW, newH))
+	scaler(opts.Filter, resized.Rect, bounds).Scale(resized, resized.Rect, img, bounds, xdraw.Over, nil)
+	return resized
+}
+
+// orient applies an EXIF orientation (1-8) to img, returning the image as it
+// should be displayed.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	src := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.Copy(src, image.Point{}, img, b, xdraw.Src, nil)
+
+	// Orientations 5-8 swap width and height.
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			// Source pixel shown at (x, y).
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // transposed
+				sx, sy = y, x
+			case 6: // rotated 90° clockwise to display
+				sx, sy = y, h-1-x
+			case 7: // transversed
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90° counter-clockwise to display
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):][:4])
+		}
+	}
+	return dst
+}
+
+// withTimeout runs process and returns its result, or an error if it has not
+// finished within timeout (0 waits indefinitely). Go cannot abort a running
+// decoder, so a timed-out call keeps running in the background and its result
+// is discarded; the collage simply moves on without that image.
+func withTimeout[T any](timeout time.Duration, process func() (T, error)) (T, error) {
+	if timeout <= 0 {
+		return process()
+	}
+	type result struct {
+		val T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		val, err := process()
+		done <- result{val, err}
+	}()
+	select {
+	case r := <-done:
+		return r.val, r.err
+	case <-time.After(timeout):
+		var zero T
+		return zero, fmt.Errorf("%w after %v, skipping", errTimedOut, timeout)
+	}
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,108 @@
+// load_test.go
+package collage
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestIsImageFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"photo.jpg", true},
+		{"photo.JPEG", true},
+		{"scan.png", true},
+		{"clip.gif", true},
+		{"photo.jpg.webp", true},
+		{"photo.avif", true},
+		{"notes.txt", false},
+		{"photo.webp.txt", false},
+		{"png", false},
+	}
+	for _, tt := range tests {
+		if got := IsImageFile(tt.name); got != tt.want {
+			t.Errorf("IsImageFile(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWalkDirs(t *testing.T) {
+	root := t.TempDir()
+	var want []string
+	for _, dir := range []string{"", "a", "a/x", "a/x/deep", "a/y", "b", "c", "c/z"} {
+		path := filepath.Join(root, filepath.FromSlash(dir))
+		if err := os.MkdirAll(path, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, path)
+	}
+	if err := os.WriteFile(filepath.Join(root, "a", "photo.jpg"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(want)
+	for _, workers := range []int{0, 1, 3, 16} {
+		opts := DefaultOptions()
+		opts.ScanWorkers = workers
+		if got := walkDirs(root, opts); !slices.Equal(got, want) {
+			t.Errorf("walkDirs() with %d workers = %v, want %v", workers, got, want)
+		}
+	}
+}
+
+func TestImageExtensions(t *testing.T) {
+	want := []string{".avif", ".gif", ".jpg", ".png", ".webp"}
+	if got := ImageExtensions(); !slices.Equal(got, want) {
+		t.Errorf("ImageExtensions() = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeImage(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 3, 2))
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	var pngData, jpegData bytes.Buffer
+	if err := png.Encode(&pngData, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := jpeg.Encode(&jpegData, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		data    []byte
+		wantErr bool
+	}{
+		{"png", "a.png", pngData.Bytes(), false},
+		{"png saved as jpg", "a.jpg", pngData.Bytes(), false},
+		{"jpeg saved as png", "a.PNG", jpegData.Bytes(), false},
+		{"unsupported extension", "a.bmp", pngData.Bytes(), true},
+		{"garbage", "a.png", []byte("not an image"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodeImage(context.Background(), tt.path, tt.data, 0)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("decodeImage(%s) succeeded, want an error", tt.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeImage(%s) error = %v", tt.path, err)
+			}
+			if got.Bounds() != img.Bounds() {
+				t.Errorf("decodeImage(%s) bounds = %v, want %v", tt.path, got.Bounds(), img.Bounds())
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+// manifest.go
+package collage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"time"
+)
+
+// manifest records which image occupies which cell of a rendered collage. It is
+// kept beside the collage for -update and written on request (-manifest) for
+// tools such as clickable web viewers.
+type manifest struct {
+	Width    int            `json:"width"`
+	Height   int            `json:"height"`
+	Settings string         `json:"settings"` // settingsHash of the options the collage was rendered with
+	Cells    []manifestCell `json:"cells"`
+}
+
+// manifestCell is one image of the collage and the source file state it was drawn from.
+type manifestCell struct {
+	Index   int       `json:"index"`
+	Path    string    `json:"path"` // as given: the URL or archive entry of a fetched image (see Options.Source)
+	X       int       `json:"x"`
+	Y       int       `json:"y"`
+	W       int       `json:"w"`
+	H       int       `json:"h"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+
+	Duplicates []string `json:"duplicates,omitempty"` // other locations of the same image under the input roots
+
+	file string // local file the image was read from, if not Path
+}
+
+// local returns the file the image of the cell was read from.
+func (c manifestCell) local() string {
+	if c.file != "" {
+		return c.file
+	}
+	return c.Path
+}
+
+// rect returns the cell rectangle on the canvas.
+func (c manifestCell) rect() image.Rectangle {
+	return image.Rect(c.X, c.Y, c.X+c.W, c.Y+c.H)
+}
+
+// drawSettings are the options that decide which images are drawn and how,
+// and so the pixels of the collage. Output locations, side files such as
+// the proof and masks, and run-time settings are left out.
+type drawSettings struct {
+	CellSize, SlideSize, Cols, Rows, Gutter, Margin  int
+	Variants, PerPage, Carousel, PackEffort          int
+	Fit, Filter, Backend, Sort, Size, Layout, Weight string
+	WeightsFile, ExactGrid, Spans, Pack, Background  string
+	Reverse, Shuffle, Hierarchical                   bool
+	Compare                                          []string
+
+	JitterRotation      float64
+	Inset, InsetJitter  int
+	Seed                int64
+	WebPLossless        bool
+	Quality             int
+	TargetFileSize      int64
+	Reserved            []Reservation
+	TitleCells          []TitleCell
+	Font, Caption       string
+	FontSize            float64
+	CaptionStyle        string
+	CaptionColor        string
+	Subtitles           []Subtitle
+	Badges              []string
+	Target              string
+	MosaicRepeats       int
+	PageSize            string
+	DPI                 int
+	TileOverlap, Bleed  float64
+	CropMarks           bool
+	ICCProfile          string
+	NoEXIFRotate        bool
+	Frame               int
+	ScoreBorders        bool
+	SkipBlurry          float64
+	SkipUniform         float64
+	MinWidth, MinHeight int
+	MinBytes            int64
+	MaxImages           int
+	MaxPerFolder        int
+	Sample              string
+}
+
+// settingsHash identifies the options that affect how the cells are drawn
+// (see drawSettings).
+func settingsHash(opts Options) string {
+	settings := drawSettings{
+		CellSize: opts.CellSize, SlideSize: opts.SlideSize, Cols: opts.Cols, Rows: opts.Rows, Gutter: opts.Gutter, Margin: opts.Margin,
+		Variants: opts.Variants, PerPage: opts.PerPage, Carousel: opts.Carousel, PackEffort: opts.PackEffort,
+		Fit: opts.Fit, Filter: opts.Filter, Backend: opts.Backend, Sort: opts.Sort, Size: opts.Size, Layout: opts.Layout, Weight: opts.Weight,
+		WeightsFile: opts.WeightsFile, ExactGrid: opts.ExactGrid, Spans: opts.Spans, Pack: opts.Pack, Background: opts.Background,
+		Reverse: opts.Reverse, Shuffle: opts.Shuffle, Hierarchical: opts.Hierarchical, Compare: opts.Compare,
+
+		JitterRotation: opts.JitterRotation, Inset: opts.Inset, InsetJitter: opts.InsetJitter, Seed: opts.Seed,
+		WebPLossless: opts.WebPLossless, Quality: opts.Quality, TargetFileSize: opts.TargetFileSize,
+		Reserved: opts.Reserved, TitleCells: opts.TitleCells,
+		Font: opts.Font, FontSize: opts.FontSize, Caption: opts.Caption, CaptionStyle: opts.CaptionStyle, CaptionColor: opts.CaptionColor,
+		Subtitles: opts.Subtitles, Badges: opts.Badges, Target: opts.Target, MosaicRepeats: opts.MosaicRepeats,
+		PageSize: opts.PageSize, DPI: opts.DPI, TileOverlap: opts.TileOverlap, Bleed: opts.Bleed, CropMarks: opts.CropMarks, ICCProfile: opts.ICCProfile,
+		NoEXIFRotate: opts.NoEXIFRotate, Frame: opts.Frame, ScoreBorders: opts.ScoreBorders,
+		SkipBlurry: opts.SkipBlurry, SkipUniform: opts.SkipUniform, MinWidth: opts.MinWidth, MinHeight: opts.MinHeight, MinBytes: opts.MinBytes,
+		MaxImages: opts.MaxImages, MaxPerFolder: opts.MaxPerFolder, Sample: opts.Sample,
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%+v", settings)))
+	return hex.EncodeToString(h[:])
+}
+
+// newManifest describes the collage of imagePaths laid out with its trim area at origin.
+func newManifest(canvas image.Rectangle, origin image.Point, layout Layout, imagePaths []string, opts Options) *manifest {
+	m := &manifest{Width: canvas.Dx(), Height: canvas.Dy(), Settings: settingsHash(opts)}
+	for i, path := range imagePaths {
+		r := layout.Cells[i].Add(origin)
+		c := manifestCell{Index: i, Path: opts.Source(path), X: r.Min.X, Y: r.Min.Y, W: r.Dx(), H: r.Dy(), Duplicates: opts.Duplicates[path]}
+		if c.Path != path {
+			c.file = path
+		}
+		if info, err := os.Stat(path); err == nil {
+			c.Size, c.ModTime = info.Size(), info.ModTime()
+		}
+		m.Cells = append(m.Cells, c)
+	}
+	return m
+}
+
+// readManifest reads a manifest written by write.
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %v", path, err)
+	}
+	return &m, nil
+}
+
+// write saves the manifest as indented JSON to path.
+func (m *manifest) write(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// writeManifests saves the manifest of a written collage beside it for -update,
+// to opts.ManifestPath and as the HTML image map opts.HTMLPath, as requested.
+// Only the requested files are errors if they fail; without the -update
+// manifest the next -update simply rebuilds the collage.
+func writeManifests(m *manifest, opts Options) error {
+	if opts.Update {
+		if err := m.write(updateManifestPath(opts.OutputPath)); err != nil {
+			opts.logger().Printf("Warning: could not save cell manifest: %v", err)
+		}
+	}
+	if opts.ManifestPath != "" {
+		if err := m.write(opts.ManifestPath); err != nil {
+			return fmt.Errorf("failed to write manifest: %v", err)
+		}
+	}
+	if opts.HTMLPath != "" {
+		if err := writeImageMap(m, opts); err != nil {
+			return fmt.Errorf("failed to write HTML image map: %v", err)
+		}
+	}
+	return nil
+}
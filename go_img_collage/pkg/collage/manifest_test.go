@@ -0,0 +1,90 @@
+// manifest_test.go
+package collage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSettingsHash(t *testing.T) {
+	base := DefaultOptions()
+	tests := []struct {
+		name    string
+		change  func(*Options)
+		changed bool
+	}{
+		{"output path", func(o *Options) { o.OutputPath = "other.png" }, false},
+		{"proof", func(o *Options) { o.ProofPath, o.ProofWidth, o.GamutWarning = "proof.png", 300, true }, false},
+		{"coverage report", func(o *Options) { o.CoverageReport = "report.json" }, false},
+		{"matte", func(o *Options) { o.MattePath, o.MatteArea = "matte.png", MatteTrim }, false},
+		{"tile print", func(o *Options) { o.TilePrint = "2x2" }, false},
+		{"run-time settings", func(o *Options) { o.Jobs, o.Quiet, o.Retry.Attempts, o.ImageTimeout = 8, true, 5, time.Minute }, false},
+		{"images", func(o *Options) {
+			o.Images, o.Sources = []string{"a.jpg"}, map[string]string{"a.jpg": "https://x/a.jpg"}
+		}, false},
+		{"cell size", func(o *Options) { o.CellSize++ }, true},
+		{"caption", func(o *Options) { o.Caption = CaptionFilename }, true},
+		{"seed", func(o *Options) { o.Seed++ }, true},
+		{"sample", func(o *Options) { o.MaxImages, o.Sample = 4, SampleRandom }, true},
+		{"title cells", func(o *Options) { o.TitleCells = []TitleCell{{Text: "Trip"}} }, true},
+	}
+	want := settingsHash(base)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := base
+			tt.change(&opts)
+			if got := settingsHash(opts); (got != want) != tt.changed {
+				t.Errorf("settingsHash changed = %v, want %v", got != want, tt.changed)
+			}
+		})
+	}
+}
+
+func TestFingerprintSources(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string, mtime time.Time) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	fetched := func(local string) Options {
+		opts := DefaultOptions()
+		opts.Sources = map[string]string{local: "https://cdn.test/a.jpg"}
+		return opts
+	}
+	first := write("dl1.jpg", "image", day)
+	key := fingerprint([]string{first}, fetched(first))
+	tests := []struct {
+		name    string
+		local   string
+		changed bool
+	}{
+		{"downloaded again to another file", write("dl2.jpg", "image", day.Add(time.Hour)), false},
+		{"content changed", write("dl3.jpg", "image 2", day), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fingerprint([]string{tt.local}, fetched(tt.local)); (got != key) != tt.changed {
+				t.Errorf("fingerprint changed = %v, want %v", got != key, tt.changed)
+			}
+		})
+	}
+
+	// A local file is identified by its path, size and modification time.
+	local := write("b.jpg", "image", day)
+	opts := DefaultOptions()
+	opts.InputDir = dir
+	before := fingerprint([]string{local}, opts)
+	write("b.jpg", "image", day.Add(time.Hour))
+	if fingerprint([]string{local}, opts) == before {
+		t.Error("fingerprint unchanged after the file was modified")
+	}
+}
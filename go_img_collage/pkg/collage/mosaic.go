@@ -0,0 +1,184 @@
+// mosaic.go
+package collage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// mosaicCols is the width in tiles of a photo mosaic when Options.Cols is 0.
+const mosaicCols = 40
+
+// mosaicSample is the size in pixels the tiles are scaled to for their average colour.
+const mosaicSample = 16
+
+// mosaic prepares a photo mosaic of opts.Target: it divides the target into a
+// grid of square regions and returns the options for a collage whose cells,
+// in grid order, show the tiles whose average colours best match those
+// regions. A tile is used at most opts.MosaicRepeats times, if positive.
+// Tiles repeat, so without opts.CacheDir they are cached in a temporary
+// directory that cleanup removes once the mosaic has been rendered.
+func (opts Options) mosaic() (mosaic Options, cleanup func(), err error) {
+	tiles, err := opts.imagePaths()
+	if err != nil {
+		return Options{}, nil, err
+	}
+	if len(tiles) == 0 {
+		return Options{}, nil, ErrNoImages
+	}
+
+	// Step 1: Average the target over a grid of square regions.
+	data, err := opts.Retry.readFile(opts.Target, opts.logger())
+	if err != nil {
+		return Options{}, nil, fmt.Errorf("failed to read target image: %v", err)
+	}
+	target, err := decodeImage(opts.context(), opts.Target, data, 0)
+	if errors.Is(err, errUnsupportedFormat) {
+		target, _, err = image.Decode(bytes.NewReader(data)) // e.g. a PNG target
+	}
+	if err != nil {
+		return Options{}, nil, fmt.Errorf("failed to decode target image: %v", err)
+	}
+	if !opts.NoEXIFRotate {
+		target = orient(target, parseEXIF(data).orientation())
+	}
+	cols := opts.Cols
+	if cols <= 0 {
+		cols = mosaicCols
+	}
+	b := target.Bounds()
+	rows := opts.Rows
+	if rows <= 0 {
+		rows = max(1, int(math.Round(float64(cols)*float64(b.Dy())/float64(b.Dx()))))
+	}
+	regions := make([][3]float64, cols*rows)
+	for i := range regions {
+		col, row := i%cols, i/cols
+		r := image.Rect(b.Min.X+col*b.Dx()/cols, b.Min.Y+row*b.Dy()/rows, b.Min.X+(col+1)*b.Dx()/cols, b.Min.Y+(row+1)*b.Dy()/rows)
+		regions[i] = srgbToLab(averageColor(target, r))
+	}
+	if opts.MosaicRepeats > 0 && opts.MosaicRepeats*len(tiles) < len(regions) {
+		return Options{}, nil, fmt.Errorf("%d tiles used at most %d times each cannot fill %d mosaic cells; add images or raise the repeat limit",
+			len(tiles), opts.MosaicRepeats, len(regions))
+	}
+
+	// Step 2: Average each tile as it is drawn (covering its cell).
+	opts.logger().Printf("Matching %d tiles to %d mosaic cells\n", len(tiles), len(regions))
+	colors := mosaicTileColors(tiles, opts)
+	for i, c := range colors {
+		if c == nil && opts.Strict {
+			return Options{}, nil, fmt.Errorf("%w '%s' as a mosaic tile", ErrImageFailed, tiles[i])
+		}
+	}
+
+	// Step 3: Give each region, in a random order so no corner gets all the
+	// best tiles, the closest tile still available.
+	uses := make([]int, len(tiles))
+	images := make([]string, len(regions))
+	for _, i := range rand.New(rand.NewSource(opts.Seed)).Perm(len(regions)) {
+		best, bestDist := -1, math.Inf(1)
+		for t, c := range colors {
+			if c == nil || (opts.MosaicRepeats > 0 && uses[t] >= opts.MosaicRepeats) {
+				continue
+			}
+			d := labDistance(regions[i], *c)
+			if d < bestDist {
+				best, bestDist = t, d
+			}
+		}
+		if best < 0 {
+			return Options{}, nil, fmt.Errorf("not enough readable tiles for %d mosaic cells", len(regions))
+		}
+		uses[best]++
+		images[i] = tiles[best]
+	}
+
+	// Step 4: Lay the tiles out on the grid of regions.
+	cleanup = func() {}
+	if opts.CacheDir == "" {
+		dir, err := os.MkdirTemp("", "collage-mosaic-*")
+		if err != nil {
+			return Options{}, nil, fmt.Errorf("failed to create temp dir: %v", err)
+		}
+		cleanup = func() { os.RemoveAll(dir) }
+		opts.CacheDir = dir
+	}
+	// The tiles were chosen and ordered by the matching; the cells must not be
+	// filtered, sorted or sampled again.
+	mosaic = opts.selected(images)
+	mosaic.Target = ""
+	mosaic.Cols, mosaic.Rows = cols, rows
+	mosaic.Fit = FitCover
+	mosaic.Layout, mosaic.Spans, mosaic.ExactGrid, mosaic.Size = LayoutGrid, SpanNone, "", ""
+	mosaic.Reserved, mosaic.TitleCells = nil, nil
+	return mosaic, cleanup, nil
+}
+
+// mosaicTileColors returns the CIELAB average colour of each tile scaled to
+// cover a small cell, computed in parallel; nil for tiles that cannot be read.
+func mosaicTileColors(tiles []string, opts Options) []*[3]float64 {
+	opts.Fit = FitCover
+	colors := make([]*[3]float64, len(tiles))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				img, err := withTimeout(opts.ImageTimeout, func() (*image.RGBA, error) {
+					return loadResized(tiles[i], mosaicSample, mosaicSample, opts, nil)
+				})
+				if err != nil {
+					opts.Skipped.Add(tiles[i], errorKind(err), err.Error())
+					continue
+				}
+				lab := srgbToLab(averageColor(img, img.Bounds()))
+				colors[i] = &lab
+			}
+		}()
+	}
+	for i := range tiles {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return colors
+}
+
+// averageColor returns the mean sRGB colour (components 0-1) of r in img,
+// weighted by alpha; fully transparent areas are black.
+func averageColor(img image.Image, r image.Rectangle) [3]float64 {
+	var sum [3]float64
+	var weight float64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			cr, cg, cb, ca := img.At(x, y).RGBA()
+			if ca == 0 {
+				continue
+			}
+			// Un-premultiply and weight by alpha: the premultiplied values sum directly.
+			sum[0] += float64(cr)
+			sum[1] += float64(cg)
+			sum[2] += float64(cb)
+			weight += float64(ca)
+		}
+	}
+	if weight == 0 {
+		return [3]float64{}
+	}
+	return [3]float64{sum[0] / weight, sum[1] / weight, sum[2] / weight}
+}
+
+// labDistance returns the squared CIE76 distance between two CIELAB colours.
+func labDistance(a, b [3]float64) float64 {
+	dl, da, db := a[0]-b[0], a[1]-b[1], a[2]-b[2]
+	return dl*dl + da*da + db*db
+}
@@ -0,0 +1,76 @@
+// mosaic_test.go
+package collage
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// writeColorImage writes a w by h PNG at path, filled with c except for its
+// right half, which is filled with right.
+func writeColorImage(t *testing.T, path string, w, h int, c, right color.Color) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(w/2, 0, w, h), image.NewUniform(right), image.Point{}, draw.Src)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMosaicSelection(t *testing.T) {
+	dir := t.TempDir()
+	black, white, navy := color.Black, color.White, color.RGBA{0, 0, 128, 255}
+	var tiles []string
+	for i, c := range []color.Color{black, white, navy} {
+		path := filepath.Join(dir, string(rune('a'+i))+".png")
+		writeColorImage(t, path, 8, 8, c, c)
+		tiles = append(tiles, path)
+	}
+	target := filepath.Join(t.TempDir(), "target.png")
+	writeColorImage(t, target, 40, 10, black, white)
+
+	tests := []struct {
+		name   string
+		change func(*Options)
+		want   []string
+	}{
+		{"all tiles", func(*Options) {}, []string{tiles[0], tiles[0], tiles[1], tiles[1]}},
+		// Reversed and sampled, the navy and white tiles are left to match.
+		{"max images and reverse", func(o *Options) { o.MaxImages, o.Reverse = 2, true }, []string{tiles[2], tiles[2], tiles[1], tiles[1]}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Images, opts.Target, opts.Cols, opts.Rows = tiles, target, 4, 1
+			opts.CacheDir = t.TempDir()
+			tt.change(&opts)
+			mosaic, cleanup, err := opts.mosaic()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cleanup()
+			if !slices.Equal(mosaic.Images, tt.want) {
+				t.Errorf("mosaic tiles = %v, want %v", mosaic.Images, tt.want)
+			}
+			cells, err := mosaic.imagePaths()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(cells, tt.want) {
+				t.Errorf("mosaic cells = %v, want the %d matched tiles %v in order", cells, len(tt.want), tt.want)
+			}
+		})
+	}
+}
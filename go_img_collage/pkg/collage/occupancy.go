@@ -0,0 +1,112 @@
+// occupancy.go
+package collage
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Grid cell states of the occupancy mask.
+const (
+	cellEmpty    = 0 // background only
+	cellImage    = 1 // an image was drawn
+	cellReserved = 2 // a title cell or section banner
+)
+
+// occupancy is the JSON form of the occupancy mask.
+type occupancy struct {
+	Cols     int            `json:"cols"`
+	Rows     int            `json:"rows"`
+	CellSize int            `json:"cell_size"`
+	Gutter   int            `json:"gutter"`
+	Margin   int            `json:"margin"`
+	Legend   map[int]string `json:"legend"`
+	Grid     [][]int        `json:"grid"` // Grid[row][col]
+}
+
+// occupancyGrid divides the trim area into grid cells of opts.CellSize with
+// opts.Gutter between them and classifies each by what covers its centre: an
+// image that was drawn (not one that failed), a reserved block or header, or
+// nothing. Non-grid layouts are sampled on the same grid.
+func occupancyGrid(layout Layout, imagePaths []string, errs *errorLog, opts Options) occupancy {
+	pitch := opts.CellSize + opts.Gutter
+	occ := occupancy{
+		Cols:     max(0, (layout.Width-2*opts.Margin+opts.Gutter)/pitch),
+		Rows:     max(0, (layout.Height-2*opts.Margin+opts.Gutter)/pitch),
+		CellSize: opts.CellSize,
+		Gutter:   opts.Gutter,
+		Margin:   opts.Margin,
+		Legend:   map[int]string{cellEmpty: "empty", cellImage: "image", cellReserved: "reserved"},
+	}
+	failed := errs.failed()
+	for row := 0; row < occ.Rows; row++ {
+		line := make([]int, occ.Cols)
+		for col := range line {
+			x := opts.Margin + col*pitch + opts.CellSize/2
+			y := opts.Margin + row*pitch + opts.CellSize/2
+			line[col] = occupantAt(image.Pt(x, y), layout, imagePaths, failed)
+		}
+		occ.Grid = append(occ.Grid, line)
+	}
+	return occ
+}
+
+// occupantAt returns the state of the collage at p.
+func occupantAt(p image.Point, layout Layout, imagePaths []string, failed map[string]bool) int {
+	for i, c := range layout.Cells {
+		if p.In(c) && !failed[imagePaths[i]] {
+			return cellImage
+		}
+	}
+	for _, r := range layout.Reserved {
+		if p.In(r) {
+			return cellReserved
+		}
+	}
+	for _, h := range layout.Headers {
+		if p.In(h.Rect) {
+			return cellReserved
+		}
+	}
+	return cellEmpty
+}
+
+// writeOccupancyMask writes the occupancy mask to opts.OccupancyPath, if set.
+func writeOccupancyMask(layout Layout, imagePaths []string, errs *errorLog, opts Options) error {
+	if opts.OccupancyPath == "" {
+		return nil
+	}
+	if err := writeOccupancy(opts.OccupancyPath, layout, imagePaths, errs, opts); err != nil {
+		return fmt.Errorf("failed to write occupancy mask: %v", err)
+	}
+	return nil
+}
+
+// writeOccupancy writes the occupancy mask to path: as JSON for a .json path,
+// otherwise as a grayscale PNG with one pixel per grid cell (white for
+// images, gray for reserved cells, black for empty ones).
+func writeOccupancy(path string, layout Layout, imagePaths []string, errs *errorLog, opts Options) error {
+	occ := occupancyGrid(layout, imagePaths, errs, opts)
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		data, err := json.MarshalIndent(occ, "", "  ")
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(path, append(data, '\n'), 0o644)
+	}
+	if occ.Cols == 0 || occ.Rows == 0 {
+		return fmt.Errorf("the collage has no grid cells")
+	}
+	mask := image.NewGray(image.Rect(0, 0, occ.Cols, occ.Rows))
+	levels := map[int]uint8{cellEmpty: 0, cellImage: 255, cellReserved: 128}
+	for y, line := range occ.Grid {
+		for x, state := range line {
+			mask.Pix[y*mask.Stride+x] = levels[state]
+		}
+	}
+	return writePNG(path, mask)
+}
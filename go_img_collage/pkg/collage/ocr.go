@@ -0,0 +1,132 @@
+// ocr.go
+package collage
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Text is read from images with the tesseract OCR engine, which must be on
+// PATH; there is no pure Go OCR to build in.
+const ocrTool = "tesseract"
+
+// DefaultOCRLanguage is the tesseract language of ReadText when none is given.
+const DefaultOCRLanguage = "eng"
+
+// maxSnippet is the length in characters of a CaptionText caption.
+const maxSnippet = 40
+
+// ReadText recognises the text in each of paths with tesseract in language
+// lang (such as "eng" or "eng+deu"), for CaptionText captions and the search
+// of the image map page, and returns it keyed by path with its whitespace
+// collapsed. Images without legible text are left out. Without tesseract on
+// PATH it warns and returns none, so the collage is still made.
+func ReadText(paths []string, lang string, opts Options) (map[string]string, error) {
+	tool, err := exec.LookPath(ocrTool)
+	if err != nil {
+		opts.logger().Printf("Warning: reading text needs %s on PATH; going on without it: %v", ocrTool, err)
+		return nil, nil
+	}
+	opts.logger().Printf("Reading text from %d images...\n", len(paths))
+
+	texts := map[string]string{}
+	var mu sync.Mutex // guards texts
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range jobs {
+				text, err := recognize(tool, path, lang, opts)
+				if err != nil {
+					if opts.canceled() == nil { // else the run stops below
+						opts.logger().Printf("Warning: no text read from %s: %v", path, err)
+					}
+					continue
+				}
+				if text != "" {
+					mu.Lock()
+					texts[path] = text
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, path := range paths {
+		if err := opts.canceled(); err != nil {
+			break
+		}
+		jobs <- path
+	}
+	close(jobs)
+	wg.Wait()
+	if err := opts.canceled(); err != nil {
+		return nil, err
+	}
+	return texts, nil
+}
+
+// recognize returns the text tesseract finds in the image at path. The image
+// is decoded here and passed on as PNG, so every input format can be read.
+func recognize(tool, path, lang string, opts Options) (string, error) {
+	img, err := LoadImage(path, opts.Retry)
+	if err != nil {
+		return "", err
+	}
+	var in bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestSpeed}
+	if err := enc.Encode(&in, img); err != nil {
+		return "", err
+	}
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(opts.context(), tool, "stdin", "stdout", "-l", lang)
+	cmd.Stdin, cmd.Stderr = &in, &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if err := opts.canceled(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("%s failed: %v: %s", ocrTool, err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return legibleText(string(out)), nil
+}
+
+// legibleText collapses the whitespace of OCR output and returns "" if it
+// has no word of two letters or digits, as when tesseract finds specks in a photo.
+func legibleText(s string) string {
+	words := strings.Fields(s)
+	for _, w := range words {
+		n := 0
+		for _, r := range w {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				if n++; n >= 2 {
+					return strings.Join(words, " ")
+				}
+			} else {
+				n = 0
+			}
+		}
+	}
+	return ""
+}
+
+// snippet shortens text to at most maxSnippet characters, at a word boundary
+// where possible, marking the cut with an ellipsis.
+func snippet(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxSnippet {
+		return text
+	}
+	cut := string(runes[:maxSnippet-1])
+	if i := strings.LastIndexByte(cut, ' '); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
@@ -0,0 +1,191 @@
+// output.go
+package collage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chai2010/webp"
+)
+
+// encoder writes the collage in one output format.
+type encoder struct {
+	name   string
+	encode func(w io.Writer, img *image.RGBA, opts Options) error
+}
+
+// encoders maps output file extensions (lower case) to their encoders. TIFF and
+// PDF are handled separately as CMYK print formats.
+var encoders = map[string]encoder{
+	// Lossless (the default) keeps the collage pixel-exact; lossy is far smaller for large collages.
+	".webp": {"WebP", func(w io.Writer, img *image.RGBA, opts Options) error {
+		return webp.Encode(w, img, &webp.Options{Lossless: opts.WebPLossless, Quality: float32(opts.Quality)})
+	}},
+	// PNG keeps transparency; fast compression, as collages are large.
+	".png": {"PNG", func(w io.Writer, img *image.RGBA, _ Options) error {
+		enc := png.Encoder{CompressionLevel: png.BestSpeed}
+		return enc.Encode(w, img)
+	}},
+	// JPEG has no alpha channel. The canvas background is transparent white, so
+	// its colour channels already hold the collage composited over white.
+	".jpg":  {"JPEG", encodeJPEG},
+	".jpeg": {"JPEG", encodeJPEG},
+	// AVIF keeps transparency and is much smaller than JPEG at the same quality.
+	".avif": {"AVIF", encodeAVIF},
+}
+
+func encodeJPEG(w io.Writer, img *image.RGBA, opts Options) error {
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: opts.Quality})
+}
+
+// checkOutput returns an error if no encoder handles the extension of
+// opts.OutputPath, the encoder settings are out of range or the ICC profile
+// of a CMYK output is not a CMYK output profile.
+func checkOutput(opts Options) error {
+	if opts.Quality < 1 || opts.Quality > 100 {
+		return fmt.Errorf("invalid quality %d: must be between 1 and 100", opts.Quality)
+	}
+	if isCMYKOutput(opts.OutputPath) {
+		if opts.ICCProfile != "" {
+			if _, err := loadICCProfile(opts.ICCProfile); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if _, ok := encoders[strings.ToLower(filepath.Ext(opts.OutputPath))]; !ok {
+		return fmt.Errorf("unsupported output format %q: use .webp, .png, .jpg, .avif, .tif or .pdf", filepath.Ext(opts.OutputPath))
+	}
+	if opts.TargetFileSize > 0 && !isLossy(opts.OutputPath) {
+		return fmt.Errorf("a target file size needs a lossy output format: .jpg, .webp or .avif")
+	}
+	if strings.EqualFold(filepath.Ext(opts.OutputPath), ".avif") {
+		if _, err := avifTool(avifEncoder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeOutput encodes the finished collage to opts.OutputPath in the format
+// given by its extension.
+func writeOutput(collage *image.RGBA, opts Options) (err error) {
+	if err := checkOutput(opts); err != nil {
+		return err
+	}
+
+	// Do not leave a truncated output behind if interrupted, cancelled or
+	// failing while encoding.
+	defer onInterrupt(func() { os.Remove(opts.OutputPath) })()
+	defer func() {
+		if err != nil {
+			os.Remove(opts.OutputPath)
+		}
+	}()
+
+	// TIFF and PDF outputs are print formats and are written as CMYK.
+	if isCMYKOutput(opts.OutputPath) {
+		if err := writeCMYK(opts.OutputPath, collage, opts); err != nil {
+			if cause := opts.canceled(); cause != nil {
+				return cause
+			}
+			return fmt.Errorf("failed to write CMYK output: %v", err)
+		}
+		return nil
+	}
+
+	// Save the final collage in the format chosen by the extension.
+	enc := encoders[strings.ToLower(filepath.Ext(opts.OutputPath))]
+	var fitted []byte
+	if opts.TargetFileSize > 0 {
+		var err error
+		if fitted, err = fitFileSize(enc, collage, opts); err != nil {
+			return err
+		}
+	}
+	outFile, err := os.Create(opts.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer outFile.Close()
+
+	bw := bufio.NewWriterSize(cancelWriter{outFile, opts}, 1<<20)
+	if fitted != nil {
+		_, err = bw.Write(fitted)
+	} else if err = enc.encode(bw, collage, opts); err != nil {
+		if cause := opts.canceled(); cause != nil {
+			return cause
+		}
+		return fmt.Errorf("failed to encode %s: %v", enc.name, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	if err := bw.Flush(); err != nil {
+		if cause := opts.canceled(); cause != nil {
+			return cause
+		}
+		return fmt.Errorf("failed to write output file: %v", err)
+	}
+	return outFile.Close()
+}
+
+// isLossy reports whether the output format at path has a quality setting.
+func isLossy(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg", ".webp", ".avif":
+		return true
+	}
+	return false
+}
+
+// fitFileSize encodes the collage at the highest quality, up to opts.Quality,
+// whose file is at most opts.TargetFileSize bytes, found by binary search, and
+// returns the encoded file. WebP is encoded lossily. If even quality 1 is too
+// large, that is returned with a warning.
+func fitFileSize(enc encoder, img *image.RGBA, opts Options) ([]byte, error) {
+	opts.WebPLossless = false
+	encodeAt := func(quality int) ([]byte, error) {
+		var buf bytes.Buffer
+		q := opts
+		q.Quality = quality
+		if err := enc.encode(&buf, img, q); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %v", enc.name, err)
+		}
+		return buf.Bytes(), nil
+	}
+	var best, smallest []byte
+	lo, hi := 1, opts.Quality
+	for lo <= hi {
+		if err := opts.canceled(); err != nil {
+			return nil, err
+		}
+		mid := (lo + hi) / 2
+		data, err := encodeAt(mid)
+		if err != nil {
+			return nil, err
+		}
+		if mid == 1 {
+			smallest = data
+		}
+		if int64(len(data)) <= opts.TargetFileSize {
+			best, lo = data, mid+1
+		} else {
+			hi = mid - 1
+		}
+	}
+	if best == nil {
+		opts.logger().Printf("Warning: even quality 1 gives %d bytes, over the target file size of %d bytes", len(smallest), opts.TargetFileSize)
+		return smallest, nil
+	}
+	opts.logger().Printf("Quality %d fits the target file size (%d bytes)\n", lo-1, len(best))
+	return best, nil
+}
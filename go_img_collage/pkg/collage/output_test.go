@@ -0,0 +1,41 @@
+// output_test.go
+package collage
+
+import (
+	"context"
+	"errors"
+	"image"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteOutputCanceled(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		change func(*Options)
+	}{
+		{"CMYK TIFF", "out.tif", func(*Options) {}},
+		{"CMYK PDF", "out.pdf", func(*Options) {}},
+		{"JPEG", "out.jpg", func(*Options) {}},
+		{"target file size", "out.jpg", func(o *Options) { o.TargetFileSize = 1000 }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			opts := DefaultOptions()
+			opts.Context = ctx
+			opts.OutputPath = filepath.Join(t.TempDir(), tt.output)
+			tt.change(&opts)
+			err := writeOutput(image.NewRGBA(image.Rect(0, 0, 64, 64)), opts)
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("writeOutput() error = %v, want %v", err, context.Canceled)
+			}
+			if _, err := os.Stat(opts.OutputPath); !os.IsNotExist(err) {
+				t.Errorf("output left behind after cancelling: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+// pages.go
+package collage
+
+import (
+	"fmt"
+)
+
+// PagePath returns the path of page i (1-based) of the output at path:
+// collage.jpg becomes collage_p1.jpg, collage_p2.jpg, ...
+func PagePath(path string, i int) string {
+	return numberedPath(path, "p", i)
+}
+
+// createPages splits the images into collages of at most opts.PerPage images,
+// such as the slides of a social media carousel, each written beside
+// opts.OutputPath (and its manifest, image map, occupancy mask and matte
+// beside theirs) as PagePath names. The images are found, filtered and sorted
+// once and keep their order across the pages.
+func createPages(opts Options) error {
+	if opts.Hierarchical || opts.Target != "" || opts.Update {
+		return fmt.Errorf("pages cannot be combined with hierarchical, mosaic or updated collages")
+	}
+	if err := checkOutput(opts); err != nil {
+		return err
+	}
+
+	// Step 1: Find, filter and sort the images once.
+	paths, err := opts.imagePaths()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return ErrNoImages
+	}
+
+	// Step 2: Render each page from its share of the images.
+	pages := (len(paths) + opts.PerPage - 1) / opts.PerPage
+	for i := 1; i <= pages; i++ {
+		sub := opts.selected(paths[(i-1)*opts.PerPage : min(len(paths), i*opts.PerPage)])
+		sub.PerPage, sub.StateFile = 0, ""
+		sub.OutputPath = PagePath(opts.OutputPath, i)
+		sub.ManifestPath, sub.HTMLPath = PagePath(opts.ManifestPath, i), PagePath(opts.HTMLPath, i)
+		sub.OccupancyPath, sub.MattePath = PagePath(opts.OccupancyPath, i), PagePath(opts.MattePath, i)
+		opts.logger().Printf("Rendering page %d of %d (%d images)\n", i, pages, len(sub.Images))
+		if err := create(sub); err != nil {
+			return fmt.Errorf("page %d: %v", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+// patterns.go
+package collage
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pathPattern is an -include or -exclude pattern: a glob, matched against the
+// file name or, if it contains a /, the path relative to the input root; or a
+// regular expression written "re:<expr>", searched for in the relative path.
+type pathPattern struct {
+	spec string
+	re   *regexp.Regexp // nil for a glob
+}
+
+func (p pathPattern) match(rel string) bool {
+	if p.re != nil {
+		return p.re.MatchString(rel)
+	}
+	name := rel
+	if !strings.Contains(p.spec, "/") {
+		name = path.Base(rel)
+	}
+	ok, _ := path.Match(p.spec, name)
+	return ok
+}
+
+// pathFilter selects files by opts.Include and opts.Exclude. A nil *pathFilter
+// allows everything.
+type pathFilter struct {
+	include, exclude []pathPattern
+}
+
+// newPathFilter compiles the patterns of opts; it returns nil if there are none.
+func newPathFilter(opts Options) (*pathFilter, error) {
+	if len(opts.Include) == 0 && len(opts.Exclude) == 0 {
+		return nil, nil
+	}
+	compile := func(specs []string) ([]pathPattern, error) {
+		var patterns []pathPattern
+		for _, spec := range specs {
+			p := pathPattern{spec: spec}
+			if expr, ok := strings.CutPrefix(spec, "re:"); ok {
+				re, err := regexp.Compile(expr)
+				if err != nil {
+					return nil, fmt.Errorf("invalid pattern %q: %v", spec, err)
+				}
+				p.re = re
+			} else if _, err := path.Match(spec, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %v", spec, err)
+			}
+			patterns = append(patterns, p)
+		}
+		return patterns, nil
+	}
+	var f pathFilter
+	var err error
+	if f.include, err = compile(opts.Include); err != nil {
+		return nil, err
+	}
+	if f.exclude, err = compile(opts.Exclude); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// allows reports whether the file at path, below root, passes the filter,
+// and otherwise why not.
+func (f *pathFilter) allows(root, file string) (bool, string) {
+	if f == nil {
+		return true, ""
+	}
+	rel, err := filepath.Rel(root, file)
+	if err != nil {
+		rel = file
+	}
+	rel = filepath.ToSlash(rel)
+	for _, p := range f.exclude {
+		if p.match(rel) {
+			return false, "-exclude " + p.spec
+		}
+	}
+	if len(f.include) == 0 {
+		return true, ""
+	}
+	for _, p := range f.include {
+		if p.match(rel) {
+			return true, ""
+		}
+	}
+	return false, "no -include match"
+}
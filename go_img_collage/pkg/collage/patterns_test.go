@@ -0,0 +1,61 @@
+// patterns_test.go
+package collage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPathFilter(t *testing.T) {
+	root := filepath.FromSlash("/photos")
+	tests := []struct {
+		name             string
+		include, exclude []string
+		file             string
+		want             bool
+		why              string
+	}{
+		{"no patterns", nil, nil, "trip/a.jpg", true, ""},
+		{"glob on the name", []string{"*.jpg"}, nil, "trip/a.jpg", true, ""},
+		{"glob on the name misses", []string{"*.png"}, nil, "trip/a.jpg", false, "no -include match"},
+		{"glob with a slash matches the relative path", []string{"trip/*"}, nil, "trip/a.jpg", true, ""},
+		{"glob with a slash does not match the name", []string{"*/a.jpg"}, nil, "2024/trip/a.jpg", false, "no -include match"},
+		{"exclude wins over include", []string{"*.jpg"}, []string{"a.*"}, "trip/a.jpg", false, "-exclude a.*"},
+		{"exclude only", nil, []string{"*_thumb.jpg"}, "trip/a_thumb.jpg", false, "-exclude *_thumb.jpg"},
+		{"exclude only passes others", nil, []string{"*_thumb.jpg"}, "trip/a.jpg", true, ""},
+		{"regexp searches the relative path", []string{`re:^trip/`}, nil, "trip/a.jpg", true, ""},
+		{"regexp exclude misses", nil, []string{`re:(?i)\.PNG$`}, "trip/a.jpg", true, ""},
+		{"regexp excludes", nil, []string{`re:(?i)\.JPG$`}, "trip/a.jpg", false, `-exclude re:(?i)\.JPG$`},
+		{"any include matches", []string{"*.png", "*.jpg"}, nil, "trip/a.jpg", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.Include, opts.Exclude = tt.include, tt.exclude
+			f, err := newPathFilter(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ok, why := f.allows(root, filepath.Join(root, filepath.FromSlash(tt.file)))
+			if ok != tt.want || why != tt.why {
+				t.Errorf("allows(%q) = %v, %q, want %v, %q", tt.file, ok, why, tt.want, tt.why)
+			}
+		})
+	}
+}
+
+func TestNewPathFilterErrors(t *testing.T) {
+	tests := []struct {
+		include, exclude []string
+	}{
+		{[]string{"[a-"}, nil},
+		{nil, []string{"re:("}},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Include, opts.Exclude = tt.include, tt.exclude
+		if _, err := newPathFilter(opts); err == nil {
+			t.Errorf("newPathFilter(include %q, exclude %q) succeeded, want an error", tt.include, tt.exclude)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+// perfolder.go
+package collage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// stateFile is the name of the index, kept in the output root, of the inputs
+// each per-folder collage was last built from.
+const stateFile = ".collage-state.json"
+
+// folderState maps each per-folder collage, by its path relative to the output
+// root, to the fingerprint of its inputs.
+type folderState map[string]string
+
+// loadFolderState reads the state index of outDir; a missing or damaged index
+// is empty, with a warning to log if damaged.
+func loadFolderState(outDir string, log *log.Logger) folderState {
+	state := folderState{}
+	data, err := os.ReadFile(filepath.Join(outDir, stateFile))
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Warning: ignoring damaged state file: %v", err)
+		return folderState{}
+	}
+	return state
+}
+
+// save writes the state index to outDir.
+func (s folderState) save(outDir string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(outDir, stateFile), append(data, '\n'), 0o644)
+}
+
+// folderImages returns the sorted images directly inside dir that pass filter.
+func folderImages(dir string, filter *pathFilter, opts Options) ([]string, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var images []string
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		if !IsImageFile(f.Name()) {
+			opts.Skipped.Add(path, SkipUnsupported, filepath.Ext(f.Name()))
+			continue
+		}
+		if ok, why := filter.allows(opts.InputDir, path); !ok {
+			opts.Skipped.Add(path, SkipExcluded, why)
+			continue
+		}
+		images = append(images, path)
+	}
+	sort.Strings(images)
+	return images, nil
+}
+
+// outputFolders returns the folders that get their own collage: the subfolders
+// of opts.InputDir or, with opts.Recursive, every folder of the tree including
+// the root, in sorted order.
+func outputFolders(opts Options) ([]string, error) {
+	if !opts.Recursive {
+		_, subfolders, err := Scan(Options{InputDir: opts.InputDir, ScanWorkers: opts.ScanWorkers})
+		return subfolders, err
+	}
+	if _, err := os.Stat(opts.InputDir); err != nil {
+		return nil, err
+	}
+	return walkDirs(opts.InputDir, opts), nil
+}
+
+// fingerprint identifies the inputs of a collage: the options that affect the
+// output and the path (relative to opts.InputDir), size and modification time
+// of every image. Images fetched from a URL or archive entry (see
+// Options.Source) are identified by their source and content instead, as the
+// local copy is new on every run.
+func fingerprint(images []string, opts Options) string {
+	h := sha256.New()
+	fmt.Fprintln(h, settingsHash(opts))
+	for _, path := range images {
+		if src := opts.Source(path); src != path {
+			if data, err := os.ReadFile(path); err == nil {
+				fmt.Fprintf(h, "%s\t%x\n", src, sha256.Sum256(data))
+			} else {
+				fmt.Fprintf(h, "%s\t%v\n", src, err)
+			}
+			continue
+		}
+		name := path
+		if rel, err := filepath.Rel(opts.InputDir, path); err == nil && opts.InputDir != "" {
+			name = filepath.ToSlash(rel)
+		}
+		if info, err := os.Stat(path); err == nil {
+			fmt.Fprintf(h, "%s\t%d\t%d\n", name, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(h, "%s\t%v\n", name, err)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// CreatePerFolder writes one collage per folder of opts.InputDir instead of a
+// combined one, mirroring the input tree under opts.OutputDir: the folder a/b
+// becomes a/b.<opts.Format> there. Collages whose inputs and options are
+// unchanged since the last run, according to the state index in the output
+// root, are skipped; the others are built opts.Jobs at a time. Failed folders
+// are logged and the others still built.
+func CreatePerFolder(opts Options) error {
+	format := "." + strings.TrimPrefix(strings.ToLower(opts.Format), ".")
+	if err := checkOutput(Options{OutputPath: "collage" + format, Quality: opts.Quality}); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(opts.OutputDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %v", err)
+	}
+	filter, err := newPathFilter(opts)
+	if err != nil {
+		return err
+	}
+	dirs, err := outputFolders(opts)
+	if err != nil {
+		return err
+	}
+
+	// folderJob is a folder collage that needs building.
+	type folderJob struct {
+		dir, key, out, sum string
+		images             []string
+	}
+	state := loadFolderState(opts.OutputDir, opts.logger())
+	var jobs []folderJob
+	unchanged := 0
+	for _, dir := range dirs {
+		images, err := folderImages(dir, filter, opts)
+		if err != nil {
+			opts.logger().Printf("Warning: could not read folder %s: %v", dir, err)
+			opts.Skipped.Add(dir, SkipUnreadable, err.Error())
+			continue
+		}
+		if len(images) == 0 {
+			continue
+		}
+
+		// Step 1: Name the collage after the folder, mirroring the tree.
+		rel, err := filepath.Rel(opts.InputDir, dir)
+		if err != nil || rel == "." {
+			rel = filepath.Base(filepath.Clean(opts.InputDir))
+		}
+		job := folderJob{dir: dir, key: filepath.ToSlash(rel) + format, out: filepath.Join(opts.OutputDir, rel+format), images: images}
+
+		// Step 2: Skip it if nothing changed since it was last built.
+		job.sum = fingerprint(images, opts)
+		if _, err := os.Stat(job.out); err == nil && state[job.key] == job.sum {
+			unchanged++
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+
+	// Step 3: Build the collages in parallel and record their inputs.
+	workers := opts.Jobs
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	var mu sync.Mutex // guards state, built and failed
+	built, failed := 0, 0
+	queue := make(chan folderJob)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if opts.canceled() != nil {
+					continue // drain the queue
+				}
+				opts.logger().Printf("Building %s (%d images)\n", job.out, len(job.images))
+				sub := opts
+				sub.Images, sub.OutputPath, sub.StateFile = job.images, job.out, ""
+				sub.Quiet = opts.Quiet || workers > 1 // progress lines of parallel builds would interleave
+				err := os.MkdirAll(filepath.Dir(job.out), 0o755)
+				if err == nil {
+					err = Create(sub)
+				}
+				mu.Lock()
+				if err != nil {
+					opts.logger().Printf("Error creating collage of %s: %v", job.dir, err)
+					failed++
+				} else {
+					built++
+					state[job.key] = job.sum
+					if err := state.save(opts.OutputDir); err != nil {
+						opts.logger().Printf("Warning: could not save state file: %v", err)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+	if err := opts.canceled(); err != nil {
+		return err
+	}
+
+	opts.logger().Printf("Per-folder collages: %d built, %d unchanged, %d failed\n", built, unchanged, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d folder collages failed", failed, built+failed)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// prefetch.go
+package collage
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// Prefetcher decodes and resizes images in the background as soon as Scan
+// finds them, so that slow storage is read while the rest of the tree is still
+// being scanned and rendering starts from ready tiles. At most limit tiles are
+// held until rendering takes them; images beyond that, and any whose cell turns
+// out to have another size, are loaded by the renderer as usual. A nil
+// *Prefetcher does nothing.
+type Prefetcher struct {
+	opts  Options
+	size  image.Point // tile size every cell is known to have
+	limit int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []string        // paths waiting to be loaded, in scan order
+	queued map[string]bool // paths in queue not yet taken or started
+	tiles  map[string]*prefetchedTile
+	held   int // tiles loading or loaded and not yet taken
+	closed bool
+}
+
+// prefetchedTile is an image loaded (or being loaded) by a Prefetcher.
+type prefetchedTile struct {
+	done chan struct{} // closed once img, info and err are set
+	img  *image.RGBA
+	info imageInfo
+	err  error
+}
+
+// NewPrefetcher starts a Prefetcher for the collage described by opts that
+// holds up to limit tiles. It returns nil, which disables prefetching, if the
+// size of the cells is not known before layout: for layouts other than the
+// plain grid, spanning or jittered cells, layouts stretched to a Size, mosaics
+// and hierarchical or updated collages.
+func NewPrefetcher(opts Options, limit int) *Prefetcher {
+	if limit <= 0 || (opts.Layout != "" && opts.Layout != LayoutGrid) || opts.Spans != SpanNone ||
+		opts.InsetJitter > 0 || opts.Size != "" || opts.Target != "" || opts.Hierarchical || opts.Update {
+		return nil
+	}
+	side := max(1, opts.CellSize-2*opts.Inset)
+	p := &Prefetcher{
+		opts:   opts,
+		size:   image.Pt(side, side),
+		limit:  limit,
+		queued: map[string]bool{},
+		tiles:  map[string]*prefetchedTile{},
+	}
+	p.cond = sync.NewCond(&p.mu)
+	for w := 0; w < runtime.NumCPU(); w++ {
+		go p.work()
+	}
+	return p
+}
+
+// Add queues images for loading.
+func (p *Prefetcher) Add(paths []string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, path := range paths {
+		if _, ok := p.tiles[path]; ok || p.queued[path] {
+			continue
+		}
+		p.queue = append(p.queue, path)
+		p.queued[path] = true
+	}
+	p.cond.Broadcast()
+}
+
+// Close stops loading further images.
+func (p *Prefetcher) Close() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.cond.Broadcast()
+}
+
+// work loads queued images while fewer than limit tiles are held.
+func (p *Prefetcher) work() {
+	for {
+		p.mu.Lock()
+		for !p.closed && (len(p.queue) == 0 || p.held >= p.limit) {
+			p.cond.Wait()
+		}
+		if p.closed {
+			p.mu.Unlock()
+			return
+		}
+		path := p.queue[0]
+		p.queue = p.queue[1:]
+		if !p.queued[path] { // taken before it was started
+			p.mu.Unlock()
+			continue
+		}
+		delete(p.queued, path)
+		t := &prefetchedTile{done: make(chan struct{}), info: imageInfo{analyze: p.opts.ScoreBorders}}
+		p.tiles[path] = t
+		p.held++
+		p.mu.Unlock()
+
+		t.img, t.err = withTimeout(p.opts.ImageTimeout, func() (*image.RGBA, error) {
+			return loadResized(path, p.size.X, p.size.Y, p.opts, &t.info)
+		})
+		close(t.done)
+	}
+}
+
+// take returns the tile of path if it was prefetched for a cell of w by h
+// pixels, waiting for it if it is still loading, and releases it. ok is false
+// if the caller has to load the image itself; err is the error of loading it
+// in the background.
+func (p *Prefetcher) take(path string, w, h int) (img *image.RGBA, info *imageInfo, ok bool, err error) {
+	if p == nil || p.size != image.Pt(w, h) {
+		return nil, nil, false, nil
+	}
+	p.mu.Lock()
+	t, found := p.tiles[path]
+	if found {
+		delete(p.tiles, path)
+		p.held--
+		p.cond.Broadcast()
+	} else {
+		delete(p.queued, path) // the renderer gets there first
+	}
+	p.mu.Unlock()
+	if !found {
+		return nil, nil, false, nil
+	}
+	<-t.done
+	return t.img, &t.info, true, t.err
+}
@@ -0,0 +1,114 @@
+// prewarm.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// Prewarm fills opts.CacheDir with the resized tiles of the collage described
+// by opts, without rendering it, so the real run later only reads the cache.
+// Tiles already cached are skipped, so an interrupted prewarm resumes where it
+// stopped. Images are resized opts.Jobs at a time (0: one per CPU); failures
+// are logged in the summary and recorded in opts.Skipped.
+func Prewarm(opts Options) error {
+	if opts.CacheDir == "" {
+		return fmt.Errorf("prewarm needs a cache directory")
+	}
+	imagePaths, err := opts.imagePaths()
+	if err != nil {
+		return err
+	}
+	if len(imagePaths) == 0 {
+		return ErrNoImages
+	}
+	layout, err := opts.planLayout(imagePaths)
+	if err != nil {
+		return err
+	}
+	if err := checkFit(opts.Fit); err != nil {
+		return err
+	}
+	if err := checkFilter(opts.Filter); err != nil {
+		return err
+	}
+	if err := checkBackend(opts.Backend); err != nil {
+		return err
+	}
+
+	// Step 1: Find the tiles the cache is missing.
+	type tileJob struct {
+		idx  int
+		w, h int
+	}
+	var jobs []tileJob
+	for idx, path := range imagePaths {
+		inner := insetCell(layout.Cells[idx], idx, opts)
+		key := tileKey(path, inner.Dx(), inner.Dy(), opts)
+		if key == "" || !tileCached(opts.CacheDir, key) {
+			jobs = append(jobs, tileJob{idx, inner.Dx(), inner.Dy()})
+		}
+	}
+	opts.logger().Printf("Prewarming %d of %d tiles (%d already cached)\n", len(jobs), len(imagePaths), len(imagePaths)-len(jobs))
+
+	// Step 2: Resize them in parallel; loadResized stores each in the cache.
+	workers := opts.Jobs
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	errs := newErrorLog(opts.MaxErrorsShown, opts.logger())
+	defer errs.summary(opts.logger().Writer())
+	prog := newProgress(len(jobs), opts)
+	var failed atomic.Int64
+	queue := make(chan tileJob)
+	var wg sync.WaitGroup
+	for w := 0; w < min(workers, len(jobs)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				if opts.canceled() != nil {
+					continue // drain the queue
+				}
+				path := imagePaths[job.idx]
+				_, err := withTimeout(opts.ImageTimeout, func() (*image.RGBA, error) {
+					return loadResized(path, job.w, job.h, opts, &imageInfo{analyze: opts.ScoreBorders})
+				})
+				if err != nil {
+					errs.add(path, err)
+					opts.Skipped.Add(path, errorKind(err), err.Error())
+					failed.Add(1)
+				}
+				prog.step()
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+	prog.finish()
+	if err := opts.canceled(); err != nil {
+		return err
+	}
+	if n := failed.Load(); n > 0 && opts.Strict {
+		return fmt.Errorf("%w: %d of %d tiles could not be cached", ErrImageFailed, n, len(jobs))
+	}
+	opts.logger().Printf("Cached %d tiles in '%s'\n", len(jobs)-int(failed.Load()), opts.CacheDir)
+	return nil
+}
+
+// tileCached reports whether the cache holds the tile for key.
+func tileCached(dir, key string) bool {
+	for _, ext := range []string{".png", ".json"} {
+		if _, err := os.Stat(tilePath(dir, key, ext)); err != nil {
+			return false
+		}
+	}
+	return true
+}
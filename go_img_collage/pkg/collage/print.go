@@ -0,0 +1,231 @@
+// print.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// pageSizes maps paper names to their portrait width and height in millimetres.
+var pageSizes = map[string][2]float64{
+	"a3":      {297, 420},
+	"a4":      {210, 297},
+	"a5":      {148, 210},
+	"letter":  {215.9, 279.4},
+	"legal":   {215.9, 355.6},
+	"tabloid": {279.4, 431.8},
+}
+
+// pageMargin is the unprintable border (in mm) left around each page for crop marks.
+const pageMargin = 12.0
+
+// printMarksSize is the slug (in mm) added outside the bleed to hold crop and registration marks.
+const printMarksSize = 8.0
+
+// parseGrid parses a "AxB" specification into its two positive integers.
+func parseGrid(spec string) (int, int, error) {
+	parts := strings.Split(strings.ToLower(spec), "x")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid grid %q: expected AxB", spec)
+	}
+	a, errA := strconv.Atoi(strings.TrimSpace(parts[0]))
+	b, errB := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if errA != nil || errB != nil || a <= 0 || b <= 0 {
+		return 0, 0, fmt.Errorf("invalid grid %q: expected two positive integers", spec)
+	}
+	return a, b, nil
+}
+
+// parsePageSize returns the page width and height in millimetres for a paper
+// name (see pageSizes) or an explicit "WxH" size in millimetres.
+func parsePageSize(spec string) (float64, float64, error) {
+	if size, ok := pageSizes[strings.ToLower(spec)]; ok {
+		return size[0], size[1], nil
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.ToLower(spec), "mm"), "x")
+	if len(parts) == 2 {
+		w, errW := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+		h, errH := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if errW == nil && errH == nil && w > 0 && h > 0 {
+			return w, h, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("unknown page size %q", spec)
+}
+
+// mmToPixels converts a length in millimetres to pixels at the given resolution.
+func mmToPixels(mm float64, dpi int) int {
+	return int(mm / 25.4 * float64(dpi))
+}
+
+// lengthUnits maps physical length units to millimetres.
+var lengthUnits = map[string]float64{
+	"mm": 1,
+	"cm": 10,
+	"in": 25.4,
+	"pt": 25.4 / 72,
+}
+
+// ParseLength parses a length such as "200", "200px", "2cm", "15mm", "24in"
+// or "36pt" and returns it in pixels, converting physical units at dpi and
+// rounding to the nearest pixel.
+func ParseLength(s string, dpi int) (int, error) {
+	t := strings.ToLower(strings.TrimSpace(s))
+	mm, unit := 0.0, ""
+	for u, v := range lengthUnits {
+		if strings.HasSuffix(t, u) {
+			mm, unit = v, u
+		}
+	}
+	t = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(t, unit), "px"))
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid length %q: use pixels or a mm, cm, in or pt suffix, e.g. 2cm", s)
+	}
+	if unit != "" {
+		if dpi <= 0 {
+			return 0, fmt.Errorf("length %q in %s needs a positive DPI", s, unit)
+		}
+		v = v * mm / 25.4 * float64(dpi)
+	}
+	return int(math.Round(v)), nil
+}
+
+// writePrintTiles splits collage into the AxB pages requested by opts.TilePrint and
+// writes each one as a PNG next to the output file (collage_tile_r1c1.png, ...).
+// Each page shows its share of the collage plus opts.TileOverlap of its neighbours,
+// with crop marks in the margin indicating where to trim before assembling the poster.
+func writePrintTiles(collage image.Image, opts Options) error {
+	cols, rows, err := parseGrid(opts.TilePrint)
+	if err != nil {
+		return err
+	}
+	pageW, pageH, err := parsePageSize(opts.PageSize)
+	if err != nil {
+		return err
+	}
+
+	bounds := collage.Bounds()
+	coreW := (bounds.Dx() + cols - 1) / cols
+	coreH := (bounds.Dy() + rows - 1) / rows
+	// Rotate the page to landscape when that better matches the tile shape.
+	if (coreW > coreH) != (pageW > pageH) {
+		pageW, pageH = pageH, pageW
+	}
+
+	pagePxW, pagePxH := mmToPixels(pageW, opts.DPI), mmToPixels(pageH, opts.DPI)
+	margin := mmToPixels(pageMargin, opts.DPI)
+	overlap := mmToPixels(opts.TileOverlap, opts.DPI)
+	trimW := pagePxW - 2*margin - 2*overlap
+	trimH := pagePxH - 2*margin - 2*overlap
+	if trimW <= 0 || trimH <= 0 {
+		return fmt.Errorf("page size %s is too small for the margin and %.1fmm overlap", opts.PageSize, opts.TileOverlap)
+	}
+
+	// Scale every tile identically so the printed pages line up.
+	scale := min(float64(trimW)/float64(coreW), float64(trimH)/float64(coreH))
+	overlapSrc := int(float64(overlap) / scale)
+
+	base := strings.TrimSuffix(opts.OutputPath, filepath.Ext(opts.OutputPath))
+	for r := 0; r < rows; r++ {
+		for c := 0; c < cols; c++ {
+			core := image.Rect(c*coreW, r*coreH, (c+1)*coreW, (r+1)*coreH).Add(bounds.Min)
+			src := image.Rect(core.Min.X-overlapSrc, core.Min.Y-overlapSrc, core.Max.X+overlapSrc, core.Max.Y+overlapSrc).Intersect(bounds)
+
+			page := image.NewRGBA(image.Rect(0, 0, pagePxW, pagePxH))
+			draw.Draw(page, page.Rect, image.White, image.Point{}, draw.Src)
+
+			// Place the core region's top-left corner just inside the margin and overlap.
+			originX := margin + overlap - int(float64(core.Min.X-src.Min.X)*scale)
+			originY := margin + overlap - int(float64(core.Min.Y-src.Min.Y)*scale)
+			dst := image.Rect(originX, originY,
+				originX+int(float64(src.Dx())*scale), originY+int(float64(src.Dy())*scale))
+			scaler(opts.Filter, dst, src).Scale(page, dst, collage, src, xdraw.Over, nil)
+
+			trim := image.Rect(margin+overlap, margin+overlap,
+				margin+overlap+int(float64(core.Dx())*scale), margin+overlap+int(float64(core.Dy())*scale))
+			gap := mmToPixels(2, opts.DPI) // keep marks clear of the artwork
+			drawCropMarks(page, trim, overlap+gap, margin-gap, max(1, opts.DPI/300))
+
+			path := fmt.Sprintf("%s_tile_r%dc%d.png", base, r+1, c+1)
+			if err := writePNG(path, page); err != nil {
+				return err
+			}
+		}
+	}
+	opts.logger().Printf("Wrote %d print tiles (%dx%d pages of %s at %d dpi)\n", rows*cols, cols, rows, opts.PageSize, opts.DPI)
+	return nil
+}
+
+// drawCropMarks draws hairlines of the given length and thickness that extend
+// the edges of trim outwards, starting offset pixels away from the trim corners.
+func drawCropMarks(dst draw.Image, trim image.Rectangle, offset, length, thickness int) {
+	black := &image.Uniform{color.Black}
+	for _, x := range []int{trim.Min.X, trim.Max.X} {
+		draw.Draw(dst, image.Rect(x, trim.Min.Y-offset-length, x+thickness, trim.Min.Y-offset), black, image.Point{}, draw.Src)
+		draw.Draw(dst, image.Rect(x, trim.Max.Y+offset, x+thickness, trim.Max.Y+offset+length), black, image.Point{}, draw.Src)
+	}
+	for _, y := range []int{trim.Min.Y, trim.Max.Y} {
+		draw.Draw(dst, image.Rect(trim.Min.X-offset-length, y, trim.Min.X-offset, y+thickness), black, image.Point{}, draw.Src)
+		draw.Draw(dst, image.Rect(trim.Max.X+offset, y, trim.Max.X+offset+length, y+thickness), black, image.Point{}, draw.Src)
+	}
+}
+
+// drawPrintMarks draws crop marks at the trim corners and registration targets at
+// the middle of each side, all placed in the slug outside a bleed of bleedPx pixels.
+func drawPrintMarks(dst draw.Image, trim image.Rectangle, bleedPx, dpi int) {
+	thickness := max(1, dpi/300)
+	offset := bleedPx + mmToPixels(1, dpi)
+	length := mmToPixels(printMarksSize, dpi) - mmToPixels(2, dpi)
+	drawCropMarks(dst, trim, offset, length, thickness)
+
+	radius := length / 3
+	dist := offset + length/2
+	midX, midY := (trim.Min.X+trim.Max.X)/2, (trim.Min.Y+trim.Max.Y)/2
+	for _, c := range []image.Point{
+		{midX, trim.Min.Y - dist}, {midX, trim.Max.Y + dist},
+		{trim.Min.X - dist, midY}, {trim.Max.X + dist, midY},
+	} {
+		drawRegistrationMark(dst, c, radius, thickness)
+	}
+}
+
+// drawRegistrationMark draws a circle with a crosshair centred on c.
+func drawRegistrationMark(dst draw.Image, c image.Point, radius, thickness int) {
+	black := &image.Uniform{color.Black}
+	outer := float64(radius * radius)
+	inner := float64((radius - thickness) * (radius - thickness))
+	for y := -radius; y <= radius; y++ {
+		for x := -radius; x <= radius; x++ {
+			if d := float64(x*x + y*y); d <= outer && d >= inner {
+				dst.Set(c.X+x, c.Y+y, color.Black)
+			}
+		}
+	}
+	extent := radius + radius/2
+	draw.Draw(dst, image.Rect(c.X-extent, c.Y, c.X+extent, c.Y+thickness), black, image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(c.X, c.Y-extent, c.X+thickness, c.Y+extent), black, image.Point{}, draw.Src)
+}
+
+// writePNG encodes img as a PNG file at path.
+func writePNG(path string, img image.Image) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := png.Encode(f, img); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,54 @@
+// print_test.go
+package collage
+
+import "testing"
+
+func TestParseGrid(t *testing.T) {
+	tests := []struct {
+		spec    string
+		a, b    int
+		wantErr bool
+	}{
+		{"2x3", 2, 3, false},
+		{"4X1", 4, 1, false},
+		{" 2 x 2 ", 2, 2, false},
+		{"2x", 0, 0, true},
+		{"0x3", 0, 0, true},
+		{"2x3x4", 0, 0, true},
+		{"axb", 0, 0, true},
+	}
+	for _, tt := range tests {
+		a, b, err := parseGrid(tt.spec)
+		if (err != nil) != tt.wantErr || a != tt.a || b != tt.b {
+			t.Errorf("parseGrid(%q) = %d, %d, %v, want %d, %d, error %v", tt.spec, a, b, err, tt.a, tt.b, tt.wantErr)
+		}
+	}
+}
+
+func TestParseLength(t *testing.T) {
+	tests := []struct {
+		s       string
+		dpi     int
+		want    int
+		wantErr bool
+	}{
+		{"200", 300, 200, false},
+		{"200px", 0, 200, false},
+		{" 12.6 PX ", 0, 13, false},
+		{"1in", 300, 300, false},
+		{"2.54cm", 300, 300, false},
+		{"15mm", 300, 177, false},
+		{"36pt", 72, 36, false},
+		{"0", 300, 0, false},
+		{"2cm", 0, 0, true},
+		{"-5", 300, 0, true},
+		{"2 feet", 300, 0, true},
+		{"", 300, 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseLength(tt.s, tt.dpi)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseLength(%q, %d) = %d, %v, want %d, error %v", tt.s, tt.dpi, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
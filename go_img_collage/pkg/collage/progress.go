@@ -0,0 +1,70 @@
+// progress.go
+package collage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressInterval is the minimum time between redraws of the progress line.
+const progressInterval = 200 * time.Millisecond
+
+// progress shows how many of total images have been drawn, with an estimate of
+// the time remaining, on a single line of stderr. A nil *progress shows nothing.
+type progress struct {
+	mu    sync.Mutex
+	w     io.Writer
+	total int
+	done  int
+	start time.Time
+	last  time.Time
+}
+
+// newProgress returns a progress display for total images, or nil if opts.Quiet is set.
+func newProgress(total int, opts Options) *progress {
+	if opts.Quiet || total == 0 {
+		return nil
+	}
+	return &progress{w: os.Stderr, total: total, start: time.Now()}
+}
+
+// step records that one more image has been processed and redraws the line
+// unless it was redrawn very recently.
+func (p *progress) step() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done++
+	if now := time.Now(); p.done == p.total || now.Sub(p.last) >= progressInterval {
+		p.last = now
+		p.draw(now)
+	}
+}
+
+// draw writes the progress line, overwriting the previous one.
+func (p *progress) draw(now time.Time) {
+	line := fmt.Sprintf("Rendering: %d/%d images (%d%%)", p.done, p.total, 100*p.done/p.total)
+	if p.done < p.total {
+		elapsed := now.Sub(p.start)
+		eta := time.Duration(float64(elapsed) / float64(p.done) * float64(p.total-p.done))
+		line += fmt.Sprintf(", ETA %v", eta.Round(time.Second))
+	} else {
+		line += fmt.Sprintf(" in %v", now.Sub(p.start).Round(time.Millisecond))
+	}
+	fmt.Fprintf(p.w, "\r%-60s", line)
+}
+
+// finish ends the progress line so later output starts on a new line.
+func (p *progress) finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.w)
+}
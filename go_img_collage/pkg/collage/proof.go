@@ -0,0 +1,209 @@
+// proof.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"sort"
+	"strings"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// printCondition is a simple model of a printing process used for soft-proofing:
+// solid ink and paper colours (sRGB, 0-1), the total ink limit, midtone dot gain
+// and the amount of grey component replaced by black in the separation.
+type printCondition struct {
+	paper    [3]float64
+	inks     [4][3]float64 // cyan, magenta, yellow, black
+	inkLimit float64       // total area coverage, 1.0 = 100%
+	dotGain  float64       // additional coverage at a 50% tint
+	gcr      float64       // fraction of the grey component printed with black
+}
+
+// printConditions are the built-in printer profiles selectable with
+// -proof-condition, used when no ICC profile is given.
+var printConditions = map[string]printCondition{
+	"coated": {
+		paper:    [3]float64{0.97, 0.97, 0.96},
+		inks:     [4][3]float64{{0, 0.62, 0.88}, {0.84, 0.12, 0.54}, {1, 0.93, 0}, {0.14, 0.13, 0.13}},
+		inkLimit: 3.3, dotGain: 0.12, gcr: 0.5,
+	},
+	"uncoated": {
+		paper:    [3]float64{0.96, 0.95, 0.92},
+		inks:     [4][3]float64{{0.20, 0.60, 0.82}, {0.82, 0.30, 0.52}, {0.98, 0.90, 0.25}, {0.22, 0.21, 0.21}},
+		inkLimit: 3.0, dotGain: 0.18, gcr: 0.6,
+	},
+	"newsprint": {
+		paper:    [3]float64{0.91, 0.89, 0.84},
+		inks:     [4][3]float64{{0.30, 0.55, 0.72}, {0.75, 0.35, 0.50}, {0.92, 0.85, 0.35}, {0.30, 0.29, 0.28}},
+		inkLimit: 2.4, dotGain: 0.26, gcr: 0.7,
+	},
+}
+
+// gamutWarningColor marks pixels the printer cannot reproduce in the soft-proof.
+var gamutWarningColor = color.RGBA{255, 0, 255, 255}
+
+// writeSoftProof renders a preview of collage, at most opts.ProofWidth pixels wide,
+// as it would look printed and saves it to opts.ProofPath. The press is that of
+// the opts.ICCProfile output profile if set, else opts.ProofCondition.
+// Pixels whose chroma drops by more than opts.GamutThreshold (CIELAB units) in the
+// simulation are out of the printer's gamut and are painted in gamutWarningColor.
+func writeSoftProof(collage image.Image, opts Options) error {
+	simulate, condition, err := proofSimulation(opts)
+	if err != nil {
+		return err
+	}
+
+	// Simulate on a downscaled copy; a proof only needs to be viewable on screen.
+	bounds := collage.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if opts.ProofWidth > 0 && w > opts.ProofWidth {
+		w, h = opts.ProofWidth, max(1, h*opts.ProofWidth/w)
+	}
+	preview := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.ApproxBiLinear.Scale(preview, preview.Rect, collage, bounds, xdraw.Src, nil)
+
+	outOfGamut := 0
+	for i := 0; i < len(preview.Pix); i += 4 {
+		// Composite over white paper (the buffer is premultiplied).
+		paper := 255 - preview.Pix[i+3]
+		src := [3]float64{
+			float64(preview.Pix[i]+paper) / 255,
+			float64(preview.Pix[i+1]+paper) / 255,
+			float64(preview.Pix[i+2]+paper) / 255,
+		}
+		sim := simulate(src)
+
+		if opts.GamutWarning && chroma(src)-chroma(sim) > opts.GamutThreshold {
+			preview.Pix[i], preview.Pix[i+1], preview.Pix[i+2] = gamutWarningColor.R, gamutWarningColor.G, gamutWarningColor.B
+			outOfGamut++
+		} else {
+			preview.Pix[i] = uint8(math.Round(sim[0] * 255))
+			preview.Pix[i+1] = uint8(math.Round(sim[1] * 255))
+			preview.Pix[i+2] = uint8(math.Round(sim[2] * 255))
+		}
+		preview.Pix[i+3] = 255
+	}
+
+	if err := writePNG(opts.ProofPath, preview); err != nil {
+		return err
+	}
+	msg := fmt.Sprintf("Soft-proof (%s) saved to '%s'", condition, opts.ProofPath)
+	if opts.GamutWarning {
+		msg += fmt.Sprintf(", %.1f%% of the preview is out of gamut", 100*float64(outOfGamut)/float64(w*h))
+	}
+	opts.logger().Println(msg)
+	return nil
+}
+
+// proofSimulation returns the function simulating print for writeSoftProof
+// and the name of the print condition it simulates.
+func proofSimulation(opts Options) (func([3]float64) [3]float64, string, error) {
+	if opts.ICCProfile != "" {
+		p, err := loadICCProfile(opts.ICCProfile)
+		if err != nil {
+			return nil, "", err
+		}
+		if p.fromCMYK == nil {
+			return nil, "", fmt.Errorf("ICC profile %s has no AToB table to proof with", opts.ICCProfile)
+		}
+		return p.proof, p.name, nil
+	}
+	cond, ok := printConditions[strings.ToLower(opts.ProofCondition)]
+	if !ok {
+		var names []string
+		for name := range printConditions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, "", fmt.Errorf("unknown print condition %q (available: %s)", opts.ProofCondition, strings.Join(names, ", "))
+	}
+	return cond.simulate, opts.ProofCondition, nil
+}
+
+// simulate separates an sRGB colour into ink coverages for the condition and
+// returns the sRGB colour of that ink combination printed on its paper.
+func (pc printCondition) simulate(rgb [3]float64) [3]float64 {
+	// Start from a naive separation with partial grey component replacement.
+	k := pc.gcr * (1 - math.Max(rgb[0], math.Max(rgb[1], rgb[2])))
+	var cov [4]float64
+	for i := 0; i < 3; i++ {
+		if k < 1 {
+			cov[i] = (1 - rgb[i] - k) / (1 - k)
+		}
+	}
+	cov[3] = k
+
+	// Refine the chromatic inks against the ink model; each mainly controls one
+	// channel (cyan red, magenta green, yellow blue). What cannot be matched
+	// within the ink limit is out of gamut.
+	out := pc.render(cov)
+	for iter := 0; iter < 12; iter++ {
+		for i := 0; i < 3; i++ {
+			cov[i] = math.Min(1, math.Max(0, cov[i]+out[i]-rgb[i]))
+		}
+		if total := cov[0] + cov[1] + cov[2] + cov[3]; total > pc.inkLimit {
+			scale := (pc.inkLimit - cov[3]) / (total - cov[3])
+			for i := 0; i < 3; i++ {
+				cov[i] *= scale
+			}
+		}
+		out = pc.render(cov)
+	}
+	return out
+}
+
+// render returns the sRGB colour of the given ink coverages printed on the
+// condition's paper, multiplying the transmittance of each layer in linear light.
+func (pc printCondition) render(cov [4]float64) [3]float64 {
+	var out [3]float64
+	for ch := 0; ch < 3; ch++ {
+		paper := srgbToLinear(pc.paper[ch])
+		t := paper
+		for i, c := range cov {
+			c += 4 * pc.dotGain * c * (1 - c)
+			t *= 1 - c*(1-srgbToLinear(pc.inks[i][ch])/paper)
+		}
+		out[ch] = linearToSRGB(t)
+	}
+	return out
+}
+
+// chroma returns the CIELAB chroma of an sRGB colour (components 0-1).
+func chroma(rgb [3]float64) float64 {
+	lab := srgbToLab(rgb)
+	return math.Hypot(lab[1], lab[2])
+}
+
+// srgbToLab converts an sRGB colour (components 0-1) to CIELAB (D65).
+func srgbToLab(rgb [3]float64) [3]float64 {
+	r, g, b := srgbToLinear(rgb[0]), srgbToLinear(rgb[1]), srgbToLinear(rgb[2])
+	x := (0.4124*r + 0.3576*g + 0.1805*b) / 0.95047
+	y := 0.2126*r + 0.7152*g + 0.0722*b
+	z := (0.0193*r + 0.1192*g + 0.9505*b) / 1.08883
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	return [3]float64{116*f(y) - 16, 500 * (f(x) - f(y)), 200 * (f(y) - f(z))}
+}
+
+func srgbToLinear(v float64) float64 {
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(v float64) float64 {
+	v = math.Min(1, math.Max(0, v))
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
@@ -0,0 +1,242 @@
+// remote.go
+package collage
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Downloader fetches remote images over HTTP(S), at most a fixed number at
+// once and, if limited, sharing a bandwidth budget between all downloads so
+// large albums don't saturate the connection. With a cache (see UseCache),
+// unchanged files are not downloaded again.
+type Downloader struct {
+	client *http.Client
+	slots  chan struct{}  // one token per download in progress
+	rate   *rateLimiter   // nil if the bandwidth is unlimited
+	cache  *downloadCache // nil if downloads are not cached
+
+	Log *log.Logger // receives warnings about the cache; nil discards them
+}
+
+// NewDownloader returns a Downloader running up to maxConcurrent downloads
+// (at least 1) at once and reading at most maxBandwidth bytes per second in
+// total; 0 leaves the bandwidth unlimited. timeout bounds each request; 0
+// disables it.
+func NewDownloader(maxConcurrent int, maxBandwidth int64, timeout time.Duration) *Downloader {
+	d := &Downloader{
+		client: &http.Client{Timeout: timeout},
+		slots:  make(chan struct{}, max(1, maxConcurrent)),
+	}
+	if maxBandwidth > 0 {
+		d.rate = &rateLimiter{bytesPerSec: float64(maxBandwidth)}
+	}
+	return d
+}
+
+// UseCache keeps downloads in dir, evicting the least recently used beyond
+// maxBytes in total (0: unlimited). Cached files are checked against their
+// recorded size and SHA-256 and revalidated with the server by ETag or
+// Last-Modified before use.
+func (d *Downloader) UseCache(dir string, maxBytes int64) {
+	d.cache = &downloadCache{dir: dir, maxBytes: maxBytes}
+}
+
+// logger returns d.Log, or discardLog if it is nil.
+func (d *Downloader) logger() *log.Logger {
+	if d.Log == nil {
+		return discardLog
+	}
+	return d.Log
+}
+
+// Fetch downloads url, waiting for a free download slot first, and returns
+// the body and its Content-Type. Responses other than 200 OK (or 304 Not
+// Modified for a cached file) are errors, as are bodies shorter or longer
+// than their Content-Length.
+func (d *Downloader) Fetch(url string) ([]byte, string, error) {
+	d.slots <- struct{}{}
+	defer func() { <-d.slots }()
+
+	// Step 1: Ask for the file only if it changed since it was cached.
+	var cached []byte
+	var meta *downloadMeta
+	if d.cache != nil {
+		cached, meta, _ = d.cache.load(url, d.logger())
+	}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if meta != nil {
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+	downloadAuthMu.Lock()
+	sign := downloadAuth[req.URL.Host]
+	downloadAuthMu.Unlock()
+	if sign != nil {
+		sign(req)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && meta != nil {
+		d.cache.touch(url)
+		return cached, meta.ContentType, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", &statusError{url: url, code: resp.StatusCode, status: resp.Status}
+	}
+
+	// Step 2: Download it within the bandwidth budget and check it is complete.
+	data, err := d.read(resp)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	contentType := resp.Header.Get("Content-Type")
+
+	// Step 3: Keep it for the next run.
+	if d.cache != nil {
+		err := d.cache.store(data, downloadMeta{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			ContentType:  contentType,
+		})
+		if err != nil {
+			d.logger().Printf("Warning: could not cache download of %s: %v", url, err)
+		}
+	}
+	return data, contentType, nil
+}
+
+// get fetches url with the authorization added by sign, sharing the download
+// slots and bandwidth budget but not the cache, as bucket listings do.
+func (d *Downloader) get(url string, sign func(*http.Request)) ([]byte, error) {
+	d.slots <- struct{}{}
+	defer func() { <-d.slots }()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	sign(req)
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, &statusError{url: url, code: resp.StatusCode, status: resp.Status}
+	}
+	return d.read(resp)
+}
+
+// read returns the body of resp, read within the bandwidth budget, and fails
+// if it is shorter or longer than its Content-Length.
+func (d *Downloader) read(resp *http.Response) ([]byte, error) {
+	var body io.Reader = resp.Body
+	if d.rate != nil {
+		body = &limitedReader{r: body, rate: d.rate}
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength >= 0 && int64(len(data)) != resp.ContentLength {
+		return nil, fmt.Errorf("got %d of %d bytes", len(data), resp.ContentLength)
+	}
+	return data, nil
+}
+
+// downloadAuth maps hosts to functions adding credentials to download
+// requests, registered by the ImageSources that list them.
+var (
+	downloadAuthMu sync.Mutex
+	downloadAuth   = map[string]func(*http.Request){}
+)
+
+// authorizeHost makes downloads from host pass through sign.
+func authorizeHost(host string, sign func(*http.Request)) {
+	downloadAuthMu.Lock()
+	defer downloadAuthMu.Unlock()
+	downloadAuth[host] = sign
+}
+
+// statusError is an HTTP response other than 200 OK.
+type statusError struct {
+	url    string
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string { return e.url + ": " + e.status }
+
+// rateLimiter spaces out reads so they average at most bytesPerSec.
+type rateLimiter struct {
+	bytesPerSec float64
+	mu          sync.Mutex
+	next        time.Time // when the budget is free again
+}
+
+// wait blocks until n more bytes fit the budget.
+func (l *rateLimiter) wait(n int) {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	until := l.next
+	l.next = l.next.Add(time.Duration(float64(n) / l.bytesPerSec * float64(time.Second)))
+	l.mu.Unlock()
+	time.Sleep(time.Until(until))
+}
+
+// limitedReader reads from r in small chunks, each waiting for the budget of rate.
+type limitedReader struct {
+	r    io.Reader
+	rate *rateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > 16<<10 {
+		p = p[:16<<10]
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		lr.rate.wait(n)
+	}
+	return n, err
+}
+
+// ParseByteSize parses a size or rate in bytes such as "500000", "800K",
+// "2.5M" or "1G" (powers of 1024, case-insensitive, with an optional trailing
+// B or /s).
+func ParseByteSize(s string) (int64, error) {
+	t := strings.ToUpper(strings.TrimSpace(s))
+	t = strings.TrimSuffix(strings.TrimSuffix(t, "/S"), "B")
+	mult := 1.0
+	if n := len(t); n > 0 {
+		if i := strings.IndexByte("KMGT", t[n-1]); i >= 0 {
+			mult = float64(int64(1) << (10 * (i + 1)))
+			t = t[:n-1]
+		}
+	}
+	v, err := strconv.ParseFloat(t, 64)
+	if err != nil || v < 0 {
+		return 0, fmt.Errorf("invalid size %q: use bytes or a K, M or G suffix, e.g. 2M", s)
+	}
+	return int64(v * mult), nil
+}
@@ -0,0 +1,97 @@
+// remote_test.go
+package collage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBucketListingLimits(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, most := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		most = max(most, inFlight)
+		mu.Unlock()
+		defer func() {
+			mu.Lock()
+			inFlight--
+			mu.Unlock()
+		}()
+		if strings.HasSuffix(r.URL.Query().Get("prefix"), "slow/") {
+			time.Sleep(200 * time.Millisecond)
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte(`{"items":[{"name":"photos/trip/a.jpg"}]}`))
+	}))
+	defer srv.Close()
+	t.Setenv("STORAGE_EMULATOR_HOST", srv.URL)
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+
+	// Listings take the download slots, so no more run at once.
+	opts := DefaultOptions()
+	opts.MaxDownloads = 1
+	src, err := newGCSSource("gs://album/photos", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := src.(*bucketSource).list
+	errs := make(chan error)
+	for range 4 {
+		go func() {
+			_, err := list("photos/")
+			errs <- err
+		}()
+	}
+	for range 4 {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if most != 1 {
+		t.Errorf("%d listings ran at once, want 1", most)
+	}
+
+	// And they give up after the download timeout.
+	opts.DownloadTimeout = 50 * time.Millisecond
+	if src, err = newGCSSource("gs://album/slow", opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := src.List(); err == nil {
+		t.Error("List() of a slow bucket succeeded, want a timeout")
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    int64
+		wantErr bool
+	}{
+		{"500000", 500000, false},
+		{"800K", 800 << 10, false},
+		{"2.5M", 5 << 19, false},
+		{"1g", 1 << 30, false},
+		{"1T", 1 << 40, false},
+		{" 5GB ", 5 << 30, false},
+		{"2MB/s", 2 << 20, false},
+		{"100B", 100, false},
+		{"0", 0, false},
+		{"", 0, true},
+		{"M", 0, true},
+		{"-1M", 0, true},
+		{"2X", 0, true},
+		{"fast", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,377 @@
+// render.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"sync"
+
+	mmap "github.com/edsrzf/mmap-go"
+)
+
+// canvasBounds returns the trim rectangle the layout is drawn in and the full
+// canvas around it, which adds the bleed and, for crop marks, a slug to draw them in.
+func canvasBounds(layout Layout, opts Options) (trim, canvas image.Rectangle) {
+	pad := mmToPixels(opts.Bleed, opts.DPI)
+	if opts.CropMarks {
+		pad += mmToPixels(printMarksSize, opts.DPI)
+	}
+	trim = image.Rect(pad, pad, pad+layout.Width, pad+layout.Height)
+	canvas = image.Rect(0, 0, layout.Width+2*pad, layout.Height+2*pad)
+	return trim, canvas
+}
+
+// fillBackground fills the canvas with bg.
+func fillBackground(img *image.RGBA, bg color.Color) {
+	draw.Draw(img, img.Rect, &image.Uniform{bg}, image.Point{}, draw.Src)
+}
+
+// renderImages loads each image, scales it to fit its layout cell and pastes it
+// centred in that cell, with cells offset by origin on dst. Failures are
+// recorded in errs and leave the cell empty; with opts.Strict, the first one
+// stops rendering and is returned. Only the cells inside dst are drawn, so a
+// collage can be rendered in bands; each counts as a step of prog.
+func renderImages(dst *image.RGBA, origin image.Point, layout Layout, imagePaths []string, opts Options, errs *errorLog, prog *progress) error {
+	var fonts *fontSet
+	if opts.Caption != "" || len(opts.Badges) > 0 {
+		fonts, _ = loadFonts(opts.Font) // checked by checkText
+	}
+	for idx, imgPath := range imagePaths {
+		cell := layout.Cells[idx].Add(origin)
+		if !cell.In(dst.Rect) {
+			continue
+		}
+		if err := opts.canceled(); err != nil {
+			return err
+		}
+		inner := insetCell(cell, idx, opts)
+		resized, info, ok, err := opts.Prefetch.take(imgPath, inner.Dx(), inner.Dy())
+		if !ok {
+			info = &imageInfo{analyze: opts.ScoreBorders}
+			resized, err = withTimeout(opts.ImageTimeout, func() (*image.RGBA, error) {
+				return loadResized(imgPath, inner.Dx(), inner.Dy(), opts, info)
+			})
+		}
+		if err != nil {
+			errs.add(imgPath, err)
+			opts.Skipped.Add(imgPath, errorKind(err), err.Error())
+			prog.step()
+			if opts.Strict {
+				return imageFailure(imgPath, err)
+			}
+			continue
+		}
+		newW, newH := resized.Rect.Dx(), resized.Rect.Dy()
+
+		// Center the resized image in the cell, inside its inset.
+		offsetX := inner.Min.X + (inner.Dx()-newW)/2
+		offsetY := inner.Min.Y + (inner.Dy()-newH)/2
+
+		// Paste the resized image onto the collage, tilted if rotation jitter is on.
+		destRect := image.Rect(offsetX, offsetY, offsetX+newW, offsetY+newH)
+		if angle := jitterAngle(idx, opts); angle != 0 {
+			destRect = pasteRotated(dst, inner, resized, angle)
+		} else {
+			draw.Draw(dst, destRect, resized, image.Point{}, draw.Over)
+		}
+
+		if opts.Caption != "" {
+			drawCaption(dst, destRect, captionText(opts.Caption, imgPath, idx, opts), fonts, opts)
+		}
+		if len(opts.Badges) > 0 {
+			drawBadges(dst, destRect, imageBadges(imgPath, info, opts.Badges), fonts)
+		}
+		if info.analyze {
+			drawScoreBorder(dst, cell, info.stats)
+		}
+		prog.step()
+	}
+	return nil
+}
+
+// Create renders the collage described by opts and writes it to opts.OutputPath,
+// together with any requested print tiles, proofs and coverage reports; with
+// opts.Compare, a comparison sheet of layouts (see createComparison) or with
+// opts.Variants, that many variations of it (see createVariants) or with
+// opts.Carousel, a panorama cut into slides (see createCarousel) or with
+// opts.PerPage, a series of pages (see createPages).
+// On success the inputs are recorded in opts.StateFile, if set.
+func Create(opts Options) error {
+	render := create
+	switch {
+	case len(opts.Compare) > 0:
+		render = createComparison
+	case opts.Variants > 1:
+		render = createVariants
+	case opts.Carousel > 0:
+		render = createCarousel
+	case opts.PerPage > 0:
+		render = createPages
+	}
+	if err := render(opts); err != nil {
+		return err
+	}
+	if err := saveState(opts); err != nil {
+		opts.logger().Printf("Warning: could not save state file: %v", err)
+	}
+	return nil
+}
+
+// create implements Create. This version uses a disk‑backed memory map to hold
+// the collage buffer.
+func create(opts Options) error {
+	if opts.Hierarchical {
+		if err := checkOutput(opts); err != nil {
+			return err
+		}
+		master, cleanup, err := opts.overview()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		defer onInterrupt(cleanup)()
+		opts = master
+	}
+	if opts.Target != "" {
+		if err := checkOutput(opts); err != nil {
+			return err
+		}
+		mosaic, cleanup, err := opts.mosaic()
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		defer onInterrupt(cleanup)()
+		opts = mosaic
+	}
+	imagePaths, err := opts.imagePaths()
+	if err != nil {
+		return err
+	}
+	outputPath := opts.OutputPath
+	if err := checkOutput(opts); err != nil {
+		return err
+	}
+	totalImages := len(imagePaths)
+	if totalImages == 0 {
+		return ErrNoImages
+	}
+
+	layout, err := opts.planLayout(imagePaths)
+	if err != nil {
+		return err
+	}
+	trim, bounds := canvasBounds(layout, opts)
+	collageWidth, collageHeight := bounds.Dx(), bounds.Dy()
+	bufferSize := collageWidth * collageHeight * 4 // 4 bytes per pixel (RGBA)
+
+	// Check the fit, background, text settings and font before spending time on rendering.
+	if err := checkFit(opts.Fit); err != nil {
+		return err
+	}
+	if err := checkFilter(opts.Filter); err != nil {
+		return err
+	}
+	if err := checkBackend(opts.Backend); err != nil {
+		return err
+	}
+	if err := checkMatteArea(opts.MatteArea); err != nil {
+		return err
+	}
+	bg, err := parseColor(opts.Background)
+	if err != nil {
+		return err
+	}
+	if err := checkText(opts); err != nil {
+		return err
+	}
+
+	// Stream the collage in bands of cells instead of holding the whole canvas.
+	if opts.Streaming {
+		if err := checkStreaming(opts); err != nil {
+			return err
+		}
+		errs := newErrorLog(opts.MaxErrorsShown, opts.logger())
+		defer errs.summary(opts.logger().Writer())
+		if err := createStreaming(layout, imagePaths, bg, opts, errs); err != nil {
+			return err
+		}
+		if err := writeManifests(newManifest(bounds, trim.Min, layout, imagePaths, opts), opts); err != nil {
+			return err
+		}
+		if err := writeOccupancyMask(layout, imagePaths, errs, opts); err != nil {
+			return err
+		}
+		opts.logger().Printf("Collage saved to '%s'\n", outputPath)
+		return nil
+	}
+
+	// Redraw only the changed cells of an existing collage if possible.
+	if opts.Update {
+		updated, err := updateCollage(bounds, trim.Min, layout, imagePaths, bg, opts)
+		if err != nil {
+			return err
+		}
+		if updated {
+			opts.logger().Printf("Collage saved to '%s'\n", outputPath)
+			return nil
+		}
+	}
+
+	// Fail early if the temp or output filesystem cannot hold the result.
+	if !opts.SkipSpaceCheck {
+		err := checkDiskSpace(
+			spaceNeed{dir: os.TempDir(), what: "temp canvas", bytes: uint64(bufferSize)},
+			spaceNeed{dir: outputDir(outputPath), what: "output", bytes: estimateOutputSize(collageWidth, collageHeight)},
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Create a temporary file to back our collage buffer.
+	tmpFile, err := os.CreateTemp("", "collage-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %v", err)
+	}
+	// Ensure the file is removed after we're done.
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	// Set the file size.
+	if err := tmpFile.Truncate(int64(bufferSize)); err != nil {
+		return fmt.Errorf("failed to truncate temp file: %v", err)
+	}
+
+	// Memory-map the temporary file (read-write).
+	mapped, err := mmap.Map(tmpFile, mmap.RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("failed to memory-map file: %v", err)
+	}
+	// Ensure the mapping is unmapped later.
+	defer mapped.Unmap()
+
+	// If interrupted, remove the (multi-GB) temp file. Unix allows unlinking it while
+	// mapped, which avoids pulling the mapping out from under the rendering code;
+	// Windows needs the mapping and handle released first.
+	defer onInterrupt(func() {
+		if os.Remove(tmpFile.Name()) == nil {
+			return
+		}
+		mapped.Unmap()
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+	})()
+
+	// Create an RGBA image that uses the memory-mapped slice as its pixel buffer.
+	collage := &image.RGBA{
+		Pix:    mapped,
+		Stride: collageWidth * 4,
+		Rect:   bounds,
+	}
+	fillBackground(collage, bg)
+
+	// Process each image, collecting errors for a summary at the end.
+	errs := newErrorLog(opts.MaxErrorsShown, opts.logger())
+	defer errs.summary(opts.logger().Writer())
+	prog := newProgress(totalImages, opts)
+	err = renderImages(collage, trim.Min, layout, imagePaths, opts, errs, prog)
+	prog.finish()
+	if err != nil {
+		return err
+	}
+	if err := drawTitleCells(collage, trim.Min, layout, opts); err != nil {
+		return err
+	}
+
+	// Ensure any changes to the memory map are flushed.
+	if err := mapped.Flush(); err != nil {
+		return fmt.Errorf("failed to flush memory map: %v", err)
+	}
+
+	if opts.CropMarks {
+		drawPrintMarks(collage, trim, mmToPixels(opts.Bleed, opts.DPI), opts.DPI)
+	}
+
+	// Side outputs only read the canvas, so they are written concurrently with
+	// encoding the collage itself to hide their cost.
+	var sides []func() error
+
+	// Split the collage (trim area only) into printable pages if requested.
+	if opts.TilePrint != "" {
+		sides = append(sides, func() error {
+			if err := writePrintTiles(collage.SubImage(trim), opts); err != nil {
+				return fmt.Errorf("failed to write print tiles: %v", err)
+			}
+			return nil
+		})
+	}
+
+	// Export the alpha channel, which also shows the uncovered areas of a
+	// transparent background.
+	if opts.MattePath != "" {
+		sides = append(sides, func() error {
+			area := collage
+			if opts.MatteArea == MatteTrim {
+				area = collage.SubImage(trim).(*image.RGBA)
+			}
+			if err := writeCoverageMask(opts.MattePath, area); err != nil {
+				return fmt.Errorf("failed to write matte: %v", err)
+			}
+			return nil
+		})
+	}
+	if opts.CoverageReport != "" {
+		sides = append(sides, func() error {
+			if err := writeCoverageReport(opts.CoverageReport, collage.SubImage(trim).(*image.RGBA), opts.logger()); err != nil {
+				return fmt.Errorf("failed to write coverage report: %v", err)
+			}
+			return nil
+		})
+	}
+
+	// Preview how the collage will print.
+	if opts.ProofPath != "" {
+		sides = append(sides, func() error {
+			if err := writeSoftProof(collage.SubImage(trim), opts); err != nil {
+				return fmt.Errorf("failed to write soft-proof: %v", err)
+			}
+			return nil
+		})
+	}
+
+	var side sync.WaitGroup
+	sideErrs := make(chan error, len(sides))
+	for _, write := range sides {
+		side.Add(1)
+		go func() {
+			defer side.Done()
+			if err := write(); err != nil {
+				sideErrs <- err
+			}
+		}()
+	}
+
+	if err = writeOutput(collage, opts); err != nil {
+		err = fmt.Errorf("%w: %w", ErrEncode, err)
+	}
+	if err == nil {
+		err = writeManifests(newManifest(bounds, trim.Min, layout, imagePaths, opts), opts)
+	}
+	if err == nil {
+		err = writeOccupancyMask(layout, imagePaths, errs, opts)
+	}
+	side.Wait()
+	close(sideErrs)
+	if err != nil {
+		return err
+	}
+	if err := <-sideErrs; err != nil {
+		return err
+	}
+	opts.logger().Printf("Collage saved to '%s'\n", outputPath)
+	return nil
+}
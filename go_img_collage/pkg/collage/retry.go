@@ -0,0 +1,88 @@
+// retry.go
+package collage
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how transient source read errors are retried before an
+// image is given up on.
+type RetryPolicy struct {
+	Attempts int           // retries after the first failure; 0 disables retrying
+	Backoff  time.Duration // delay before the first retry, doubled for each further one
+}
+
+// transientErrnos are errors network filesystems (NFS, SMB) and remote sources
+// report for conditions that usually clear up when the operation is repeated.
+var transientErrnos = []syscall.Errno{
+	syscall.EIO, syscall.ESTALE, syscall.ETIMEDOUT, syscall.EAGAIN, syscall.EINTR,
+	syscall.EBUSY, syscall.ECONNRESET, syscall.ECONNABORTED, syscall.EHOSTUNREACH, syscall.ENETUNREACH,
+}
+
+// transientWindowsErrnos are the SMB equivalents reported on Windows.
+var transientWindowsErrnos = []syscall.Errno{
+	32,  // ERROR_SHARING_VIOLATION
+	59,  // ERROR_UNEXP_NET_ERR
+	64,  // ERROR_NETNAME_DELETED
+	121, // ERROR_SEM_TIMEOUT
+}
+
+// isTransient reports whether err is worth retrying.
+func isTransient(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+	var se *statusError
+	if errors.As(err, &se) && (se.code == 429 || se.code >= 500) {
+		return true // the server is overloaded or failing for now
+	}
+	errnos := transientErrnos
+	if runtime.GOOS == "windows" {
+		errnos = transientWindowsErrnos
+	}
+	for _, errno := range errnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// do runs f, retrying it with exponential backoff and jitter while it fails with
+// a transient error. what names the operation in the retry warnings to log.
+func (p RetryPolicy) do(log *log.Logger, what string, f func() error) error {
+	delay := p.Backoff
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= p.Attempts || !isTransient(err) {
+			return err
+		}
+		wait := delay + time.Duration(rand.Int63n(int64(delay)/2+1))
+		log.Printf("Transient error reading %s (attempt %d/%d), retrying in %v: %v",
+			what, attempt+1, p.Attempts+1, wait.Round(time.Millisecond), err)
+		time.Sleep(wait)
+		delay *= 2
+	}
+}
+
+// readFile reads path under the retry policy, logging retries to log.
+func (p RetryPolicy) readFile(path string, log *log.Logger) ([]byte, error) {
+	var data []byte
+	err := p.do(log, path, func() error {
+		var err error
+		data, err = os.ReadFile(path)
+		return err
+	})
+	return data, err
+}
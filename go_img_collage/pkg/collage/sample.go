@@ -0,0 +1,105 @@
+// sample.go
+package collage
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"sort"
+)
+
+// Sampling strategies choosing which images stay under Options.MaxImages and
+// Options.MaxPerFolder.
+const (
+	SampleFirst  = "first"  // the first images in collage order
+	SampleLast   = "last"   // the last images in collage order
+	SampleEvenly = "evenly" // images spread evenly over the collage order
+	SampleRandom = "random" // a random choice, reproducible with Seed
+)
+
+// checkSample returns an error for an unknown sampling strategy.
+func checkSample(strategy string) error {
+	switch strategy {
+	case "", SampleFirst, SampleLast, SampleEvenly, SampleRandom:
+		return nil
+	}
+	return fmt.Errorf("unknown sampling %q: use %s, %s, %s or %s", strategy, SampleFirst, SampleLast, SampleEvenly, SampleRandom)
+}
+
+// sampleIndices returns the indices, in increasing order, of the k of n
+// images the strategy keeps.
+func sampleIndices(n, k int, strategy string, seed int64) []int {
+	idx := make([]int, 0, k)
+	switch strategy {
+	case SampleLast:
+		for i := n - k; i < n; i++ {
+			idx = append(idx, i)
+		}
+	case SampleEvenly:
+		for i := 0; i < k; i++ {
+			idx = append(idx, i*n/k)
+		}
+	case SampleRandom:
+		idx = append(idx, rand.New(rand.NewSource(seed)).Perm(n)[:k]...)
+		sort.Ints(idx)
+	default:
+		for i := 0; i < k; i++ {
+			idx = append(idx, i)
+		}
+	}
+	return idx
+}
+
+// sample keeps at most opts.MaxPerFolder images of each folder and then at
+// most opts.MaxImages in all, chosen by opts.Sample and in the given order,
+// recording the others in opts.Skipped.
+func sample(paths []string, opts Options) []string {
+	total := len(paths)
+	if opts.MaxPerFolder > 0 {
+		// Step 1: Sample each folder, keeping the images in place.
+		byFolder := map[string][]int{}
+		var folders []string
+		for i, p := range paths {
+			dir := filepath.Dir(p)
+			if _, ok := byFolder[dir]; !ok {
+				folders = append(folders, dir)
+			}
+			byFolder[dir] = append(byFolder[dir], i)
+		}
+		keep := make([]bool, len(paths))
+		for f, dir := range folders {
+			members := byFolder[dir]
+			k := min(len(members), opts.MaxPerFolder)
+			for _, j := range sampleIndices(len(members), k, opts.Sample, opts.Seed+int64(f)) {
+				keep[members[j]] = true
+			}
+		}
+		paths = keepSampled(paths, keep, fmt.Sprintf("over %d per folder", opts.MaxPerFolder), opts)
+	}
+	if opts.MaxImages > 0 && len(paths) > opts.MaxImages {
+		// Step 2: Sample the whole collage.
+		keep := make([]bool, len(paths))
+		for _, j := range sampleIndices(len(paths), opts.MaxImages, opts.Sample, opts.Seed) {
+			keep[j] = true
+		}
+		paths = keepSampled(paths, keep, fmt.Sprintf("over %d images", opts.MaxImages), opts)
+	}
+	if len(paths) < total {
+		opts.logger().Printf("Sampled %d of %d images (%s)\n", len(paths), total, opts.Sample)
+	}
+	return paths
+}
+
+// keepSampled returns the paths marked in keep, recording the others in
+// opts.Skipped with detail.
+func keepSampled(paths []string, keep []bool, detail string, opts Options) []string {
+	var kept []string
+	for i, p := range paths {
+		if keep[i] {
+			kept = append(kept, p)
+		} else {
+			opts.Skipped.Add(p, SkipSampled, detail)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,53 @@
+// scale.go
+package collage
+
+import (
+	"fmt"
+	"image"
+
+	xdraw "golang.org/x/image/draw"
+)
+
+// Resampling filters (Options.Filter) for scaling images.
+const (
+	FilterAuto       = "auto"       // box for downscales beyond boxThreshold, else catmullrom
+	FilterNearest    = "nearest"    // nearest neighbour: fastest, blocky
+	FilterBilinear   = "bilinear"   // bilinear: fast, slightly soft
+	FilterCatmullRom = "catmullrom" // Catmull-Rom cubic: sharpest, slowest on large downscales
+	FilterBox        = "box"        // area average: fast and alias-free for large downscales
+)
+
+// boxThreshold is the downscale factor beyond which FilterAuto averages areas:
+// Catmull-Rom's cost grows with the factor while its sharpness no longer shows.
+const boxThreshold = 4
+
+// boxKernel averages the source pixels under each destination pixel; the
+// kernel is widened by the downscale factor, so its support covers the area.
+var boxKernel = &xdraw.Kernel{Support: 0.5, At: func(t float64) float64 { return 1 }}
+
+// checkFilter returns an error for an unknown resampling filter.
+func checkFilter(filter string) error {
+	switch filter {
+	case "", FilterAuto, FilterNearest, FilterBilinear, FilterCatmullRom, FilterBox:
+		return nil
+	}
+	return fmt.Errorf("unknown filter %q: use auto, nearest, bilinear, catmullrom or box", filter)
+}
+
+// scaler returns the scaler filter uses to resample src into dst.
+func scaler(filter string, dst, src image.Rectangle) xdraw.Scaler {
+	switch filter {
+	case FilterNearest:
+		return xdraw.NearestNeighbor
+	case FilterBilinear:
+		return xdraw.BiLinear
+	case FilterCatmullRom:
+		return xdraw.CatmullRom
+	case FilterBox:
+		return boxKernel
+	}
+	if src.Dx() > boxThreshold*dst.Dx() && src.Dy() > boxThreshold*dst.Dy() {
+		return boxKernel
+	}
+	return xdraw.CatmullRom
+}
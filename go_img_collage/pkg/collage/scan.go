@@ -0,0 +1,212 @@
+// scan.go
+package collage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// IsImageFile reports whether name has an extension LoadImage can decode.
+// Only the last extension counts, in any case: photo.JPG and photo.jpg.webp are images.
+func IsImageFile(name string) bool {
+	_, ok := decoders[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// SortedImagePaths returns a slice of image file paths gathered from the sorted subfolders of rootDir.
+// It also returns a slice of subfolder paths (in sorted order) for later per‑folder counting.
+func SortedImagePaths(rootDir string) ([]string, []string, error) {
+	return Scan(Options{InputDir: rootDir, ScanWorkers: DefaultOptions().ScanWorkers})
+}
+
+// Scan gathers the image paths from the sorted subfolders of opts.InputDir, like
+// SortedImagePaths, followed by those of each of opts.InputDirs, and records
+// every file it leaves out in opts.Skipped. With several roots, an image found
+// under more than one of them is included once (see dedupeImages). Roots may
+// be remote ImageSources such as s3://bucket/prefix, whose images are URLs.
+func Scan(opts Options) ([]string, []string, error) {
+	var imagePaths, subfolders []string
+	for _, root := range append([]string{opts.InputDir}, opts.InputDirs...) {
+		source, err := OpenSource(root, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		paths, folders, err := source.List()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := opts.canceled(); err != nil {
+			return nil, nil, err
+		}
+		imagePaths = append(imagePaths, paths...)
+		subfolders = append(subfolders, folders...)
+	}
+	if len(opts.InputDirs) > 0 {
+		imagePaths = dedupeImages(imagePaths, opts)
+	}
+	return imagePaths, subfolders, nil
+}
+
+// walkDirs returns root and every folder below it in sorted order, reading up
+// to opts.ScanWorkers folders at once. Unreadable folders are logged and
+// recorded in opts.Skipped.
+func walkDirs(root string, opts Options) []string {
+	var (
+		mu      sync.Mutex
+		found   = sync.NewCond(&mu) // signalled when queue or pending change
+		queue   = []string{root}    // folders waiting to be read
+		pending = 1                 // folders queued or being read
+		dirs    []string
+		wg      sync.WaitGroup
+	)
+	for w := 0; w < max(1, opts.ScanWorkers); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			defer mu.Unlock()
+			for {
+				for len(queue) == 0 && pending > 0 {
+					found.Wait()
+				}
+				if pending == 0 {
+					return
+				}
+				dir := queue[len(queue)-1]
+				queue = queue[:len(queue)-1]
+				mu.Unlock()
+
+				var subdirs []string
+				canceled := opts.canceled() != nil
+				if !canceled {
+					entries, err := os.ReadDir(dir)
+					if err != nil {
+						opts.logger().Printf("Warning: could not read folder %s: %v", dir, err)
+						opts.Skipped.Add(dir, SkipUnreadable, err.Error())
+					}
+					for _, e := range entries {
+						if e.IsDir() {
+							subdirs = append(subdirs, filepath.Join(dir, e.Name()))
+						}
+					}
+				}
+
+				mu.Lock()
+				if !canceled {
+					dirs = append(dirs, dir)
+				}
+				queue = append(queue, subdirs...)
+				pending += len(subdirs) - 1
+				found.Broadcast()
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Strings(dirs)
+	return dirs
+}
+
+// scanRoot gathers the image paths from the sorted subfolders of rootDir that
+// pass opts.Include and opts.Exclude and are dated within opts.Since and
+// opts.Before.
+func scanRoot(rootDir string, opts Options) ([]string, []string, error) {
+	filter, err := newPathFilter(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var subfolders []string
+	for _, e := range entries {
+		if e.IsDir() {
+			subfolders = append(subfolders, filepath.Join(rootDir, e.Name()))
+		} else {
+			opts.Skipped.Add(filepath.Join(rootDir, e.Name()), SkipOutsideAlbum, "")
+		}
+	}
+	sort.Strings(subfolders)
+
+	// Step 1: Read the folders concurrently; slow storage spends its time waiting.
+	type folderScan struct {
+		images  []string
+		skipped []Skip
+		undated int // images left out by date
+		err     error
+	}
+	scans := make([]folderScan, len(subfolders))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(1, opts.ScanWorkers), len(subfolders)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if opts.canceled() != nil {
+					continue // drain the queue
+				}
+				folder := subfolders[i]
+				files, err := os.ReadDir(folder)
+				if err != nil {
+					scans[i].err = err
+					continue
+				}
+				for _, file := range files {
+					if file.IsDir() {
+						continue
+					}
+					path := filepath.Join(folder, file.Name())
+					if !IsImageFile(file.Name()) {
+						scans[i].skipped = append(scans[i].skipped, Skip{path, SkipUnsupported, filepath.Ext(path)})
+						continue
+					}
+					if ok, why := filter.allows(rootDir, path); !ok {
+						scans[i].skipped = append(scans[i].skipped, Skip{path, SkipExcluded, why})
+						continue
+					}
+					if s, ok := outsideDates(path, opts); ok {
+						scans[i].skipped = append(scans[i].skipped, s)
+						scans[i].undated++
+						continue
+					}
+					scans[i].images = append(scans[i].images, path)
+				}
+				sort.Strings(scans[i].images)
+				opts.Prefetch.Add(scans[i].images)
+			}
+		}()
+	}
+	for i := range subfolders {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	if err := opts.canceled(); err != nil {
+		return nil, nil, err
+	}
+
+	// Step 2: Collect the images in folder order.
+	var imagePaths []string
+	undated := 0
+	for i, folder := range subfolders {
+		if err := scans[i].err; err != nil {
+			opts.logger().Printf("Warning: could not read folder %s: %v", folder, err)
+			opts.Skipped.Add(folder, SkipUnreadable, err.Error())
+			continue
+		}
+		for _, s := range scans[i].skipped {
+			opts.Skipped.Add(s.Path, s.Reason, s.Detail)
+		}
+		imagePaths = append(imagePaths, scans[i].images...)
+		undated += scans[i].undated
+	}
+	if opts.dated() {
+		opts.logger().Printf("%d of %d images in %s are dated %s\n", len(imagePaths), len(imagePaths)+undated, rootDir, opts.dateRange())
+	}
+	return imagePaths, subfolders, nil
+}
@@ -0,0 +1,65 @@
+// sections.go
+package collage
+
+import (
+	"image"
+	"math"
+	"path/filepath"
+)
+
+// Header is a title banner of a layout, drawn across the top of a group of cells.
+type Header struct {
+	Rect image.Rectangle
+	Text string
+}
+
+// sectionHeaderHeight returns the height of the folder banners of LayoutSections
+// for the given cell size.
+func sectionHeaderHeight(cellSize int) int {
+	return max(24, cellSize/4)
+}
+
+// sectionLayout groups the images by folder, in the order each folder first
+// appears, and lays each group out on the grid starting on a new row below a
+// banner with the folder name. The grid is opts.Cols cells wide or as wide as
+// a nearly square grid of all the images.
+func sectionLayout(paths []string, opts Options) Layout {
+	// Step 1: Group the images by folder, keeping the folder order.
+	var folders []string
+	groups := map[string][]int{}
+	for i, p := range paths {
+		dir := filepath.Dir(p)
+		if _, ok := groups[dir]; !ok {
+			folders = append(folders, dir)
+		}
+		groups[dir] = append(groups[dir], i)
+	}
+
+	ncols := opts.Cols
+	if ncols <= 0 {
+		ncols = int(math.Ceil(math.Sqrt(float64(len(paths)))))
+	}
+	pitch := opts.CellSize + opts.Gutter
+	width := ncols*pitch - opts.Gutter
+	banner := sectionHeaderHeight(opts.CellSize)
+
+	// Step 2: Stack a banner and the rows of cells of each folder.
+	layout := Layout{Width: width + 2*opts.Margin, Cells: make([]image.Rectangle, len(paths))}
+	y := opts.Margin
+	for _, dir := range folders {
+		layout.Headers = append(layout.Headers, Header{
+			Rect: image.Rect(opts.Margin, y, opts.Margin+width, y+banner),
+			Text: filepath.Base(dir),
+		})
+		y += banner + opts.Gutter
+		members := groups[dir]
+		for k, i := range members {
+			x := opts.Margin + k%ncols*pitch
+			top := y + k/ncols*pitch
+			layout.Cells[i] = image.Rect(x, top, x+opts.CellSize, top+opts.CellSize)
+		}
+		y += (len(members) + ncols - 1) / ncols * pitch
+	}
+	layout.Height = y - opts.Gutter + opts.Margin
+	return layout
+}
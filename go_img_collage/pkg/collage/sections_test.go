@@ -0,0 +1,25 @@
+// sections_test.go
+package collage
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+func TestSectionLayout(t *testing.T) {
+	opts := DefaultOptions()
+	opts.CellSize, opts.Cols = 100, 2
+	l := sectionLayout([]string{"a/1.jpg", "b/1.jpg", "a/2.jpg"}, opts)
+	cells := []image.Rectangle{image.Rect(0, 25, 100, 125), image.Rect(0, 150, 100, 250), image.Rect(100, 25, 200, 125)}
+	headers := []Header{{Rect: image.Rect(0, 0, 200, 25), Text: "a"}, {Rect: image.Rect(0, 125, 200, 150), Text: "b"}}
+	if l.Width != 200 || l.Height != 250 {
+		t.Errorf("sectionLayout() is %dx%d, want 200x250", l.Width, l.Height)
+	}
+	if !reflect.DeepEqual(l.Cells, cells) {
+		t.Errorf("sectionLayout() cells = %v, want %v", l.Cells, cells)
+	}
+	if !reflect.DeepEqual(l.Headers, headers) {
+		t.Errorf("sectionLayout() headers = %v, want %v", l.Headers, headers)
+	}
+}
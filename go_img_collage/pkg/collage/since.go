@@ -0,0 +1,142 @@
+// since.go
+package collage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Image dates used by the -since, -after and -before filters (Options.SinceBy).
+const (
+	DateModified = "mtime" // the file modification time
+	DateTaken    = "exif"  // the EXIF capture time, or the modification time if there is none
+)
+
+// sinceLayouts are the timestamp forms accepted by ParseSince, tried in order.
+var sinceLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// ParseSince parses a -since, -after or -before value relative to now: a
+// duration ago such as 7d, 2w, 36h or 90m, or a timestamp such as 2024-06-01
+// or 2024-06-01T18:00:00Z (local time unless a zone is given).
+func ParseSince(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if n, unit := strings.TrimRight(s, "dw"), strings.TrimLeft(s, "0123456789"); unit == "d" || unit == "w" {
+		days, err := strconv.Atoi(n)
+		if err == nil {
+			if unit == "w" {
+				days *= 7
+			}
+			return now.AddDate(0, 0, -days), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	for _, layout := range sinceLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q: use a duration like 7d, 2w or 36h, or a date like 2024-06-01", s)
+}
+
+// checkSinceBy returns an error for an unknown image date source.
+func checkSinceBy(by string) error {
+	switch by {
+	case DateModified, DateTaken:
+		return nil
+	}
+	return fmt.Errorf("unknown image date %q: use mtime or exif", by)
+}
+
+// imageDate returns the date of the image at path: its EXIF capture time if by
+// is DateTaken and it has one, otherwise its modification time. Only the EXIF
+// header of the file is read, not the image data.
+func imageDate(path, by string, opts Options) (time.Time, error) {
+	if by == DateTaken {
+		var data []byte
+		err := opts.Retry.do(opts.logger(), path, func() error {
+			var err error
+			data, err = exifHeader(path)
+			return err
+		})
+		if err == nil {
+			if t, ok := parseEXIF(data).dateTaken(); ok {
+				return t, nil
+			}
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// filterSince drops the images dated before opts.Since or not before
+// opts.Before, recording them in opts.Skipped. Images whose date cannot be
+// read are kept, so rendering reports their error as usual.
+func filterSince(paths []string, opts Options) []string {
+	if !opts.dated() {
+		return paths
+	}
+	kept := datedImages(paths, opts)
+	opts.logger().Printf("%d of %d images are dated %s\n", len(kept), len(paths), opts.dateRange())
+	return kept
+}
+
+// datedImages returns the paths dated from opts.Since and before opts.Before,
+// where set, recording the others in opts.Skipped.
+func datedImages(paths []string, opts Options) []string {
+	if !opts.dated() {
+		return paths
+	}
+	var kept []string
+	for _, path := range paths {
+		if s, ok := outsideDates(path, opts); ok {
+			opts.Skipped.Add(s.Path, s.Reason, s.Detail)
+			continue
+		}
+		kept = append(kept, path)
+	}
+	return kept
+}
+
+// outsideDates returns the Skip for the image at path if it is dated before
+// opts.Since or not before opts.Before. Images whose date cannot be read are
+// within them.
+func outsideDates(path string, opts Options) (Skip, bool) {
+	if !opts.dated() {
+		return Skip{}, false
+	}
+	t, err := imageDate(path, opts.SinceBy, opts)
+	switch {
+	case err != nil:
+		return Skip{}, false
+	case !opts.Since.IsZero() && t.Before(opts.Since):
+		return Skip{path, SkipTooOld, fmt.Sprintf("%s is before %s", t.Format(time.DateTime), opts.Since.Format(time.DateTime))}, true
+	case !opts.Before.IsZero() && !t.Before(opts.Before):
+		return Skip{path, SkipTooNew, fmt.Sprintf("%s is not before %s", t.Format(time.DateTime), opts.Before.Format(time.DateTime))}, true
+	}
+	return Skip{}, false
+}
+
+// dated reports whether opts leaves out images by date.
+func (opts Options) dated() bool {
+	return !opts.Since.IsZero() || !opts.Before.IsZero()
+}
+
+// dateRange describes the dates opts keeps images from, for logging.
+func (opts Options) dateRange() string {
+	var within []string
+	if !opts.Since.IsZero() {
+		within = append(within, "from "+opts.Since.Format(time.DateTime))
+	}
+	if !opts.Before.IsZero() {
+		within = append(within, "before "+opts.Before.Format(time.DateTime))
+	}
+	return strings.Join(within, " and ")
+}
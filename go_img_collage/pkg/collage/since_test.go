@@ -0,0 +1,94 @@
+// since_test.go
+package collage
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		s       string
+		want    time.Time
+		wantErr bool
+	}{
+		{"7d", time.Date(2024, 6, 8, 12, 0, 0, 0, time.Local), false},
+		{" 2w ", time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local), false},
+		{"0d", now, false},
+		{"36h", now.Add(-36 * time.Hour), false},
+		{"90m", now.Add(-90 * time.Minute), false},
+		{"1h30m", now.Add(-90 * time.Minute), false},
+		{"2024-06-01", time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), false},
+		{"2024-06-01 18:30", time.Date(2024, 6, 1, 18, 30, 0, 0, time.Local), false},
+		{"2024-06-01T18:00:05", time.Date(2024, 6, 1, 18, 0, 5, 0, time.Local), false},
+		{"2024-06-01T18:00:00Z", time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC), false},
+		{"2024-06-01T18:00:00+02:00", time.Date(2024, 6, 1, 16, 0, 0, 0, time.UTC), false},
+		{"d", time.Time{}, true},
+		{"7x", time.Time{}, true},
+		{"1w2d", time.Time{}, true},
+		{"2024-13-01", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+		{"", time.Time{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSince(tt.s, now)
+		if (err != nil) != tt.wantErr || !got.Equal(tt.want) {
+			t.Errorf("ParseSince(%q) = %v, %v, want %v, error %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestScanSince(t *testing.T) {
+	root := t.TempDir()
+	album := filepath.Join(root, "album")
+	if err := os.Mkdir(album, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ages := map[string]time.Duration{"old.jpg": 30 * 24 * time.Hour, "recent.jpg": time.Hour, "future.jpg": -time.Hour}
+	for name, age := range ages {
+		path := filepath.Join(album, name)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name          string
+		since, before time.Time
+		want          []string
+		skipped       map[string]int
+	}{
+		{"no dates", time.Time{}, time.Time{}, []string{"future.jpg", "old.jpg", "recent.jpg"}, map[string]int{}},
+		{"since", now.Add(-24 * time.Hour), time.Time{}, []string{"future.jpg", "recent.jpg"}, map[string]int{SkipTooOld: 1}},
+		{"since and before", now.Add(-24 * time.Hour), now, []string{"recent.jpg"}, map[string]int{SkipTooOld: 1, SkipTooNew: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.InputDir, opts.Since, opts.Before, opts.Skipped = root, tt.since, tt.before, &SkipLog{}
+			paths, _, err := Scan(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, path := range paths {
+				got = append(got, filepath.Base(path))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Scan() = %v, want %v", got, tt.want)
+			}
+			if skipped := opts.Skipped.ByReason(); !maps.Equal(skipped, tt.skipped) {
+				t.Errorf("Scan() skipped %v, want %v", skipped, tt.skipped)
+			}
+		})
+	}
+}
@@ -0,0 +1,383 @@
+// site.go
+package collage
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Static site image sizes, in pixels.
+const (
+	siteImageSize = 1600 // longest side of the image shown on an image page
+	siteThumbSize = 240  // longest side of the thumbnails on a folder page
+)
+
+// siteTemplates are the default page templates of a static site, by file
+// name; a file of the same name in Options.SiteTemplates replaces one.
+//
+// index.html receives a sitePage with Collage set to the collage of every
+// image and Folders listing the folder pages; folder.html one with Collage
+// set to the folder's collage and Images to its image pages; image.html one
+// with Image set. Links are relative to the page.
+var siteTemplates = map[string]string{
+	"index.html": `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+{{template "collage" .Collage}}
+<nav aria-label="Folders">
+<ul>
+{{- range .Folders}}
+<li><a href="{{.Href}}">{{.Name}}</a> ({{.Count}} images)</li>
+{{- end}}
+</ul>
+</nav>
+</main>
+</body>
+</html>
+`,
+	"folder.html": `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+.thumbs { list-style: none; display: flex; flex-wrap: wrap; gap: 8px; padding: 0; }
+</style>
+</head>
+<body>
+<nav><a href="{{.Up}}">All folders</a></nav>
+<main>
+<h1>{{.Title}}</h1>
+{{template "collage" .Collage}}
+<ol class="thumbs">
+{{- range .Images}}
+<li><a href="{{.Href}}"><img src="{{.Thumb}}" width="{{.ThumbWidth}}" height="{{.ThumbHeight}}" loading="lazy" decoding="async" alt="{{.Alt}}"></a></li>
+{{- end}}
+</ol>
+</main>
+</body>
+</html>
+`,
+	"image.html": `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+</head>
+<body>
+<nav>
+<a href="{{.Up}}">{{.Image.Folder}}</a>
+{{- with .Image.Prev}} | <a href="{{.}}" rel="prev">Previous</a>{{end}}
+{{- with .Image.Next}} | <a href="{{.}}" rel="next">Next</a>{{end}}
+</nav>
+<main>
+<figure>
+<img src="{{.Image.Src}}" width="{{.Image.Width}}" height="{{.Image.Height}}" alt="{{.Image.Alt}}">
+<figcaption>{{.Image.Alt}}</figcaption>
+</figure>
+</main>
+</body>
+</html>
+`,
+}
+
+// siteCollageTemplate draws a collage with an image map linking its cells; it
+// is available to every page template as {{template "collage" .Collage}}.
+const siteCollageTemplate = `{{define "collage"}}<figure>
+<img src="{{.Src}}" width="{{.Width}}" height="{{.Height}}" alt="Collage of {{len .Areas}} images" usemap="#collage">
+</figure>
+<map name="collage">
+{{- range .Areas}}
+<area shape="rect" coords="{{.Coords}}" href="{{.Href}}" alt="{{.Alt}}" title="{{.Alt}}">
+{{- end}}
+</map>{{end}}`
+
+// sitePage is the data of a static site page.
+type sitePage struct {
+	Title   string
+	Up      template.URL // the page one level up; empty on the index
+	Collage *siteCollage
+	Folders []siteFolder
+	Images  []siteImage
+	Image   *siteImage
+}
+
+// siteCollage is a collage shown on a page, with its cells linked to their image pages.
+type siteCollage struct {
+	Src           template.URL
+	Width, Height int
+	Areas         []imageMapArea
+}
+
+// siteFolder is a folder page listed on the index.
+type siteFolder struct {
+	Name  string
+	Href  template.URL
+	Count int
+}
+
+// siteImage is an image page.
+type siteImage struct {
+	Href                    template.URL // from the folder page
+	Src                     template.URL // from the image page
+	Thumb                   template.URL // from the folder page
+	Width, Height           int
+	ThumbWidth, ThumbHeight int
+	Alt                     string
+	Folder                  string
+	Prev, Next              template.URL // neighbouring image pages; empty at the ends
+}
+
+// CreateSite writes a static gallery site to opts.SiteDir from the images of
+// opts: index.html with a collage of every image and a list of folders, a
+// page per folder (<folder>/index.html) with the folder's collage and
+// thumbnails, and a page per image (<folder>/<n>.html) with a web-sized copy
+// and links to its neighbours. The collage cells link to the image pages.
+// Templates in opts.SiteTemplates replace the default ones (see siteTemplates).
+func CreateSite(opts Options) error {
+	tmpl, err := loadSiteTemplates(opts.SiteTemplates)
+	if err != nil {
+		return err
+	}
+	paths, err := opts.imagePaths()
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return ErrNoImages
+	}
+	if err := os.MkdirAll(opts.SiteDir, 0o755); err != nil {
+		return fmt.Errorf("failed to create site directory: %v", err)
+	}
+
+	// Step 1: Group the images by folder, keeping their order, and give each
+	// folder a directory and each image a page.
+	var folders []string
+	groups := map[string][]string{}
+	for _, p := range paths {
+		dir := ImageFolder(p)
+		if _, ok := groups[dir]; !ok {
+			folders = append(folders, dir)
+		}
+		groups[dir] = append(groups[dir], p)
+	}
+	slugs := siteSlugs(folders)
+	pages := map[string]string{} // image path -> page, relative to the site root
+	for _, dir := range folders {
+		for i, p := range groups[dir] {
+			pages[p] = slugs[dir] + "/" + fmt.Sprintf("%d.html", i+1)
+		}
+	}
+
+	// Step 2: The index with the collage of every image.
+	index := sitePage{Title: filepath.Base(filepath.Clean(opts.InputDir))}
+	if index.Title == "." || index.Title == string(filepath.Separator) {
+		index.Title = "Gallery"
+	}
+	if index.Collage, err = siteCollageFor(opts, paths, opts.SiteDir, "", pages); err != nil {
+		return err
+	}
+	for _, dir := range folders {
+		index.Folders = append(index.Folders, siteFolder{Name: filepath.Base(dir), Href: template.URL(escapePath(slugs[dir]) + "/index.html"), Count: len(groups[dir])})
+	}
+	if err := writeSitePage(tmpl, "index.html", filepath.Join(opts.SiteDir, "index.html"), index); err != nil {
+		return err
+	}
+
+	// Step 3: A page per folder and per image.
+	for f, dir := range folders {
+		opts.logger().Printf("Building site folder %d of %d: %s\n", f+1, len(folders), dir)
+		out := filepath.Join(opts.SiteDir, filepath.FromSlash(slugs[dir]))
+		page := sitePage{Title: filepath.Base(dir), Up: "../index.html"}
+		if page.Collage, err = siteCollageFor(opts, groups[dir], out, slugs[dir]+"/", pages); err != nil {
+			return err
+		}
+		images, err := writeSiteImages(groups[dir], out, opts)
+		if err != nil {
+			return err
+		}
+		for i := range images {
+			images[i].Folder = page.Title
+			imgPage := sitePage{Title: images[i].Alt, Up: "index.html", Image: &images[i]}
+			if err := writeSitePage(tmpl, "image.html", filepath.Join(out, fmt.Sprintf("%d.html", i+1)), imgPage); err != nil {
+				return err
+			}
+		}
+		page.Images = images
+		if err := writeSitePage(tmpl, "folder.html", filepath.Join(out, "index.html"), page); err != nil {
+			return err
+		}
+	}
+	opts.logger().Printf("Site saved to '%s' (%d folders, %d images)\n", opts.SiteDir, len(folders), len(paths))
+	return nil
+}
+
+// loadSiteTemplates parses the page templates, taking each from dir if it
+// holds a file of that name and from siteTemplates otherwise.
+func loadSiteTemplates(dir string) (*template.Template, error) {
+	root := template.Must(template.New("").Parse(siteCollageTemplate))
+	for name, text := range siteTemplates {
+		if dir != "" {
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err == nil {
+				text = string(data)
+			} else if !os.IsNotExist(err) {
+				return nil, fmt.Errorf("failed to read site template: %v", err)
+			}
+		}
+		if _, err := root.New(name).Parse(text); err != nil {
+			return nil, fmt.Errorf("failed to parse site template %s: %v", name, err)
+		}
+	}
+	return root, nil
+}
+
+// writeSitePage renders the template name with page to path.
+func writeSitePage(tmpl *template.Template, name, path string, page sitePage) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to write site page: %v", err)
+	}
+	if err := tmpl.ExecuteTemplate(f, name, page); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to render %s: %v", path, err)
+	}
+	return f.Close()
+}
+
+// siteSlugs names the site directory of each folder after its base name,
+// reduced to letters, digits, - and _, and numbered where names repeat.
+func siteSlugs(folders []string) map[string]string {
+	slugs := map[string]string{}
+	used := map[string]bool{}
+	for _, dir := range folders {
+		slug := strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '-' || r == '_' {
+				return unicode.ToLower(r)
+			}
+			return '-'
+		}, filepath.Base(dir))
+		if slug = strings.Trim(slug, "-"); slug == "" || slug == "index" {
+			slug = "folder"
+		}
+		name := slug
+		for n := 2; used[name]; n++ {
+			name = fmt.Sprintf("%s-%d", slug, n)
+		}
+		used[name] = true
+		slugs[dir] = name
+	}
+	return slugs
+}
+
+// siteCollageFor renders the collage of paths as collage.jpg in dir, the site
+// directory at prefix below the root, and returns it with each cell linked to
+// its image page in pages.
+func siteCollageFor(opts Options, paths []string, dir, prefix string, pages map[string]string) (*siteCollage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create site directory: %v", err)
+	}
+	// The images are already filtered, sorted and sampled.
+	sub := opts.selected(paths)
+	sub.SiteDir = ""
+	sub.OutputPath, sub.ManifestPath = filepath.Join(dir, "collage.jpg"), filepath.Join(dir, "collage.json")
+	sub.HTMLPath, sub.OccupancyPath, sub.MattePath, sub.StateFile = "", "", "", ""
+	sub.Variants, sub.Compare, sub.Update, sub.TilePrint, sub.ProofPath = 0, nil, false, "", ""
+	sub.Quiet = true
+	if err := create(sub); err != nil {
+		return nil, err
+	}
+	m, err := readManifest(sub.ManifestPath)
+	if err != nil {
+		return nil, err
+	}
+	c := &siteCollage{Src: "collage.jpg", Width: m.Width, Height: m.Height}
+	for _, cell := range m.Cells {
+		r := cell.rect()
+		cell.file = paths[cell.Index] // the manifest gives the source
+		c.Areas = append(c.Areas, imageMapArea{
+			Coords: fmt.Sprintf("%d,%d,%d,%d", r.Min.X, r.Min.Y, r.Max.X, r.Max.Y),
+			Href:   template.URL(escapePath(strings.TrimPrefix(pages[cell.file], prefix))),
+			Alt:    altText(cell, opts),
+		})
+	}
+	return c, nil
+}
+
+// writeSiteImages saves a web-sized copy and a thumbnail of each image of a
+// folder into its site directory dir, in parallel, and returns the image
+// pages, linked in order.
+func writeSiteImages(paths []string, dir string, opts Options) ([]siteImage, error) {
+	sub := opts
+	sub.Fit = FitContain
+	images := make([]siteImage, len(paths))
+	errs := make([]error, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				errs[i] = writeSiteImage(&images[i], paths[i], i, len(paths), dir, sub)
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return images, nil
+}
+
+// writeSiteImage fills im for image i of n at path, saving its web-sized copy
+// and thumbnail into dir.
+func writeSiteImage(im *siteImage, path string, i, n int, dir string, opts Options) error {
+	num := i + 1
+	im.Href = template.URL(fmt.Sprintf("%d.html", num))
+	im.Alt = altText(manifestCell{Index: i, Path: path}, opts)
+	if i > 0 {
+		im.Prev = template.URL(fmt.Sprintf("%d.html", num-1))
+	}
+	if num < n {
+		im.Next = template.URL(fmt.Sprintf("%d.html", num+1))
+	}
+	for _, size := range []int{siteImageSize, siteThumbSize} {
+		img, err := loadResized(path, size, size, opts, nil)
+		if err != nil {
+			return fmt.Errorf("failed to load %s: %v", path, err)
+		}
+		name := fmt.Sprintf("%d.jpg", num)
+		if size == siteThumbSize {
+			name = fmt.Sprintf("%d_thumb.jpg", num)
+			im.Thumb, im.ThumbWidth, im.ThumbHeight = template.URL(name), img.Rect.Dx(), img.Rect.Dy()
+		} else {
+			im.Src, im.Width, im.Height = template.URL(name), img.Rect.Dx(), img.Rect.Dy()
+		}
+		if err := writeThumbnail(filepath.Join(dir, name), img, opts); err != nil {
+			return fmt.Errorf("failed to save site image: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// size.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+)
+
+// screenSizes maps common display names to their width and height in pixels.
+var screenSizes = map[string]image.Point{
+	"720p":  {1280, 720},
+	"1080p": {1920, 1080},
+	"fhd":   {1920, 1080},
+	"1440p": {2560, 1440},
+	"qhd":   {2560, 1440},
+	"4k":    {3840, 2160},
+	"uhd":   {3840, 2160},
+	"5k":    {5120, 2880},
+	"8k":    {7680, 4320},
+	"uwqhd": {3440, 1440},
+}
+
+// ParseSize returns the output size in pixels of a screen name (see
+// screenSizes) or an explicit "WxH" size such as "2560x1440".
+func ParseSize(spec string) (image.Point, error) {
+	if size, ok := screenSizes[strings.ToLower(spec)]; ok {
+		return size, nil
+	}
+	w, h, err := parseGrid(spec)
+	if err != nil {
+		names := make([]string, 0, len(screenSizes))
+		for name := range screenSizes {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return image.Point{}, fmt.Errorf("invalid size %q: use WxH in pixels or one of %s", spec, strings.Join(names, ", "))
+	}
+	return image.Pt(w, h), nil
+}
+
+// SafeMargin returns the margin kept clear around a wallpaper of size, where
+// menu bars, docks and taskbars would cover the images.
+func SafeMargin(size image.Point) int {
+	return min(size.X, size.Y) / 40
+}
+
+// sizedCols returns the columns of a grid of n cells for an output of size:
+// the cells stretched to the area inside the margin should stay close to
+// square, and a wallpaper should not end in a row of holes, which weigh double.
+func sizedCols(n int, size image.Point, margin int) int {
+	w, h := float64(size.X-2*margin), float64(size.Y-2*margin)
+	best, bestCost := 1, math.Inf(1)
+	for cols := 1; cols <= n; cols++ {
+		rows := (n + cols - 1) / cols
+		holes := float64(cols*rows-n) / float64(cols*rows)
+		cost := math.Abs(math.Log((w/float64(cols))/(h/float64(rows)))) + 2*holes
+		if cost < bestCost {
+			best, bestCost = cols, cost
+		}
+	}
+	return best
+}
+
+// stretchLayout maps layout onto an output of size, keeping margin pixels
+// clear on every side. The area inside the margin is scaled horizontally and
+// vertically by their own factors, so cells may turn into rectangles that
+// cover-fitted images fill without gaps.
+func stretchLayout(layout Layout, size image.Point, margin int) (Layout, error) {
+	inW, inH := layout.Width-2*margin, layout.Height-2*margin
+	outW, outH := size.X-2*margin, size.Y-2*margin
+	if outW <= 0 || outH <= 0 {
+		return Layout{}, fmt.Errorf("a margin of %d pixels leaves no room on a %dx%d output", margin, size.X, size.Y)
+	}
+	if inW <= 0 || inH <= 0 {
+		return Layout{}, fmt.Errorf("the layout has no cells to fit to %dx%d", size.X, size.Y)
+	}
+	sx, sy := float64(outW)/float64(inW), float64(outH)/float64(inH)
+	scale := func(r image.Rectangle) image.Rectangle {
+		x := func(v int) int { return margin + int(math.Round(float64(v-margin)*sx)) }
+		y := func(v int) int { return margin + int(math.Round(float64(v-margin)*sy)) }
+		return image.Rect(x(r.Min.X), y(r.Min.Y), x(r.Max.X), y(r.Max.Y))
+	}
+	out := Layout{Width: size.X, Height: size.Y}
+	for _, c := range layout.Cells {
+		out.Cells = append(out.Cells, scale(c))
+	}
+	for _, r := range layout.Reserved {
+		out.Reserved = append(out.Reserved, scale(r))
+	}
+	for _, h := range layout.Headers {
+		out.Headers = append(out.Headers, Header{Rect: scale(h.Rect), Text: h.Text})
+	}
+	return out, nil
+}
@@ -0,0 +1,28 @@
+// size_test.go
+package collage
+
+import (
+	"image"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    image.Point
+		wantErr bool
+	}{
+		{"1920x1080", image.Pt(1920, 1080), false},
+		{"4K", image.Pt(3840, 2160), false},
+		{"fhd", image.Pt(1920, 1080), false},
+		{"8k", image.Pt(7680, 4320), false},
+		{"huge", image.Point{}, true},
+		{"1920x", image.Point{}, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.spec)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseSize(%q) = %v, %v, want %v, error %v", tt.spec, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// skip.go
+package collage
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+)
+
+// Reasons recorded in a SkipLog.
+const (
+	SkipUnsupported  = "unsupported extension"
+	SkipOutsideAlbum = "not in a subfolder"
+	SkipUnreadable   = "unreadable folder"
+	SkipBlurry       = "blurry"
+	SkipUniform      = "uniform"
+	SkipTooSmall     = "too small"
+	SkipTooOld       = "older than -since"
+	SkipTooNew       = "newer than -before"
+	SkipSampled      = "not sampled"
+	SkipDuplicate    = "duplicate"
+	SkipExcluded     = "excluded"
+	SkipDownload     = "download failed"
+	SkipNotImage     = "not an image"
+	SkipTooLarge     = "too large to extract"
+)
+
+// deliberateSkips are the reasons a file is left out by choice rather than
+// because something went wrong; every other reason is a failure.
+var deliberateSkips = map[string]bool{
+	SkipUnsupported: true, SkipOutsideAlbum: true, SkipBlurry: true, SkipUniform: true,
+	SkipTooSmall: true, SkipTooOld: true, SkipTooNew: true, SkipSampled: true,
+	SkipDuplicate: true, SkipExcluded: true,
+}
+
+// Skip is a source file that was left out of the collage, and why.
+type Skip struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SkipLog collects the files left out of a collage so curators can fix their
+// archives. A nil *SkipLog discards everything; it is safe for concurrent use.
+type SkipLog struct {
+	mu      sync.Mutex
+	entries []Skip
+}
+
+// Add records that path was skipped for reason, with an optional detail such as the error message.
+func (l *SkipLog) Add(path, reason, detail string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, Skip{Path: path, Reason: reason, Detail: detail})
+}
+
+// Entries returns a copy of the recorded skips in the order they happened.
+func (l *SkipLog) Entries() []Skip {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]Skip(nil), l.entries...)
+}
+
+// ByReason returns the number of recorded files for each reason.
+func (l *SkipLog) ByReason() map[string]int {
+	counts := map[string]int{}
+	for _, e := range l.Entries() {
+		counts[e.Reason]++
+	}
+	return counts
+}
+
+// Failures returns how many of the recorded files were left out because they
+// could not be read, downloaded or decoded, rather than by a filter.
+func (l *SkipLog) Failures() int {
+	n := 0
+	for _, e := range l.Entries() {
+		if !deliberateSkips[e.Reason] {
+			n++
+		}
+	}
+	return n
+}
+
+// WriteJSON writes the skip report to path: totals per reason followed by every skipped file.
+func (l *SkipLog) WriteJSON(path string) error {
+	entries := l.Entries()
+	report := struct {
+		Total    int            `json:"total"`
+		ByReason map[string]int `json:"by_reason"`
+		Files    []Skip         `json:"files"`
+	}{Total: len(entries), ByReason: l.ByReason(), Files: entries}
+	if report.Files == nil {
+		report.Files = []Skip{}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
@@ -0,0 +1,190 @@
+// sort.go
+package collage
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Image orders.
+const (
+	SortName        = "name"        // folder by folder, by file name (the scan order)
+	SortBrightness  = "brightness"  // brightest first, so the collage flows from day to night
+	SortTemperature = "temperature" // coolest (blue daylight) first, warmest (tungsten light) last
+	SortEXIFDate    = "exif-date"   // oldest first by EXIF capture time, else file modification time, across all folders
+	SortColor       = "color"       // a rainbow by dominant hue, then the greyish images from light to dark
+	SortMTime       = "mtime"       // oldest first by file modification time, across all folders
+	SortSize        = "size"        // smallest file first, across all folders
+	SortRoundRobin  = "round-robin" // the first image of every folder, then the second of every folder, ...
+)
+
+// checkSort validates an image order.
+func checkSort(order string) error {
+	switch order {
+	case SortName, SortBrightness, SortTemperature, SortColor, SortEXIFDate, SortMTime, SortSize, SortRoundRobin:
+		return nil
+	}
+	return fmt.Errorf("unsupported sort order %q: use %s, %s, %s, %s, %s, %s, %s or %s", order, SortName, SortBrightness, SortTemperature, SortColor, SortEXIFDate, SortMTime, SortSize, SortRoundRobin)
+}
+
+// sortsByStats reports whether the order needs the images analysed.
+func sortsByStats(order string) bool {
+	return order == SortBrightness || order == SortTemperature || order == SortColor
+}
+
+// greyChroma is the mean chroma below which SortColor treats an image as grey,
+// ordering it by brightness after the colourful ones.
+const greyChroma = 0.08
+
+// sortImages returns paths ordered by order, using their statistics, leaving
+// paths itself untouched. Images that could not be analysed go last; ties keep
+// their scan order.
+func sortImages(paths []string, stats []*imageStats, order string) []string {
+	if !sortsByStats(order) {
+		return paths
+	}
+	key := func(st *imageStats) float64 {
+		switch order {
+		case SortBrightness:
+			return -st.Brightness
+		case SortColor:
+			if st.Chroma < greyChroma {
+				return 360 + 1 - st.Brightness
+			}
+			return st.Hue
+		}
+		return st.Warmth
+	}
+	idx := make([]int, len(paths))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		sa, sb := stats[idx[a]], stats[idx[b]]
+		if sa == nil || sb == nil {
+			return sb == nil && sa != nil
+		}
+		return key(sa) < key(sb)
+	})
+	sorted := make([]string, len(paths))
+	for i, j := range idx {
+		sorted[i] = paths[j]
+	}
+	return sorted
+}
+
+// sortByDate returns paths in chronological order of their EXIF capture time,
+// or modification time if they have none, read in parallel. Images whose date
+// cannot be read go last; ties keep their scan order.
+func sortByDate(paths []string, opts Options) []string {
+	dates := make([]time.Time, len(paths))
+	ok := make([]bool, len(paths))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				t, err := imageDate(paths[i], DateTaken, opts)
+				dates[i], ok[i] = t, err == nil
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	idx := make([]int, len(paths))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ia, ib := idx[a], idx[b]
+		if !ok[ia] || !ok[ib] {
+			return ok[ia] && !ok[ib]
+		}
+		return dates[ia].Before(dates[ib])
+	})
+	sorted := make([]string, len(paths))
+	for i, j := range idx {
+		sorted[i] = paths[j]
+	}
+	return sorted
+}
+
+// sortByFileInfo returns paths ordered by file modification time (SortMTime)
+// or size (SortSize). Files that cannot be read go last; ties keep their scan order.
+func sortByFileInfo(paths []string, order string) []string {
+	infos := make([]os.FileInfo, len(paths))
+	for i, path := range paths {
+		infos[i], _ = os.Stat(path)
+	}
+	idx := make([]int, len(paths))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		ia, ib := infos[idx[a]], infos[idx[b]]
+		if ia == nil || ib == nil {
+			return ib == nil && ia != nil
+		}
+		if order == SortSize {
+			return ia.Size() < ib.Size()
+		}
+		return ia.ModTime().Before(ib.ModTime())
+	})
+	sorted := make([]string, len(paths))
+	for i, j := range idx {
+		sorted[i] = paths[j]
+	}
+	return sorted
+}
+
+// interleaveFolders returns paths with the folders interleaved round-robin:
+// the first image of each folder in order of first appearance, then the
+// second of each, and so on, skipping folders that have run out.
+func interleaveFolders(paths []string) []string {
+	var folders []string
+	groups := map[string][]string{}
+	for _, p := range paths {
+		dir := ImageFolder(p)
+		if _, ok := groups[dir]; !ok {
+			folders = append(folders, dir)
+		}
+		groups[dir] = append(groups[dir], p)
+	}
+	out := make([]string, 0, len(paths))
+	for i := 0; len(out) < len(paths); i++ {
+		for _, dir := range folders {
+			if i < len(groups[dir]) {
+				out = append(out, groups[dir][i])
+			}
+		}
+	}
+	return out
+}
+
+// shuffled returns paths in a random order determined by seed, so the same
+// seed and images always give the same arrangement.
+func shuffled(paths []string, seed int64) []string {
+	out := append([]string(nil), paths...)
+	rand.New(rand.NewSource(seed)).Shuffle(len(out), func(i, j int) { out[i], out[j] = out[j], out[i] })
+	return out
+}
+
+// reversed returns paths in reverse order.
+func reversed(paths []string) []string {
+	out := make([]string, len(paths))
+	for i, p := range paths {
+		out[len(paths)-1-i] = p
+	}
+	return out
+}
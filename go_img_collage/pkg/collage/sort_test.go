@@ -0,0 +1,77 @@
+// sort_test.go
+package collage
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSortImages(t *testing.T) {
+	paths := []string{"a", "b", "c", "d"}
+	stats := []*imageStats{
+		{Brightness: 0.2, Warmth: 0.5, Hue: 200, Chroma: 0.5},
+		nil, // not analysed
+		{Brightness: 0.9, Warmth: -0.3, Hue: 20, Chroma: 0.4},
+		{Brightness: 0.5, Warmth: 0.1, Hue: 100, Chroma: 0.01}, // grey
+	}
+	tests := []struct {
+		order string
+		want  []string
+	}{
+		{SortName, []string{"a", "b", "c", "d"}},
+		{SortBrightness, []string{"c", "d", "a", "b"}},
+		{SortTemperature, []string{"c", "d", "a", "b"}},
+		{SortColor, []string{"c", "a", "d", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.order, func(t *testing.T) {
+			in := slices.Clone(paths)
+			got := sortImages(in, stats, tt.order)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("sortImages(%s) = %v, want %v", tt.order, got, tt.want)
+			}
+			if !slices.Equal(in, paths) {
+				t.Errorf("sortImages(%s) changed its input to %v", tt.order, in)
+			}
+		})
+	}
+}
+
+func TestInterleaveFolders(t *testing.T) {
+	tests := []struct {
+		name  string
+		paths []string
+		want  []string
+	}{
+		{"empty", nil, []string{}},
+		{"one folder", []string{"x/1", "x/2"}, []string{"x/1", "x/2"}},
+		{"uneven", []string{"x/1", "x/2", "x/3", "y/1", "z/1", "z/2"}, []string{"x/1", "y/1", "z/1", "x/2", "z/2", "x/3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := interleaveFolders(tt.paths); !slices.Equal(got, tt.want) {
+				t.Errorf("interleaveFolders(%v) = %v, want %v", tt.paths, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShuffledAndReversed(t *testing.T) {
+	paths := []string{"a", "b", "c", "d", "e"}
+	in := slices.Clone(paths)
+	first, again := shuffled(in, 7), shuffled(in, 7)
+	if !slices.Equal(first, again) {
+		t.Errorf("shuffled with the same seed gave %v and %v", first, again)
+	}
+	sorted := slices.Clone(first)
+	slices.Sort(sorted)
+	if !slices.Equal(sorted, paths) {
+		t.Errorf("shuffled(%v) = %v, not a permutation", paths, first)
+	}
+	if got, want := reversed(in), []string{"e", "d", "c", "b", "a"}; !slices.Equal(got, want) {
+		t.Errorf("reversed(%v) = %v, want %v", in, got, want)
+	}
+	if !slices.Equal(in, paths) {
+		t.Errorf("input changed to %v", in)
+	}
+}
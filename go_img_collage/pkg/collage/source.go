@@ -0,0 +1,57 @@
+// source.go
+package collage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ImageSource lists the images of an input root, such as a local folder or a
+// cloud storage bucket: the images of its albums (top-level folders) in
+// collage order, and the albums in sorted order. Images of remote sources are
+// http(s) URLs or archive entries for FetchImages.
+type ImageSource interface {
+	List() (images, albums []string, err error)
+}
+
+// sources maps the URL schemes of input roots to their ImageSource
+// constructors; roots without a registered scheme are local folders.
+var sources = map[string]func(root string, opts Options) (ImageSource, error){
+	"s3": newS3Source,
+	"gs": newGCSSource,
+}
+
+// RegisterSource makes input roots written scheme://... open with open, so
+// more storage backends can be plugged in.
+func RegisterSource(scheme string, open func(root string, opts Options) (ImageSource, error)) {
+	sources[scheme] = open
+}
+
+// OpenSource returns the ImageSource of an input root.
+func OpenSource(root string, opts Options) (ImageSource, error) {
+	if scheme, _, ok := strings.Cut(root, "://"); ok {
+		open, ok := sources[scheme]
+		if !ok {
+			return nil, fmt.Errorf("unsupported input %s: no %s:// source", root, scheme)
+		}
+		return open(root, opts)
+	}
+	if strings.EqualFold(filepath.Ext(root), ".zip") {
+		if info, err := os.Stat(root); err == nil && !info.IsDir() {
+			return zipSource{root, opts}, nil
+		}
+	}
+	return localSource{root, opts}, nil
+}
+
+// localSource is a folder on a local or network filesystem.
+type localSource struct {
+	root string
+	opts Options
+}
+
+func (s localSource) List() ([]string, []string, error) {
+	return scanRoot(s.root, s.opts)
+}
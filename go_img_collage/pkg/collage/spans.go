@@ -0,0 +1,158 @@
+// spans.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"sort"
+)
+
+// Span modes (Options.Spans) giving images blocks of several grid cells.
+const (
+	SpanNone       = ""           // every image takes one cell
+	SpanAspect     = "aspect"     // landscape images take 2x1 cells, portrait ones 1x2
+	SpanResolution = "resolution" // images with at least twice the median pixel count take 2x2 cells
+)
+
+// Packing strategies (Options.Pack) for placing the blocks of a variable-size grid.
+const (
+	PackOrder   = "order"   // place blocks in image order, each in the first free spot
+	PackLargest = "largest" // place the largest blocks first and backfill with the small ones
+)
+
+// spanAspect is the width to height ratio (or its inverse) from which an image
+// spans two cells with SpanAspect.
+const spanAspect = 1.5
+
+// checkSpans returns an error for an unknown span mode or packing strategy.
+func checkSpans(opts Options) error {
+	switch opts.Spans {
+	case SpanNone, SpanAspect, SpanResolution:
+	default:
+		return fmt.Errorf("unknown span mode %q: use aspect or resolution", opts.Spans)
+	}
+	switch opts.Pack {
+	case "", PackOrder, PackLargest:
+	default:
+		return fmt.Errorf("unknown packing strategy %q: use order or largest", opts.Pack)
+	}
+	return nil
+}
+
+// imageSpans returns the block of cells (columns by rows) each image takes
+// under opts.Spans, or nil if every image takes one cell. Images whose size
+// cannot be read take one cell.
+func imageSpans(paths []string, opts Options) []image.Point {
+	if opts.Spans == SpanNone {
+		return nil
+	}
+	sizes := imageSizes(paths, opts)
+	spans := make([]image.Point, len(paths))
+	switch opts.Spans {
+	case SpanAspect:
+		for i, s := range sizes {
+			spans[i] = image.Pt(1, 1)
+			switch {
+			case s.X > 0 && s.Y > 0 && float64(s.X) >= spanAspect*float64(s.Y):
+				spans[i].X = 2
+			case s.X > 0 && s.Y > 0 && float64(s.Y) >= spanAspect*float64(s.X):
+				spans[i].Y = 2
+			}
+		}
+	case SpanResolution:
+		pixels := make([]int, len(sizes))
+		for i, s := range sizes {
+			pixels[i] = s.X * s.Y
+		}
+		sorted := append([]int(nil), pixels...)
+		sort.Ints(sorted)
+		median := sorted[len(sorted)/2]
+		for i, p := range pixels {
+			spans[i] = image.Pt(1, 1)
+			if median > 0 && p >= 2*median {
+				spans[i] = image.Pt(2, 2)
+			}
+		}
+	}
+	return spans
+}
+
+// planLayout lays out paths as opts.Layout says (see arrange) and, with
+// opts.Size, stretches the layout to that output size.
+func (opts Options) planLayout(paths []string) (Layout, error) {
+	if opts.Size == "" {
+		return opts.arrange(paths)
+	}
+	size, err := ParseSize(opts.Size)
+	if err != nil {
+		return Layout{}, err
+	}
+	if opts.Layout == LayoutGrid && opts.ExactGrid == "" && opts.Cols == 0 && opts.Rows == 0 {
+		opts.Cols = sizedCols(len(paths), size, opts.Margin)
+	}
+	layout, err := opts.arrange(paths)
+	if err != nil {
+		return Layout{}, err
+	}
+	return stretchLayout(layout, size, opts.Margin)
+}
+
+// arrange lays out paths as opts.Layout says: on the collage grid, with the
+// cell blocks of opts.Spans, in aspect buckets, in folder sections, in
+// justified rows or as a weighted treemap.
+func (opts Options) arrange(paths []string) (Layout, error) {
+	if err := checkSpans(opts); err != nil {
+		return Layout{}, err
+	}
+	if err := checkLayout(opts); err != nil {
+		return Layout{}, err
+	}
+	switch opts.Layout {
+	case LayoutBuckets:
+		return bucketLayout(paths, opts), nil
+	case LayoutSections:
+		return sectionLayout(paths, opts), nil
+	case LayoutJustified:
+		return justifiedLayout(paths, opts), nil
+	case LayoutTreemap:
+		if err := checkWeight(opts); err != nil {
+			return Layout{}, err
+		}
+		return treemapLayout(paths, opts)
+	}
+	if opts.ExactGrid != "" {
+		if err := opts.checkExactGrid(len(paths)); err != nil {
+			return Layout{}, err
+		}
+		opts.Rows, opts.Cols, _ = parseGrid(opts.ExactGrid)
+	}
+	spec := opts.gridSpec()
+	spec.Spans = imageSpans(paths, opts)
+	return PlanLayout(len(paths), spec)
+}
+
+// checkExactGrid verifies that n images, with the reserved cells, fill the
+// opts.ExactGrid grid of rows by columns exactly.
+func (opts Options) checkExactGrid(n int) error {
+	rows, cols, err := parseGrid(opts.ExactGrid)
+	if err != nil {
+		return fmt.Errorf("invalid exact grid: %v", err)
+	}
+	if opts.Spans != SpanNone {
+		return fmt.Errorf("an exact grid cannot be combined with -spans")
+	}
+	if (opts.Cols > 0 && opts.Cols != cols) || (opts.Rows > 0 && opts.Rows != rows) {
+		return fmt.Errorf("exact grid %dx%d contradicts %d columns by %d rows", rows, cols, opts.Cols, opts.Rows)
+	}
+	want := rows * cols
+	for _, r := range opts.reservations() {
+		want -= r.Cols * r.Rows
+	}
+	switch {
+	case n < want:
+		return fmt.Errorf("exact grid %dx%d needs %d images, but only %d remain after filtering (%d missing)", rows, cols, want, n, want-n)
+	case n > want:
+		return fmt.Errorf("exact grid %dx%d needs %d images, but %d remain after filtering (%d too many)", rows, cols, want, n, n-want)
+	}
+	return nil
+}
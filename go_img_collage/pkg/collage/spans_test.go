@@ -0,0 +1,87 @@
+// spans_test.go
+package collage
+
+import (
+	"image"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImageSpans(t *testing.T) {
+	paths := writeTestImages(t, image.Pt(30, 10), image.Pt(10, 10), image.Pt(10, 20), image.Pt(14, 10), image.Pt(40, 40))
+	paths = append(paths, filepath.Join(t.TempDir(), "missing.png"))
+	tests := []struct {
+		spans string
+		want  []image.Point
+	}{
+		{SpanNone, nil},
+		{SpanAspect, []image.Point{{2, 1}, {1, 1}, {1, 2}, {1, 1}, {1, 1}, {1, 1}}},
+		// Median pixel count 200: the 1600-pixel image takes 2x2.
+		{SpanResolution, []image.Point{{1, 1}, {1, 1}, {1, 1}, {1, 1}, {2, 2}, {1, 1}}},
+	}
+	for _, tt := range tests {
+		opts := DefaultOptions()
+		opts.Spans = tt.spans
+		if got := imageSpans(paths, opts); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("imageSpans(%q) = %v, want %v", tt.spans, got, tt.want)
+		}
+	}
+}
+
+func TestCheckSpans(t *testing.T) {
+	tests := []struct {
+		spans, pack string
+		wantErr     string
+	}{
+		{SpanAspect, PackLargest, ""},
+		{SpanNone, "", ""},
+		{"diagonal", PackOrder, "unknown span mode"},
+		{SpanResolution, "smallest", "unknown packing strategy"},
+	}
+	for _, tt := range tests {
+		err := checkSpans(Options{Spans: tt.spans, Pack: tt.pack})
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("checkSpans(%q, %q) error = %v, want %q", tt.spans, tt.pack, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCheckExactGrid(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(*Options)
+		n       int
+		wantErr string
+	}{
+		{"filled", nil, 6, ""},
+		{"too few", nil, 5, "1 missing"},
+		{"too many", nil, 8, "2 too many"},
+		{"reserved cells", func(o *Options) { o.Reserved = []Reservation{{Cols: 1, Rows: 1, Position: "center"}} }, 5, ""},
+		{"title cells", func(o *Options) {
+			o.TitleCells = []TitleCell{{Text: "Trip", Reservation: Reservation{Cols: 2, Rows: 1, Position: "top"}}}
+		}, 4, ""},
+		{"matching columns", func(o *Options) { o.Cols = 3 }, 6, ""},
+		{"contradicting columns", func(o *Options) { o.Cols = 4 }, 6, "contradicts"},
+		{"spans", func(o *Options) { o.Spans = SpanAspect }, 6, "cannot be combined"},
+		{"invalid", func(o *Options) { o.ExactGrid = "2x" }, 6, "invalid exact grid"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.ExactGrid = "2x3"
+			if tt.change != nil {
+				tt.change(&opts)
+			}
+			err := opts.checkExactGrid(tt.n)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkExactGrid(%d) error = %v", tt.n, err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkExactGrid(%d) error = %v, want one containing %q", tt.n, err, tt.wantErr)
+			}
+		})
+	}
+}
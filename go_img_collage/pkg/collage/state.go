@@ -0,0 +1,84 @@
+// state.go
+package collage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// runState is the content of Options.StateFile: what the last successful run
+// rendered, so a scheduled run can tell when nothing changed.
+type runState struct {
+	Output string `json:"output"`
+	Inputs string `json:"inputs"` // fingerprint of the image set and drawing options
+}
+
+// inputsKey returns the fingerprint of the images the collage is built from,
+// after the -since cut-off but before the quality filters, together with the
+// drawing options.
+func (opts Options) inputsKey() (string, error) {
+	opts.Skipped = nil
+	images := opts.Images
+	if len(images) == 0 {
+		var err error
+		scan := Options{InputDir: opts.InputDir, InputDirs: opts.InputDirs, ScanWorkers: opts.ScanWorkers, Since: opts.Since, Before: opts.Before, SinceBy: opts.SinceBy, Retry: opts.Retry}
+		if images, _, err = Scan(scan); err != nil {
+			return "", err
+		}
+	} else {
+		images = datedImages(images, opts)
+	}
+	return fingerprint(images, opts), nil
+}
+
+// Unchanged reports whether opts.StateFile shows that the last successful run
+// wrote opts.OutputPath from the same images and options, with the output
+// still in place, so rendering again would give the same collage.
+func Unchanged(opts Options) (bool, error) {
+	if opts.StateFile == "" {
+		return false, nil
+	}
+	data, err := os.ReadFile(opts.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	var last runState
+	if json.Unmarshal(data, &last) != nil || last.Output != opts.OutputPath {
+		return false, nil
+	}
+	out := opts.OutputPath
+	if opts.Variants > 1 {
+		out = VariantPath(out, 1)
+	} else if opts.PerPage > 0 {
+		out = PagePath(out, 1)
+	} else if opts.Carousel > 0 {
+		out = SlicePath(out, 1)
+	}
+	if _, err := os.Stat(out); err != nil {
+		return false, nil
+	}
+	key, err := opts.inputsKey()
+	if err != nil {
+		return false, err
+	}
+	return key == last.Inputs, nil
+}
+
+// saveState records a successful run in opts.StateFile, if set.
+func saveState(opts Options) error {
+	if opts.StateFile == "" {
+		return nil
+	}
+	key, err := opts.inputsKey()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(runState{Output: opts.OutputPath, Inputs: key}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(opts.StateFile, append(data, '\n'), 0o644)
+}
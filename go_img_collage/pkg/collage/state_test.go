@@ -0,0 +1,61 @@
+// state_test.go
+package collage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUnchanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(t *testing.T, opts *Options)
+		want   bool
+	}{
+		{"same run", func(*testing.T, *Options) {}, true},
+		{"new proof", func(_ *testing.T, o *Options) { o.ProofPath = filepath.Join(filepath.Dir(o.OutputPath), "proof.png") }, true},
+		{"output removed", func(_ *testing.T, o *Options) { os.Remove(o.OutputPath) }, false},
+		{"other output", func(_ *testing.T, o *Options) { o.OutputPath += ".png" }, false},
+		{"image touched", func(t *testing.T, o *Options) {
+			later := time.Now().Add(time.Hour)
+			if err := os.Chtimes(o.Images[0], later, later); err != nil {
+				t.Fatal(err)
+			}
+		}, false},
+		{"image added", func(t *testing.T, o *Options) { o.Images = append(o.Images, o.Images[0]) }, false},
+		{"cell size", func(_ *testing.T, o *Options) { o.CellSize++ }, false},
+		{"state file damaged", func(_ *testing.T, o *Options) { os.WriteFile(o.StateFile, []byte("{"), 0o644) }, false},
+		{"state file missing", func(_ *testing.T, o *Options) { os.Remove(o.StateFile) }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := DefaultOptions()
+			for _, name := range []string{"a.jpg", "b.jpg"} {
+				path := filepath.Join(dir, name)
+				if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				opts.Images = append(opts.Images, path)
+			}
+			opts.OutputPath = filepath.Join(dir, "collage.png")
+			opts.StateFile = filepath.Join(dir, "state.json")
+			if err := os.WriteFile(opts.OutputPath, []byte("png"), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			if err := saveState(opts); err != nil {
+				t.Fatal(err)
+			}
+			tt.change(t, &opts)
+			got, err := Unchanged(opts)
+			if err != nil {
+				t.Fatalf("Unchanged() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Unchanged() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
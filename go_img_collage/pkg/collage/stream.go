@@ -0,0 +1,363 @@
+// stream.go
+package collage
+
+import (
+	"bufio"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// checkStreaming returns an error if opts asks for streaming together with an
+// output that needs the whole canvas at once.
+func checkStreaming(opts Options) error {
+	switch ext := strings.ToLower(filepath.Ext(opts.OutputPath)); {
+	case ext != ".png" && ext != ".tif" && ext != ".tiff":
+		return fmt.Errorf("streaming output supports .png and .tif, not %q", ext)
+	case opts.TilePrint != "", opts.ProofPath != "", opts.CoverageReport != "":
+		return fmt.Errorf("streaming output cannot be combined with print tiles, proofs or coverage reports")
+	case opts.Bleed > 0 || opts.CropMarks:
+		return fmt.Errorf("streaming output cannot be combined with bleed or crop marks")
+	case opts.Update:
+		return fmt.Errorf("streaming output cannot be combined with -update")
+	}
+	return nil
+}
+
+// layoutBands splits the layout into horizontal bands, one per row of cells,
+// so that every cell lies entirely inside one band: cells spanning several
+// rows join them into one band. Each band also holds the gutter above its row;
+// the first and last take the margins.
+func layoutBands(layout Layout) []image.Rectangle {
+	cells := append([]image.Rectangle(nil), layout.Cells...)
+	sort.Slice(cells, func(i, j int) bool { return cells[i].Min.Y < cells[j].Min.Y })
+
+	// A band ends where the next cell starts below every cell so far.
+	var bands []image.Rectangle
+	y, end := 0, 0
+	for _, c := range cells {
+		if end > y && c.Min.Y >= end {
+			bands = append(bands, image.Rect(0, y, layout.Width, end))
+			y = end
+		}
+		end = max(end, c.Max.Y)
+	}
+	return append(bands, image.Rect(0, y, layout.Width, layout.Height))
+}
+
+// bandWriter encodes a collage that arrives as consecutive horizontal bands.
+type bandWriter interface {
+	writeBand(band *image.RGBA) error
+	close() error
+}
+
+// createStreaming renders the collage one band of cells at a time into a small
+// buffer and streams each band to the encoder, so memory use is proportional
+// to one row of cells instead of the whole canvas.
+func createStreaming(layout Layout, imagePaths []string, bg color.Color, opts Options, errs *errorLog) (err error) {
+	f, err := os.Create(opts.OutputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %v", err)
+	}
+	defer f.Close()
+	defer onInterrupt(func() { os.Remove(opts.OutputPath) })()
+	defer func() {
+		if err != nil { // a truncated stream is no image
+			f.Close()
+			os.Remove(opts.OutputPath)
+		}
+	}()
+
+	var bw bandWriter
+	if strings.EqualFold(filepath.Ext(opts.OutputPath), ".png") {
+		bw, err = newPNGBandWriter(f, layout.Width, layout.Height, false)
+	} else {
+		bw, err = newTIFFBandWriter(f, layout.Width, opts)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The matte is streamed alongside, band by band.
+	var matte *pngBandWriter
+	if opts.MattePath != "" {
+		mf, createErr := os.Create(opts.MattePath)
+		if createErr != nil {
+			return fmt.Errorf("failed to create matte: %v", createErr)
+		}
+		defer mf.Close()
+		defer onInterrupt(func() { os.Remove(opts.MattePath) })()
+		defer func() {
+			if err != nil {
+				mf.Close()
+				os.Remove(opts.MattePath)
+			}
+		}()
+		if matte, err = newPNGBandWriter(mf, layout.Width, layout.Height, true); err != nil {
+			return err
+		}
+	}
+
+	prog := newProgress(len(imagePaths), opts)
+	defer prog.finish()
+	for _, r := range layoutBands(layout) {
+		band := image.NewRGBA(r)
+		fillBackground(band, bg)
+		if err := renderImages(band, image.Point{}, layout, imagePaths, opts, errs, prog); err != nil {
+			return err
+		}
+		if err := drawTitleCells(band, image.Point{}, layout, opts); err != nil {
+			return err
+		}
+		if err := bw.writeBand(band); err != nil {
+			return fmt.Errorf("%w: %w", ErrEncode, err)
+		}
+		if matte != nil {
+			if err := matte.writeBand(band); err != nil {
+				return fmt.Errorf("failed to write matte: %v", err)
+			}
+		}
+	}
+	if err := bw.close(); err != nil {
+		return fmt.Errorf("failed to write output: %v", err)
+	}
+	if matte != nil {
+		if err := matte.close(); err != nil {
+			return fmt.Errorf("failed to write matte: %v", err)
+		}
+	}
+	return f.Close()
+}
+
+// pngChunkSize is the amount of compressed data collected into each IDAT chunk.
+const pngChunkSize = 1 << 18
+
+// pngBandWriter streams an 8-bit RGBA PNG, or with matte the grayscale PNG
+// of the alpha channel, row by row.
+type pngBandWriter struct {
+	w     *bufio.Writer
+	idat  *pngChunkWriter
+	zw    *zlib.Writer
+	matte bool
+	prev  []byte // previous filtered row, reused as scratch
+	row   []byte
+}
+
+func newPNGBandWriter(w io.Writer, width, height int, matte bool) (*pngBandWriter, error) {
+	bpp, colorType := 4, byte(6) // 8-bit RGBA
+	if matte {
+		bpp, colorType = 1, 0 // 8-bit grayscale
+	}
+	p := &pngBandWriter{w: bufio.NewWriterSize(w, 1<<20), matte: matte, row: make([]byte, 1+bpp*width), prev: make([]byte, bpp*width)}
+	if _, err := p.w.WriteString("\x89PNG\r\n\x1a\n"); err != nil {
+		return nil, err
+	}
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], uint32(width))
+	binary.BigEndian.PutUint32(ihdr[4:], uint32(height))
+	ihdr[8], ihdr[9] = 8, colorType // deflate, no interlace
+	if err := writePNGChunk(p.w, "IHDR", ihdr); err != nil {
+		return nil, err
+	}
+	p.idat = &pngChunkWriter{w: p.w}
+	p.zw, _ = zlib.NewWriterLevel(p.idat, zlib.BestSpeed)
+	return p, nil
+}
+
+// writeBand appends the rows of band, un-premultiplied (or just their alpha
+// for a matte) and with the Sub filter.
+func (p *pngBandWriter) writeBand(band *image.RGBA) error {
+	b := band.Rect
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		src := band.Pix[band.PixOffset(b.Min.X, y):][:4*b.Dx()]
+		if p.matte {
+			p.row[0] = 1 // Sub
+			prev := byte(0)
+			for x := 0; x < b.Dx(); x++ {
+				a := src[4*x+3]
+				p.row[1+x] = a - prev
+				prev = a
+			}
+			if _, err := p.zw.Write(p.row); err != nil {
+				return err
+			}
+			continue
+		}
+		px := p.prev
+		for i := 0; i < len(src); i += 4 {
+			px[i+3] = src[i+3]
+			switch a := uint32(src[i+3]); a {
+			case 255:
+				copy(px[i:i+3], src[i:i+3])
+			case 0:
+				px[i], px[i+1], px[i+2] = 0, 0, 0
+			default:
+				for c := i; c < i+3; c++ {
+					px[c] = uint8(min(255, uint32(src[c])*255/a))
+				}
+			}
+		}
+		p.row[0] = 1 // Sub
+		out := p.row[1:]
+		copy(out[:4], px[:4])
+		for i := 4; i < len(px); i++ {
+			out[i] = px[i] - px[i-4]
+		}
+		if _, err := p.zw.Write(p.row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *pngBandWriter) close() error {
+	if err := p.zw.Close(); err != nil {
+		return err
+	}
+	if err := p.idat.flush(); err != nil {
+		return err
+	}
+	if err := writePNGChunk(p.w, "IEND", nil); err != nil {
+		return err
+	}
+	return p.w.Flush()
+}
+
+// pngChunkWriter collects compressed image data into IDAT chunks of pngChunkSize.
+type pngChunkWriter struct {
+	w   io.Writer
+	buf []byte
+}
+
+func (c *pngChunkWriter) Write(data []byte) (int, error) {
+	c.buf = append(c.buf, data...)
+	for len(c.buf) >= pngChunkSize {
+		if err := writePNGChunk(c.w, "IDAT", c.buf[:pngChunkSize]); err != nil {
+			return 0, err
+		}
+		c.buf = append(c.buf[:0], c.buf[pngChunkSize:]...)
+	}
+	return len(data), nil
+}
+
+func (c *pngChunkWriter) flush() error {
+	if len(c.buf) == 0 {
+		return nil
+	}
+	err := writePNGChunk(c.w, "IDAT", c.buf)
+	c.buf = c.buf[:0]
+	return err
+}
+
+// writePNGChunk writes one PNG chunk: length, type, data and CRC.
+func writePNGChunk(w io.Writer, typ string, data []byte) error {
+	var head [8]byte
+	binary.BigEndian.PutUint32(head[:4], uint32(len(data)))
+	copy(head[4:], typ)
+	crc := crc32.NewIEEE()
+	crc.Write(head[4:])
+	crc.Write(data)
+	var tail [4]byte
+	binary.BigEndian.PutUint32(tail[:], crc.Sum32())
+	for _, part := range [][]byte{head[:], data, tail[:]} {
+		if _, err := w.Write(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tiffBandWriter streams a CMYK TIFF like writeCMYKTIFF, compressing the rows
+// of each strip as they arrive.
+type tiffBandWriter struct {
+	f            *os.File
+	width        int
+	icc          *iccProfile
+	dpi          int
+	offset       int64
+	height       int
+	stripOffsets []uint32
+	stripCounts  []uint32
+	strip        countingBuffer
+	zw           *zlib.Writer
+	rows         int // rows in the current strip
+	row          []byte
+}
+
+// countingBuffer is the compressed data of the strip being written.
+type countingBuffer struct{ data []byte }
+
+func (b *countingBuffer) Write(p []byte) (int, error) {
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+func newTIFFBandWriter(f *os.File, width int, opts Options) (*tiffBandWriter, error) {
+	var icc *iccProfile
+	if opts.ICCProfile != "" {
+		var err error
+		if icc, err = loadICCProfile(opts.ICCProfile); err != nil {
+			return nil, err
+		}
+	}
+	// Header; the IFD offset at byte 4 is patched once the strips are written.
+	if _, err := f.Write([]byte{'I', 'I', 42, 0, 0, 0, 0, 0}); err != nil {
+		return nil, err
+	}
+	t := &tiffBandWriter{f: f, width: width, icc: icc, dpi: opts.DPI, offset: 8, row: make([]byte, 4*width)}
+	t.zw = zlib.NewWriter(&t.strip)
+	return t, nil
+}
+
+// writeBand converts the rows of band to CMYK and adds them to the strips.
+func (t *tiffBandWriter) writeBand(band *image.RGBA) error {
+	for y := band.Rect.Min.Y; y < band.Rect.Max.Y; y++ {
+		cmykRow(band, y, t.row, t.icc)
+		t.zw.Write(t.row) // writes to a countingBuffer cannot fail
+		t.height++
+		if t.rows++; t.rows == tiffRowsPerStrip {
+			if err := t.flushStrip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// flushStrip writes the current strip to the file and starts the next.
+func (t *tiffBandWriter) flushStrip() error {
+	t.zw.Close()
+	if t.offset+int64(len(t.strip.data)) > 1<<32-1 {
+		return fmt.Errorf("CMYK TIFF exceeds the 4 GiB classic TIFF limit")
+	}
+	if _, err := t.f.Write(t.strip.data); err != nil {
+		return err
+	}
+	t.stripOffsets = append(t.stripOffsets, uint32(t.offset))
+	t.stripCounts = append(t.stripCounts, uint32(len(t.strip.data)))
+	t.offset += int64(len(t.strip.data))
+	t.strip.data, t.rows = t.strip.data[:0], 0
+	t.zw.Reset(&t.strip)
+	return nil
+}
+
+func (t *tiffBandWriter) close() error {
+	if t.rows > 0 {
+		if err := t.flushStrip(); err != nil {
+			return err
+		}
+	}
+	var profile []byte
+	if t.icc != nil {
+		profile = t.icc.data
+	}
+	return writeTIFFIFD(t.f, t.offset, t.width, t.height, t.stripOffsets, t.stripCounts, profile, t.dpi)
+}
@@ -0,0 +1,104 @@
+// subtitles.go
+package collage
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSubtitleGap is how far from a frame the nearest subtitle may end or
+// start and still caption it; frames in longer silences get none.
+const maxSubtitleGap = 5 * time.Second
+
+// Subtitle is one cue of a subtitle file: Text is shown from Start to End.
+type Subtitle struct {
+	Start, End time.Duration
+	Text       string // the cue's lines joined by spaces, without formatting tags
+}
+
+var (
+	// srtTiming matches the timing line of a SubRip cue, e.g.
+	// "00:01:02,500 --> 00:01:04,000"; a few writers use a dot for the comma.
+	srtTiming = regexp.MustCompile(`^(\d+):(\d{2}):(\d{2})[,.](\d{3})\s*-->\s*(\d+):(\d{2}):(\d{2})[,.](\d{3})`)
+	// srtTags matches the HTML-like (<i>) and ASS-style ({\an8}) formatting tags of SubRip text.
+	srtTags = regexp.MustCompile(`<[^>]*>|\{\\[^}]*\}`)
+)
+
+// ReadSubtitles parses the SubRip (.srt) file at path into its cues in file order.
+func ReadSubtitles(path string) ([]Subtitle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read subtitles: %v", err)
+	}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	var subs []Subtitle
+	var cue *Subtitle
+	var text []string
+	flush := func() {
+		if cue != nil {
+			cue.Text = strings.Join(strings.Fields(srtTags.ReplaceAllString(strings.Join(text, " "), "")), " ")
+			if cue.Text != "" {
+				subs = append(subs, *cue)
+			}
+		}
+		cue, text = nil, nil
+	}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; sc.Scan(); line++ {
+		s := strings.TrimSpace(sc.Text())
+		switch m := srtTiming.FindStringSubmatch(s); {
+		case m != nil:
+			flush()
+			cue = &Subtitle{Start: srtTime(m[1:5]), End: srtTime(m[5:9])}
+		case s == "":
+			flush()
+		case cue != nil:
+			text = append(text, s)
+		default:
+			// The cue number before the timing line.
+			if _, err := strconv.Atoi(s); err != nil {
+				return nil, fmt.Errorf("failed to parse subtitles %s: line %d: expected a cue number or timing, got %q", path, line, s)
+			}
+		}
+	}
+	flush()
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read subtitles: %v", err)
+	}
+	return subs, nil
+}
+
+// srtTime converts the hours, minutes, seconds and milliseconds of a SubRip timing.
+func srtTime(parts []string) time.Duration {
+	var n [4]int
+	for i, p := range parts {
+		n[i], _ = strconv.Atoi(p) // digits, as matched by srtTiming
+	}
+	return time.Duration(n[0])*time.Hour + time.Duration(n[1])*time.Minute +
+		time.Duration(n[2])*time.Second + time.Duration(n[3])*time.Millisecond
+}
+
+// nearestSubtitle returns the text of the cue showing at time at or, failing
+// that, the one nearest to it within maxSubtitleGap, and "" if there is none.
+func nearestSubtitle(subs []Subtitle, at time.Duration) string {
+	best, bestGap := "", maxSubtitleGap+1
+	for _, sub := range subs {
+		gap := time.Duration(0)
+		if at < sub.Start {
+			gap = sub.Start - at
+		} else if at > sub.End {
+			gap = at - sub.End
+		}
+		if gap < bestGap {
+			best, bestGap = sub.Text, gap
+		}
+	}
+	return best
+}
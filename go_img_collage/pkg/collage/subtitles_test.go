@@ -0,0 +1,95 @@
+// subtitles_test.go
+package collage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReadSubtitles(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name    string
+		srt     string
+		want    []Subtitle
+		wantErr bool
+	}{
+		{
+			name: "cues",
+			srt:  "1\n00:00:01,000 --> 00:00:02,500\nHello\n\n2\n00:01:02,003 --> 01:00:00,000\nTwo\nlines\n",
+			want: []Subtitle{{1000 * ms, 2500 * ms, "Hello"}, {62003 * ms, time.Hour, "Two lines"}},
+		},
+		{
+			name: "byte order mark and CRLF",
+			srt:  "\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n\r\n",
+			want: []Subtitle{{time.Second, 2 * time.Second, "Hello"}},
+		},
+		{
+			name: "dot before the milliseconds",
+			srt:  "1\n00:00:01.250 --> 00:00:02.000\nHello\n",
+			want: []Subtitle{{1250 * ms, 2 * time.Second, "Hello"}},
+		},
+		{
+			name: "formatting tags",
+			srt:  "1\n00:00:01,000 --> 00:00:02,000\n{\\an8}<i>Hello</i>   <b>there</b>\n",
+			want: []Subtitle{{time.Second, 2 * time.Second, "Hello there"}},
+		},
+		{
+			name: "cue without text is dropped",
+			srt:  "1\n00:00:01,000 --> 00:00:02,000\n<i></i>\n\n2\n00:00:03,000 --> 00:00:04,000\nLast\n",
+			want: []Subtitle{{3 * time.Second, 4 * time.Second, "Last"}},
+		},
+		{
+			name: "no blank line between cues",
+			srt:  "1\n00:00:01,000 --> 00:00:02,000\nOne\n00:00:03,000 --> 00:00:04,000\nTwo\n",
+			want: []Subtitle{{time.Second, 2 * time.Second, "One"}, {3 * time.Second, 4 * time.Second, "Two"}},
+		},
+		{name: "empty", srt: "", want: nil},
+		{name: "not SubRip", srt: "WEBVTT\n\n00:01.000 --> 00:02.000\nHello\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.srt")
+			if err := os.WriteFile(path, []byte(tt.srt), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadSubtitles(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadSubtitles() error = %v, want error %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadSubtitles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if _, err := ReadSubtitles(filepath.Join(t.TempDir(), "missing.srt")); err == nil {
+		t.Error("ReadSubtitles() of a missing file succeeded, want an error")
+	}
+}
+
+func TestNearestSubtitle(t *testing.T) {
+	subs := []Subtitle{
+		{10 * time.Second, 12 * time.Second, "first"},
+		{20 * time.Second, 21 * time.Second, "second"},
+	}
+	tests := []struct {
+		at   time.Duration
+		want string
+	}{
+		{11 * time.Second, "first"},
+		{12 * time.Second, "first"},
+		{15 * time.Second, "first"},  // 3s after the first, 5s before the second
+		{17 * time.Second, "second"}, // 5s after the first, 3s before the second
+		{5 * time.Second, "first"},   // within the gap before the first
+		{4 * time.Second, ""},        // more than maxSubtitleGap from any cue
+		{27 * time.Second, ""},
+	}
+	for _, tt := range tests {
+		if got := nearestSubtitle(subs, tt.at); got != tt.want {
+			t.Errorf("nearestSubtitle(%v) = %q, want %q", tt.at, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// text.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/go-text/typesetting/di"
+	"github.com/go-text/typesetting/font"
+	"github.com/go-text/typesetting/font/opentype"
+	"github.com/go-text/typesetting/language"
+	"github.com/go-text/typesetting/shaping"
+	"golang.org/x/image/math/fixed"
+	"golang.org/x/image/vector"
+	"golang.org/x/text/unicode/bidi"
+)
+
+// TitleCell is a text block rendered inside the grid, occupying a reserved block of cells.
+type TitleCell struct {
+	Text string
+	Reservation
+}
+
+// ParseTitleCell parses a title cell spec of the form "text:WxH:position" or
+// "text:WxH", e.g. "Summer 2024:2x2:center". The text may itself contain colons.
+func ParseTitleCell(spec string) (TitleCell, error) {
+	parts := strings.Split(spec, ":")
+	for n := 2; n >= 1; n-- {
+		if len(parts) <= n {
+			continue
+		}
+		r, err := ParseReservation(strings.Join(parts[len(parts)-n:], ":"))
+		if err != nil {
+			continue
+		}
+		text := strings.TrimSpace(strings.Join(parts[:len(parts)-n], ":"))
+		if text == "" {
+			break
+		}
+		return TitleCell{Text: text, Reservation: r}, nil
+	}
+	return TitleCell{}, fmt.Errorf("invalid title cell %q: expected text:WxH:position, e.g. \"Summer 2024:2x2:center\"", spec)
+}
+
+// Title cell styling.
+var (
+	titleBackground = color.RGBA{34, 34, 34, 255}
+	titleForeground = color.RGBA{255, 255, 255, 255}
+)
+
+// titleFill is the fraction of the block the text may cover in either direction.
+const titleFill = 0.8
+
+// measureSize is the font size at which text is shaped; it is scaled when drawn.
+const measureSize = 100
+
+// wrapSteps is the number of line widths tried when fitting text to a block.
+const wrapSteps = 24
+
+// drawTitleCell fills block on dst with the title background and draws text
+// centred in it. With size 0 the text is wrapped and sized to fill as much of
+// the block as possible; otherwise it is drawn at size pixels, wrapped to the block width.
+func drawTitleCell(dst *image.RGBA, block image.Rectangle, text string, fonts *fontSet, size float64) {
+	draw.Draw(dst, block, &image.Uniform{titleBackground}, image.Point{}, draw.Src)
+
+	maxW, maxH := float64(block.Dx())*titleFill, float64(block.Dy())*titleFill
+	shaped := shapeText(text, fonts)
+	var lines []shaping.Line
+	if size > 0 {
+		lines = shaped.wrap(int(maxW * measureSize / size))
+	} else {
+		lines, size = shaped.fit(maxW, maxH)
+	}
+	drawTextLines(dst, block, lines, size/measureSize, titleForeground)
+}
+
+// shapedText is a paragraph shaped at measureSize: split into runs by direction,
+// script and font, so right-to-left and complex scripts are laid out correctly.
+type shapedText struct {
+	runes []rune
+	dir   di.Direction
+	runs  []shaping.Output
+}
+
+// shapeText shapes text with fonts. The paragraph direction follows its first strongly directional character.
+func shapeText(text string, fonts *fontSet) shapedText {
+	st := shapedText{runes: []rune(text), dir: paragraphDirection(text)}
+	input := shaping.Input{
+		Text:      st.runes,
+		RunEnd:    len(st.runes),
+		Direction: st.dir,
+		Size:      fixed.I(measureSize),
+		Language:  language.DefaultLanguage(),
+	}
+	var seg shaping.Segmenter
+	var shaper shaping.HarfbuzzShaper
+	for _, run := range seg.Split(input, fonts) {
+		st.runs = append(st.runs, shaper.Shape(run))
+	}
+	return st
+}
+
+// paragraphDirection returns right-to-left if the first strongly directional character of text is, else left-to-right.
+func paragraphDirection(text string) di.Direction {
+	for _, r := range text {
+		p, _ := bidi.LookupRune(r)
+		switch p.Class() {
+		case bidi.L:
+			return di.DirectionLTR
+		case bidi.R, bidi.AL:
+			return di.DirectionRTL
+		}
+	}
+	return di.DirectionLTR
+}
+
+// wrap breaks the text into lines at most maxWidth pixels wide at measureSize,
+// using Unicode line breaking rules (so CJK text breaks between characters).
+func (st shapedText) wrap(maxWidth int) []shaping.Line {
+	if len(st.runs) == 0 {
+		return nil
+	}
+	// The wrapper trims trailing spaces in place, so give it its own copy of the glyphs.
+	runs := make([]shaping.Output, len(st.runs))
+	for i, run := range st.runs {
+		run.Glyphs = append([]shaping.Glyph(nil), run.Glyphs...)
+		runs[i] = run
+	}
+	var wrapper shaping.LineWrapper
+	lines, _ := wrapper.WrapParagraph(shaping.WrapConfig{Direction: st.dir}, max(1, maxWidth), st.runes, shaping.NewSliceIterator(runs))
+	return lines
+}
+
+// fit wraps the text into the lines that can be drawn largest within maxW by
+// maxH pixels, and returns them with the font size that fills that area.
+func (st shapedText) fit(maxW, maxH float64) ([]shaping.Line, float64) {
+	full := 0
+	for _, run := range st.runs {
+		full += run.Advance.Ceil()
+	}
+	bestWidth, bestSize := full, 0.0
+	for step := wrapSteps; step > 0; step-- {
+		width := full * step / wrapSteps
+		w, h := linesSize(st.wrap(width))
+		if w == 0 || h == 0 {
+			continue
+		}
+		size := measureSize * min(maxW/float64(w), maxH/float64(h))
+		if size > bestSize {
+			bestWidth, bestSize = width, size
+		}
+	}
+	return st.wrap(bestWidth), math.Max(1, math.Floor(bestSize))
+}
+
+// lineMetrics returns the width of line and the ascent and height of its line box.
+func lineMetrics(line shaping.Line) (width, ascent, height fixed.Int26_6) {
+	var descent, gap fixed.Int26_6
+	for _, run := range line {
+		width += run.Advance
+		ascent = max26(ascent, run.LineBounds.Ascent)
+		descent = min(descent, run.LineBounds.Descent)
+		gap = max26(gap, run.LineBounds.Gap)
+	}
+	return width, ascent, ascent - descent + gap
+}
+
+func max26(a, b fixed.Int26_6) fixed.Int26_6 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// linesSize returns the size in pixels of lines at measureSize.
+func linesSize(lines []shaping.Line) (w, h int) {
+	var height fixed.Int26_6
+	for _, line := range lines {
+		lw, _, lh := lineMetrics(line)
+		w = max(w, lw.Ceil())
+		height += lh
+	}
+	return w, height.Ceil()
+}
+
+// drawTextLines draws lines shaped at measureSize, scaled by scale, each centred
+// horizontally in r and together centred vertically.
+func drawTextLines(dst draw.Image, r image.Rectangle, lines []shaping.Line, scale float64, c color.Color) {
+	mask := textMask(r.Size(), lines, scale)
+	draw.DrawMask(dst, r, &image.Uniform{c}, image.Point{}, mask, image.Point{}, draw.Over)
+}
+
+// textMask renders lines shaped at measureSize, scaled by scale, into an alpha
+// mask of the given size, each line centred horizontally and together centred vertically.
+func textMask(size image.Point, lines []shaping.Line, scale float64) *image.Alpha {
+	_, h := linesSize(lines)
+	z := vector.NewRasterizer(size.X, size.Y)
+	y := (float64(size.Y) - float64(h)*scale) / 2
+	for _, line := range lines {
+		width, ascent, height := lineMetrics(line)
+		baseline := y + fix(ascent)*scale
+		x := (float64(size.X) - fix(width)*scale) / 2
+
+		// Runs are stored in logical order; draw them left to right.
+		runs := append(shaping.Line(nil), line...)
+		sort.Slice(runs, func(i, j int) bool { return runs[i].VisualIndex < runs[j].VisualIndex })
+		for _, run := range runs {
+			unit := float64(run.Size) / 64 * scale / float64(run.Face.Upem())
+			for _, g := range run.Glyphs {
+				if outline, ok := run.Face.GlyphData(g.GlyphID).(font.GlyphOutline); ok {
+					addGlyph(z, outline, x+fix(g.XOffset)*scale, baseline-fix(g.YOffset)*scale, unit)
+				}
+				x += fix(g.Advance) * scale
+			}
+		}
+		y += fix(height) * scale
+	}
+	mask := image.NewAlpha(image.Rect(0, 0, size.X, size.Y))
+	z.Draw(mask, mask.Rect, image.Opaque, image.Point{})
+	return mask
+}
+
+func fix(v fixed.Int26_6) float64 { return float64(v) / 64 }
+
+// addGlyph adds a glyph outline in font units to z, with its origin at (x, y)
+// and unit pixels per font unit. Font units grow up, pixels grow down.
+func addGlyph(z *vector.Rasterizer, outline font.GlyphOutline, x, y, unit float64) {
+	pt := func(p font.SegmentPoint) (float32, float32) {
+		return float32(x + float64(p.X)*unit), float32(y - float64(p.Y)*unit)
+	}
+	for i, s := range outline.Segments {
+		switch s.Op {
+		case opentype.SegmentOpMoveTo:
+			if i > 0 {
+				z.ClosePath()
+			}
+			z.MoveTo(pt(s.Args[0]))
+		case opentype.SegmentOpLineTo:
+			z.LineTo(pt(s.Args[0]))
+		case opentype.SegmentOpQuadTo:
+			bx, by := pt(s.Args[0])
+			cx, cy := pt(s.Args[1])
+			z.QuadTo(bx, by, cx, cy)
+		case opentype.SegmentOpCubeTo:
+			bx, by := pt(s.Args[0])
+			cx, cy := pt(s.Args[1])
+			dx, dy := pt(s.Args[2])
+			z.CubeTo(bx, by, cx, cy, dx, dy)
+		}
+	}
+	if len(outline.Segments) > 0 {
+		z.ClosePath()
+	}
+}
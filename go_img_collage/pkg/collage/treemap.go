@@ -0,0 +1,230 @@
+// treemap.go
+package collage
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tile weights (Options.Weight) of LayoutTreemap.
+const (
+	WeightSize       = "size"       // file size in bytes
+	WeightResolution = "resolution" // pixel count
+)
+
+// checkWeight returns an error for an unknown treemap weight.
+func checkWeight(opts Options) error {
+	switch opts.Weight {
+	case "", WeightSize, WeightResolution:
+		return nil
+	}
+	return fmt.Errorf("unknown weight %q: use size or resolution", opts.Weight)
+}
+
+// imageWeights returns the treemap weight of each image: from opts.WeightsFile
+// if set, otherwise by opts.Weight. Images without a positive weight get the
+// mean of the others, or 1.
+func imageWeights(paths []string, opts Options) ([]float64, error) {
+	weights := make([]float64, len(paths))
+	switch {
+	case opts.WeightsFile != "":
+		listed, err := readWeights(opts.WeightsFile)
+		if err != nil {
+			return nil, err
+		}
+		missing := 0
+		for i, path := range paths {
+			w, ok := listed[path]
+			if !ok {
+				w, ok = listed[filepath.Base(path)]
+			}
+			if !ok {
+				missing++
+			}
+			weights[i] = w
+		}
+		if missing > 0 {
+			opts.logger().Printf("Warning: %d images are not in %s and get the mean weight", missing, opts.WeightsFile)
+		}
+	case opts.Weight == WeightResolution:
+		for i, s := range imageSizes(paths, opts) {
+			weights[i] = float64(s.X) * float64(s.Y)
+		}
+	default:
+		for i, path := range paths {
+			if info, err := os.Stat(path); err == nil {
+				weights[i] = float64(info.Size())
+			}
+		}
+	}
+
+	sum, n := 0.0, 0
+	for _, w := range weights {
+		if w > 0 {
+			sum += w
+			n++
+		}
+	}
+	mean := 1.0
+	if n > 0 {
+		mean = sum / float64(n)
+	}
+	for i, w := range weights {
+		if w <= 0 {
+			weights[i] = mean
+		}
+	}
+	return weights, nil
+}
+
+// readWeights reads a weights file: one "weight path" line per image, where
+// path is the image's path or file name. Blank lines and lines starting with #
+// are ignored.
+func readWeights(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read weights file: %v", err)
+	}
+	defer f.Close()
+	weights := map[string]float64{}
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		value, name, ok := strings.Cut(text, " ")
+		w, err := strconv.ParseFloat(value, 64)
+		if !ok || err != nil || w < 0 {
+			return nil, fmt.Errorf("%s:%d: expected \"weight path\"", path, line)
+		}
+		weights[strings.TrimSpace(name)] = w
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read weights file: %v", err)
+	}
+	return weights, nil
+}
+
+// frect is a rectangle with fractional coordinates.
+type frect struct{ x0, y0, x1, y1 float64 }
+
+// treemapLayout divides a canvas of about opts.CellSize squared pixels per
+// image (opts.Cols cells wide, or square) into one rectangle per image with
+// an area proportional to its weight, using the squarified treemap algorithm
+// so the rectangles stay close to square. Heavier images come first, from
+// the top-left corner.
+func treemapLayout(paths []string, opts Options) (Layout, error) {
+	weights, err := imageWeights(paths, opts)
+	if err != nil {
+		return Layout{}, err
+	}
+	area := float64(len(paths)) * float64(opts.CellSize) * float64(opts.CellSize)
+	width := math.Sqrt(area)
+	if opts.Cols > 0 {
+		width = float64(opts.Cols * opts.CellSize)
+	}
+	height := math.Ceil(area / width)
+	width = math.Round(width)
+
+	// Step 1: Scale the weights to areas of the canvas, heaviest first.
+	order := make([]int, len(paths))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return weights[order[a]] > weights[order[b]] })
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	g := float64(opts.Gutter)
+	areas := make([]float64, len(order))
+	for k, i := range order {
+		areas[k] = weights[i] / total * (width + g) * (height + g)
+	}
+
+	// Step 2: Squarify over the canvas plus one gutter, then take the gutter
+	// off the right and bottom of every rectangle.
+	m := float64(opts.Margin)
+	rects := squarify(areas, frect{m, m, m + width + g, m + height + g})
+	layout := Layout{
+		Width:  int(width) + 2*opts.Margin,
+		Height: int(height) + 2*opts.Margin,
+		Cells:  make([]image.Rectangle, len(paths)),
+	}
+	for k, i := range order {
+		r := rects[k]
+		x0, y0 := int(math.Round(r.x0)), int(math.Round(r.y0))
+		x1, y1 := int(math.Round(r.x1))-opts.Gutter, int(math.Round(r.y1))-opts.Gutter
+		layout.Cells[i] = image.Rect(x0, y0, max(x0+1, x1), max(y0+1, y1))
+	}
+	return layout, nil
+}
+
+// squarify lays out areas (in decreasing order, summing to the area of r) as
+// rectangles tiling r: each row along the shorter side of the space left takes
+// items while that improves its worst aspect ratio.
+func squarify(areas []float64, r frect) []frect {
+	out := make([]frect, 0, len(areas))
+	for start := 0; start < len(areas); {
+		side := math.Min(r.x1-r.x0, r.y1-r.y0)
+		end := start + 1
+		for end < len(areas) && worstAspect(areas[start:end+1], side) <= worstAspect(areas[start:end], side) {
+			end++
+		}
+		row := areas[start:end]
+		sum := 0.0
+		for _, a := range row {
+			sum += a
+		}
+		if r.x1-r.x0 >= r.y1-r.y0 {
+			// A column on the left, items stacked top to bottom.
+			w := sum / (r.y1 - r.y0)
+			if end == len(areas) {
+				w = r.x1 - r.x0
+			}
+			y := r.y0
+			for _, a := range row {
+				h := a / sum * (r.y1 - r.y0)
+				out = append(out, frect{r.x0, y, r.x0 + w, y + h})
+				y += h
+			}
+			r.x0 += w
+		} else {
+			// A row at the top, items side by side.
+			h := sum / (r.x1 - r.x0)
+			if end == len(areas) {
+				h = r.y1 - r.y0
+			}
+			x := r.x0
+			for _, a := range row {
+				w := a / sum * (r.x1 - r.x0)
+				out = append(out, frect{x, r.y0, x + w, r.y0 + h})
+				x += w
+			}
+			r.y0 += h
+		}
+		start = end
+	}
+	return out
+}
+
+// worstAspect returns the largest aspect ratio (at least 1) of the rectangles
+// of a row of areas laid along a side of the given length.
+func worstAspect(row []float64, side float64) float64 {
+	sum, lo, hi := 0.0, math.Inf(1), 0.0
+	for _, a := range row {
+		sum += a
+		lo = math.Min(lo, a)
+		hi = math.Max(hi, a)
+	}
+	s2, sum2 := side*side, sum*sum
+	return math.Max(s2*hi/sum2, sum2/(s2*lo))
+}
@@ -0,0 +1,129 @@
+// treemap_test.go
+package collage
+
+import (
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestReadWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		want    map[string]float64
+		wantErr bool
+	}{
+		{"weights", "# views\n3 trip/a.jpg\n\n0.5   b.jpg  \n", map[string]float64{"trip/a.jpg": 3, "b.jpg": 0.5}, false},
+		{"name with spaces", "2 my photo.jpg\n", map[string]float64{"my photo.jpg": 2}, false},
+		{"no path", "3\n", nil, true},
+		{"negative", "-1 a.jpg\n", nil, true},
+		{"not a number", "many a.jpg\n", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "weights.txt")
+			if err := os.WriteFile(path, []byte(tt.file), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			got, err := readWeights(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readWeights() error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readWeights() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImageWeights(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.txt")
+	if err := os.WriteFile(path, []byte("4 /photos/trip/a.jpg\n2 b.jpg\n0 c.jpg\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	opts := DefaultOptions()
+	opts.WeightsFile = path
+	// By path, by file name, zero and missing; the last two get the mean of the others.
+	got, err := imageWeights([]string{"/photos/trip/a.jpg", "/photos/home/b.jpg", "/photos/c.jpg", "/photos/d.jpg"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []float64{4, 2, 3, 3}; !slices.Equal(got, want) {
+		t.Errorf("imageWeights() = %v, want %v", got, want)
+	}
+}
+
+func TestSquarify(t *testing.T) {
+	tests := []struct {
+		name  string
+		areas []float64
+		r     frect
+	}{
+		{"one", []float64{24}, frect{0, 0, 6, 4}},
+		{"classic", []float64{6, 6, 4, 3, 2, 2, 1}, frect{0, 0, 6, 4}},
+		{"tall", []float64{50, 30, 20}, frect{10, 10, 20, 20}},
+		{"equal", []float64{1, 1, 1, 1, 1, 1, 1, 1, 1}, frect{0, 0, 3, 3}},
+	}
+	const eps = 1e-9
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rects := squarify(tt.areas, tt.r)
+			if len(rects) != len(tt.areas) {
+				t.Fatalf("squarify() gave %d rectangles, want %d", len(rects), len(tt.areas))
+			}
+			for i, r := range rects {
+				if a := (r.x1 - r.x0) * (r.y1 - r.y0); math.Abs(a-tt.areas[i]) > eps {
+					t.Errorf("rectangle %d = %+v has area %g, want %g", i, r, a, tt.areas[i])
+				}
+				if r.x0 < tt.r.x0-eps || r.y0 < tt.r.y0-eps || r.x1 > tt.r.x1+eps || r.y1 > tt.r.y1+eps {
+					t.Errorf("rectangle %d = %+v is outside %+v", i, r, tt.r)
+				}
+				for j, s := range rects[:i] {
+					if math.Min(r.x1, s.x1)-math.Max(r.x0, s.x0) > eps && math.Min(r.y1, s.y1)-math.Max(r.y0, s.y0) > eps {
+						t.Errorf("rectangles %d = %+v and %d = %+v overlap", j, s, i, r)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestTreemapLayout(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weights.txt")
+	if err := os.WriteFile(path, []byte("1 b.jpg\n3 a.jpg\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name          string
+		gutter        int
+		margin        int
+		width, height int
+		cells         []image.Rectangle
+	}{
+		// The heavier a.jpg takes three quarters of the canvas, on the left.
+		{"plain", 0, 0, 200, 100, []image.Rectangle{image.Rect(150, 0, 200, 100), image.Rect(0, 0, 150, 100)}},
+		{"gutter and margin", 10, 5, 210, 110, []image.Rectangle{image.Rect(163, 5, 205, 105), image.Rect(5, 5, 153, 105)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultOptions()
+			opts.WeightsFile, opts.CellSize, opts.Cols = path, 100, 2
+			opts.Gutter, opts.Margin = tt.gutter, tt.margin
+			l, err := treemapLayout([]string{"b.jpg", "a.jpg"}, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if l.Width != tt.width || l.Height != tt.height {
+				t.Errorf("treemapLayout() is %dx%d, want %dx%d", l.Width, l.Height, tt.width, tt.height)
+			}
+			if !slices.Equal(l.Cells, tt.cells) {
+				t.Errorf("treemapLayout() cells = %v, want %v", l.Cells, tt.cells)
+			}
+		})
+	}
+}
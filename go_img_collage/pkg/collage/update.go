@@ -0,0 +1,101 @@
+// update.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// updateManifestPath returns the manifest -update keeps beside the collage.
+func updateManifestPath(outputPath string) string {
+	return outputPath + ".cells.json"
+}
+
+// readCollage decodes a previously written collage.
+func readCollage(path string, opts Options) (image.Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".png") {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return png.Decode(f)
+	}
+	return decodeImage(opts.context(), path, data, 0)
+}
+
+// updateCollage redraws only the cells of the existing collage at
+// opts.OutputPath whose image changed since its manifest was written: another
+// file took the cell, or the file's size or modification time differs. It
+// reports false, without writing anything, if the collage has to be rebuilt
+// instead because there is no usable collage and manifest or the canvas or
+// drawing options changed.
+func updateCollage(canvas image.Rectangle, origin image.Point, layout Layout, imagePaths []string, bg color.Color, opts Options) (bool, error) {
+	manifestPath := updateManifestPath(opts.OutputPath)
+	old, err := readManifest(manifestPath)
+	if err != nil {
+		opts.logger().Println("No usable cell manifest; rebuilding the whole collage")
+		return false, nil
+	}
+	current := newManifest(canvas, origin, layout, imagePaths, opts)
+	if old.Width != current.Width || old.Height != current.Height || old.Settings != current.Settings {
+		opts.logger().Println("Canvas or drawing options changed; rebuilding the whole collage")
+		return false, nil
+	}
+	prev, err := readCollage(opts.OutputPath, opts)
+	if err != nil || prev.Bounds() != canvas {
+		opts.logger().Println("Existing collage unreadable; rebuilding the whole collage")
+		return false, nil
+	}
+
+	// Step 1: Start from the existing collage over the background.
+	img := image.NewRGBA(canvas)
+	fillBackground(img, bg)
+	draw.Draw(img, canvas, prev, canvas.Min, draw.Over)
+
+	// Step 2: Find the cells whose image changed, was added or was removed.
+	var dirty []image.Rectangle
+	for i, c := range current.Cells {
+		if i >= len(old.Cells) || old.Cells[i].Path != c.Path || old.Cells[i].Size != c.Size ||
+			!old.Cells[i].ModTime.Equal(c.ModTime) || old.Cells[i].rect() != c.rect() {
+			dirty = append(dirty, c.rect())
+		}
+	}
+	for _, c := range old.Cells[min(len(old.Cells), len(current.Cells)):] {
+		dirty = append(dirty, c.rect())
+	}
+
+	// Step 3: Clear and redraw just those cells.
+	errs := newErrorLog(opts.MaxErrorsShown, opts.logger())
+	defer errs.summary(opts.logger().Writer())
+	prog := newProgress(len(dirty), opts)
+	for _, r := range dirty {
+		cell := img.SubImage(r).(*image.RGBA)
+		fillBackground(cell, bg)
+		if err := renderImages(cell, origin, layout, imagePaths, opts, errs, prog); err != nil {
+			prog.finish()
+			return true, err
+		}
+	}
+	prog.finish()
+	opts.logger().Printf("Updated %d of %d cells\n", len(dirty), len(current.Cells))
+	if len(dirty) > 0 {
+		if err := writeOutput(img, opts); err != nil {
+			return true, fmt.Errorf("%w: %w", ErrEncode, err)
+		}
+	}
+	if err := writeManifests(current, opts); err != nil {
+		return true, err
+	}
+	return true, writeOccupancyMask(layout, imagePaths, errs, opts)
+}
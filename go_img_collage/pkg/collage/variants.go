@@ -0,0 +1,82 @@
+// variants.go
+package collage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// VariantPath returns the path of variant i (1-based) of the output at path:
+// collage.png becomes collage_v1.png, collage_v2.png, ...
+func VariantPath(path string, i int) string {
+	return numberedPath(path, "v", i)
+}
+
+// numberedPath inserts _<tag><i> before the extension of path; an empty path stays empty.
+func numberedPath(path, tag string, i int) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s_%s%d%s", strings.TrimSuffix(path, ext), tag, i, ext)
+}
+
+// createVariants renders opts.Variants variations of the collage, with seeds
+// opts.Seed, opts.Seed+1, ..., each written beside opts.OutputPath (and its
+// manifest, image map, occupancy mask and matte beside theirs) as variantPath
+// names. The variants are shuffled unless opts.Sort asks for another order, and
+// the jitter differs with the seed. The images are found, filtered and sorted
+// once, and decoded and resized once into opts.CacheDir or, without one, a
+// temporary tile cache shared by the variants.
+func createVariants(opts Options) error {
+	if opts.Hierarchical || opts.Target != "" || opts.Update || opts.PerPage > 0 || opts.Carousel > 0 {
+		return fmt.Errorf("variants cannot be combined with hierarchical, mosaic, updated, paged or carousel collages")
+	}
+	shuffle := opts.Shuffle || opts.Sort == SortName
+	if !shuffle && opts.JitterRotation == 0 && opts.InsetJitter == 0 {
+		return fmt.Errorf("variants in %s order without jitter would all be the same; add -jitter-rotation or -inset-jitter", opts.Sort)
+	}
+	if err := checkOutput(opts); err != nil {
+		return err
+	}
+
+	// Step 1: Find, filter and sort the images once.
+	base := opts
+	base.Shuffle = false
+	paths, err := base.imagePaths()
+	if err != nil {
+		return err
+	}
+
+	// Step 2: Share the tiles between the variants through the tile cache.
+	if opts.CacheDir == "" {
+		dir, err := os.MkdirTemp("", "collage-variants-*")
+		if err != nil {
+			return fmt.Errorf("failed to create tile cache: %v", err)
+		}
+		cleanup := func() { os.RemoveAll(dir) }
+		defer cleanup()
+		defer onInterrupt(cleanup)()
+		opts.CacheDir = dir
+	}
+
+	// Step 3: Render each variant from the prepared images.
+	for i := 1; i <= opts.Variants; i++ {
+		sub := opts.selected(paths)
+		sub.Variants, sub.StateFile = 0, ""
+		sub.Seed = opts.Seed + int64(i-1)
+		if shuffle {
+			sub.Images = shuffled(paths, sub.Seed)
+		}
+		sub.OutputPath = VariantPath(opts.OutputPath, i)
+		sub.ManifestPath, sub.HTMLPath = VariantPath(opts.ManifestPath, i), VariantPath(opts.HTMLPath, i)
+		sub.OccupancyPath, sub.MattePath = VariantPath(opts.OccupancyPath, i), VariantPath(opts.MattePath, i)
+		opts.logger().Printf("Rendering variant %d of %d (seed %d)\n", i, opts.Variants, sub.Seed)
+		if err := create(sub); err != nil {
+			return fmt.Errorf("variant %d: %v", i, err)
+		}
+	}
+	return nil
+}
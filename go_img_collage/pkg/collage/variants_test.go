@@ -0,0 +1,23 @@
+// variants_test.go
+package collage
+
+import "testing"
+
+func TestNumberedPath(t *testing.T) {
+	tests := []struct {
+		got, want string
+	}{
+		{numberedPath("collage.png", "v", 1), "collage_v1.png"},
+		{numberedPath("out/my.collage.webp", "p", 12), "out/my.collage_p12.webp"},
+		{numberedPath("collage", "s", 2), "collage_s2"},
+		{numberedPath("", "v", 1), ""},
+		{VariantPath("a.jpg", 3), "a_v3.jpg"},
+		{PagePath("a.jpg", 2), "a_p2.jpg"},
+		{SlicePath("a.jpg", 10), "a_s10.jpg"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("got %q, want %q", tt.got, tt.want)
+		}
+	}
+}
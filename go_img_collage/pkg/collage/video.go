@@ -0,0 +1,121 @@
+// video.go
+package collage
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Video frames are extracted with the ffprobe and ffmpeg tools of FFmpeg,
+// which must be on PATH.
+const (
+	videoProbe   = "ffprobe"
+	videoDecoder = "ffmpeg"
+)
+
+// DefaultFrames is the number of frames of a video contact sheet when none is given.
+const DefaultFrames = 16
+
+// videoInput returns the argument naming the local file path as input to
+// ffprobe or ffmpeg: through the file protocol, so a name starting with "-"
+// is not taken for an option nor one with a colon for another protocol.
+func videoInput(path string) string {
+	return "file:" + path
+}
+
+// videoTool returns the path of an FFmpeg command-line tool.
+func videoTool(name string) (string, error) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", fmt.Errorf("video contact sheets need %s from FFmpeg on PATH: %v", name, err)
+	}
+	return path, nil
+}
+
+// VideoFrames extracts n frames at even intervals from the video at path for a
+// contact sheet and returns their files in playback order, in a temp directory
+// removed by cleanup, with the time of each in the video keyed by its file.
+// The frames are taken from the middle of n equal parts of the video, so the
+// black frames that often open and close it are missed.
+func VideoFrames(path string, n int, opts Options) (frames []string, times map[string]time.Duration, cleanup func(), err error) {
+	cleanup = func() {}
+	if n <= 0 {
+		return nil, nil, cleanup, fmt.Errorf("invalid frame count %d", n)
+	}
+	probe, err := videoTool(videoProbe)
+	if err != nil {
+		return nil, nil, cleanup, err
+	}
+	ffmpeg, err := videoTool(videoDecoder)
+	if err != nil {
+		return nil, nil, cleanup, err
+	}
+
+	// Step 1: Find the length of the video.
+	out, err := exec.CommandContext(opts.context(), probe, "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", videoInput(path)).Output()
+	if err := opts.canceled(); err != nil {
+		return nil, nil, cleanup, err
+	}
+	if err != nil {
+		return nil, nil, cleanup, fmt.Errorf("failed to read video %s: %v", path, err)
+	}
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil || seconds <= 0 {
+		return nil, nil, cleanup, fmt.Errorf("failed to read the length of video %s: %q", path, bytes.TrimSpace(out))
+	}
+	length := time.Duration(seconds * float64(time.Second))
+
+	// Step 2: Extract each frame as a JPEG, seeking to it before decoding.
+	dir, err := os.MkdirTemp("", "collage-frames-*")
+	if err != nil {
+		return nil, nil, cleanup, fmt.Errorf("failed to create frame directory: %v", err)
+	}
+	unregister := onInterrupt(func() { os.RemoveAll(dir) })
+	cleanup = func() {
+		os.RemoveAll(dir)
+		unregister()
+	}
+	opts.logger().Printf("Extracting %d frames from %s (%v)...\n", n, path, length.Round(time.Second))
+	times = map[string]time.Duration{}
+	for i := 0; i < n; i++ {
+		if err := opts.canceled(); err != nil {
+			cleanup()
+			return nil, nil, func() {}, err
+		}
+		at := length * time.Duration(2*i+1) / time.Duration(2*n)
+		frame := filepath.Join(dir, fmt.Sprintf("frame_%04d.jpg", i+1))
+		cmd := exec.CommandContext(opts.context(), ffmpeg, "-v", "error", "-ss", strconv.FormatFloat(at.Seconds(), 'f', 3, 64),
+			"-i", videoInput(path), "-frames:v", "1", "-q:v", "2", "-y", frame)
+		if msg, err := cmd.CombinedOutput(); err != nil {
+			cleanup()
+			if err := opts.canceled(); err != nil {
+				return nil, nil, func() {}, err
+			}
+			return nil, nil, func() {}, fmt.Errorf("%s failed at %v: %v: %s", videoDecoder, at, err, bytes.TrimSpace(msg))
+		}
+		if _, err := os.Stat(frame); err != nil {
+			// Seeking close to the end can find no frame left to decode.
+			opts.logger().Printf("Warning: no frame of %s at %v", path, at)
+			continue
+		}
+		frames = append(frames, frame)
+		times[frame] = at
+	}
+	return frames, times, cleanup, nil
+}
+
+// formatTimestamp writes a time in a video as m:ss, or h:mm:ss from an hour on.
+func formatTimestamp(d time.Duration) string {
+	s := int(d / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
@@ -0,0 +1,42 @@
+// video_test.go
+package collage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0:00"},
+		{1500 * time.Millisecond, "0:01"},
+		{75 * time.Second, "1:15"},
+		{59*time.Minute + 59*time.Second, "59:59"},
+		{time.Hour, "1:00:00"},
+		{2*time.Hour + 3*time.Minute + 4*time.Second, "2:03:04"},
+	}
+	for _, tt := range tests {
+		if got := formatTimestamp(tt.d); got != tt.want {
+			t.Errorf("formatTimestamp(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestVideoInput(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"clip.mp4", "file:clip.mp4"},
+		{"-clip.mp4", "file:-clip.mp4"},
+		{"http:clip.mp4", "file:http:clip.mp4"},
+		{"/videos/a b.mov", "file:/videos/a b.mov"},
+	}
+	for _, tt := range tests {
+		if got := videoInput(tt.path); got != tt.want {
+			t.Errorf("videoInput(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+//go:build vips
+
+// vips.go
+package collage
+
+import (
+	"fmt"
+	"image"
+	"sync"
+
+	"github.com/davidbyttow/govips/v2/vips"
+)
+
+// Building with -tags vips needs libvips (8.10 or later) and its headers;
+// github.com/davidbyttow/govips/v2 is required by go.mod.
+
+var vipsStartup sync.Once
+
+func init() {
+	vipsResize = resizeVips
+}
+
+// resizeVips implements vipsResize. libvips shrinks JPEGs while decoding them
+// and streams the rest, so the full-size image is never held in memory.
+func resizeVips(data []byte, cellW, cellH int, opts Options) (*image.RGBA, error) {
+	vipsStartup.Do(func() {
+		vips.LoggingSettings(nil, vips.LogLevelError)
+		vips.Startup(&vips.Config{ConcurrencyLevel: 1}) // the collage runs its own workers
+	})
+
+	crop, size := vips.InterestingNone, vips.SizeBoth
+	switch opts.Fit {
+	case FitCover:
+		crop = vips.InterestingCentre
+	case FitStretch:
+		size = vips.SizeForce
+	}
+	ref, err := vips.NewThumbnailWithSizeFromBuffer(data, cellW, cellH, crop, size)
+	if err != nil {
+		return nil, fmt.Errorf("libvips: %v", err)
+	}
+	defer ref.Close()
+	if err := ref.ToColorSpace(vips.InterpretationSRGB); err != nil {
+		return nil, fmt.Errorf("libvips: %v", err)
+	}
+	if !ref.HasAlpha() {
+		if err := ref.AddAlpha(); err != nil {
+			return nil, fmt.Errorf("libvips: %v", err)
+		}
+	}
+	pix, err := ref.ToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("libvips: %v", err)
+	}
+	w, h := ref.Width(), ref.Height()
+	if len(pix) != w*h*4 {
+		return nil, fmt.Errorf("libvips: unexpected %d bytes for %dx%d RGBA", len(pix), w, h)
+	}
+
+	// libvips keeps colour and alpha separate; image.RGBA premultiplies them.
+	img := &image.RGBA{Pix: pix, Stride: w * 4, Rect: image.Rect(0, 0, w, h)}
+	for i := 0; i < len(pix); i += 4 {
+		if a := uint32(pix[i+3]); a < 255 {
+			pix[i] = uint8(uint32(pix[i]) * a / 255)
+			pix[i+1] = uint8(uint32(pix[i+1]) * a / 255)
+			pix[i+2] = uint8(uint32(pix[i+2]) * a / 255)
+		}
+	}
+	return img, nil
+}
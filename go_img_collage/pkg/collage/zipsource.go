@@ -0,0 +1,169 @@
+// zipsource.go
+package collage
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// zipSource is a ZIP archive read like a folder: its top-level directories
+// are the albums. Its images are paths inside the archive, such as
+// export.zip/Trip/photo.jpg, which FetchImages extracts.
+type zipSource struct {
+	archive string
+	opts    Options
+}
+
+func (s zipSource) List() ([]string, []string, error) {
+	r, err := zip.OpenReader(s.archive)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer r.Close()
+	filter, err := newPathFilter(s.opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byAlbum := map[string][]string{}
+	for _, f := range r.File {
+		name := strings.TrimPrefix(f.Name, "/")
+		album, rest, ok := strings.Cut(name, "/")
+		entry := s.archive + "/" + name
+		switch {
+		case f.FileInfo().IsDir() || strings.Contains(rest, "/"):
+			continue // deeper levels, which the folder scan does not read either
+		case !ok:
+			s.opts.Skipped.Add(entry, SkipOutsideAlbum, "")
+		case path.Ext(rest) != "" && !IsImageFile(rest):
+			// Entries without an extension are kept and sniffed when extracted.
+			s.opts.Skipped.Add(entry, SkipUnsupported, path.Ext(rest))
+		default:
+			if ok, why := filter.allows("", name); !ok {
+				s.opts.Skipped.Add(entry, SkipExcluded, why)
+				continue
+			}
+			byAlbum[album] = append(byAlbum[album], entry)
+		}
+	}
+	albums := make([]string, 0, len(byAlbum))
+	for album := range byAlbum {
+		albums = append(albums, album)
+	}
+	sort.Strings(albums)
+	var images, folders []string
+	for _, album := range albums {
+		sort.Strings(byAlbum[album])
+		images = append(images, byAlbum[album]...)
+		folders = append(folders, s.archive+"/"+album)
+	}
+	return images, folders, nil
+}
+
+// maxEntrySize is the largest archive entry extracted, in bytes, so a
+// damaged or malicious archive cannot exhaust memory.
+const maxEntrySize = 256 << 20
+
+var (
+	// errNotImage reports an archive entry whose contents are not a supported image.
+	errNotImage = errors.New("not an image")
+	// errEntryTooLarge reports an archive entry over maxEntrySize.
+	errEntryTooLarge = errors.New("entry too large")
+)
+
+// splitArchivePath splits a path inside a ZIP archive, such as
+// export.zip/Trip/photo.jpg, into the archive and the entry name.
+func splitArchivePath(p string) (archive, entry string, ok bool) {
+	i := strings.Index(strings.ToLower(p), ".zip/")
+	if i < 0 {
+		return "", "", false
+	}
+	return p[:i+4], p[i+5:], true
+}
+
+// extractEntries extracts the archive entries paths[i] for each i of entries
+// into dir, setting local[i] to the extracted file or failed[i]. Each file
+// keeps the entry's modification time.
+func extractEntries(paths []string, entries []int, dir string, local []string, failed []bool, opts Options) error {
+	byArchive := map[string][]int{}
+	for _, i := range entries {
+		archive, _, _ := splitArchivePath(paths[i])
+		byArchive[archive] = append(byArchive[archive], i)
+	}
+	opts.logger().Printf("Extracting %d images...\n", len(entries))
+	for archive, indices := range byArchive {
+		r, err := zip.OpenReader(archive)
+		if err != nil {
+			return fmt.Errorf("failed to open archive: %v", err)
+		}
+		files := map[string]*zip.File{}
+		for _, f := range r.File {
+			files[strings.TrimPrefix(f.Name, "/")] = f
+		}
+		for _, i := range indices {
+			_, name, _ := splitArchivePath(paths[i])
+			file, err := extractEntry(files[name], filepath.Join(dir, fmt.Sprint(i)))
+			if err != nil {
+				opts.logger().Printf("Warning: could not extract %s: %v", paths[i], err)
+				reason := errorKind(err)
+				if errors.Is(err, errNotImage) {
+					reason = SkipNotImage
+				} else if errors.Is(err, errEntryTooLarge) {
+					reason = SkipTooLarge
+				}
+				opts.Skipped.Add(paths[i], reason, err.Error())
+				failed[i] = true
+				continue
+			}
+			local[i] = file
+		}
+		r.Close()
+	}
+	return nil
+}
+
+// extractEntry writes the archive entry f, if it is an image of at most
+// maxEntrySize bytes, into dir.
+func extractEntry(f *zip.File, dir string) (string, error) {
+	if f == nil {
+		return "", fs.ErrNotExist
+	}
+	tooLarge := fmt.Errorf("%w: over %s", errEntryTooLarge, formatBytes(maxEntrySize))
+	if f.UncompressedSize64 > maxEntrySize {
+		return "", tooLarge
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	// Read at most one byte past the limit, whatever size the entry records.
+	data, err := io.ReadAll(io.LimitReader(rc, maxEntrySize+1))
+	rc.Close()
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxEntrySize {
+		return "", tooLarge
+	}
+	ext, mediaType, ok := ImageExt("", data)
+	if !ok {
+		return "", fmt.Errorf("%w: %s", errNotImage, mediaType)
+	}
+	file, err := saveFetched(dir, path.Base(f.Name), ext, data)
+	if err != nil {
+		return "", err
+	}
+	if mod := f.Modified; !mod.IsZero() {
+		os.Chtimes(file, time.Now(), mod)
+	}
+	return file, nil
+}
@@ -0,0 +1,131 @@
+// zipsource_test.go
+package collage
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitArchivePath(t *testing.T) {
+	tests := []struct {
+		path, archive, entry string
+		ok                   bool
+	}{
+		{"export.zip/Trip/photo.jpg", "export.zip", "Trip/photo.jpg", true},
+		{"/data/Export.ZIP/a/b.png", "/data/Export.ZIP", "a/b.png", true},
+		{"/data/a.zip.d/x.zip/y.jpg", "/data/a.zip.d/x.zip", "y.jpg", true},
+		{"/data/export.zip", "", "", false},
+		{"/data/zip/photo.jpg", "", "", false},
+	}
+	for _, tt := range tests {
+		archive, entry, ok := splitArchivePath(tt.path)
+		if archive != tt.archive || entry != tt.entry || ok != tt.ok {
+			t.Errorf("splitArchivePath(%q) = %q, %q, %v, want %q, %q, %v", tt.path, archive, entry, ok, tt.archive, tt.entry, tt.ok)
+		}
+	}
+}
+
+// rawEntry returns the header and deflated data of an archive entry holding
+// data, with the uncompressed size it records.
+func rawEntry(t *testing.T, name string, data []byte, size uint64) (*zip.FileHeader, []byte) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestSpeed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	w.Close()
+	return &zip.FileHeader{
+		Name:               name,
+		Method:             zip.Deflate,
+		CRC32:              crc32.ChecksumIEEE(data),
+		CompressedSize64:   uint64(buf.Len()),
+		UncompressedSize64: size,
+	}, buf.Bytes()
+}
+
+func TestExtractEntry(t *testing.T) {
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 2))); err != nil {
+		t.Fatal(err)
+	}
+	huge := make([]byte, maxEntrySize+1)
+	archive := filepath.Join(t.TempDir(), "a.zip")
+	out, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(out)
+	for _, e := range []struct {
+		name string
+		data []byte
+		size uint64
+	}{
+		{"album/photo.png", img.Bytes(), uint64(img.Len())},
+		{"album/notes.png", []byte("plain text"), 10},
+		{"album/claims-huge.png", img.Bytes(), maxEntrySize + 1},
+		{"album/hides-huge.png", huge, 1}, // archive/zip fails reading past the recorded size
+	} {
+		header, data := rawEntry(t, e.name, e.data, e.size)
+		w, err := zw.CreateRaw(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out.Close()
+
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	files := map[string]*zip.File{}
+	for _, f := range r.File {
+		files[f.Name] = f
+	}
+	tests := []struct {
+		name    string
+		wantErr error
+	}{
+		{"album/photo.png", nil},
+		{"album/notes.png", errNotImage},
+		{"album/claims-huge.png", errEntryTooLarge},
+		{"album/hides-huge.png", zip.ErrFormat},
+		{"album/missing.png", os.ErrNotExist},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file, err := extractEntry(files[tt.name], filepath.Join(t.TempDir(), string(rune('a'+i))))
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("extractEntry() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractEntry() error = %v", err)
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if got, _ := io.ReadAll(f); !bytes.Equal(got, img.Bytes()) {
+				t.Errorf("extracted %d bytes, want the %d of the entry", len(got), img.Len())
+			}
+		})
+	}
+}
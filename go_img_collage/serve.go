@@ -0,0 +1,271 @@
+// serve.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	xdraw "golang.org/x/image/draw"
+
+	"github.com/BadarSaghir/go_img_collage/pkg/collage"
+)
+
+// Preview widths in pixels: the default and the largest that may be asked for.
+const (
+	previewWidth    = 800
+	maxPreviewWidth = 4096
+)
+
+// server serves the collage at path while builds replace it: the page at /
+// shows it and reloads it when a build finishes, told by the server-sent
+// events of /events; /collage is the file itself, /preview a small JPEG of it
+// and a POST to /rebuild starts a build.
+type server struct {
+	path string
+	b    *builder
+
+	mu      sync.Mutex
+	clients map[chan buildEvent]bool
+
+	previewMu  sync.Mutex
+	previewKey string // modification time, size and width of the collage the preview was made for
+	preview    []byte
+}
+
+// buildEvent reports a finished build to the /events clients.
+type buildEvent struct {
+	Status int       `json:"status"` // exit status of the build (see the exit* constants)
+	Time   time.Time `json:"time"`
+}
+
+// serveCollage serves the collage at path on addr, building it with b first
+// and then whenever asked to, until ctx is cancelled. With watch, the builds
+// also follow changes of the inputs, as watch says. It returns the exit status.
+func serveCollage(ctx context.Context, addr, path string, b *builder, watch func() int) int {
+	s := &server{path: path, b: b, clients: map[chan buildEvent]bool{}}
+	b.done = s.broadcast
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/collage", s.handleCollage)
+	mux.HandleFunc("/preview", s.handlePreview)
+	mux.HandleFunc("/rebuild", s.handleRebuild)
+	mux.HandleFunc("/events", s.handleEvents)
+	srv := &http.Server{Addr: addr, Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+
+	errs := make(chan error, 1)
+	go func() { errs <- srv.ListenAndServe() }()
+	fmt.Printf("Serving the collage on http://%s/ (Ctrl+C to stop)\n", displayAddr(addr))
+
+	status := make(chan int, 1)
+	go func() {
+		if watch != nil {
+			status <- watch()
+			return
+		}
+		b.build()
+		<-ctx.Done()
+		status <- exitStatus(context.Cause(ctx))
+	}()
+	select {
+	case err := <-errs:
+		log.Printf("Error: failed to serve on %s: %v", addr, err)
+		return 1
+	case code := <-status:
+		shutdown, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+		return code
+	}
+}
+
+// displayAddr returns addr as a host:port to open in a browser; ":8080"
+// listens on every interface, which includes localhost.
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
+
+// broadcast tells the /events clients that a build finished with status.
+func (s *server) broadcast(status int) {
+	ev := buildEvent{Status: status, Time: time.Now()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		select {
+		case c <- ev:
+		default: // a client that is not reading misses the event
+		}
+	}
+}
+
+// handleIndex serves the page showing the collage.
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, indexPage, filepath.Base(s.path))
+}
+
+// indexPage is the page of handleIndex; the collage is fitted to the window,
+// and reloaded whenever a build finishes.
+const indexPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>%s</title>
+<style>
+body { margin: 0; background: #222; color: #ccc; font: 14px sans-serif; }
+img { display: block; max-width: 100vw; max-height: calc(100vh - 2em); margin: auto; }
+p { margin: 0; height: 2em; line-height: 2em; text-align: center; }
+</style>
+</head>
+<body>
+<img id="collage" src="/collage" alt="The collage">
+<p id="status">Waiting for builds&hellip;</p>
+<script>
+const events = new EventSource("/events");
+events.addEventListener("build", e => {
+  const build = JSON.parse(e.data);
+  const time = new Date(build.time).toLocaleTimeString();
+  if (build.status === 0) {
+    document.getElementById("collage").src = "/collage?t=" + Date.now();
+    document.getElementById("status").textContent = "Rebuilt at " + time;
+  } else if (build.status === 3) {
+    document.getElementById("status").textContent = "Unchanged at " + time;
+  } else {
+    document.getElementById("status").textContent = "Build failed at " + time + " (exit status " + build.status + ")";
+  }
+});
+</script>
+</body>
+</html>
+`
+
+// handleCollage serves the collage file as the last build left it.
+func (s *server) handleCollage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, s.path)
+}
+
+// handlePreview serves the collage scaled down to the width query parameter
+// (previewWidth by default) as a JPEG, on white where it is transparent. The
+// preview is made again only when the collage or the width changes.
+func (s *server) handlePreview(w http.ResponseWriter, r *http.Request) {
+	width := previewWidth
+	if q := r.URL.Query().Get("width"); q != "" {
+		n, err := strconv.Atoi(q)
+		if err != nil || n <= 0 || n > maxPreviewWidth {
+			http.Error(w, fmt.Sprintf("width must be 1 to %d pixels", maxPreviewWidth), http.StatusBadRequest)
+			return
+		}
+		width = n
+	}
+	info, err := os.Stat(s.path)
+	if err != nil {
+		http.Error(w, "no collage built yet", http.StatusNotFound)
+		return
+	}
+
+	s.previewMu.Lock()
+	defer s.previewMu.Unlock()
+	key := fmt.Sprintf("%d %d %d", info.ModTime().UnixNano(), info.Size(), width)
+	if key != s.previewKey {
+		data, err := makePreview(s.path, width)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.previewKey, s.preview = key, data
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(s.preview)
+}
+
+// makePreview decodes the collage at path and encodes it as a JPEG at most
+// width pixels wide.
+func makePreview(path string, width int) ([]byte, error) {
+	img, err := collage.LoadImage(path, collage.RetryPolicy{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read collage: %v", err)
+	}
+	b := img.Bounds()
+	if b.Dx() < width {
+		width = b.Dx()
+	}
+	height := max(1, b.Dy()*width/b.Dx())
+	preview := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(preview, preview.Rect, image.White, image.Point{}, draw.Src)
+	xdraw.ApproxBiLinear.Scale(preview, preview.Rect, img, b, draw.Over, nil)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, preview, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("failed to encode preview: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// handleRebuild starts a build, after any still running; /events tells when
+// it is done.
+func (s *server) handleRebuild(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "use POST to rebuild", http.StatusMethodNotAllowed)
+		return
+	}
+	go s.b.build()
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "rebuild started")
+}
+
+// handleEvents streams a "build" server-sent event with a buildEvent for
+// every build that finishes while the client is connected.
+func (s *server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	c := make(chan buildEvent, 4)
+	s.mu.Lock()
+	s.clients[c] = true
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-c:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: build\ndata: %s\n\n", data)
+			flusher.Flush()
+		}
+	}
+}
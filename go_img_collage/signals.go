@@ -0,0 +1,58 @@
+// signals.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/BadarSaghir/go_img_collage/pkg/collage"
+)
+
+// stopGrace is how long the run may take to stop by itself after the first
+// SIGINT/SIGTERM before its temp files are removed and the process exits anyway.
+const stopGrace = 10 * time.Second
+
+// handleSignals installs SIGINT/SIGTERM handling. The first signal cancels the
+// returned context, so the render stops at its next image or write and
+// removes its temp canvas and partial outputs as it returns; a second signal,
+// or a run still going after stopGrace, removes them at once and exits. The
+// exit status is the conventional 128+signal either way.
+func handleSignals() context.Context {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-sigs
+		fmt.Fprintf(os.Stderr, "\nReceived %v, stopping (again to quit at once)...\n", sig)
+		cancel(interrupted{sig})
+		select {
+		case sig = <-sigs:
+		case <-time.After(stopGrace):
+		}
+		fmt.Fprintf(os.Stderr, "\nReceived %v, cleaning up...\n", sig)
+		collage.Cleanup()
+		os.Exit(interrupted{sig}.status())
+	}()
+	return ctx
+}
+
+// interrupted is the cause of a run cancelled by a signal.
+type interrupted struct {
+	sig os.Signal
+}
+
+func (e interrupted) Error() string {
+	return fmt.Sprintf("interrupted by %v", e.sig)
+}
+
+// status returns the conventional exit status 128+signal.
+func (e interrupted) status() int {
+	if e.sig == syscall.SIGTERM {
+		return 143
+	}
+	return 130
+}
@@ -0,0 +1,51 @@
+// wallpaper.go
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// setDesktopWallpaper makes the image at path the desktop wallpaper: of every
+// desktop on macOS, through SystemParametersInfo on Windows and with gsettings
+// (GNOME) or, failing that, feh on other systems.
+func setDesktopWallpaper(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to set wallpaper: %v", err)
+	}
+	var cmds [][]string
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("tell application \"System Events\" to tell every desktop to set picture to POSIX file %s", appleScriptString(abs))
+		cmds = [][]string{{"osascript", "-e", script}}
+	case "windows":
+		script := "Add-Type -TypeDefinition 'using System.Runtime.InteropServices; public class Wallpaper { " +
+			"[DllImport(\"user32.dll\", CharSet = CharSet.Unicode)] public static extern bool SystemParametersInfo(int a, int b, string c, int d); }'; " +
+			fmt.Sprintf("if (-not [Wallpaper]::SystemParametersInfo(20, 0, %s, 3)) { exit 1 }", powerShellString(abs)) // SPI_SETDESKWALLPAPER, saved and broadcast
+		cmds = [][]string{{"powershell", "-NoProfile", "-NonInteractive", "-Command", script}}
+	default:
+		if _, err := exec.LookPath("gsettings"); err == nil {
+			uri := (&url.URL{Scheme: "file", Path: abs}).String()
+			cmds = [][]string{
+				{"gsettings", "set", "org.gnome.desktop.background", "picture-uri", uri},
+				{"gsettings", "set", "org.gnome.desktop.background", "picture-uri-dark", uri}, // GNOME 42 and later
+			}
+		} else if _, err := exec.LookPath("feh"); err == nil {
+			cmds = [][]string{{"feh", "--bg-fill", abs}}
+		} else {
+			return fmt.Errorf("failed to set wallpaper: neither gsettings nor feh is installed")
+		}
+	}
+	for i, args := range cmds {
+		out, err := exec.Command(args[0], args[1:]...).CombinedOutput()
+		if err != nil && i == 0 { // later commands only cover newer desktops
+			return fmt.Errorf("failed to set wallpaper with %s: %v %s", args[0], err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
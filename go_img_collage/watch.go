@@ -0,0 +1,213 @@
+// watch.go
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+
+	"github.com/BadarSaghir/go_img_collage/pkg/collage"
+)
+
+// builder runs the builds of -watch and -serve, one at a time, each as this
+// command again without the flags that keep it running, so a build behaves
+// exactly like a single run (and with -cache-dir only redoes the changed
+// images).
+type builder struct {
+	ctx  context.Context
+	dir  string // working directory of the builds; empty for this one
+	args []string
+	mu   sync.Mutex
+	done func(status int) // if set, called with the exit status after each build
+}
+
+// newBuilder returns a builder running this command with the flags named by
+// drop left out and turned off explicitly, so a -config file cannot turn them
+// back on.
+func newBuilder(ctx context.Context, drop ...string) *builder {
+	b := &builder{ctx: ctx}
+	dropped := map[string]bool{}
+	for _, name := range drop {
+		dropped[name] = true
+		if f := flag.Lookup(name); f != nil && isBoolFlag(f) {
+			b.args = append(b.args, "-"+name+"=false")
+		} else {
+			b.args = append(b.args, "-"+name+"=")
+		}
+	}
+	args := os.Args[1:]
+	for i := 0; i < len(args); i++ {
+		name, _, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || !dropped[name] {
+			b.args = append(b.args, args[i])
+			continue
+		}
+		if f := flag.Lookup(name); !hasValue && f != nil && !isBoolFlag(f) {
+			i++ // the value follows as the next argument
+		}
+	}
+	return b
+}
+
+// isBoolFlag reports whether f is a boolean flag, which takes no separate value.
+func isBoolFlag(f *flag.Flag) bool {
+	bf, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && bf.IsBoolFlag()
+}
+
+// build runs one build, after any still running, and returns its exit status.
+// A failed build is reported; the caller goes on.
+func (b *builder) build() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	name := os.Args[0]
+	if b.dir != "" && strings.ContainsRune(name, filepath.Separator) {
+		name, _ = filepath.Abs(name) // relative to this directory, not b.dir
+	}
+	cmd := exec.CommandContext(b.ctx, name, b.args...)
+	cmd.Dir = b.dir
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	// A signal reaches the build too when sent to the terminal's process
+	// group; otherwise pass it on so the build can clean up.
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	cmd.WaitDelay = stopGrace
+	status := 0
+	var exit *exec.ExitError
+	if err := cmd.Run(); errors.As(err, &exit) {
+		status = exit.ExitCode()
+		if status != exitUnchanged && b.ctx.Err() == nil {
+			log.Printf("Warning: build failed with exit status %d", status)
+		}
+	} else if err != nil {
+		status = 1
+		if b.ctx.Err() == nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	if b.done != nil && b.ctx.Err() == nil {
+		b.done(status)
+	}
+	return status
+}
+
+// watchInputs builds the collage with b, then watches the input directories
+// roots and builds it again once images have been added, removed or changed
+// and the tree has been quiet for delay, until ctx is cancelled. Changes to
+// ignore, such as the outputs when written inside the tree, are left out.
+// It returns the exit status.
+func watchInputs(ctx context.Context, b *builder, roots []string, delay time.Duration, ignore func(path string) bool) int {
+	for _, root := range roots {
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			log.Printf("Error: -watch needs local input directories; %s is not one", root)
+			return 1
+		}
+	}
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Error: failed to watch the input directories: %v", err)
+		return 1
+	}
+	defer w.Close()
+	for _, root := range roots {
+		if err := watchTree(w, root); err != nil {
+			log.Printf("Error: failed to watch %s: %v", root, err)
+			return 1
+		}
+	}
+
+	b.build()
+	fmt.Printf("Watching %d input directories for changes (Ctrl+C to stop)...\n", len(roots))
+	timer := time.NewTimer(delay)
+	timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return exitStatus(context.Cause(ctx))
+		case err := <-w.Errors:
+			// An overflow loses events, so rebuild to be sure.
+			log.Printf("Warning: watching the input directories: %v", err)
+			timer.Reset(delay)
+		case ev := <-w.Events:
+			if ignore(ev.Name) {
+				continue
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					// A new folder may arrive with its images already in it.
+					if err := watchTree(w, ev.Name); err != nil {
+						log.Printf("Warning: failed to watch %s: %v", ev.Name, err)
+					}
+					timer.Reset(delay)
+					continue
+				}
+			}
+			// Removed folders leave their watches by themselves; they are told
+			// from files by having no extension.
+			gone := ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename)
+			if collage.IsImageFile(ev.Name) || (gone && filepath.Ext(ev.Name) == "") {
+				timer.Reset(delay)
+			}
+		case <-timer.C:
+			fmt.Printf("\nInputs changed at %s, rebuilding...\n", time.Now().Format("15:04:05"))
+			b.build()
+		}
+	}
+}
+
+// watchTree adds root and every folder below it to w; fsnotify does not
+// watch subfolders by itself.
+func watchTree(w *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return w.Add(path)
+		}
+		return nil
+	})
+}
+
+// outputFilter returns a watchInputs ignore function for the files a build
+// writes: the output and the outputs numbered after it (variants, pages,
+// slides) and everything under the output, site and tile cache directories.
+func outputFilter(opts collage.Options) func(path string) bool {
+	var stem string
+	if opts.OutputPath != "" {
+		if abs, err := filepath.Abs(opts.OutputPath); err == nil {
+			stem = strings.TrimSuffix(abs, filepath.Ext(abs))
+		}
+	}
+	var dirs []string
+	for _, dir := range []string{opts.OutputDir, opts.SiteDir, opts.CacheDir} {
+		if abs, err := filepath.Abs(dir); dir != "" && err == nil {
+			dirs = append(dirs, abs+string(filepath.Separator))
+		}
+	}
+	return func(path string) bool {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return false
+		}
+		if stem != "" && strings.HasPrefix(abs, stem) && filepath.Dir(abs) == filepath.Dir(stem) {
+			return true
+		}
+		for _, dir := range dirs {
+			if strings.HasPrefix(abs, dir) {
+				return true
+			}
+		}
+		return false
+	}
+}